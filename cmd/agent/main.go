@@ -3,24 +3,40 @@ package main
 import (
 	"context"
 	"flag"
-	//"fmt"
+	"fmt"
 	"os"
 	"os/signal"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/yanchenko-igor/blockchain-universe/internal/agent"
+	"github.com/yanchenko-igor/blockchain-universe/internal/api"
 	"github.com/yanchenko-igor/blockchain-universe/internal/blockchain"
 	"github.com/yanchenko-igor/blockchain-universe/internal/config"
 	"github.com/yanchenko-igor/blockchain-universe/internal/llm"
+	"github.com/yanchenko-igor/blockchain-universe/internal/scheduler"
 	"github.com/yanchenko-igor/blockchain-universe/pkg/logger"
+	"github.com/yanchenko-igor/blockchain-universe/pkg/metrics"
+	"github.com/yanchenko-igor/blockchain-universe/pkg/tracing"
 )
 
+// configPollInterval is how often the configuration files are checked for
+// changes to reload
+const configPollInterval = 5 * time.Second
+
 var (
 	configPath = flag.String("config", "config.yaml", "Path to configuration file")
+	envName    = flag.String("env", os.Getenv("BU_ENV"), "Environment overlay, loads config.<env>.yaml over the configuration file")
 	logLevel   = flag.String("log-level", "info", "Log level (debug, info, warn, error)")
+	overrides  = setFlag{}
 )
 
+func init() {
+	flag.Var(overrides, "set", "Set a configuration key, e.g. -set llm.temperature=0.2 (repeatable)")
+}
+
 func main() {
 	flag.Parse()
 
@@ -29,70 +45,382 @@ func main() {
 	log.Info("Starting Blockchain Universe Agent...")
 
 	// Load configuration
-	cfg, err := config.Load(*configPath)
+	opts := configOptions()
+	cfg, provenance, err := config.LoadLayers(opts)
 	if err != nil {
 		log.Fatal("Failed to load configuration", "error", err)
 	}
 
+	// Switch to the configured sinks
+	log, err = logger.NewWithConfig(logger.Config{
+		Level:  cfg.Logging.Level,
+		Levels: cfg.Logging.Levels,
+		Sinks:  cfg.Logging.Sinks,
+	})
+	if err != nil {
+		logger.New(*logLevel).Fatal("Failed to initialize logging", "error", err)
+	}
+	defer logger.Sync(log)
+	for _, key := range config.Keys() {
+		if src := provenance[key]; src.Layer != config.LayerDefault {
+			log.Debug("Configuration value", "key", key, "source", src.String())
+		}
+	}
+
 	// Create context with cancellation
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	reg := metrics.NewRegistry()
+
 	// Initialize blockchain
-	bc := blockchain.New(log)
+	bc := blockchain.New(log.Named("blockchain"))
+	bc.SetMetrics(reg)
+	bc.SetCheckpointQuorum(cfg.Blockchain.CheckpointQuorum)
+	bc.SetTrustedSigners(cfg.Blockchain.TrustedSigners)
+	bc.SetAdmissionPolicy(blockchain.AdmissionPolicy{
+		MaxParents:      cfg.Admission.MaxParents,
+		MaxDescription:  cfg.Admission.MaxDescription,
+		MaxPayloadKeys:  cfg.Admission.MaxPayloadKeys,
+		MaxPayloadBytes: cfg.Admission.MaxPayloadBytes,
+		AuthorRate:      cfg.Admission.AuthorRate,
+		AuthorBurst:     cfg.Admission.AuthorBurst,
+		GlobalRate:      cfg.Admission.GlobalRate,
+		GlobalBurst:     cfg.Admission.GlobalBurst,
+	})
 
-	// Initialize LLM client
-	llmClient, err := llm.NewClient(cfg.LLM, log)
-	if err != nil {
-		log.Fatal("Failed to initialize LLM client", "error", err)
+	if prune := cfg.Blockchain.Prune; prune.Archive != "" {
+		err := bc.SetPrunePolicy(blockchain.PrunePolicy{
+			KeepEvents:   prune.KeepEvents,
+			KeepDuration: prune.KeepDuration,
+			ArchivePath:  prune.Archive,
+		})
+		if err != nil {
+			log.Fatal("Failed to enable pruning", "error", err)
+		}
+		defer bc.Close()
+	}
+
+	// Pruning is enabled first, so a large archive is imported in bounded
+	// memory. A failed import, e.g. a tampered archive detected at its
+	// manifest, has already admitted events, so the node must not start.
+	if cfg.Blockchain.BootstrapArchive != "" {
+		if err := importArchive(bc, cfg.Blockchain.BootstrapArchive); err != nil {
+			log.Fatal("Failed to import bootstrap archive", "error", err)
+		}
+		log.Info("Bootstrap archive imported", "path", cfg.Blockchain.BootstrapArchive, "events", bc.Len())
 	}
 
-	// Initialize agent
-	agentInstance, err := agent.New(cfg.Agent, bc, llmClient, log)
+	tracer, err := newTracer(cfg.Tracing, log.Named("tracing"))
 	if err != nil {
-		log.Fatal("Failed to initialize agent", "error", err)
+		log.Fatal("Failed to initialize tracing", "error", err)
 	}
+	reg.NewGaugeFunc("bu_tracing_spans_dropped", "Spans dropped because the export queue was full", func() float64 {
+		return float64(tracer.Dropped())
+	})
+	defer func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := tracer.Shutdown(shutdownCtx); err != nil {
+			log.Warn("Tracing shutdown error", "error", err)
+		}
+	}()
 
-	log.Info("Agent initialized", "public_key", agentInstance.PublicKeyHex())
+	// Initialize agents, each with its own LLM client. Agents with the same
+	// cache configuration share the cache.
+	llmMetrics := llm.NewMetrics(reg)
+	agentMetrics := agent.NewMetrics(reg)
+	caches := make(map[config.CacheConfig]llm.Cache)
+	var runners []*runner
+	for _, spec := range cfg.Instances() {
+		llmClient, err := llm.NewClient(spec.LLM, log.Named("llm"))
+		if err != nil {
+			log.Fatal("Failed to initialize LLM client", "name", spec.Agent.Name, "error", err)
+		}
+		llmClient.SetMetrics(llmMetrics)
+		llmClient.SetPersona(spec.Agent.Persona)
 
-	// Start agent in background
-	go func() {
-		if err := agentInstance.Start(ctx); err != nil {
-			log.Error("Agent error", "error", err)
-			cancel()
+		cache, ok := caches[spec.LLM.Cache]
+		if !ok {
+			if cache, err = llm.NewCache(spec.LLM.Cache); err != nil {
+				log.Fatal("Failed to initialize LLM cache", "name", spec.Agent.Name, "error", err)
+			}
+			caches[spec.LLM.Cache] = cache
 		}
-	}()
+		if cache != nil {
+			llmClient.SetCache(cache)
+		}
+
+		agentInstance, err := agent.New(spec.Agent, bc, llmClient, log.Named("agent"))
+		if err != nil {
+			log.Fatal("Failed to initialize agent", "name", spec.Agent.Name, "error", err)
+		}
+		agentInstance.SetMetrics(agentMetrics)
+		agentInstance.SetTracer(tracer)
 
-	// Create initial event
-	if err := agentInstance.CreateInitialEvent(ctx); err != nil {
-		log.Error("Failed to create initial event", "error", err)
+		log.Info("Agent initialized", "name", agentInstance.Name(), "public_key", agentInstance.PublicKeyHex(), "model", spec.LLM.Model)
+		runners = append(runners, newRunner(agentInstance, llmClient, log))
 	}
 
-	// Run decision loop
-	ticker := time.NewTicker(cfg.Agent.DecisionInterval)
-	defer ticker.Stop()
+	// Goroutines to wait for on shutdown
+	var background sync.WaitGroup
+
+	// Start agents in background
+	for _, r := range runners {
+		background.Add(1)
+		go func(a *agent.Agent) {
+			defer background.Done()
+			if err := a.Start(ctx); err != nil {
+				log.Error("Agent error", "name", a.Name(), "error", err)
+				cancel()
+			}
+		}(r.agent)
+	}
+
+	// Start HTTP API
+	if cfg.HTTP.ListenAddr != "" {
+		server := api.New(cfg.HTTP, bc, log.Named("api"))
+		server.SetMetrics(reg)
+		for _, r := range runners {
+			r.agent.OnDecision(server.PublishDecision)
+			r.agent.OnPartial(server.PublishPartial)
+		}
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			if err := server.Start(ctx); err != nil {
+				log.Error("HTTP API error", "error", err)
+			}
+		}()
+	}
+
+	// Create initial events and schedule decision cycles
+	sched := scheduler.New(scheduler.Config{
+		Workers: cfg.Scheduler.Workers,
+		Jitter:  cfg.Scheduler.Jitter,
+		Overrun: cfg.Scheduler.Overrun,
+	}, log.Named("scheduler"))
+	sched.SetMetrics(reg)
+	for i, r := range runners {
+		if err := r.agent.CreateInitialEvent(ctx); err != nil {
+			log.Error("Failed to create initial event", "name", r.agent.Name(), "error", err)
+		}
+		r.task = sched.Add(r.agent.Name(), cfg.Instances()[i].Agent.DecisionInterval, r.cycle)
+
+		// Admitted events matching the agent's triggers start a cycle early
+		background.Add(1)
+		go func(r *runner) {
+			defer background.Done()
+			r.agent.WatchTriggers(ctx, r.task.Trigger)
+		}(r)
+	}
+	// Chain maintenance is shared by all agents of the process
+	maintenance := sched.Add("maintenance", shortestInterval(cfg), func(ctx context.Context) {
+		maintain(ctx, runners, bc, log)
+	})
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		sched.Run(ctx)
+	}()
 
 	// Setup graceful shutdown
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 
-	log.Info("Agent running. Press Ctrl+C to stop.")
+	// Reload the configuration on SIGHUP or when its files change
+	watcher := config.NewWatcher(opts, cfg, provenance)
+	go watcher.Run(ctx, configPollInterval)
+	hupChan := make(chan os.Signal, 1)
+	signal.Notify(hupChan, syscall.SIGHUP)
+
+	log.Info("Agents running. Press Ctrl+C to stop.", "agents", len(runners))
 
 	for {
 		select {
 		case <-ctx.Done():
 			log.Info("Context cancelled, shutting down...")
+			shutdown(&background, cfg.Scheduler.ShutdownTimeout, log)
 			return
 		case <-sigChan:
 			log.Info("Received shutdown signal")
 			cancel()
-			// Allow some time for graceful shutdown
-			time.Sleep(2 * time.Second)
+			shutdown(&background, cfg.Scheduler.ShutdownTimeout, log)
 			return
-		case <-ticker.C:
-			if err := agentInstance.MakeDecision(ctx); err != nil {
-				log.Error("Decision error", "error", err)
+		case <-hupChan:
+			log.Info("Received SIGHUP, reloading configuration")
+			watcher.Reload()
+		case reload := <-watcher.Updates():
+			if reload.Err != nil {
+				log.Error("Failed to reload configuration", "error", reload.Err)
+				continue
+			}
+			if len(reload.Ignored) > 0 {
+				log.Warn("Configuration changes require a restart", "keys", reload.Ignored)
+			}
+			if len(reload.Applied) == 0 {
+				continue
+			}
+			cfg = reload.Config
+			for i, spec := range cfg.Instances() {
+				runners[i].task.SetInterval(spec.Agent.DecisionInterval)
+				runners[i].llm.SetTemperature(spec.LLM.Temperature)
+			}
+			maintenance.SetInterval(shortestInterval(cfg))
+			if err := logger.SetLevels(log, cfg.Logging.Level, cfg.Logging.Levels); err != nil {
+				log.Error("Failed to change log levels", "error", err)
 			}
+			log.Info("Configuration reloaded", "applied", reload.Applied)
 		}
 	}
 }
+
+// runner runs the decision cycles of one agent
+type runner struct {
+	agent *agent.Agent
+	llm   *llm.Client
+	task  *scheduler.Task
+	log   logger.Logger
+}
+
+// newRunner creates a runner for an agent and its LLM client
+func newRunner(a *agent.Agent, llmClient *llm.Client, log logger.Logger) *runner {
+	return &runner{
+		agent: a,
+		llm:   llmClient,
+		log:   log.With("name", a.Name()),
+	}
+}
+
+// cycle runs one decision cycle; the scheduler never runs two cycles of an
+// agent at once
+func (r *runner) cycle(ctx context.Context) {
+	r.agent.SetDecisionInterval(r.task.Interval())
+	if err := r.agent.MakeDecision(ctx); err != nil {
+		r.log.Error("Decision error", "error", err)
+	}
+	if ctx.Err() != nil {
+		return
+	}
+	if err := r.agent.ReportEnergy(ctx); err != nil {
+		r.log.Error("Energy report error", "error", err)
+	}
+}
+
+// maintain runs the chain maintenance of the process: every agent cosigns
+// pending checkpoints in turn, so only the first proposes a due one, the
+// first agent reports equivocations and the store is pruned once
+func maintain(ctx context.Context, runners []*runner, bc *blockchain.Blockchain, log logger.Logger) {
+	for _, r := range runners {
+		if ctx.Err() != nil {
+			return
+		}
+		if err := r.agent.MaintainCheckpoints(); err != nil {
+			r.log.Error("Checkpoint error", "error", err)
+		}
+	}
+	if len(runners) > 0 {
+		if err := runners[0].agent.ReportEquivocations(); err != nil {
+			runners[0].log.Error("Equivocation report error", "error", err)
+		}
+	}
+	if _, err := bc.Prune(); err != nil {
+		log.Error("Pruning error", "error", err)
+	}
+}
+
+// shortestInterval returns the shortest decision interval of the configured
+// agents, which chain maintenance runs at
+func shortestInterval(cfg *config.Config) time.Duration {
+	var shortest time.Duration
+	for _, spec := range cfg.Instances() {
+		if shortest == 0 || spec.Agent.DecisionInterval < shortest {
+			shortest = spec.Agent.DecisionInterval
+		}
+	}
+	return shortest
+}
+
+// shutdown waits up to timeout for the background goroutines, which stop
+// when the context is cancelled
+func shutdown(background *sync.WaitGroup, timeout time.Duration, log logger.Logger) {
+	done := make(chan struct{})
+	go func() {
+		background.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		log.Info("Shutdown complete")
+	case <-time.After(timeout):
+		log.Warn("Shutdown timed out, exiting with work in flight", "timeout", timeout)
+	}
+}
+
+// importArchive loads an archive into the blockchain
+func importArchive(bc *blockchain.Blockchain, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer f.Close()
+
+	_, err = bc.Import(f)
+	return err
+}
+
+// configOptions returns the configuration layers selected on the command
+// line. An explicit -log-level overrides logging.level.
+func configOptions() config.Options {
+	opts := config.Options{Path: *configPath, Environment: *envName, Flags: map[string]string{}}
+	for key, value := range overrides {
+		opts.Flags[key] = value
+	}
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "log-level" {
+			opts.Flags["logging.level"] = *logLevel
+		}
+	})
+	return opts
+}
+
+// setFlag collects -set key=value flags
+type setFlag map[string]string
+
+func (s setFlag) String() string {
+	pairs := make([]string, 0, len(s))
+	for key, value := range s {
+		pairs = append(pairs, key+"="+value)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (s setFlag) Set(value string) error {
+	key, v, ok := strings.Cut(value, "=")
+	if !ok {
+		return fmt.Errorf("expected key=value")
+	}
+	s[key] = v
+	return nil
+}
+
+// newTracer creates a tracer for the configured exporters, or nil if tracing
+// is disabled
+func newTracer(cfg config.TracingConfig, log logger.Logger) (*tracing.Tracer, error) {
+	var exporters []tracing.Exporter
+	if cfg.File != "" {
+		exporter, err := tracing.NewFileExporter(cfg.File)
+		if err != nil {
+			return nil, err
+		}
+		exporters = append(exporters, exporter)
+	}
+	if cfg.Endpoint != "" {
+		exporters = append(exporters, tracing.NewHTTPExporter(cfg.Endpoint))
+	}
+	if len(exporters) == 0 {
+		return nil, nil
+	}
+	return tracing.New(cfg.ServiceName, log, exporters...), nil
+}
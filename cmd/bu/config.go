@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/yanchenko-igor/blockchain-universe/internal/config"
+)
+
+// runConfig implements "bu config <subcommand>"
+func runConfig(args []string) error {
+	if len(args) > 0 && args[0] == "schema" {
+		schema, err := config.Schema()
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(schema)
+		return err
+	}
+	if len(args) == 0 || (args[0] != "validate" && args[0] != "show") {
+		return fmt.Errorf("usage: bu config validate|show [-config path] [-env name] [-set key=value] | schema")
+	}
+
+	fs := flag.NewFlagSet("config "+args[0], flag.ExitOnError)
+	path := fs.String("config", "config.yaml", "Path to configuration file")
+	env := fs.String("env", os.Getenv("BU_ENV"), "Environment overlay, loads config.<env>.yaml over the configuration file")
+	var sets listFlag
+	fs.Var(&sets, "set", "Set a configuration key, e.g. -set llm.temperature=0.2 (repeatable)")
+	fs.Parse(args[1:])
+
+	opts := config.Options{Path: *path, Environment: *env, Flags: map[string]string{}}
+	for _, set := range sets {
+		key, value, ok := strings.Cut(set, "=")
+		if !ok {
+			return fmt.Errorf("invalid -set %q, expected key=value", set)
+		}
+		opts.Flags[key] = value
+	}
+
+	cfg, provenance, err := config.LoadLayers(opts)
+	var problems config.ValidationError
+	if errors.As(err, &problems) {
+		for _, problem := range problems {
+			fmt.Fprintln(os.Stderr, problem)
+		}
+		return fmt.Errorf("%s: %d problems", *path, len(problems))
+	}
+	if err != nil {
+		return err
+	}
+
+	if args[0] == "validate" {
+		fmt.Printf("%s is valid\n", *path)
+		return nil
+	}
+	return showConfig(cfg, provenance)
+}
+
+// showConfig prints every key with its value and where the value came from
+func showConfig(cfg *config.Config, provenance config.Provenance) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tVALUE\tSOURCE\tRELOAD")
+	for _, key := range config.Keys() {
+		value, _ := cfg.Value(key)
+		shown := fmt.Sprint(value)
+		if config.IsSecret(key) && shown != "" {
+			shown = "<redacted>"
+		}
+		reload := ""
+		if config.IsReloadable(key) {
+			reload = "yes"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", key, shown, provenance[key], reload)
+	}
+	return w.Flush()
+}
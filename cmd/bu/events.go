@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/yanchenko-igor/blockchain-universe/internal/blockchain"
+	"github.com/yanchenko-igor/blockchain-universe/pkg/logger"
+)
+
+// runInspect implements "bu inspect <hash>"
+func runInspect(args []string) error {
+	fs := flag.NewFlagSet("inspect", flag.ExitOnError)
+	var src source
+	src.register(fs)
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: bu inspect [flags] <hash>")
+	}
+
+	bc, err := src.load()
+	if err != nil {
+		return err
+	}
+	defer bc.release()
+
+	hash := fs.Arg(0)
+	event, exists := bc.GetEvent(hash)
+	if !exists {
+		return fmt.Errorf("event not found: %s", hash)
+	}
+
+	signature := "valid"
+	if err := bc.VerifyEvent(event); errors.Is(err, blockchain.ErrInsufficientSignatures) {
+		signature = "valid, " + err.Error()
+	} else if err != nil {
+		signature = "invalid: " + err.Error()
+	}
+
+	invalidatedBy, _ := bc.InvalidatedBy(hash)
+	out := struct {
+		Hash          string            `json:"hash"`
+		Signature     string            `json:"signature_status"`
+		InvalidatedBy string            `json:"invalidated_by,omitempty"`
+		Event         *blockchain.Event `json:"event"`
+	}{hash, signature, invalidatedBy, event}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+// runChain implements "bu chain <hash>"
+func runChain(args []string) error {
+	fs := flag.NewFlagSet("chain", flag.ExitOnError)
+	var src source
+	src.register(fs)
+	depth := fs.Int("depth", 100, "Maximum chain depth")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: bu chain [flags] <hash>")
+	}
+
+	bc, err := src.load()
+	if err != nil {
+		return err
+	}
+	defer bc.release()
+
+	hash := fs.Arg(0)
+	if _, exists := bc.GetEvent(hash); !exists {
+		return fmt.Errorf("event not found: %s", hash)
+	}
+
+	for _, event := range bc.GetEventChain(hash, *depth) {
+		fmt.Printf("%s  %-16s %s  %s\n",
+			shortHash(bc.HashEvent(event)),
+			event.Data.Type,
+			event.Data.Timestamp,
+			event.Data.Description,
+		)
+	}
+	return nil
+}
+
+// runAgents implements "bu agents"
+func runAgents(args []string) error {
+	fs := flag.NewFlagSet("agents", flag.ExitOnError)
+	var src source
+	src.register(fs)
+	fs.Parse(args)
+
+	bc, err := src.load()
+	if err != nil {
+		return err
+	}
+	defer bc.release()
+
+	agents := bc.GetAgents()
+	keys := make([]string, 0, len(agents))
+	for key := range agents {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		info := agents[key]
+		status := ""
+		if info.Revoked() {
+			status = "  revoked"
+		} else if info.PubKey != info.Identity {
+			status = fmt.Sprintf("  rotated=%d  current_key=%s", len(info.Keys)-1, info.PubKey)
+		}
+		if revoked := info.RevokedKeys(); revoked > 0 && !info.Revoked() {
+			status += fmt.Sprintf("  revoked_keys=%d", revoked)
+		}
+		if info.Equivocated {
+			status += "  equivocated"
+		}
+		fmt.Printf("%s  reputation=%.2f  last_event=%s  last_seen=%s%s\n",
+			info.Identity,
+			info.Reputation.Score,
+			shortHash(info.LastEventHash),
+			info.LastSeen.Format(time.RFC3339),
+			status,
+		)
+	}
+	return nil
+}
+
+// shortHash abbreviates a hash for listings
+func shortHash(hash string) string {
+	switch {
+	case hash == "":
+		return "-"
+	case len(hash) > 16:
+		return hash[:16]
+	}
+	return hash
+}
+
+// runVerify implements "bu verify <file>": it re-checks the signature of every
+// event in an archive or JSON lines export and reports each failure with its
+// location. For archives the manifest is checked as well.
+func runVerify(args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: bu verify <file>")
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	magic, _ := r.Peek(2)
+	if !bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		events, err := readEventsFile(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		i := 0
+		return verifyEvents(func() (*blockchain.Event, string, error) {
+			if i == len(events) {
+				return nil, "", io.EOF
+			}
+			i++
+			return events[i-1], fmt.Sprintf("event %d", i), nil
+		})
+	}
+
+	ar, err := blockchain.NewArchiveReader(r)
+	if err != nil {
+		return err
+	}
+	count := 0
+	if err := verifyEvents(func() (*blockchain.Event, string, error) {
+		event, err := ar.Next()
+		count++
+		return event, fmt.Sprintf("archive line %d (event %d)", ar.Line(), count), err
+	}); err != nil {
+		return err
+	}
+	fmt.Printf("manifest verified, merkle root %s\n", ar.Manifest().MerkleRoot)
+	return nil
+}
+
+// verifyEvents checks the signature of every event returned by next until it
+// returns io.EOF
+func verifyEvents(next func() (*blockchain.Event, string, error)) error {
+	bc := blockchain.New(logger.New("error"))
+	total, failures := 0, 0
+	for {
+		event, location, err := next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		total++
+		if err := bc.VerifyEvent(event); err != nil {
+			failures++
+			fmt.Printf("%s, hash %s: %v\n", location, bc.HashEvent(event), err)
+		}
+	}
+
+	if failures > 0 {
+		return fmt.Errorf("%d of %d events failed verification", failures, total)
+	}
+	fmt.Printf("%d events verified\n", total)
+	return nil
+}
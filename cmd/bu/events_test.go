@@ -0,0 +1,153 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/yanchenko-igor/blockchain-universe/internal/api"
+	"github.com/yanchenko-igor/blockchain-universe/internal/blockchain"
+	"github.com/yanchenko-igor/blockchain-universe/internal/config"
+	"github.com/yanchenko-igor/blockchain-universe/pkg/logger"
+)
+
+// captureOutput runs fn and returns what it wrote to stdout
+func captureOutput(t *testing.T, fn func() error) (string, error) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Failed to create pipe: %v", err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	out := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(r)
+		out <- string(data)
+	}()
+	err = fn()
+	w.Close()
+	return <-out, err
+}
+
+// newStore writes a local store with a chain of n events by one agent and
+// returns its path and the event hashes
+func newStore(t *testing.T, n int) (string, []string) {
+	t.Helper()
+	bc := blockchain.New(logger.New("error"))
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+
+	path := filepath.Join(t.TempDir(), "store.jsonl")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer f.Close()
+
+	var hashes []string
+	enc := json.NewEncoder(f)
+	for i := 0; i < n; i++ {
+		event, _ := bc.CreateEvent("test_event", "Step", map[string]string{}, hashes[max(0, len(hashes)-1):], pub, priv)
+		if err := bc.AddEvent(event); err != nil {
+			t.Fatalf("Failed to add event: %v", err)
+		}
+		enc.Encode(event)
+		hashes = append(hashes, bc.HashEvent(event))
+	}
+	return path, hashes
+}
+
+func TestLoadPagesThroughNode(t *testing.T) {
+	store, hashes := newStore(t, fetchPage+1)
+	local := source{store: store}
+	node, err := local.load()
+	if err != nil {
+		t.Fatalf("Failed to load store: %v", err)
+	}
+	defer node.release()
+	srv := httptest.NewServer(api.New(config.HTTPConfig{}, node.Blockchain, logger.New("error")).Handler())
+	defer srv.Close()
+
+	src := source{node: srv.URL}
+	bc, err := src.load()
+	if err != nil {
+		t.Fatalf("Failed to load from node: %v", err)
+	}
+	defer bc.release()
+	if bc.Len() != len(hashes) {
+		t.Fatalf("Expected %d events, got %d", len(hashes), bc.Len())
+	}
+	for _, hash := range []string{hashes[0], hashes[fetchPage-1], hashes[fetchPage]} {
+		if _, ok := bc.GetEvent(hash); !ok {
+			t.Errorf("Event %s missing after load", hash)
+		}
+	}
+}
+
+func TestAgentsCommand(t *testing.T) {
+	store, hashes := newStore(t, 3)
+
+	out, err := captureOutput(t, func() error { return runAgents([]string{"-store", store}) })
+	if err != nil {
+		t.Fatalf("bu agents failed: %v", err)
+	}
+	if lines := strings.Split(strings.TrimSpace(out), "\n"); len(lines) != 1 {
+		t.Fatalf("Expected one agent, got:\n%s", out)
+	}
+	if !strings.Contains(out, "last_event="+hashes[2][:16]) {
+		t.Errorf("Expected the agent's last event, got:\n%s", out)
+	}
+}
+
+func TestInspectAndChainCommands(t *testing.T) {
+	store, hashes := newStore(t, 3)
+
+	out, err := captureOutput(t, func() error { return runInspect([]string{"-store", store, hashes[1]}) })
+	if err != nil {
+		t.Fatalf("bu inspect failed: %v", err)
+	}
+	var inspected struct {
+		Hash      string `json:"hash"`
+		Signature string `json:"signature_status"`
+	}
+	if err := json.Unmarshal([]byte(out), &inspected); err != nil || inspected.Hash != hashes[1] || inspected.Signature != "valid" {
+		t.Errorf("Unexpected inspect output %q: %v", out, err)
+	}
+	if _, err := captureOutput(t, func() error { return runInspect([]string{"-store", store, "unknown"}) }); err == nil {
+		t.Error("Expected inspecting an unknown event to fail")
+	}
+	missing := filepath.Join(t.TempDir(), "missing.jsonl")
+	if _, err := captureOutput(t, func() error { return runInspect([]string{"-store", missing, hashes[1]}) }); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected a missing store to fail, got %v", err)
+	}
+
+	out, err = captureOutput(t, func() error { return runChain([]string{"-store", store, hashes[2]}) })
+	if err != nil {
+		t.Fatalf("bu chain failed: %v", err)
+	}
+	if lines := strings.Split(strings.TrimSpace(out), "\n"); len(lines) != 3 || !strings.HasPrefix(lines[0], hashes[2][:16]) {
+		t.Errorf("Expected the chain of three events, got:\n%s", out)
+	}
+}
+
+func TestShortHash(t *testing.T) {
+	for hash, want := range map[string]string{
+		"":                     "-",
+		"abc":                  "abc",
+		"0123456789abcdef0123": "0123456789abcdef",
+		"0123456789abcdef":     "0123456789abcdef",
+	} {
+		if got := shortHash(hash); got != want {
+			t.Errorf("shortHash(%q) = %q, want %q", hash, got, want)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/yanchenko-igor/blockchain-universe/internal/blockchain"
+)
+
+// runGraph implements "bu graph"
+func runGraph(args []string) error {
+	fs := flag.NewFlagSet("graph", flag.ExitOnError)
+	var src source
+	src.register(fs)
+	format := fs.String("format", blockchain.FormatDOT, "Output format (dot, graphml, jsonl)")
+	output := fs.String("o", "", "Output file (default: stdout)")
+	root := fs.String("root", "", "Only export this event and its ancestors")
+	depth := fs.Int("depth", 0, "Maximum parent links followed from -root (0 = unlimited)")
+	author := fs.String("author", "", "Only export events by this author public key")
+	since := fs.String("since", "", "Only export events at or after this RFC3339 time")
+	until := fs.String("until", "", "Only export events before this RFC3339 time")
+	fs.Parse(args)
+
+	filter := blockchain.GraphFilter{Root: *root, Depth: *depth, Author: *author}
+	var err error
+	if filter.Since, err = parseTime(*since); err != nil {
+		return fmt.Errorf("invalid -since: %w", err)
+	}
+	if filter.Until, err = parseTime(*until); err != nil {
+		return fmt.Errorf("invalid -until: %w", err)
+	}
+
+	bc, err := src.load()
+	if err != nil {
+		return err
+	}
+	defer bc.release()
+
+	graph, err := bc.Subgraph(filter)
+	if err != nil {
+		return err
+	}
+
+	w, err := createOutput(*output)
+	if err != nil {
+		return err
+	}
+	if err := graph.Write(w, *format); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// parseTime parses an optional RFC3339 timestamp
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/yanchenko-igor/blockchain-universe/internal/blockchain"
+	"github.com/yanchenko-igor/blockchain-universe/internal/keystore"
+	"github.com/yanchenko-igor/blockchain-universe/pkg/logger"
+)
+
+// runKeygen implements "bu keygen"
+func runKeygen(args []string) error {
+	fs := flag.NewFlagSet("keygen", flag.ExitOnError)
+	output := fs.String("o", "agent.key", "Key file to create")
+	fs.Parse(args)
+
+	key, err := keystore.Generate()
+	if err != nil {
+		return err
+	}
+	if err := key.Save(*output); err != nil {
+		return err
+	}
+
+	fmt.Println(key.PublicKeyHex())
+	return nil
+}
+
+// listFlag collects repeated string flags
+type listFlag []string
+
+func (l *listFlag) String() string { return strings.Join(*l, ",") }
+
+func (l *listFlag) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// runSign implements "bu sign": it crafts and signs an event by hand, and
+// optionally submits it to a node or local store
+func runSign(args []string) error {
+	fs := flag.NewFlagSet("sign", flag.ExitOnError)
+	var src source
+	src.register(fs)
+	keyPath := fs.String("key", "", "Key file created by 'bu keygen'")
+	eventType := fs.String("type", "", "Event type")
+	description := fs.String("description", "", "Event description")
+	submit := fs.Bool("submit", false, "Submit the event to -node or -store instead of printing it")
+	threshold := fs.Int("threshold", 0, "Number of -signer keys that must sign the event")
+	var payload, parents, signers listFlag
+	fs.Var(&payload, "payload", "Payload entry as key=value (repeatable)")
+	fs.Var(&parents, "parent", "Parent event hash (repeatable)")
+	fs.Var(&signers, "signer", "Public key of a required signer, including the author (repeatable)")
+	fs.Parse(args)
+
+	if *keyPath == "" || *eventType == "" {
+		return fmt.Errorf("-key and -type are required")
+	}
+	if (*threshold > 0) != (len(signers) > 0) {
+		return fmt.Errorf("-threshold and -signer must be used together")
+	}
+
+	key, err := keystore.Load(*keyPath)
+	if err != nil {
+		return err
+	}
+
+	data := make(map[string]string, len(payload))
+	for _, entry := range payload {
+		k, v, ok := strings.Cut(entry, "=")
+		if !ok {
+			return fmt.Errorf("invalid payload entry %q, expected key=value", entry)
+		}
+		data[k] = v
+	}
+
+	bc := blockchain.New(logger.New("error"))
+	var event *blockchain.Event
+	if *threshold > 0 {
+		policy := blockchain.SignaturePolicy{Threshold: *threshold, Signers: signers}
+		event, err = bc.CreateMultiSigEvent(*eventType, *description, data, append([]string{}, parents...), policy, key.Public, key.Private)
+	} else {
+		event, err = bc.CreateEvent(*eventType, *description, data, append([]string{}, parents...), key.Public, key.Private)
+	}
+	if err != nil {
+		return err
+	}
+
+	if !*submit {
+		return json.NewEncoder(os.Stdout).Encode(event)
+	}
+
+	return proposeAndReport(&src, event)
+}
+
+// runCosign implements "bu cosign": it adds a signature to a partially signed
+// event. The event is either pending on a node (given by hash) or circulated
+// as a JSON file, which is printed with the new cosignature or submitted.
+func runCosign(args []string) error {
+	fs := flag.NewFlagSet("cosign", flag.ExitOnError)
+	var src source
+	src.register(fs)
+	keyPath := fs.String("key", "", "Key file created by 'bu keygen'")
+	submit := fs.Bool("submit", false, "Submit a cosigned event file to -node or -store instead of printing it")
+	fs.Parse(args)
+	if *keyPath == "" || fs.NArg() != 1 {
+		return fmt.Errorf("usage: bu cosign -key <file> [flags] <hash | event.json>")
+	}
+
+	key, err := keystore.Load(*keyPath)
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(fs.Arg(0))
+	if errors.Is(err, os.ErrNotExist) {
+		// Not a file: cosign an event pending on a node
+		if src.node == "" {
+			return fmt.Errorf("cosigning a pending event by hash requires -node")
+		}
+		hash := fs.Arg(0)
+		admitted, err := src.cosign(hash, key.PublicKeyHex(), blockchain.SignHash(hash, key.Private))
+		if err != nil {
+			return err
+		}
+		return report(hash, admitted)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read event: %w", err)
+	}
+
+	var event blockchain.Event
+	if err := json.Unmarshal(data, &event); err != nil {
+		return fmt.Errorf("failed to parse event: %w", err)
+	}
+	hash := blockchain.Hash(&event)
+	if !blockchain.SignedBy(&event, key.PublicKeyHex()) {
+		event.Cosignatures = append(event.Cosignatures, blockchain.Cosignature{
+			PubKey:    key.PublicKeyHex(),
+			Signature: blockchain.SignHash(hash, key.Private),
+		})
+	}
+
+	if !*submit {
+		return json.NewEncoder(os.Stdout).Encode(&event)
+	}
+	return proposeAndReport(&src, &event)
+}
+
+// proposeAndReport submits an event that may still need cosignatures
+func proposeAndReport(src *source, event *blockchain.Event) error {
+	hash, admitted, err := src.propose(event)
+	if err != nil {
+		return err
+	}
+	return report(hash, admitted)
+}
+
+// report prints an event hash and whether it was admitted or is pending
+func report(hash string, admitted bool) error {
+	if admitted {
+		fmt.Println(hash)
+	} else {
+		fmt.Printf("%s (pending cosignatures)\n", hash)
+	}
+	return nil
+}
+
+// runRotate implements "bu rotate": it creates a key_rotate event moving an
+// identity from -key to -new, signed by both keys
+func runRotate(args []string) error {
+	fs := flag.NewFlagSet("rotate", flag.ExitOnError)
+	var src source
+	src.register(fs)
+	keyPath := fs.String("key", "", "Current key file")
+	newKeyPath := fs.String("new", "", "New key file created by 'bu keygen'")
+	submit := fs.Bool("submit", false, "Submit the event to -node or -store instead of printing it")
+	var parents listFlag
+	fs.Var(&parents, "parent", "Parent event hash (repeatable)")
+	fs.Parse(args)
+
+	if *keyPath == "" || *newKeyPath == "" {
+		return fmt.Errorf("-key and -new are required")
+	}
+	oldKey, err := keystore.Load(*keyPath)
+	if err != nil {
+		return err
+	}
+	newKey, err := keystore.Load(*newKeyPath)
+	if err != nil {
+		return err
+	}
+
+	bc := blockchain.New(logger.New("error"))
+	event, err := bc.NewKeyRotation(append([]string{}, parents...), oldKey.Public, oldKey.Private, newKey.Public, newKey.Private)
+	if err != nil {
+		return err
+	}
+	return emit(&src, event, *submit)
+}
+
+// runRevoke implements "bu revoke": it creates a key_revoke event, signed by
+// the identity's current key or its recovery key
+func runRevoke(args []string) error {
+	fs := flag.NewFlagSet("revoke", flag.ExitOnError)
+	var src source
+	src.register(fs)
+	keyPath := fs.String("key", "", "Key file signing the revocation")
+	pubKey := fs.String("pubkey", "", "Public key to revoke (default: the -key public key)")
+	effectiveFrom := fs.String("effective-from", "", "Last trusted event of the key; its later events are invalidated")
+	submit := fs.Bool("submit", false, "Submit the event to -node or -store instead of printing it")
+	var parents listFlag
+	fs.Var(&parents, "parent", "Parent event hash (repeatable)")
+	fs.Parse(args)
+
+	if *keyPath == "" {
+		return fmt.Errorf("-key is required")
+	}
+	key, err := keystore.Load(*keyPath)
+	if err != nil {
+		return err
+	}
+	revoked := *pubKey
+	if revoked == "" {
+		revoked = key.PublicKeyHex()
+	}
+
+	bc := blockchain.New(logger.New("error"))
+	event, err := bc.NewKeyRevocation(revoked, *effectiveFrom, append([]string{}, parents...), key.Public, key.Private)
+	if err != nil {
+		return err
+	}
+	return emit(&src, event, *submit)
+}
+
+// emit prints an event, or submits it to the source
+func emit(src *source, event *blockchain.Event, submit bool) error {
+	if !submit {
+		return json.NewEncoder(os.Stdout).Encode(event)
+	}
+	hash, err := src.submit(event)
+	if err != nil {
+		return err
+	}
+	fmt.Println(hash)
+	return nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// command is a bu subcommand
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) error
+}
+
+var commands = []command{
+	{"keygen", "Generate an agent key pair", runKeygen},
+	{"inspect", "Show an event and its signature status", runInspect},
+	{"verify", "Verify the signatures of all events in an export", runVerify},
+	{"chain", "Show the chain of events leading to an event", runChain},
+	{"agents", "List known agents", runAgents},
+	{"export", "Export all events as JSON lines", runExport},
+	{"import", "Import events from an export", runImport},
+	{"config", "Validate or show the configuration, or print its JSON Schema", runConfig},
+	{"sign", "Craft and sign an event by hand", runSign},
+	{"cosign", "Add a signature to a partially signed event", runCosign},
+	{"rotate", "Replace an agent key, linking the old and new identity", runRotate},
+	{"revoke", "Revoke a leaked agent key", runRevoke},
+	{"graph", "Export the event DAG to DOT, GraphML or JSON lines", runGraph},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	name := os.Args[1]
+	for _, cmd := range commands {
+		if cmd.name == name {
+			if err := cmd.run(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "bu %s: %v\n", name, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "bu: unknown command %q\n\n", name)
+	usage()
+	os.Exit(2)
+}
+
+// usage prints the list of available subcommands
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: bu <command> [flags]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", cmd.name, cmd.usage)
+	}
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Run 'bu <command> -h' for command flags.")
+}
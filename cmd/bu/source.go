@@ -0,0 +1,482 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/yanchenko-igor/blockchain-universe/internal/blockchain"
+	"github.com/yanchenko-igor/blockchain-universe/pkg/logger"
+)
+
+// source selects where bu reads and writes events: a running node's HTTP API
+// or a local store, which is a JSON lines file with one event per line
+type source struct {
+	node  string
+	store string
+	trust listFlag // Keys trusted to sign a checkpoint the store starts at
+}
+
+// register adds the source flags to a flag set
+func (s *source) register(fs *flag.FlagSet) {
+	fs.StringVar(&s.node, "node", "", "Base URL of a running node's HTTP API (e.g. http://localhost:8080)")
+	fs.StringVar(&s.store, "store", "", "Path to a local store (JSON lines file, one event per line)")
+	fs.Var(&s.trust, "trust", "Public key trusted to sign checkpoints to bootstrap from (repeatable)")
+}
+
+// validate checks that exactly one source is selected
+func (s *source) validate() error {
+	switch {
+	case s.node != "" && s.store != "":
+		return fmt.Errorf("-node and -store are mutually exclusive")
+	case s.node == "" && s.store == "":
+		return fmt.Errorf("one of -node or -store is required")
+	}
+	return nil
+}
+
+// load reads all events from the source into a blockchain, verifying each
+// one on admission. Event bodies are pruned to a temporary cold archive as
+// they are loaded; the caller must release the chain when done.
+func (s *source) load() (*prunedChain, error) {
+	if err := s.validate(); err != nil {
+		return nil, err
+	}
+
+	bc, err := newPrunedChain(s.trust)
+	if err != nil {
+		return nil, err
+	}
+	if s.store != "" {
+		bc.SetLegacyHashes(true)
+		err = loadStore(s.store, bc.admit)
+	} else {
+		err = s.fetchEvents(bc.admit)
+	}
+	if err != nil {
+		bc.release()
+		return nil, err
+	}
+	return bc, nil
+}
+
+// pruneInterval is how many events a pruned chain admits between moving
+// event bodies out of memory
+const pruneInterval = 10000
+
+// prunedChain is an in-memory blockchain that keeps only headers in memory:
+// event bodies are pruned to a temporary cold archive as events are admitted
+type prunedChain struct {
+	*blockchain.Blockchain
+	coldPath string
+	admitted int
+}
+
+// newPrunedChain creates an empty pruned chain bootstrapping from checkpoints
+// signed by the trusted keys
+func newPrunedChain(trusted []string) (*prunedChain, error) {
+	cold, err := os.CreateTemp("", "bu-cold-*.jsonl")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cold archive: %w", err)
+	}
+	cold.Close()
+
+	bc := &prunedChain{Blockchain: blockchain.New(logger.New("error")), coldPath: cold.Name()}
+	bc.SetTrustedSigners(trusted)
+	if err := bc.SetPrunePolicy(blockchain.PrunePolicy{ArchivePath: bc.coldPath}); err != nil {
+		bc.release()
+		return nil, err
+	}
+	return bc, nil
+}
+
+// admit adds an event to the chain, pruning bodies periodically
+func (bc *prunedChain) admit(event *blockchain.Event) error {
+	if err := admit(bc.Blockchain, event); err != nil {
+		return err
+	}
+	bc.admitted++
+	if bc.admitted%pruneInterval == 0 {
+		if _, err := bc.Prune(); err != nil {
+			return fmt.Errorf("failed to prune events: %w", err)
+		}
+	}
+	return nil
+}
+
+// release closes the chain and removes its temporary cold archive
+func (bc *prunedChain) release() {
+	bc.Close()
+	os.Remove(bc.coldPath)
+}
+
+// loadStore passes every event of a local store to add, one at a time
+func loadStore(path string, add func(event *blockchain.Event) error) error {
+	count := 0
+	return readEvents(path, func(event *blockchain.Event) error {
+		count++
+		if err := add(event); err != nil {
+			return fmt.Errorf("event %d (%s): %w", count, blockchain.Hash(event), err)
+		}
+		return nil
+	})
+}
+
+// admit adds an event to bc. A checkpoint arriving at an empty blockchain
+// bootstraps it, so stores and nodes that start at a checkpoint can be loaded.
+func admit(bc *blockchain.Blockchain, event *blockchain.Event) error {
+	if bc.Len() == 0 && event.Data.Type == blockchain.TypeCheckpoint {
+		return bc.Bootstrap(event)
+	}
+	return bc.AddEvent(event)
+}
+
+// submit admits a single event into the node or local store
+func (s *source) submit(event *blockchain.Event) (string, error) {
+	sink, err := s.open()
+	if err != nil {
+		return "", err
+	}
+	if err := sink.add(event); err != nil {
+		sink.abort()
+		return "", err
+	}
+	return blockchain.Hash(event), sink.close()
+}
+
+// propose submits an event that may still need cosignatures. Nodes keep such
+// events in their pending pool; local stores only accept complete ones.
+func (s *source) propose(event *blockchain.Event) (hash string, admitted bool, err error) {
+	if err := s.validate(); err != nil {
+		return "", false, err
+	}
+	if s.store != "" {
+		hash, err := s.submit(event)
+		return hash, err == nil, err
+	}
+
+	var result struct {
+		Hash     string `json:"hash"`
+		Admitted bool   `json:"admitted"`
+	}
+	if err := s.post("/api/pending", event, &result); err != nil {
+		return "", false, err
+	}
+	return result.Hash, result.Admitted, nil
+}
+
+// cosign adds a cosignature to an event pending on the node
+func (s *source) cosign(hash, pubKey, signature string) (admitted bool, err error) {
+	var result struct {
+		Admitted bool `json:"admitted"`
+	}
+	cosig := blockchain.Cosignature{PubKey: pubKey, Signature: signature}
+	if err := s.post("/api/pending/"+hash+"/cosign", cosig, &result); err != nil {
+		return false, err
+	}
+	return result.Admitted, nil
+}
+
+// post sends v as JSON to a node endpoint and decodes a successful response
+// into result
+func (s *source) post(path string, v, result interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	resp, err := httpClient.Post(strings.TrimRight(s.node, "/")+path, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to reach node: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusConflict {
+		return blockchain.ErrDuplicateEvent
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nodeError(resp)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// eventSink admits events into a source one at a time. Events added to a
+// store are committed by close and discarded by abort; events posted to a node
+// are admitted immediately.
+type eventSink interface {
+	add(event *blockchain.Event) error
+	close() error
+	abort()
+}
+
+// open prepares the source for admitting events: they are posted to the node,
+// or verified against and appended to the local store
+func (s *source) open() (eventSink, error) {
+	if err := s.validate(); err != nil {
+		return nil, err
+	}
+	if s.node != "" {
+		return nodeSink{s}, nil
+	}
+
+	return openStoreSink(s.store, s.trust)
+}
+
+// nodeSink posts events to a node
+type nodeSink struct {
+	src *source
+}
+
+// maxRetries bounds how often a rate limited submission is retried
+const maxRetries = 30
+
+func (n nodeSink) add(event *blockchain.Event) error {
+	for attempt := 0; ; attempt++ {
+		_, err := n.src.postEvent(event)
+		if !errors.Is(err, blockchain.ErrRateLimited) || attempt == maxRetries {
+			return err
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+func (n nodeSink) close() error { return nil }
+
+func (n nodeSink) abort() {}
+
+// storeSink verifies events against the store contents and appends them.
+// The store is read into a pruned chain, so only headers stay in memory.
+type storeSink struct {
+	bc    *prunedChain
+	file  *os.File
+	start int64 // Size of the store before the sink was opened
+	w     *bufio.Writer
+	enc   *json.Encoder
+}
+
+// openStoreSink reads the store at path and opens it for appending, creating
+// it if it does not exist. A store starting at a checkpoint must be signed by
+// a quorum of the trusted keys.
+func openStoreSink(path string, trusted []string) (*storeSink, error) {
+	bc, err := newPrunedChain(trusted)
+	if err != nil {
+		return nil, err
+	}
+	s := &storeSink{bc: bc}
+	s.bc.SetLegacyHashes(true)
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		if err := loadStore(path, s.bc.admit); err != nil {
+			s.bc.release()
+			return nil, err
+		}
+	}
+
+	s.file, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		s.bc.release()
+		return nil, fmt.Errorf("failed to open store: %w", err)
+	}
+	info, err := s.file.Stat()
+	if err != nil {
+		s.file.Close()
+		s.bc.release()
+		return nil, fmt.Errorf("failed to open store: %w", err)
+	}
+	s.start = info.Size()
+	s.w = bufio.NewWriter(s.file)
+	s.enc = json.NewEncoder(s.w)
+	return s, nil
+}
+
+func (s *storeSink) add(event *blockchain.Event) error {
+	if err := s.bc.admit(event); err != nil {
+		return err
+	}
+	if err := s.enc.Encode(event); err != nil {
+		return fmt.Errorf("failed to write store: %w", err)
+	}
+	return nil
+}
+
+func (s *storeSink) close() error {
+	defer s.bc.release()
+	if err := s.w.Flush(); err != nil {
+		s.file.Close()
+		return fmt.Errorf("failed to write store: %w", err)
+	}
+	if err := s.file.Close(); err != nil {
+		return fmt.Errorf("failed to write store: %w", err)
+	}
+	return nil
+}
+
+// abort discards the events added since the sink was opened
+func (s *storeSink) abort() {
+	defer s.bc.release()
+	if err := s.file.Truncate(s.start); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to roll back store: %v\n", err)
+	}
+	s.file.Close()
+}
+
+// httpClient is used for all node requests
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+// fetchPage is how many events are requested from a node at a time
+const fetchPage = 1000
+
+// fetchEvents pages through a node's events from the start, passing each one
+// to add as its page arrives
+func (s *source) fetchEvents(add func(event *blockchain.Event) error) error {
+	seq := 0
+	for {
+		url := fmt.Sprintf("%s/api/events?after=%d&limit=%d", strings.TrimRight(s.node, "/"), seq, fetchPage)
+		views, err := fetchEventPage(url)
+		if err != nil {
+			return err
+		}
+		for _, v := range views {
+			if err := add(v.Event); err != nil {
+				return fmt.Errorf("event %d (%s): %w", v.Seq, v.Hash, err)
+			}
+			seq = v.Seq
+		}
+		if len(views) < fetchPage {
+			return nil
+		}
+	}
+}
+
+// eventPage is one page of events returned by a node
+type eventPage []struct {
+	Seq   int               `json:"seq"`
+	Hash  string            `json:"hash"`
+	Event *blockchain.Event `json:"event"`
+}
+
+// fetchEventPage downloads one page of events
+func fetchEventPage(url string) (eventPage, error) {
+	resp, err := httpClient.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch events: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, nodeError(resp)
+	}
+
+	var views eventPage
+	if err := json.NewDecoder(resp.Body).Decode(&views); err != nil {
+		return nil, fmt.Errorf("failed to decode events: %w", err)
+	}
+	return views, nil
+}
+
+// postEvent submits an event to a node's HTTP API
+func (s *source) postEvent(event *blockchain.Event) (string, error) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	resp, err := httpClient.Post(strings.TrimRight(s.node, "/")+"/api/events", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("failed to submit event: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusConflict {
+		return "", blockchain.ErrDuplicateEvent
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return "", fmt.Errorf("%w: %v", blockchain.ErrRateLimited, nodeError(resp))
+	}
+	if resp.StatusCode != http.StatusCreated {
+		return "", nodeError(resp)
+	}
+
+	var result struct {
+		Hash string `json:"hash"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("failed to decode response: %w", err)
+	}
+	return result.Hash, nil
+}
+
+// nodeError converts an unexpected node response into an error
+func nodeError(resp *http.Response) error {
+	body, _ := io.ReadAll(resp.Body)
+	return fmt.Errorf("node error (status %d): %s", resp.StatusCode, strings.TrimSpace(string(body)))
+}
+
+// readEventsFile reads events stored one JSON object per line
+func readEventsFile(path string) ([]*blockchain.Event, error) {
+	var events []*blockchain.Event
+	err := readEvents(path, func(event *blockchain.Event) error {
+		events = append(events, event)
+		return nil
+	})
+	return events, err
+}
+
+// readEvents passes the events stored one JSON object per line to fn as they
+// are read, stopping at the first error
+func readEvents(path string, fn func(event *blockchain.Event) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open events file: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		var event blockchain.Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return fmt.Errorf("%s:%d: failed to parse event: %w", path, line, err)
+		}
+		// Stores written before parent links were signed hold data-only hashes
+		blockchain.DetectHashFormat(&event)
+		if err := fn(&event); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read events file: %w", err)
+	}
+	return nil
+}
+
+// createOutput opens the output file, or returns stdout for an empty path
+func createOutput(path string) (io.WriteCloser, error) {
+	if path == "" {
+		return nopCloser{os.Stdout}, nil
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create output file: %w", err)
+	}
+	return f, nil
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
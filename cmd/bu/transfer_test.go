@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExportAndImport(t *testing.T) {
+	store, hashes := newStore(t, 4)
+	archive := filepath.Join(t.TempDir(), "events.tar.gz")
+	if err := runExport([]string{"-store", store, "-o", archive}); err != nil {
+		t.Fatalf("bu export failed: %v", err)
+	}
+
+	target := filepath.Join(t.TempDir(), "imported.jsonl")
+	out, err := captureOutput(t, func() error { return runImport([]string{"-store", target, archive}) })
+	if err != nil {
+		t.Fatalf("bu import failed: %v", err)
+	}
+	if !strings.HasPrefix(out, "4 events imported, 0 already present") {
+		t.Errorf("Unexpected import summary %q", out)
+	}
+
+	src := source{store: target}
+	bc, err := src.load()
+	if err != nil {
+		t.Fatalf("Failed to load imported store: %v", err)
+	}
+	defer bc.release()
+	for _, hash := range hashes {
+		if _, ok := bc.GetEvent(hash); !ok {
+			t.Errorf("Event %s missing after import", hash)
+		}
+	}
+
+	out, err = captureOutput(t, func() error { return runImport([]string{"-store", target, archive}) })
+	if err != nil || !strings.HasPrefix(out, "0 events imported, 4 already present") {
+		t.Errorf("Importing twice should skip every event, got %q, %v", out, err)
+	}
+}
+
+func TestFailedImportLeavesStoreUnchanged(t *testing.T) {
+	store, _ := newStore(t, 6)
+	archive := filepath.Join(t.TempDir(), "events.tar.gz")
+	if err := runExport([]string{"-store", store, "-o", archive}); err != nil {
+		t.Fatalf("bu export failed: %v", err)
+	}
+
+	// Cut the archive short: the first events decode, the manifest is missing
+	data, _ := os.ReadFile(archive)
+	zr, _ := gzip.NewReader(bytes.NewReader(data))
+	plain, _ := io.ReadAll(zr)
+	var truncated bytes.Buffer
+	zw := gzip.NewWriter(&truncated)
+	zw.Write(plain[:len(plain)*2/3])
+	zw.Close()
+	os.WriteFile(archive, truncated.Bytes(), 0o644)
+
+	target, _ := newStore(t, 2)
+	before, _ := os.ReadFile(target)
+	if _, err := captureOutput(t, func() error { return runImport([]string{"-store", target, archive}) }); err == nil {
+		t.Fatal("Expected the truncated archive to fail")
+	}
+	if after, _ := os.ReadFile(target); !bytes.Equal(before, after) {
+		t.Error("A failed import must not change the store")
+	}
+}
@@ -1,6 +1,6 @@
 module github.com/yanchenko-igor/blockchain-universe
 
-go 1.21
+go 1.24
 
 require (
 	gopkg.in/yaml.v3 v3.0.1
@@ -3,26 +3,62 @@ package agent
 import (
 	"context"
 	"crypto/ed25519"
-	"crypto/rand"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/yanchenko-igor/blockchain-universe/internal/blockchain"
 	"github.com/yanchenko-igor/blockchain-universe/internal/config"
+	"github.com/yanchenko-igor/blockchain-universe/internal/keystore"
 	"github.com/yanchenko-igor/blockchain-universe/internal/llm"
 	"github.com/yanchenko-igor/blockchain-universe/pkg/logger"
+	"github.com/yanchenko-igor/blockchain-universe/pkg/tracing"
 )
 
+// maxPromptAgents limits how many agents are described in a prompt
+const maxPromptAgents = 10
+
+// DecisionRecord captures one decision cycle for observers such as the dashboard
+type DecisionRecord struct {
+	Agent     string    `json:"agent"`
+	Time      time.Time `json:"time"`
+	TraceID   string    `json:"trace_id,omitempty"`
+	Policy    string    `json:"policy,omitempty"` // Policy that made the decision
+	Prompt    string    `json:"prompt"`
+	Response  string    `json:"response,omitempty"`
+	EventHash string    `json:"event_hash,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// PartialRecord is the output of a decision cycle's LLM so far, published
+// while it is generated
+type PartialRecord struct {
+	Agent   string    `json:"agent"`
+	Time    time.Time `json:"time"`
+	TraceID string    `json:"trace_id,omitempty"`
+	Text    string    `json:"text"`
+}
+
 // Agent represents a blockchain universe agent
 type Agent struct {
 	pubKey     ed25519.PublicKey
 	privKey    ed25519.PrivateKey
 	blockchain *blockchain.Blockchain
-	llmClient  *llm.Client
+	policy     DecisionPolicy
+	triggers   *triggers // nil without triggers
+	budget     *budget   // nil without an LLM client
+	cycle      int       // Decision cycles so far
 	config     config.AgentConfig
 	log        logger.Logger
 	lastEvent  string
+	observers  []func(DecisionRecord)
+	partials   []func(PartialRecord)
+	metrics    *Metrics
+	tracer     *tracing.Tracer
+	lastCycle  time.Time // Start of the previous decision cycle
 }
 
 // New creates a new agent instance
@@ -32,21 +68,71 @@ func New(
 	llmClient *llm.Client,
 	log logger.Logger,
 ) (*Agent, error) {
-	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	key, err := loadKey(cfg.KeyFile, log)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate key pair: %w", err)
+		return nil, err
+	}
+	policy, err := NewPolicy(cfg.Policy, llmClient)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create decision policy: %w", err)
+	}
+
+	var trig *triggers
+	if cfg.Triggers.Enabled() {
+		if trig, err = newTriggers(cfg.Triggers, key.PublicKeyHex(), cfg.Name); err != nil {
+			return nil, err
+		}
+	}
+
+	var b *budget
+	if llmClient != nil {
+		if b, err = newBudget(cfg.Budget, llmClient); err != nil {
+			return nil, err
+		}
+	}
+
+	log = log.With("agent", key.PublicKeyHex()[:16])
+	if cfg.Name != "" {
+		log = log.With("name", cfg.Name)
 	}
 
 	return &Agent{
-		pubKey:     pub,
-		privKey:    priv,
+		pubKey:     key.Public,
+		privKey:    key.Private,
 		blockchain: bc,
-		llmClient:  llmClient,
+		policy:     policy,
+		triggers:   trig,
+		budget:     b,
 		config:     cfg,
 		log:        log,
+		metrics:    &Metrics{},
 	}, nil
 }
 
+// loadKey returns the key stored in path, creating it on first start, or a
+// new key if path is empty
+func loadKey(path string, log logger.Logger) (*keystore.Key, error) {
+	if path == "" {
+		return keystore.Generate()
+	}
+	key, created, err := keystore.LoadOrCreate(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load agent key: %w", err)
+	}
+	if created {
+		log.Info("Agent key created", "path", path, "public_key", key.PublicKeyHex())
+	}
+	return key, nil
+}
+
+// Name returns the configured name of the agent, or a prefix of its public key
+func (a *Agent) Name() string {
+	if a.config.Name != "" {
+		return a.config.Name
+	}
+	return a.PublicKeyHex()[:16]
+}
+
 // PublicKeyHex returns the agent's public key as hex string
 func (a *Agent) PublicKeyHex() string {
 	return hex.EncodeToString(a.pubKey)
@@ -60,16 +146,33 @@ func (a *Agent) Start(ctx context.Context) error {
 	return nil
 }
 
-// CreateInitialEvent creates the first event for this agent
+// CreateInitialEvent creates the first event for this agent. An agent whose
+// key already has events on the chain, restored from a store, an archive or a
+// bootstrap checkpoint, resumes its chain instead: a second parentless event
+// would fork it and be reported as an equivocation.
 func (a *Agent) CreateInitialEvent(ctx context.Context) error {
+	pubKey := a.PublicKeyHex()
+	for _, info := range a.blockchain.GetAgents() {
+		if info.PubKey == pubKey && info.LastEventHash != "" {
+			a.lastEvent = info.LastEventHash
+			a.log.Info("Resuming agent chain", "last_event", a.lastEvent)
+			return nil
+		}
+	}
+
+	payload := map[string]string{
+		"agent_id": a.PublicKeyHex()[:16],
+		"state":    "active",
+		"version":  "1.0.0",
+	}
+	if a.config.Name != "" {
+		payload["name"] = a.config.Name
+	}
+
 	event, err := a.blockchain.CreateEvent(
 		"initialization",
 		"Agent initialization in Blockchain Universe",
-		map[string]string{
-			"agent_id": a.PublicKeyHex()[:16],
-			"state":    "active",
-			"version":  "1.0.0",
-		},
+		payload,
 		[]string{},
 		a.pubKey,
 		a.privKey,
@@ -88,29 +191,141 @@ func (a *Agent) CreateInitialEvent(ctx context.Context) error {
 	return nil
 }
 
-// MakeDecision uses LLM to decide on next action
-func (a *Agent) MakeDecision(ctx context.Context) error {
+// SetDecisionInterval changes the expected interval between decision cycles,
+// used to measure drift. It must be called from the goroutine that runs
+// MakeDecision.
+func (a *Agent) SetDecisionInterval(interval time.Duration) {
+	a.config.DecisionInterval = interval
+}
+
+// SetPolicy replaces the decision policy. It must be called from the goroutine
+// that runs MakeDecision.
+func (a *Agent) SetPolicy(p DecisionPolicy) {
+	a.policy = p
+}
+
+// SetTracer traces every decision cycle with t
+func (a *Agent) SetTracer(t *tracing.Tracer) {
+	a.tracer = t
+}
+
+// OnDecision registers a callback invoked after every decision cycle.
+// Callbacks must be registered before the agent starts making decisions.
+func (a *Agent) OnDecision(fn func(DecisionRecord)) {
+	a.observers = append(a.observers, fn)
+}
+
+// OnPartial registers a callback invoked with the LLM output of the decision
+// cycle in flight as it is streamed. Callbacks must be registered before the
+// agent starts making decisions.
+func (a *Agent) OnPartial(fn func(PartialRecord)) {
+	a.partials = append(a.partials, fn)
+}
+
+// MakeDecision asks the decision policy for the next event and creates it
+func (a *Agent) MakeDecision(ctx context.Context) (err error) {
+	start := time.Now()
+	id := a.PublicKeyHex()[:16]
+	if !a.lastCycle.IsZero() {
+		a.metrics.drift.Set((start.Sub(a.lastCycle) - a.config.DecisionInterval).Seconds(), id)
+	}
+	a.lastCycle = start
+	a.cycle++
+
+	ctx, span := a.tracer.Start(ctx, "agent.decision")
+	span.SetAttribute("agent", id)
+
 	// Build context from blockchain state
+	_, promptSpan := tracing.Start(ctx, "agent.build_prompt")
 	prompt := a.buildPrompt()
+	promptSpan.SetAttribute("prompt_length", len(prompt))
+	promptSpan.End()
 
-	a.log.Debug("Requesting LLM decision", "prompt_length", len(prompt))
+	record := DecisionRecord{
+		Agent:   a.PublicKeyHex(),
+		Time:    start.UTC(),
+		TraceID: span.TraceID(),
+		Prompt:  prompt,
+	}
+	skipped, paused := false, false
+	defer func() {
+		result := "ok"
+		switch {
+		case err != nil:
+			record.Error = err.Error()
+			result = "failed"
+		case paused:
+			result = "paused"
+		case skipped:
+			result = "skipped"
+		}
+		span.RecordError(err)
+		span.End()
+		a.metrics.decisions.Inc(id, result)
+		a.metrics.duration.Observe(time.Since(start).Seconds(), id)
+		a.publish(record)
+	}()
+
+	policy := a.decisionPolicy(ctx)
+	if policy == nil {
+		a.log.DebugContext(ctx, "Paused until the LLM budget allows more")
+		paused = true
+		return nil
+	}
+	span.SetAttribute("policy", policy.Name())
 
-	// Get decision from LLM
-	decision, err := a.llmClient.GetCompletion(ctx, prompt)
+	a.log.DebugContext(ctx, "Requesting decision", "policy", policy.Name(), "prompt_length", len(prompt))
+
+	state := &State{
+		Agent:     a.PublicKeyHex(),
+		Name:      a.Name(),
+		Cycle:     a.cycle,
+		Prompt:    prompt,
+		Recent:    a.blockchain.GetRecentEvents(5),
+		Agents:    a.blockchain.GetAgents(),
+		LastEvent: a.lastEvent,
+	}
+	if len(a.partials) > 0 {
+		state.Partial = func(text string) {
+			partial := PartialRecord{Agent: record.Agent, Time: time.Now().UTC(), TraceID: record.TraceID, Text: text}
+			for _, fn := range a.partials {
+				fn(partial)
+			}
+		}
+	}
+	decision, err := policy.Decide(ctx, state)
+	if errors.Is(err, ErrNoDecision) {
+		a.log.DebugContext(ctx, "No decision this cycle", "policy", policy.Name())
+		skipped = true
+		return nil
+	}
 	if err != nil {
-		return fmt.Errorf("failed to get LLM decision: %w", err)
+		return err
+	}
+	if decision.Policy == "" {
+		decision.Policy = policy.Name()
 	}
+	record.Policy = decision.Policy
+	record.Response = decision.Description
 
-	a.log.Info("LLM decision received", "decision", decision)
+	a.log.InfoContext(ctx, "Decision received", "policy", decision.Policy, "decision", decision.Description)
 
 	// Create event based on decision
 	if err := a.createDecisionEvent(ctx, decision); err != nil {
 		return fmt.Errorf("failed to create decision event: %w", err)
 	}
+	record.EventHash = a.lastEvent
 
 	return nil
 }
 
+// publish notifies decision observers
+func (a *Agent) publish(record DecisionRecord) {
+	for _, fn := range a.observers {
+		fn(record)
+	}
+}
+
 // buildPrompt constructs a prompt for the LLM based on current blockchain state
 func (a *Agent) buildPrompt() string {
 	recentEvents := a.blockchain.GetRecentEvents(5)
@@ -129,13 +344,35 @@ func (a *Agent) buildPrompt() string {
 		)
 	}
 
-	// Add known agents
-	prompt += fmt.Sprintf("\nKnown agents (%d):\n", len(agents))
-	for pubKey, info := range agents {
-		prompt += fmt.Sprintf("- Agent %s (last seen: %s)\n",
-			pubKey[:16],
+	// Add known agents, most reputable first
+	identities := make([]string, 0, len(agents))
+	for identity := range agents {
+		identities = append(identities, identity)
+	}
+	sort.Slice(identities, func(i, j int) bool {
+		si, sj := agents[identities[i]].Reputation.Score, agents[identities[j]].Reputation.Score
+		if si != sj {
+			return si > sj
+		}
+		return identities[i] < identities[j]
+	})
+
+	prompt += fmt.Sprintf("\nKnown agents (%d), by reputation:\n", len(agents))
+	for i, identity := range identities {
+		if i == maxPromptAgents {
+			prompt += fmt.Sprintf("- ... and %d agents with lower reputation\n", len(identities)-i)
+			break
+		}
+		info := agents[identity]
+		prompt += fmt.Sprintf("- Agent %s (reputation: %.2f, last seen: %s)",
+			identity[:16],
+			info.Reputation.Score,
 			info.LastSeen.Format(time.RFC3339),
 		)
+		if info.Equivocated {
+			prompt += " EQUIVOCATED: created conflicting events, do not trust"
+		}
+		prompt += "\n"
 	}
 
 	// Add my last event
@@ -144,49 +381,131 @@ func (a *Agent) buildPrompt() string {
 	}
 
 	prompt += "\nWhat should be the next event in the Blockchain Universe? " +
-		"Provide a brief description (max 100 characters) for the event."
+		"Answer with exactly one JSON object and nothing else: " +
+		`{"type": "<type>", "description": "<brief description, max 100 characters>", "payload": {"<key>": "<value>"}}` +
+		". The type is one of: " + strings.Join(actionTypeNames(), ", ") + "."
 
 	return prompt
 }
 
-// createDecisionEvent creates an event based on LLM decision
-func (a *Agent) createDecisionEvent(ctx context.Context, decision string) error {
+// createDecisionEvent creates the event a policy decided on
+func (a *Agent) createDecisionEvent(ctx context.Context, decision Decision) error {
+	eventType := decision.Type
+	if eventType == "" {
+		eventType = "state_change"
+	}
+	payload := make(map[string]string, len(decision.Payload)+2)
+	for k, v := range decision.Payload {
+		payload[k] = v
+	}
+	payload["agent_id"] = a.PublicKeyHex()[:16]
+	payload["action"] = decision.Policy + "_decision"
+
+	return a.addChainEvent(ctx, eventType, decision.Description, payload)
+}
+
+// addChainEvent signs an event extending the agent's chain and adds it
+func (a *Agent) addChainEvent(ctx context.Context, eventType, description string, payload map[string]string) error {
 	parents := []string{}
 	if a.lastEvent != "" {
 		parents = append(parents, a.lastEvent)
 	}
 
+	_, signSpan := tracing.Start(ctx, "agent.sign_event")
 	event, err := a.blockchain.CreateEvent(
-		"state_change",
-		decision,
-		map[string]string{
-			"agent_id": a.PublicKeyHex()[:16],
-			"action":   "llm_decision",
-		},
+		eventType,
+		description,
+		payload,
 		parents,
 		a.pubKey,
 		a.privKey,
 	)
+	signSpan.RecordError(err)
+	signSpan.End()
 	if err != nil {
 		return fmt.Errorf("failed to create event: %w", err)
 	}
 
-	if err := a.blockchain.AddEvent(event); err != nil {
+	hash := a.blockchain.HashEvent(event)
+	ctx = logger.ContextWith(ctx, "event_hash", hash)
+	_, addSpan := tracing.Start(ctx, "blockchain.add_event")
+	addSpan.SetAttribute("event_hash", hash)
+	err = a.blockchain.AddEvent(event)
+	addSpan.RecordError(err)
+	addSpan.End()
+	if err != nil {
 		return fmt.Errorf("failed to add event: %w", err)
 	}
 
-	a.lastEvent = a.blockchain.HashEvent(event)
-	a.log.Info("Decision event created", "hash", a.lastEvent, "description", decision)
+	a.lastEvent = hash
+	a.log.InfoContext(ctx, "Event created", "type", eventType, "description", description)
 
 	return nil
 }
 
+// MaintainCheckpoints cosigns pending checkpoints that match this agent's view
+// of the chain and proposes a new checkpoint when one is due
+func (a *Agent) MaintainCheckpoints() error {
+	pubKey := a.PublicKeyHex()
+	for _, event := range a.blockchain.PendingEvents() {
+		if event.Data.Type != blockchain.TypeCheckpoint || blockchain.SignedBy(event, pubKey) {
+			continue
+		}
+		hash := a.blockchain.HashEvent(event)
+		if err := a.blockchain.CheckCheckpoint(event); err != nil {
+			a.log.Warn("Refusing to cosign checkpoint", "hash", hash, "error", err)
+			continue
+		}
+		admitted, err := a.blockchain.Cosign(hash, pubKey, blockchain.SignHash(hash, a.privKey))
+		if err != nil {
+			return fmt.Errorf("failed to cosign checkpoint: %w", err)
+		}
+		a.log.Info("Checkpoint cosigned", "hash", hash, "admitted", admitted)
+	}
+
+	if !a.blockchain.CheckpointDue(a.config.CheckpointInterval) {
+		return nil
+	}
+
+	checkpoint, err := a.blockchain.NewCheckpoint(a.pubKey, a.privKey)
+	if err != nil {
+		return fmt.Errorf("failed to create checkpoint: %w", err)
+	}
+	admitted, err := a.blockchain.ProposeEvent(checkpoint)
+	if err != nil {
+		return fmt.Errorf("failed to propose checkpoint: %w", err)
+	}
+	a.log.Info("Checkpoint proposed", "hash", a.blockchain.HashEvent(checkpoint), "admitted", admitted)
+
+	return nil
+}
+
+// ReportEquivocations publishes an equivocation_proof event for every
+// detected fork that has not been proven on the chain yet
+func (a *Agent) ReportEquivocations() error {
+	for _, eq := range a.blockchain.UnreportedEquivocations() {
+		proof, err := a.blockchain.NewEquivocationProof(eq, a.pubKey, a.privKey)
+		if err != nil {
+			return fmt.Errorf("failed to create equivocation proof: %w", err)
+		}
+		if err := a.blockchain.AddEvent(proof); err != nil {
+			return fmt.Errorf("failed to add equivocation proof: %w", err)
+		}
+		a.log.Warn("Equivocation reported", "offender", eq.Offender, "proof", a.blockchain.HashEvent(proof))
+	}
+	return nil
+}
+
 // GetStats returns current agent statistics
 func (a *Agent) GetStats() map[string]interface{} {
-	return map[string]interface{}{
-		"public_key":       a.PublicKeyHex(),
-		"last_event_hash":  a.lastEvent,
-		"total_events":     len(a.blockchain.GetRecentEvents(1000)),
-		"known_agents":     len(a.blockchain.GetAgents()),
+	stats := map[string]interface{}{
+		"public_key":      a.PublicKeyHex(),
+		"last_event_hash": a.lastEvent,
+		"total_events":    len(a.blockchain.GetRecentEvents(1000)),
+		"known_agents":    len(a.blockchain.GetAgents()),
 	}
-}
\ No newline at end of file
+	if a.budget != nil {
+		stats["llm_usage"] = a.usageStats()
+	}
+	return stats
+}
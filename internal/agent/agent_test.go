@@ -0,0 +1,159 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/yanchenko-igor/blockchain-universe/internal/blockchain"
+	"github.com/yanchenko-igor/blockchain-universe/internal/config"
+	"github.com/yanchenko-igor/blockchain-universe/internal/llm"
+	"github.com/yanchenko-igor/blockchain-universe/pkg/logger"
+	"github.com/yanchenko-igor/blockchain-universe/pkg/tracing"
+)
+
+func TestDecisionCycleIsTraced(t *testing.T) {
+	log := logger.New("error")
+	llmServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"choices":[{"text":"A new event"}],"usage":{"prompt_tokens":10,"completion_tokens":4}}`))
+	}))
+	defer llmServer.Close()
+
+	spans := make(chan []tracing.SpanData, 1)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req tracing.ExportRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		spans <- req.ResourceSpans[0].ScopeSpans[0].Spans
+	}))
+	defer collector.Close()
+
+	client, _ := llm.NewClient(config.LLMConfig{APIEndpoint: llmServer.URL, TimeoutSeconds: 5}, log)
+	a, _ := New(config.AgentConfig{DecisionInterval: time.Second}, blockchain.New(log), client, log)
+	tracer := tracing.New("test", log, tracing.NewHTTPExporter(collector.URL))
+	a.SetTracer(tracer)
+
+	var record DecisionRecord
+	a.OnDecision(func(r DecisionRecord) { record = r })
+	if err := a.MakeDecision(context.Background()); err != nil {
+		t.Fatalf("Decision failed: %v", err)
+	}
+
+	var exported []tracing.SpanData
+	select {
+	case exported = <-spans:
+	case <-time.After(5 * time.Second):
+		t.Fatal("No spans exported")
+	}
+
+	byName := make(map[string]tracing.SpanData)
+	for _, span := range exported {
+		byName[span.Name] = span
+	}
+	root, ok := byName["agent.decision"]
+	if !ok || root.TraceID != record.TraceID {
+		t.Fatalf("Root span should carry the decision's trace ID, got %+v", exported)
+	}
+	for name, parent := range map[string]string{
+		"agent.build_prompt":   "agent.decision",
+		"llm.completion":       "agent.decision",
+		"llm.request":          "llm.completion",
+		"agent.sign_event":     "agent.decision",
+		"blockchain.add_event": "agent.decision",
+	} {
+		span, ok := byName[name]
+		if !ok {
+			t.Errorf("Missing span %s", name)
+			continue
+		}
+		if span.ParentSpanID != byName[parent].SpanID || span.TraceID != root.TraceID {
+			t.Errorf("Span %s should be a child of %s", name, parent)
+		}
+	}
+}
+
+func TestKeyFileIsReused(t *testing.T) {
+	log := logger.New("error")
+	client, _ := llm.NewClient(config.LLMConfig{APIEndpoint: "http://localhost", TimeoutSeconds: 5}, log)
+	cfg := config.AgentConfig{Name: "archivist", KeyFile: filepath.Join(t.TempDir(), "keys", "archivist.json")}
+
+	first, err := New(cfg, blockchain.New(log), client, log)
+	if err != nil {
+		t.Fatalf("Failed to create agent: %v", err)
+	}
+	second, err := New(cfg, blockchain.New(log), client, log)
+	if err != nil {
+		t.Fatalf("Failed to create agent: %v", err)
+	}
+	if first.PublicKeyHex() != second.PublicKeyHex() {
+		t.Error("Agents with the same key file should have the same key")
+	}
+	if first.Name() != "archivist" {
+		t.Errorf("Unexpected name %q", first.Name())
+	}
+
+	ephemeral, _ := New(config.AgentConfig{}, blockchain.New(log), client, log)
+	if ephemeral.PublicKeyHex() == first.PublicKeyHex() || ephemeral.Name() != ephemeral.PublicKeyHex()[:16] {
+		t.Error("Agents without a key file should get a new key named by its prefix")
+	}
+}
+
+func TestRestartResumesChain(t *testing.T) {
+	log := logger.New("error")
+	client, _ := llm.NewClient(config.LLMConfig{APIEndpoint: "http://localhost", TimeoutSeconds: 5}, log)
+	cfg := config.AgentConfig{Name: "archivist", KeyFile: filepath.Join(t.TempDir(), "archivist.json")}
+	bc := blockchain.New(log)
+
+	first, _ := New(cfg, bc, client, log)
+	if err := first.CreateInitialEvent(context.Background()); err != nil {
+		t.Fatalf("Failed to create initial event: %v", err)
+	}
+	last := first.lastEvent
+
+	// A restarted process holding the same events and key continues the chain
+	restarted, _ := New(cfg, bc, client, log)
+	if err := restarted.CreateInitialEvent(context.Background()); err != nil {
+		t.Fatalf("Failed to resume: %v", err)
+	}
+	if restarted.lastEvent != last || bc.Len() != 1 {
+		t.Errorf("Expected the chain to resume at %s without a new event, got %s and %d events", last, restarted.lastEvent, bc.Len())
+	}
+	if len(bc.Equivocations()) != 0 {
+		t.Error("Restarting must not fork the agent's chain")
+	}
+}
+
+func TestStreamedDecision(t *testing.T) {
+	log := logger.New("error")
+	llmServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, chunk := range []string{`{"type": "proposal", `, `"description": "Merge", "payload": {"topic": "chains"}}`} {
+			data, _ := json.Marshal(map[string]interface{}{"choices": []map[string]string{{"text": chunk}}})
+			w.Write([]byte("data: " + string(data) + "\n\n"))
+		}
+	}))
+	defer llmServer.Close()
+
+	bc := blockchain.New(log)
+	client, _ := llm.NewClient(config.LLMConfig{APIEndpoint: llmServer.URL, TimeoutSeconds: 5, Stream: true}, log)
+	a, _ := New(config.AgentConfig{}, bc, client, log)
+
+	var partials []PartialRecord
+	a.OnPartial(func(p PartialRecord) { partials = append(partials, p) })
+	var record DecisionRecord
+	a.OnDecision(func(r DecisionRecord) { record = r })
+	if err := a.MakeDecision(context.Background()); err != nil {
+		t.Fatalf("Decision failed: %v", err)
+	}
+
+	if len(partials) != 2 || partials[0].Text != `{"type": "proposal", ` || partials[0].Agent != a.PublicKeyHex() {
+		t.Errorf("Expected partial output after every chunk, got %+v", partials)
+	}
+	event, ok := bc.GetEvent(record.EventHash)
+	if !ok || event.Data.Type != "proposal" || event.Data.Description != "Merge" || event.Data.Payload["topic"] != "chains" {
+		t.Errorf("Expected an event from the JSON action, got %+v", event)
+	}
+}
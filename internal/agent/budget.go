@@ -0,0 +1,137 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/yanchenko-igor/blockchain-universe/internal/config"
+	"github.com/yanchenko-igor/blockchain-universe/internal/llm"
+)
+
+// TypeEnergyReport is the type of events reporting an agent's LLM usage
+const TypeEnergyReport = "energy_report"
+
+// budget limits the LLM usage of an agent
+type budget struct {
+	cfg        config.BudgetConfig
+	usage      *llm.Ledger
+	model      string
+	fallback   DecisionPolicy // nil pauses the agent while the budget is exhausted
+	exhausted  string         // Limit exhausted at the last decision cycle
+	lastReport time.Time
+}
+
+// newBudget creates the budget of an agent whose LLM requests go through
+// llmClient
+func newBudget(cfg config.BudgetConfig, llmClient *llm.Client) (*budget, error) {
+	b := &budget{cfg: cfg, usage: llmClient.Usage(), model: llmClient.Model(), lastReport: time.Now()}
+	if cfg.OnExhausted == config.BudgetFallback {
+		fallback, err := NewPolicy(cfg.Fallback, llmClient)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create fallback policy: %w", err)
+		}
+		b.fallback = fallback
+	}
+	return b, nil
+}
+
+// check returns the exhausted limit, or "" if the budget allows more requests
+func (b *budget) check() string {
+	hour, today := b.usage.Hour(), b.usage.Today()
+	switch {
+	case b.cfg.TokensPerHour > 0 && hour.Tokens() >= b.cfg.TokensPerHour:
+		return "tokens_per_hour"
+	case b.cfg.TokensPerDay > 0 && today.Tokens() >= b.cfg.TokensPerDay:
+		return "tokens_per_day"
+	case b.cfg.CostPerDay > 0 && today.Cost >= b.cfg.CostPerDay:
+		return "cost_per_day"
+	}
+	return ""
+}
+
+// decisionPolicy returns the policy for the next decision cycle, or nil if
+// the agent is paused, logging when the budget runs out or allows more again
+func (a *Agent) decisionPolicy(ctx context.Context) DecisionPolicy {
+	if a.budget == nil || !a.budget.cfg.Limited() {
+		return a.policy
+	}
+	id := a.PublicKeyHex()[:16]
+	limit := a.budget.check()
+	switch {
+	case limit != "" && a.budget.exhausted == "":
+		a.metrics.exhausted.Set(1, id)
+		a.log.WarnContext(ctx, "LLM budget exhausted", "limit", limit, "action", a.budget.cfg.OnExhausted)
+	case limit == "" && a.budget.exhausted != "":
+		a.metrics.exhausted.Set(0, id)
+		a.log.InfoContext(ctx, "LLM budget available again", "policy", a.policy.Name())
+	}
+	a.budget.exhausted = limit
+
+	switch {
+	case limit == "":
+		return a.policy
+	case a.budget.fallback != nil:
+		return a.budget.fallback
+	}
+	return nil
+}
+
+// ReportEnergy creates an energy_report event with the agent's LLM usage of
+// the current day once the report interval has passed since the last one
+func (a *Agent) ReportEnergy(ctx context.Context) error {
+	if a.budget == nil || a.budget.cfg.ReportInterval <= 0 || time.Since(a.budget.lastReport) < a.budget.cfg.ReportInterval {
+		return nil
+	}
+	a.budget.lastReport = time.Now()
+
+	hour, today := a.budget.usage.Hour(), a.budget.usage.Today()
+	state := "ok"
+	if limit := a.budget.check(); limit != "" {
+		state = "exhausted:" + limit
+	}
+	payload := map[string]string{
+		"day":               time.Now().UTC().Format(time.DateOnly),
+		"model":             a.budget.model,
+		"requests":          strconv.Itoa(today.Requests),
+		"prompt_tokens":     strconv.Itoa(today.PromptTokens),
+		"completion_tokens": strconv.Itoa(today.CompletionTokens),
+		"tokens":            strconv.Itoa(today.Tokens()),
+		"hour_tokens":       strconv.Itoa(hour.Tokens()),
+		"cost":              strconv.FormatFloat(today.Cost, 'f', 4, 64),
+		"budget":            state,
+	}
+	for name, limit := range map[string]int{"tokens_per_hour": a.budget.cfg.TokensPerHour, "tokens_per_day": a.budget.cfg.TokensPerDay} {
+		if limit > 0 {
+			payload[name] = strconv.Itoa(limit)
+		}
+	}
+	if a.budget.cfg.CostPerDay > 0 {
+		payload["cost_per_day"] = strconv.FormatFloat(a.budget.cfg.CostPerDay, 'f', -1, 64)
+	}
+
+	description := fmt.Sprintf("Energy report: %d tokens in %d requests today", today.Tokens(), today.Requests)
+	if err := a.addChainEvent(ctx, TypeEnergyReport, description, payload); err != nil {
+		return fmt.Errorf("failed to report energy: %w", err)
+	}
+	return nil
+}
+
+// usageStats describes the LLM usage of the agent for GetStats
+func (a *Agent) usageStats() map[string]interface{} {
+	stats := map[string]interface{}{
+		"model": a.budget.model,
+		"hour":  a.budget.usage.Hour(),
+		"today": a.budget.usage.Today(),
+		"days":  a.budget.usage.Days(),
+	}
+	if a.budget.cfg.Limited() {
+		state := "ok"
+		if limit := a.budget.check(); limit != "" {
+			state = "exhausted:" + limit
+		}
+		stats["budget"] = state
+	}
+	return stats
+}
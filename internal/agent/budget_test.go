@@ -0,0 +1,114 @@
+package agent
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/yanchenko-igor/blockchain-universe/internal/blockchain"
+	"github.com/yanchenko-igor/blockchain-universe/internal/config"
+	"github.com/yanchenko-igor/blockchain-universe/internal/llm"
+	"github.com/yanchenko-igor/blockchain-universe/pkg/logger"
+)
+
+// newBudgetAgent creates an agent whose LLM requests use 100 tokens each
+func newBudgetAgent(t *testing.T, budget config.BudgetConfig) (*Agent, *blockchain.Blockchain, *int) {
+	t.Helper()
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte(`{"choices":[{"text":"A new event"}],"usage":{"prompt_tokens":80,"completion_tokens":20}}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	log := logger.New("error")
+	bc := blockchain.New(log)
+	client, _ := llm.NewClient(config.LLMConfig{
+		APIEndpoint:    srv.URL,
+		TimeoutSeconds: 5,
+		Model:          "large",
+		Costs:          map[string]float64{"large": 0.5},
+	}, log)
+	a, err := New(config.AgentConfig{Policy: config.PolicyConfig{Type: config.PolicyLLM}, Budget: budget}, bc, client, log)
+	if err != nil {
+		t.Fatalf("Failed to create agent: %v", err)
+	}
+	return a, bc, &requests
+}
+
+func TestExhaustedBudgetPausesAgent(t *testing.T) {
+	a, _, requests := newBudgetAgent(t, config.BudgetConfig{TokensPerHour: 200, OnExhausted: config.BudgetPause})
+	var results []string
+	a.OnDecision(func(r DecisionRecord) { results = append(results, r.EventHash) })
+
+	for range 3 {
+		if err := a.MakeDecision(context.Background()); err != nil {
+			t.Fatalf("Decision failed: %v", err)
+		}
+	}
+	if *requests != 2 || results[2] != "" {
+		t.Errorf("Expected the third cycle to be paused, got %d requests", *requests)
+	}
+
+	usage := a.GetStats()["llm_usage"].(map[string]interface{})
+	if today := usage["today"].(llm.Usage); today.Tokens() != 200 || today.Cost != 0.1 || usage["budget"] != "exhausted:tokens_per_hour" {
+		t.Errorf("Unexpected usage %+v", usage)
+	}
+}
+
+func TestExhaustedBudgetFallsBack(t *testing.T) {
+	a, bc, requests := newBudgetAgent(t, config.BudgetConfig{
+		CostPerDay:  0.05,
+		OnExhausted: config.BudgetFallback,
+		Fallback:    config.PolicyConfig{Type: config.PolicyRules, Rules: []config.RuleConfig{{Description: "Saving energy"}}},
+	})
+	var records []DecisionRecord
+	a.OnDecision(func(r DecisionRecord) { records = append(records, r) })
+
+	for range 2 {
+		if err := a.MakeDecision(context.Background()); err != nil {
+			t.Fatalf("Decision failed: %v", err)
+		}
+	}
+	if *requests != 1 || records[1].Policy != config.PolicyRules {
+		t.Fatalf("Expected the fallback policy to decide once the budget is spent, got %+v", records[1])
+	}
+	if event, _ := bc.GetEvent(records[1].EventHash); event.Data.Description != "Saving energy" {
+		t.Errorf("Unexpected fallback event %+v", event.Data)
+	}
+}
+
+func TestEnergyReport(t *testing.T) {
+	a, bc, _ := newBudgetAgent(t, config.BudgetConfig{TokensPerDay: 1000, ReportInterval: time.Hour})
+	if err := a.MakeDecision(context.Background()); err != nil {
+		t.Fatalf("Decision failed: %v", err)
+	}
+
+	decision := a.lastEvent
+	if err := a.ReportEnergy(context.Background()); err != nil || a.lastEvent != decision {
+		t.Fatalf("Energy reports should wait for the report interval, got %v", err)
+	}
+
+	a.budget.lastReport = time.Now().Add(-time.Hour)
+	if err := a.ReportEnergy(context.Background()); err != nil {
+		t.Fatalf("Failed to report energy: %v", err)
+	}
+	report, ok := bc.GetEvent(a.lastEvent)
+	if !ok || report.Data.Type != TypeEnergyReport || report.Parents[0] != decision {
+		t.Fatalf("Expected an energy report extending the agent's chain, got %+v", report)
+	}
+	for key, want := range map[string]string{
+		"model":          "large",
+		"requests":       "1",
+		"tokens":         "100",
+		"cost":           "0.0500",
+		"budget":         "ok",
+		"tokens_per_day": "1000",
+	} {
+		if got := report.Data.Payload[key]; got != want {
+			t.Errorf("Expected %s %q, got %q", key, want, got)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yanchenko-igor/blockchain-universe/internal/config"
+)
+
+// EnsemblePolicy picks or votes among member policies
+type EnsemblePolicy struct {
+	mode    string
+	members []DecisionPolicy
+	weights []float64
+	total   float64
+	rng     *rand.Rand
+	mu      sync.Mutex // Guards rng
+}
+
+// NewEnsemblePolicy creates an ensemble of members. In random mode a member is
+// picked with probability proportional to its weight; in vote mode weights
+// count as votes. Weights of 0 count as 1. A seed of 0 picks a different
+// sequence every time.
+func NewEnsemblePolicy(mode string, members []DecisionPolicy, weights []float64, seed int64) (*EnsemblePolicy, error) {
+	if len(members) == 0 {
+		return nil, fmt.Errorf("ensemble has no members")
+	}
+	switch mode {
+	case "":
+		mode = config.EnsembleFirst
+	case config.EnsembleFirst, config.EnsembleRandom, config.EnsembleVote:
+	default:
+		return nil, fmt.Errorf("unknown ensemble mode %q", mode)
+	}
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
+	p := &EnsemblePolicy{mode: mode, members: members, weights: make([]float64, len(members)), rng: rand.New(rand.NewSource(seed))}
+	for i := range members {
+		p.weights[i] = 1
+		if i < len(weights) && weights[i] > 0 {
+			p.weights[i] = weights[i]
+		}
+		p.total += p.weights[i]
+	}
+	return p, nil
+}
+
+// Name returns "ensemble"
+func (p *EnsemblePolicy) Name() string {
+	return config.PolicyEnsemble
+}
+
+// Decide asks the members according to the mode. The decision names the
+// member that made it.
+func (p *EnsemblePolicy) Decide(ctx context.Context, state *State) (Decision, error) {
+	switch p.mode {
+	case config.EnsembleRandom:
+		return decide(ctx, p.members[p.pick()], state)
+	case config.EnsembleVote:
+		return p.vote(ctx, state)
+	default:
+		return p.first(ctx, state)
+	}
+}
+
+// decide asks a member, naming it in the decision
+func decide(ctx context.Context, member DecisionPolicy, state *State) (Decision, error) {
+	d, err := member.Decide(ctx, state)
+	if err == nil && d.Policy == "" {
+		d.Policy = member.Name()
+	}
+	return d, err
+}
+
+// pick chooses a member at random by weight
+func (p *EnsemblePolicy) pick() int {
+	p.mu.Lock()
+	x := p.rng.Float64() * p.total
+	p.mu.Unlock()
+
+	for i, w := range p.weights {
+		if x < w {
+			return i
+		}
+		x -= w
+	}
+	return len(p.weights) - 1
+}
+
+// first returns the decision of the first member that makes one, falling
+// back to the next member when one fails
+func (p *EnsemblePolicy) first(ctx context.Context, state *State) (Decision, error) {
+	var errs []error
+	for _, member := range p.members {
+		d, err := decide(ctx, member, state)
+		if err == nil {
+			return d, nil
+		}
+		if !errors.Is(err, ErrNoDecision) {
+			errs = append(errs, fmt.Errorf("%s: %w", member.Name(), err))
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	if len(errs) > 0 {
+		return Decision{}, errors.Join(errs...)
+	}
+	return Decision{}, ErrNoDecision
+}
+
+// vote asks every member and returns the event most weight agrees on; ties
+// go to the earlier member. Descriptions are compared ignoring case and
+// surrounding space.
+func (p *EnsemblePolicy) vote(ctx context.Context, state *State) (Decision, error) {
+	type ballot struct {
+		decision Decision
+		weight   float64
+	}
+	var ballots []*ballot
+	byKey := make(map[string]*ballot)
+	var errs []error
+
+	for i, member := range p.members {
+		d, err := decide(ctx, member, state)
+		if err != nil {
+			if !errors.Is(err, ErrNoDecision) {
+				errs = append(errs, fmt.Errorf("%s: %w", member.Name(), err))
+			}
+			if ctx.Err() != nil {
+				break
+			}
+			continue
+		}
+		key := d.Type + "\x00" + strings.ToLower(strings.TrimSpace(d.Description))
+		b, ok := byKey[key]
+		if !ok {
+			b = &ballot{decision: d}
+			byKey[key] = b
+			ballots = append(ballots, b)
+		}
+		b.weight += p.weights[i]
+	}
+
+	if len(ballots) == 0 {
+		if len(errs) > 0 {
+			return Decision{}, errors.Join(errs...)
+		}
+		return Decision{}, ErrNoDecision
+	}
+
+	winner := ballots[0]
+	for _, b := range ballots[1:] {
+		if b.weight > winner.weight {
+			winner = b
+		}
+	}
+	d := winner.decision
+	payload := make(map[string]string, len(d.Payload)+1)
+	for k, v := range d.Payload {
+		payload[k] = v
+	}
+	payload["votes"] = fmt.Sprintf("%g/%g", winner.weight, p.total)
+	d.Payload = payload
+	return d, nil
+}
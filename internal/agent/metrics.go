@@ -0,0 +1,33 @@
+package agent
+
+import (
+	"github.com/yanchenko-igor/blockchain-universe/pkg/metrics"
+)
+
+// Metrics instruments agents; several agents may share one, as series are
+// labeled by agent
+type Metrics struct {
+	decisions *metrics.Counter
+	duration  *metrics.Histogram
+	drift     *metrics.Gauge
+	triggers  *metrics.Counter
+	wakeups   *metrics.Counter
+	exhausted *metrics.Gauge
+}
+
+// NewMetrics registers the agent metrics with reg
+func NewMetrics(reg *metrics.Registry) *Metrics {
+	return &Metrics{
+		decisions: reg.NewCounter("bu_agent_decisions_total", "Decision cycles, by agent and result", "agent", "result"),
+		duration:  reg.NewHistogram("bu_agent_decision_duration_seconds", "Duration of decision cycles", metrics.DefaultBuckets, "agent"),
+		drift:     reg.NewGauge("bu_agent_interval_drift_seconds", "How much later than the decision interval the last decision started", "agent"),
+		triggers:  reg.NewCounter("bu_agent_triggers_total", "Admitted events that matched a trigger, by agent and reason", "agent", "reason"),
+		wakeups:   reg.NewCounter("bu_agent_trigger_wakeups_total", "Decision cycles started early by triggers", "agent"),
+		exhausted: reg.NewGauge("bu_agent_budget_exhausted", "1 while the agent's LLM budget is exhausted", "agent"),
+	}
+}
+
+// SetMetrics instruments the agent with m
+func (a *Agent) SetMetrics(m *Metrics) {
+	a.metrics = m
+}
@@ -0,0 +1,179 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/yanchenko-igor/blockchain-universe/internal/blockchain"
+	"github.com/yanchenko-igor/blockchain-universe/internal/config"
+	"github.com/yanchenko-igor/blockchain-universe/internal/llm"
+)
+
+// ErrNoDecision is returned by policies that choose not to create an event
+// this cycle, e.g. when no rule matches or a scenario has ended
+var ErrNoDecision = errors.New("no decision")
+
+// DecisionPolicy decides on the next event of an agent
+type DecisionPolicy interface {
+	// Name identifies the policy in events, logs and traces
+	Name() string
+	// Decide returns the next event, or ErrNoDecision to skip the cycle
+	Decide(ctx context.Context, state *State) (Decision, error)
+}
+
+// Decision is the event a policy decided on
+type Decision struct {
+	Type        string            // Event type, state_change if empty
+	Description string            // Event description
+	Payload     map[string]string // Added to the event payload
+	Policy      string            // Name of the policy that decided, set by ensembles
+}
+
+// State is what a policy knows when deciding. Its methods may be used in
+// rule templates, e.g. {{.Name}} or {{.KnownAgents}}.
+type State struct {
+	Agent     string                           // Public key
+	Name      string                           // Configured name, or a public key prefix
+	Cycle     int                              // Decision cycle, starting at 1
+	Prompt    string                           // Prompt describing the state for LLMs
+	Recent    []*blockchain.Event              // Most recent events, oldest first
+	Agents    map[string]*blockchain.AgentInfo // Known agents by identity
+	LastEvent string                           // Hash of the agent's last event
+	Partial   func(text string)                // Receives LLM output as it is generated; may be nil
+}
+
+// LastEventType returns the type of the most recent event, or ""
+func (s *State) LastEventType() string {
+	if len(s.Recent) == 0 {
+		return ""
+	}
+	return s.Recent[len(s.Recent)-1].Data.Type
+}
+
+// KnownAgents returns the number of known agents
+func (s *State) KnownAgents() int {
+	return len(s.Agents)
+}
+
+// Equivocation reports whether a known agent created conflicting events
+func (s *State) Equivocation() bool {
+	for _, info := range s.Agents {
+		if info.Equivocated {
+			return true
+		}
+	}
+	return false
+}
+
+// NewPolicy creates the policy described by cfg. LLM policies use
+// llmClient.
+func NewPolicy(cfg config.PolicyConfig, llmClient *llm.Client) (DecisionPolicy, error) {
+	switch cfg.Type {
+	case config.PolicyLLM, "":
+		if llmClient == nil {
+			return nil, fmt.Errorf("llm policy requires an LLM client")
+		}
+		return NewLLMPolicy(llmClient), nil
+	case config.PolicyRules:
+		return NewRulePolicy(cfg.Rules)
+	case config.PolicyRandom:
+		return NewRandomPolicy(cfg.Descriptions, cfg.Seed), nil
+	case config.PolicyScripted:
+		return LoadScriptedPolicy(cfg.Scenario, cfg.Loop)
+	case config.PolicyEnsemble:
+		members := make([]DecisionPolicy, len(cfg.Members))
+		weights := make([]float64, len(cfg.Members))
+		for i, member := range cfg.Members {
+			policy, err := NewPolicy(member, llmClient)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create ensemble member %d: %w", i, err)
+			}
+			members[i] = policy
+			weights[i] = member.Weight
+		}
+		return NewEnsemblePolicy(cfg.Mode, members, weights, cfg.Seed)
+	default:
+		return nil, fmt.Errorf("unknown policy type %q", cfg.Type)
+	}
+}
+
+// LLMPolicy asks an LLM for the next event
+type LLMPolicy struct {
+	client *llm.Client
+}
+
+// NewLLMPolicy creates a policy asking client
+func NewLLMPolicy(client *llm.Client) *LLMPolicy {
+	return &LLMPolicy{client: client}
+}
+
+// Name returns "llm"
+func (p *LLMPolicy) Name() string {
+	return config.PolicyLLM
+}
+
+// Decide sends the state's prompt to the LLM. A completion holding a JSON
+// action object such as {"type": "proposal", "description": "...",
+// "payload": {...}} decides on that event; any other completion is the
+// description of a state_change event.
+func (p *LLMPolicy) Decide(ctx context.Context, state *State) (Decision, error) {
+	completion, err := p.client.GetCompletionStream(ctx, state.Prompt, state.Partial)
+	if err != nil {
+		return Decision{}, fmt.Errorf("failed to get LLM decision: %w", err)
+	}
+	if d, ok := parseAction(completion); ok {
+		return d, nil
+	}
+	return Decision{Description: completion}, nil
+}
+
+// actionTypes are the event types an LLM may decide on. System events, such
+// as checkpoints, key management, equivocation proofs and energy reports,
+// are created by the node only; other types become a state_change.
+var actionTypes = map[string]bool{
+	"state_change":         true,
+	"proposal":             true,
+	blockchain.TypeEndorse: true,
+}
+
+// actionTypeNames returns the sorted actionTypes, for prompts
+func actionTypeNames() []string {
+	names := make([]string, 0, len(actionTypes))
+	for name := range actionTypes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// reservedPayloadKeys are set by the agent on every decision event and
+// cannot be chosen by an LLM
+var reservedPayloadKeys = []string{"agent_id", "action"}
+
+// parseAction decodes the first JSON action object in a completion. Types
+// outside actionTypes are dropped, as are reserved payload keys.
+func parseAction(completion string) (Decision, bool) {
+	start := strings.Index(completion, "{")
+	if start < 0 {
+		return Decision{}, false
+	}
+	var action struct {
+		Type        string            `json:"type"`
+		Description string            `json:"description"`
+		Payload     map[string]string `json:"payload"`
+	}
+	if err := json.NewDecoder(strings.NewReader(completion[start:])).Decode(&action); err != nil || action.Description == "" {
+		return Decision{}, false
+	}
+	if !actionTypes[action.Type] {
+		action.Type = ""
+	}
+	for _, key := range reservedPayloadKeys {
+		delete(action.Payload, key)
+	}
+	return Decision{Type: action.Type, Description: action.Description, Payload: action.Payload}, true
+}
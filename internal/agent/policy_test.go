@@ -0,0 +1,217 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/yanchenko-igor/blockchain-universe/internal/blockchain"
+	"github.com/yanchenko-igor/blockchain-universe/internal/config"
+	"github.com/yanchenko-igor/blockchain-universe/internal/llm"
+	"github.com/yanchenko-igor/blockchain-universe/pkg/logger"
+)
+
+// failingPolicy always fails
+type failingPolicy struct{}
+
+func (failingPolicy) Name() string { return "failing" }
+
+func (failingPolicy) Decide(ctx context.Context, state *State) (Decision, error) {
+	return Decision{}, errors.New("unavailable")
+}
+
+// fixedPolicy always decides on the same description
+type fixedPolicy string
+
+func (p fixedPolicy) Name() string { return string(p) }
+
+func (p fixedPolicy) Decide(ctx context.Context, state *State) (Decision, error) {
+	return Decision{Description: string(p)}, nil
+}
+
+func TestRulePolicy(t *testing.T) {
+	policy, err := NewRulePolicy([]config.RuleConfig{
+		{When: config.RuleCondition{Every: 3}, Type: "census", Description: "{{.Name}} counts {{.KnownAgents}} agents"},
+		{When: config.RuleCondition{LastEventType: "initialization"}, Description: "Welcome"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create policy: %v", err)
+	}
+
+	state := &State{Name: "archivist", Cycle: 3, Agents: map[string]*blockchain.AgentInfo{"a": {}, "b": {}}}
+	d, err := policy.Decide(context.Background(), state)
+	if err != nil || d.Type != "census" || d.Description != "archivist counts 2 agents" {
+		t.Errorf("Unexpected decision %+v, %v", d, err)
+	}
+
+	state.Cycle = 4
+	if _, err := policy.Decide(context.Background(), state); !errors.Is(err, ErrNoDecision) {
+		t.Errorf("Expected no decision without a matching rule, got %v", err)
+	}
+
+	if _, err := NewRulePolicy([]config.RuleConfig{{Description: "{{.Name"}}); err == nil {
+		t.Error("Invalid templates should be rejected")
+	}
+}
+
+func TestParseAction(t *testing.T) {
+	d, ok := parseAction(`Sure: {"type": "endorse", "description": "Vouch", "payload": {"agent": "ab12"}}`)
+	if !ok || d.Type != blockchain.TypeEndorse || d.Payload["agent"] != "ab12" {
+		t.Errorf("Unexpected decision %+v", d)
+	}
+
+	for _, typ := range []string{"checkpoint", "key_rotate", "key_revoke", "equivocation_proof", "energy_report", "initialization"} {
+		d, ok := parseAction(`{"type": "` + typ + `", "description": "Forged", "payload": {"agent_id": "x", "action": "y", "note": "z"}}`)
+		if !ok || d.Type != "" || d.Description != "Forged" {
+			t.Errorf("System type %s should become a state_change, got %+v", typ, d)
+		}
+		if _, ok := d.Payload["agent_id"]; ok || d.Payload["action"] != "" || d.Payload["note"] != "z" {
+			t.Errorf("Reserved payload keys should be dropped, got %v", d.Payload)
+		}
+	}
+
+	if _, ok := parseAction("Just a thought"); ok {
+		t.Error("Plain completions are not actions")
+	}
+}
+
+func TestLLMPolicyStopsAtStreamedAction(t *testing.T) {
+	log := logger.New("error")
+	var prompt string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req llm.CompletionRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		prompt = req.Prompt
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, chunk := range []string{`{"type": "endorse", "description": "Vouch", `, `"payload": {"agent": "ab12"}}`, ` Also, `} {
+			data, _ := json.Marshal(map[string]interface{}{"choices": []map[string]string{{"text": chunk}}})
+			w.Write([]byte("data: " + string(data) + "\n\n"))
+			w.(http.Flusher).Flush()
+		}
+		// Keep generating until the client hangs up
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	client, _ := llm.NewClient(config.LLMConfig{APIEndpoint: srv.URL, TimeoutSeconds: 5, Stream: true}, log)
+	a, _ := New(config.AgentConfig{}, blockchain.New(log), client, log)
+
+	d, err := NewLLMPolicy(client).Decide(context.Background(), &State{Prompt: a.buildPrompt()})
+	if err != nil {
+		t.Fatalf("Decision failed: %v", err)
+	}
+	if d.Type != blockchain.TypeEndorse || d.Description != "Vouch" || d.Payload["agent"] != "ab12" {
+		t.Errorf("Expected the streamed JSON action, got %+v", d)
+	}
+	if !strings.Contains(prompt, `{"type": "<type>"`) || !strings.Contains(prompt, "endorse, proposal, state_change") {
+		t.Errorf("Prompt should ask for a JSON action with the allowed types, got %q", prompt)
+	}
+}
+
+func TestScriptedPolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scenario.yaml")
+	os.WriteFile(path, []byte(`
+steps:
+  - description: First
+  - skip: true
+  - type: proposal
+    description: Third
+    payload: {topic: merge}
+`), 0644)
+
+	policy, err := LoadScriptedPolicy(path, true)
+	if err != nil {
+		t.Fatalf("Failed to load scenario: %v", err)
+	}
+	var got []string
+	for range 4 {
+		d, err := policy.Decide(context.Background(), &State{})
+		switch {
+		case errors.Is(err, ErrNoDecision):
+			got = append(got, "-")
+		case err != nil:
+			t.Fatalf("Decision failed: %v", err)
+		default:
+			got = append(got, d.Description)
+		}
+	}
+	if want := []string{"First", "-", "Third", "First"}; !slices.Equal(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+
+	os.WriteFile(path, []byte("steps:\n  - descripton: typo\n"), 0644)
+	if _, err := LoadScriptedPolicy(path, false); err == nil {
+		t.Error("Unknown keys in scenarios should be rejected")
+	}
+}
+
+func TestEnsemblePolicy(t *testing.T) {
+	first, _ := NewEnsemblePolicy("", []DecisionPolicy{failingPolicy{}, fixedPolicy("fallback")}, nil, 1)
+	d, err := first.Decide(context.Background(), &State{})
+	if err != nil || d.Description != "fallback" || d.Policy != "fallback" {
+		t.Errorf("Expected the fallback member's decision, got %+v, %v", d, err)
+	}
+
+	vote, _ := NewEnsemblePolicy(config.EnsembleVote, []DecisionPolicy{
+		fixedPolicy("Merge"), fixedPolicy("Split"), fixedPolicy("merge "), failingPolicy{},
+	}, []float64{1, 1.5, 1, 1}, 1)
+	d, err = vote.Decide(context.Background(), &State{})
+	if err != nil || d.Description != "Merge" || d.Payload["votes"] != "2/4.5" {
+		t.Errorf("Expected the majority decision, got %+v, %v", d, err)
+	}
+
+	random, _ := NewEnsemblePolicy(config.EnsembleRandom, []DecisionPolicy{fixedPolicy("a"), fixedPolicy("b")}, []float64{1, 0}, 7)
+	counts := make(map[string]int)
+	for range 100 {
+		d, _ := random.Decide(context.Background(), &State{})
+		counts[d.Description]++
+	}
+	if counts["a"] == 0 || counts["b"] == 0 {
+		t.Errorf("Expected both members to be picked, got %v", counts)
+	}
+}
+
+func TestMakeDecisionWithPolicy(t *testing.T) {
+	log := logger.New("error")
+	bc := blockchain.New(log)
+	a, err := New(config.AgentConfig{
+		Name: "clerk",
+		Policy: config.PolicyConfig{Type: config.PolicyRules, Rules: []config.RuleConfig{
+			{When: config.RuleCondition{MinAgents: 1}, Type: "census", Description: "Cycle {{.Cycle}}", Payload: map[string]string{"kind": "count"}},
+		}},
+	}, bc, nil, log)
+	if err != nil {
+		t.Fatalf("Failed to create agent without an LLM client: %v", err)
+	}
+
+	var records []DecisionRecord
+	a.OnDecision(func(r DecisionRecord) { records = append(records, r) })
+
+	// No agents are known before the initial event
+	if err := a.MakeDecision(context.Background()); err != nil || records[0].EventHash != "" {
+		t.Fatalf("Expected a skipped cycle, got %+v, %v", records[0], err)
+	}
+	if err := a.CreateInitialEvent(context.Background()); err != nil {
+		t.Fatalf("Failed to create initial event: %v", err)
+	}
+	if err := a.MakeDecision(context.Background()); err != nil {
+		t.Fatalf("Decision failed: %v", err)
+	}
+
+	event, ok := bc.GetEvent(records[1].EventHash)
+	if !ok || records[1].Policy != config.PolicyRules {
+		t.Fatalf("Expected an event decided by the rules, got %+v", records[1])
+	}
+	if event.Data.Type != "census" || event.Data.Description != "Cycle 2" ||
+		event.Data.Payload["kind"] != "count" || event.Data.Payload["action"] != "rules_decision" {
+		t.Errorf("Unexpected event %+v", event.Data)
+	}
+}
@@ -0,0 +1,55 @@
+package agent
+
+import (
+	"context"
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/yanchenko-igor/blockchain-universe/internal/config"
+)
+
+// defaultDescriptions are used by random policies without descriptions
+var defaultDescriptions = []string{
+	"Observed the latest events of the universe",
+	"Extended my event chain",
+	"Acknowledged the known agents",
+	"Recorded a state change",
+	"Reflected on the chain so far",
+}
+
+// RandomPolicy picks event descriptions at random, for load testing without
+// an LLM
+type RandomPolicy struct {
+	descriptions []string
+	rng          *rand.Rand
+	mu           sync.Mutex // Guards rng
+}
+
+// NewRandomPolicy creates a policy picking from descriptions, or built-in
+// ones if empty. A seed of 0 picks a different sequence every time.
+func NewRandomPolicy(descriptions []string, seed int64) *RandomPolicy {
+	if len(descriptions) == 0 {
+		descriptions = defaultDescriptions
+	}
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return &RandomPolicy{descriptions: descriptions, rng: rand.New(rand.NewSource(seed))}
+}
+
+// Name returns "random"
+func (p *RandomPolicy) Name() string {
+	return config.PolicyRandom
+}
+
+// Decide picks a description and a random nonce
+func (p *RandomPolicy) Decide(ctx context.Context, state *State) (Decision, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return Decision{
+		Description: p.descriptions[p.rng.Intn(len(p.descriptions))],
+		Payload:     map[string]string{"nonce": strconv.FormatUint(p.rng.Uint64(), 16)},
+	}, nil
+}
@@ -0,0 +1,67 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/yanchenko-igor/blockchain-universe/internal/config"
+)
+
+// RulePolicy decides with the first rule whose conditions hold
+type RulePolicy struct {
+	rules     []config.RuleConfig
+	templates []*template.Template
+}
+
+// NewRulePolicy creates a policy from rules, parsing their description
+// templates
+func NewRulePolicy(rules []config.RuleConfig) (*RulePolicy, error) {
+	p := &RulePolicy{rules: rules, templates: make([]*template.Template, len(rules))}
+	for i, rule := range rules {
+		tmpl, err := template.New(fmt.Sprintf("rule %d", i)).Option("missingkey=error").Parse(rule.Description)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse rule %d: %w", i, err)
+		}
+		p.templates[i] = tmpl
+	}
+	return p, nil
+}
+
+// Name returns "rules"
+func (p *RulePolicy) Name() string {
+	return config.PolicyRules
+}
+
+// Decide applies the first matching rule, or returns ErrNoDecision
+func (p *RulePolicy) Decide(ctx context.Context, state *State) (Decision, error) {
+	for i, rule := range p.rules {
+		if !matches(rule.When, state) {
+			continue
+		}
+		var description strings.Builder
+		if err := p.templates[i].Execute(&description, state); err != nil {
+			return Decision{}, fmt.Errorf("failed to render rule %d: %w", i, err)
+		}
+		return Decision{Type: rule.Type, Description: description.String(), Payload: rule.Payload}, nil
+	}
+	return Decision{}, ErrNoDecision
+}
+
+// matches reports whether all conditions hold in state
+func matches(when config.RuleCondition, state *State) bool {
+	switch {
+	case when.LastEventType != "" && when.LastEventType != state.LastEventType():
+		return false
+	case state.KnownAgents() < when.MinAgents:
+		return false
+	case when.MaxAgents > 0 && state.KnownAgents() > when.MaxAgents:
+		return false
+	case when.Equivocation && !state.Equivocation():
+		return false
+	case when.Every > 0 && state.Cycle%when.Every != 0:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,87 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/yanchenko-igor/blockchain-universe/internal/config"
+)
+
+// Scenario is a script of events, one per decision cycle
+type Scenario struct {
+	Steps []ScenarioStep `yaml:"steps"`
+}
+
+// ScenarioStep is the event of one decision cycle
+type ScenarioStep struct {
+	Type        string            `yaml:"type"` // state_change if empty
+	Description string            `yaml:"description"`
+	Payload     map[string]string `yaml:"payload"`
+	Skip        bool              `yaml:"skip"` // Create no event this cycle
+}
+
+// ScriptedPolicy plays a scenario
+type ScriptedPolicy struct {
+	steps []ScenarioStep
+	loop  bool
+	next  int
+	mu    sync.Mutex // Guards next
+}
+
+// NewScriptedPolicy creates a policy playing scenario, starting over after the
+// last step if loop is set
+func NewScriptedPolicy(scenario Scenario, loop bool) *ScriptedPolicy {
+	return &ScriptedPolicy{steps: scenario.Steps, loop: loop}
+}
+
+// LoadScriptedPolicy creates a policy playing the scenario file at path
+func LoadScriptedPolicy(path string, loop bool) (*ScriptedPolicy, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open scenario: %w", err)
+	}
+	defer f.Close()
+
+	var scenario Scenario
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(&scenario); err != nil {
+		return nil, fmt.Errorf("failed to parse scenario %s: %w", path, err)
+	}
+	for i, step := range scenario.Steps {
+		if !step.Skip && step.Description == "" {
+			return nil, fmt.Errorf("scenario %s: step %d has no description", path, i+1)
+		}
+	}
+	return NewScriptedPolicy(scenario, loop), nil
+}
+
+// Name returns "scripted"
+func (p *ScriptedPolicy) Name() string {
+	return config.PolicyScripted
+}
+
+// Decide plays the next step, or returns ErrNoDecision once the scenario has
+// ended
+func (p *ScriptedPolicy) Decide(ctx context.Context, state *State) (Decision, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.next == len(p.steps) {
+		if !p.loop || len(p.steps) == 0 {
+			return Decision{}, ErrNoDecision
+		}
+		p.next = 0
+	}
+	step := p.steps[p.next]
+	p.next++
+
+	if step.Skip {
+		return Decision{}, ErrNoDecision
+	}
+	return Decision{Type: step.Type, Description: step.Description, Payload: step.Payload}, nil
+}
@@ -0,0 +1,169 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/yanchenko-igor/blockchain-universe/internal/blockchain"
+	"github.com/yanchenko-igor/blockchain-universe/internal/config"
+)
+
+// Trigger reasons, as reported in logs and metrics
+const (
+	triggerMention  = "mention"
+	triggerNewAgent = "new_agent"
+	triggerType     = "type"
+	triggerPattern  = "pattern"
+)
+
+// triggerBuffer holds admissions not yet matched against the triggers; when
+// full, the oldest are dropped
+const triggerBuffer = 256
+
+// triggers matches admitted events against an agent's trigger configuration
+type triggers struct {
+	cfg      config.TriggerConfig
+	mention  *regexp.Regexp // Name or public key of the agent
+	patterns []*regexp.Regexp
+}
+
+// newTriggers compiles the trigger configuration of the agent with the given
+// public key and name
+func newTriggers(cfg config.TriggerConfig, publicKey, name string) (*triggers, error) {
+	names := regexp.QuoteMeta(publicKey[:16])
+	if name != "" {
+		names += "|" + regexp.QuoteMeta(name)
+	}
+	// \b only separates word and non-word characters, so it never matches
+	// before a name such as "@bot"; require no adjacent word character instead
+	t := &triggers{cfg: cfg, mention: regexp.MustCompile(`(?i)(?:^|\W)(?:` + names + `)(?:\W|$)`)}
+	for _, pattern := range cfg.Patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trigger pattern %q: %w", pattern, err)
+		}
+		t.patterns = append(t.patterns, re)
+	}
+	return t, nil
+}
+
+// match returns why an event by another agent triggers a decision cycle,
+// or "" if it does not
+func (t *triggers) match(event *blockchain.Event) string {
+	if t.cfg.Mentions && t.mentions(event) {
+		return triggerMention
+	}
+	if t.cfg.NewAgents && event.Data.Type == "initialization" {
+		return triggerNewAgent
+	}
+	for _, typ := range t.cfg.Types {
+		if event.Data.Type == typ {
+			return triggerType
+		}
+	}
+	for _, re := range t.patterns {
+		if re.MatchString(event.Data.Description) {
+			return triggerPattern
+		}
+	}
+	return ""
+}
+
+// mentions reports whether the description or a payload value names the agent
+func (t *triggers) mentions(event *blockchain.Event) bool {
+	if t.mention.MatchString(event.Data.Description) {
+		return true
+	}
+	for _, v := range event.Data.Payload {
+		if t.mention.MatchString(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// WatchTriggers calls wake when admitted events by other agents match the
+// agent's triggers, until ctx is done. Wakeups wait until no trigger has
+// matched for the debounce time, but no longer than the larger of the
+// debounce time and the minimum interval after the first pending match, so a
+// steady stream of matches cannot postpone them forever. They are at least
+// the minimum interval apart, so agents triggering each other cannot cascade.
+func (a *Agent) WatchTriggers(ctx context.Context, wake func()) {
+	if a.triggers == nil {
+		return
+	}
+	cfg := a.triggers.cfg
+	sub := a.blockchain.Subscribe(blockchain.SubscribeOptions{Buffer: triggerBuffer, Policy: blockchain.DropOldest})
+	defer sub.Close()
+
+	id := a.PublicKeyHex()[:16]
+	timer := time.NewTimer(0)
+	if !timer.Stop() {
+		<-timer.C
+	}
+	defer timer.Stop()
+
+	var lastWake, firstPending time.Time
+	var pending []string // Reasons since the last wakeup
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case n, ok := <-sub.C():
+			if !ok {
+				return
+			}
+			if n.Event.AuthorPubKey == a.PublicKeyHex() {
+				continue
+			}
+			reason := a.triggers.match(n.Event)
+			if reason == "" {
+				continue
+			}
+			a.metrics.triggers.Inc(id, reason)
+			a.log.DebugContext(ctx, "Trigger matched", "reason", reason, "event_hash", n.Hash)
+			if len(pending) == 0 {
+				firstPending = time.Now()
+			}
+			pending = append(pending, reason)
+
+			wait := cfg.Debounce
+			if next := time.Until(lastWake.Add(cfg.MinInterval)); next > wait {
+				wait = next
+			}
+			// The deadline is never before lastWake + MinInterval, as the
+			// first pending match came after the last wakeup
+			if deadline := time.Until(firstPending.Add(max(cfg.Debounce, cfg.MinInterval))); deadline < wait {
+				wait = max(deadline, 0)
+			}
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(wait)
+		case <-timer.C:
+			lastWake = time.Now()
+			a.metrics.wakeups.Inc(id)
+			a.log.InfoContext(ctx, "Triggered decision cycle", "triggers", len(pending), "reasons", unique(pending))
+			pending = pending[:0]
+			wake()
+		}
+	}
+}
+
+// unique returns values without repetitions, in order of first occurrence
+func unique(values []string) []string {
+	var out []string
+	seen := make(map[string]bool)
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -0,0 +1,146 @@
+package agent
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/yanchenko-igor/blockchain-universe/internal/blockchain"
+	"github.com/yanchenko-igor/blockchain-universe/internal/config"
+	"github.com/yanchenko-igor/blockchain-universe/pkg/logger"
+)
+
+// newEvent returns an unsigned event for matching
+func newEvent(typ, description string, payload map[string]string) *blockchain.Event {
+	event := &blockchain.Event{}
+	event.Data.Type = typ
+	event.Data.Description = description
+	event.Data.Payload = payload
+	return event
+}
+
+func TestTriggerMatching(t *testing.T) {
+	pub := "0123456789abcdef0123456789abcdef"
+	trig, err := newTriggers(config.TriggerConfig{
+		Mentions:  true,
+		NewAgents: true,
+		Types:     []string{"proposal"},
+		Patterns:  []string{`(?i)merge`},
+	}, pub, "Archivist")
+	if err != nil {
+		t.Fatalf("Failed to compile triggers: %v", err)
+	}
+
+	for _, tc := range []struct {
+		event  *blockchain.Event
+		reason string
+	}{
+		{newEvent("state_change", "Asking the archivist for help", nil), triggerMention},
+		{newEvent("state_change", "Reply", map[string]string{"to": pub[:16]}), triggerMention},
+		{newEvent("state_change", "The archivists met", nil), ""},
+		{newEvent("initialization", "Agent initialization", nil), triggerNewAgent},
+		{newEvent("proposal", "Split the chain", nil), triggerType},
+		{newEvent("state_change", "Merge the oldest chains", nil), triggerPattern},
+		{newEvent("state_change", "Nothing to see", nil), ""},
+	} {
+		if got := trig.match(tc.event); got != tc.reason {
+			t.Errorf("%q: expected reason %q, got %q", tc.event.Data.Description, tc.reason, got)
+		}
+	}
+
+	// Names starting or ending with non-word characters are still mentions
+	bot, _ := newTriggers(config.TriggerConfig{Mentions: true}, pub, "@bot")
+	for _, tc := range []struct {
+		event  *blockchain.Event
+		reason string
+	}{
+		{newEvent("state_change", "Ping @bot", nil), triggerMention},
+		{newEvent("state_change", "@Bot, are you there?", nil), triggerMention},
+		{newEvent("state_change", "Ping @bots", nil), ""},
+	} {
+		if got := bot.match(tc.event); got != tc.reason {
+			t.Errorf("%q: expected reason %q, got %q", tc.event.Data.Description, tc.reason, got)
+		}
+	}
+
+	if _, err := newTriggers(config.TriggerConfig{Patterns: []string{"("}}, pub, ""); err == nil {
+		t.Error("Invalid patterns should be rejected")
+	}
+}
+
+func TestSteadyTriggersStillWake(t *testing.T) {
+	log := logger.New("error")
+	bc := blockchain.New(log)
+	watcher, _ := New(config.AgentConfig{
+		Name:     "archivist",
+		Triggers: config.TriggerConfig{Mentions: true, Debounce: 50 * time.Millisecond, MinInterval: 100 * time.Millisecond},
+		Policy:   config.PolicyConfig{Type: config.PolicyRandom},
+	}, bc, nil, log)
+	other, _ := New(config.AgentConfig{Policy: config.PolicyConfig{
+		Type:  config.PolicyRules,
+		Rules: []config.RuleConfig{{Description: "Calling the archivist"}},
+	}}, bc, nil, log)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var wakeups atomic.Int32
+	go watcher.WatchTriggers(ctx, func() { wakeups.Add(1) })
+	time.Sleep(10 * time.Millisecond) // Let it subscribe
+
+	// Mentions closer together than the debounce time never go quiet
+	for range 20 {
+		other.MakeDecision(ctx)
+		time.Sleep(20 * time.Millisecond)
+	}
+	if n := wakeups.Load(); n < 2 {
+		t.Errorf("Expected wakeups during a steady stream of mentions, got %d", n)
+	}
+}
+
+func TestWatchTriggersDebouncesAndRateLimits(t *testing.T) {
+	log := logger.New("error")
+	bc := blockchain.New(log)
+	watcher, _ := New(config.AgentConfig{
+		Name:     "archivist",
+		Triggers: config.TriggerConfig{Mentions: true, Debounce: 20 * time.Millisecond, MinInterval: 300 * time.Millisecond},
+		Policy:   config.PolicyConfig{Type: config.PolicyRandom},
+	}, bc, nil, log)
+	other, _ := New(config.AgentConfig{Policy: config.PolicyConfig{
+		Type:  config.PolicyRules,
+		Rules: []config.RuleConfig{{Description: "Calling the archivist"}},
+	}}, bc, nil, log)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var wakeups atomic.Int32
+	go watcher.WatchTriggers(ctx, func() { wakeups.Add(1) })
+	time.Sleep(10 * time.Millisecond) // Let it subscribe
+
+	// A burst of mentions wakes the agent once
+	for range 3 {
+		if err := other.MakeDecision(ctx); err != nil {
+			t.Fatalf("Decision failed: %v", err)
+		}
+	}
+	// The agent's own events never trigger it
+	watcher.CreateInitialEvent(ctx)
+	time.Sleep(100 * time.Millisecond)
+	if n := wakeups.Load(); n != 1 {
+		t.Fatalf("Expected 1 wakeup after a burst, got %d", n)
+	}
+
+	// Another mention waits for the minimum interval
+	other.MakeDecision(ctx)
+	time.Sleep(50 * time.Millisecond)
+	if n := wakeups.Load(); n != 1 {
+		t.Errorf("Expected the wakeup to wait for the minimum interval, got %d wakeups", n)
+	}
+	deadline := time.Now().Add(time.Second)
+	for wakeups.Load() < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if n := wakeups.Load(); n != 2 {
+		t.Errorf("Expected a second wakeup after the minimum interval, got %d", n)
+	}
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/yanchenko-igor/blockchain-universe/internal/blockchain"
+)
+
+// checkpointView is the JSON representation of a checkpoint
+type checkpointView struct {
+	Position uint64 `json:"position"`
+	eventView
+}
+
+// handlePending returns the events waiting for cosignatures
+func (s *Server) handlePending(w http.ResponseWriter, r *http.Request) {
+	events := s.blockchain.PendingEvents()
+	views := make([]eventView, 0, len(events))
+	for _, event := range events {
+		views = append(views, s.viewEvent(0, s.blockchain.HashEvent(event), event))
+	}
+	s.writeJSON(w, http.StatusOK, views)
+}
+
+// handleProposeEvent admits a signed event or adds it to the pending pool
+func (s *Server) handleProposeEvent(w http.ResponseWriter, r *http.Request) {
+	var event blockchain.Event
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxEventBody)).Decode(&event); err != nil {
+		s.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid event: %w", err))
+		return
+	}
+
+	admitted, err := s.blockchain.ProposeEvent(&event)
+	if err != nil {
+		s.writeAdmissionError(w, err)
+		return
+	}
+
+	status := http.StatusAccepted
+	if admitted {
+		status = http.StatusCreated
+	}
+	s.writeJSON(w, status, map[string]interface{}{
+		"hash":     s.blockchain.HashEvent(&event),
+		"admitted": admitted,
+	})
+}
+
+// handleCosign adds a cosignature to a pending event.
+// The body is {"pubkey": "<hex>", "signature": "<hex signature over the hash>"}.
+func (s *Server) handleCosign(w http.ResponseWriter, r *http.Request) {
+	var cosig blockchain.Cosignature
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxEventBody)).Decode(&cosig); err != nil {
+		s.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid cosignature: %w", err))
+		return
+	}
+
+	hash := r.PathValue("hash")
+	admitted, err := s.blockchain.Cosign(hash, cosig.PubKey, cosig.Signature)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, map[string]interface{}{
+		"hash":     hash,
+		"admitted": admitted,
+	})
+}
+
+// handleLatestCheckpoint returns the most recently admitted checkpoint
+func (s *Server) handleLatestCheckpoint(w http.ResponseWriter, r *http.Request) {
+	event, position, exists := s.blockchain.LatestCheckpoint()
+	if !exists {
+		s.writeError(w, http.StatusNotFound, fmt.Errorf("no checkpoint admitted"))
+		return
+	}
+	s.writeJSON(w, http.StatusOK, checkpointView{
+		Position:  position,
+		eventView: s.viewEvent(0, s.blockchain.HashEvent(event), event),
+	})
+}
@@ -0,0 +1,225 @@
+package api
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/yanchenko-igor/blockchain-universe/internal/agent"
+)
+
+// decisionHistory is the number of decision records kept for new dashboard clients
+const decisionHistory = 100
+
+//go:embed static
+var staticFiles embed.FS
+
+// decisionFeed keeps recent decision records and fans them and partial LLM
+// output out to listeners
+type decisionFeed struct {
+	mu        sync.Mutex
+	records   []agent.DecisionRecord
+	listeners map[*decisionListener]struct{}
+}
+
+// decisionListener is a dashboard client of the feed. Decision records are
+// queued until they are sent; partial output is coalesced to the latest per
+// agent, as each supersedes the previous one. Fields are guarded by the
+// feed's mu.
+type decisionListener struct {
+	wake     chan struct{} // Signalled when messages are queued
+	records  []agent.DecisionRecord
+	partials map[string]agent.PartialRecord // By agent
+	overflow bool                           // More records queued than the history holds
+}
+
+func newDecisionFeed() *decisionFeed {
+	return &decisionFeed{
+		listeners: make(map[*decisionListener]struct{}),
+	}
+}
+
+// PublishDecision records a decision and forwards it to dashboard clients.
+// It is meant to be registered with agent.Agent.OnDecision.
+func (s *Server) PublishDecision(record agent.DecisionRecord) {
+	f := s.decisions
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.records = append(f.records, record)
+	if len(f.records) > decisionHistory {
+		f.records = f.records[len(f.records)-decisionHistory:]
+	}
+
+	for l := range f.listeners {
+		// The record ends the cycle the agent's partial output belongs to
+		delete(l.partials, record.Agent)
+		l.records = append(l.records, record)
+		l.overflow = l.overflow || len(l.records) > decisionHistory
+		l.signal()
+	}
+}
+
+// PublishPartial forwards the LLM output of a decision cycle in flight to
+// dashboard clients. Partial output is not kept in the history. It is meant
+// to be registered with agent.Agent.OnPartial.
+func (s *Server) PublishPartial(record agent.PartialRecord) {
+	f := s.decisions
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for l := range f.listeners {
+		l.partials[record.Agent] = record
+		l.signal()
+	}
+}
+
+// signal wakes the listener's stream unless it is already woken
+func (l *decisionListener) signal() {
+	select {
+	case l.wake <- struct{}{}:
+	default:
+	}
+}
+
+// listen registers a listener and returns it together with the current history
+func (f *decisionFeed) listen() (*decisionListener, []agent.DecisionRecord) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	l := &decisionListener{wake: make(chan struct{}, 1), partials: make(map[string]agent.PartialRecord)}
+	f.listeners[l] = struct{}{}
+	return l, append([]agent.DecisionRecord(nil), f.records...)
+}
+
+// take returns and clears the messages queued for a listener, partial output
+// ordered by agent. Overflowed listeners get no messages: their clients
+// fell too far behind and must reconnect to replay the history.
+func (f *decisionFeed) take(l *decisionListener) ([]agent.DecisionRecord, []agent.PartialRecord, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if l.overflow {
+		return nil, nil, false
+	}
+	records := l.records
+	l.records = nil
+	partials := make([]agent.PartialRecord, 0, len(l.partials))
+	for _, partial := range l.partials {
+		partials = append(partials, partial)
+	}
+	sort.Slice(partials, func(i, j int) bool { return partials[i].Agent < partials[j].Agent })
+	clear(l.partials)
+	return records, partials, true
+}
+
+// snapshot returns the recent decision records
+func (f *decisionFeed) snapshot() []agent.DecisionRecord {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]agent.DecisionRecord(nil), f.records...)
+}
+
+// unlisten removes a listener
+func (f *decisionFeed) unlisten(l *decisionListener) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	delete(f.listeners, l)
+}
+
+// handleDecisions returns recent decision records
+func (s *Server) handleDecisions(w http.ResponseWriter, r *http.Request) {
+	s.writeJSON(w, http.StatusOK, s.decisions.snapshot())
+}
+
+// handleDecisionStream streams decision records as Server-Sent Events,
+// starting with the recent history. Partial LLM output is sent as partial
+// events. Records are never dropped: a client falling a full history behind
+// is disconnected, and replays the history when it reconnects.
+func (s *Server) handleDecisionStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		s.writeError(w, http.StatusInternalServerError, fmt.Errorf("streaming not supported"))
+		return
+	}
+
+	listener, history := s.decisions.listen()
+	defer s.decisions.unlisten(listener)
+
+	s.writeStreamHeaders(w)
+	for _, record := range history {
+		if err := writeDecision(w, record); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-listener.wake:
+			records, partials, ok := s.decisions.take(listener)
+			if !ok {
+				s.log.Warn("Dashboard client fell behind, closing its decision stream")
+				return
+			}
+			for _, record := range records {
+				if err := writeDecision(w, record); err != nil {
+					return
+				}
+			}
+			for _, partial := range partials {
+				if err := writePartial(w, partial); err != nil {
+					return
+				}
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// writeDecision writes a decision record in SSE wire format
+func writeDecision(w http.ResponseWriter, record agent.DecisionRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal decision: %w", err)
+	}
+	_, err = fmt.Fprintf(w, "data: %s\n\n", data)
+	return err
+}
+
+// writePartial writes partial LLM output as an SSE partial event
+func writePartial(w http.ResponseWriter, record agent.PartialRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal partial output: %w", err)
+	}
+	_, err = fmt.Fprintf(w, "event: partial\ndata: %s\n\n", data)
+	return err
+}
+
+// dashboardHandler serves the embedded single-page dashboard
+func dashboardHandler() http.Handler {
+	root, err := fs.Sub(staticFiles, "static")
+	if err != nil {
+		// The embedded directory is part of the binary; this cannot fail at runtime
+		panic(err)
+	}
+	return http.FileServer(http.FS(root))
+}
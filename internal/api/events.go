@@ -0,0 +1,181 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/yanchenko-igor/blockchain-universe/internal/blockchain"
+)
+
+// eventView is the JSON representation of an event with its metadata
+type eventView struct {
+	Seq            int               `json:"seq,omitempty"`
+	Hash           string            `json:"hash"`
+	Event          *blockchain.Event `json:"event"`
+	SignatureValid bool              `json:"signature_valid"`
+	SignatureError string            `json:"signature_error,omitempty"`
+	Incomplete     bool              `json:"incomplete,omitempty"`     // Valid signatures, but fewer than its policy requires
+	InvalidatedBy  string            `json:"invalidated_by,omitempty"` // Revocation of the author's key effective before the event
+}
+
+// agentView is the JSON representation of a known agent's identity record
+type agentView struct {
+	Identity      string                 `json:"identity"`
+	PubKey        string                 `json:"pubkey"`
+	LastEventHash string                 `json:"last_event_hash"`
+	LastSeen      time.Time              `json:"last_seen"`
+	Revoked       bool                   `json:"revoked"`
+	Equivocated   bool                   `json:"equivocated"`
+	RecoveryKey   string                 `json:"recovery_key,omitempty"`
+	Reputation    blockchain.Reputation  `json:"reputation"`
+	Keys          []blockchain.KeyRecord `json:"keys"`
+}
+
+// handleEvents returns admitted events in admission order. With from (a
+// hash) or after (a seq, 0 for the start), only events admitted after it are
+// returned, and limit caps them to the next ones, so clients can page
+// forward; a bare limit returns the most recent ones.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit := -1
+	if value := query.Get("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 0 {
+			s.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid limit: %q", value))
+			return
+		}
+	}
+
+	var events []blockchain.Notification
+	if value := query.Get("after"); value != "" {
+		if query.Has("from") {
+			s.writeError(w, http.StatusBadRequest, fmt.Errorf("from and after are mutually exclusive"))
+			return
+		}
+		seq, err := strconv.Atoi(value)
+		if err != nil || seq < 0 {
+			s.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid after: %q", value))
+			return
+		}
+		if events, err = s.blockchain.EventsAfter(seq, limit); err != nil {
+			s.writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+	} else {
+		var err error
+		if events, err = s.blockchain.EventsPage(query.Get("from"), limit); err != nil {
+			s.writeError(w, http.StatusNotFound, err)
+			return
+		}
+	}
+
+	views := make([]eventView, 0, len(events))
+	for _, n := range events {
+		views = append(views, s.viewEvent(n.Seq, n.Hash, n.Event))
+	}
+	s.writeJSON(w, http.StatusOK, views)
+}
+
+// handleEvent returns a single event with its signature status
+func (s *Server) handleEvent(w http.ResponseWriter, r *http.Request) {
+	hash := r.PathValue("hash")
+	event, exists := s.blockchain.GetEvent(hash)
+	if !exists {
+		s.writeError(w, http.StatusNotFound, fmt.Errorf("event not found: %s", hash))
+		return
+	}
+	s.writeJSON(w, http.StatusOK, s.viewEvent(0, hash, event))
+}
+
+// maxEventBody limits the size of submitted events
+const maxEventBody = 1 << 20
+
+// handleSubmitEvent admits a signed event submitted by a client
+func (s *Server) handleSubmitEvent(w http.ResponseWriter, r *http.Request) {
+	var event blockchain.Event
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxEventBody)).Decode(&event); err != nil {
+		s.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid event: %w", err))
+		return
+	}
+
+	if err := s.blockchain.AddEvent(&event); err != nil {
+		s.writeAdmissionError(w, err)
+		return
+	}
+
+	s.writeJSON(w, http.StatusCreated, map[string]string{"hash": s.blockchain.HashEvent(&event)})
+}
+
+// admissionStatus maps an admission error to an HTTP status
+func admissionStatus(err error) int {
+	switch {
+	case errors.Is(err, blockchain.ErrDuplicateEvent):
+		return http.StatusConflict
+	case errors.Is(err, blockchain.ErrRateLimited):
+		return http.StatusTooManyRequests
+	case errors.Is(err, blockchain.ErrEventTooLarge):
+		return http.StatusRequestEntityTooLarge
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// writeAdmissionError reports a rejected event; rate limited clients are
+// asked to retry after a second
+func (s *Server) writeAdmissionError(w http.ResponseWriter, err error) {
+	status := admissionStatus(err)
+	if status == http.StatusTooManyRequests {
+		w.Header().Set("Retry-After", "1")
+	}
+	s.writeError(w, status, err)
+}
+
+// handleAdmission returns the admission counters
+func (s *Server) handleAdmission(w http.ResponseWriter, r *http.Request) {
+	s.writeJSON(w, http.StatusOK, s.blockchain.AdmissionStats())
+}
+
+// handleAgents returns all known agents
+func (s *Server) handleAgents(w http.ResponseWriter, r *http.Request) {
+	agents := s.blockchain.GetAgents()
+	views := make([]agentView, 0, len(agents))
+	for _, info := range agents {
+		views = append(views, agentView{
+			Identity:      info.Identity,
+			PubKey:        info.PubKey,
+			LastEventHash: info.LastEventHash,
+			LastSeen:      info.LastSeen,
+			Revoked:       info.Revoked(),
+			Equivocated:   info.Equivocated,
+			RecoveryKey:   info.RecoveryKey,
+			Reputation:    info.Reputation,
+			Keys:          info.Keys,
+		})
+	}
+	s.writeJSON(w, http.StatusOK, views)
+}
+
+// handleEquivocations returns detected equivocations with their proof events
+func (s *Server) handleEquivocations(w http.ResponseWriter, r *http.Request) {
+	s.writeJSON(w, http.StatusOK, s.blockchain.Equivocations())
+}
+
+// viewEvent builds an eventView, re-verifying the signature
+func (s *Server) viewEvent(seq int, hash string, event *blockchain.Event) eventView {
+	view := eventView{Seq: seq, Hash: hash, Event: event, SignatureValid: true}
+	err := s.blockchain.VerifyEvent(event)
+	switch {
+	case errors.Is(err, blockchain.ErrInsufficientSignatures):
+		view.Incomplete = true
+	case err != nil:
+		view.SignatureValid = false
+		view.SignatureError = err.Error()
+	}
+	view.InvalidatedBy, _ = s.blockchain.InvalidatedBy(hash)
+	return view
+}
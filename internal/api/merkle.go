@@ -0,0 +1,79 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// handleMerkleRoot returns the current commitment, or the one at ?size=
+func (s *Server) handleMerkleRoot(w http.ResponseWriter, r *http.Request) {
+	size, err := sizeParam(r, "size")
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if size == 0 {
+		s.writeJSON(w, http.StatusOK, s.blockchain.MerkleRoot())
+		return
+	}
+
+	commitment, err := s.blockchain.MerkleRootAt(size)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, commitment)
+}
+
+// handleInclusionProof returns an inclusion proof for an event, against the
+// current tree or the one at ?size=
+func (s *Server) handleInclusionProof(w http.ResponseWriter, r *http.Request) {
+	size, err := sizeParam(r, "size")
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	proof, err := s.blockchain.InclusionProof(r.PathValue("hash"), size)
+	if err != nil {
+		s.writeError(w, http.StatusNotFound, err)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, proof)
+}
+
+// handleConsistencyProof returns a consistency proof between ?old= and ?new=
+// (default: current size)
+func (s *Server) handleConsistencyProof(w http.ResponseWriter, r *http.Request) {
+	oldSize, err := sizeParam(r, "old")
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	newSize, err := sizeParam(r, "new")
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	proof, err := s.blockchain.ConsistencyProof(oldSize, newSize)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, proof)
+}
+
+// sizeParam parses an optional tree size query parameter
+func sizeParam(r *http.Request, name string) (uint64, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return 0, nil
+	}
+	size, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %q", name, value)
+	}
+	return size, nil
+}
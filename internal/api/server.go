@@ -0,0 +1,123 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/yanchenko-igor/blockchain-universe/internal/blockchain"
+	"github.com/yanchenko-igor/blockchain-universe/internal/config"
+	"github.com/yanchenko-igor/blockchain-universe/pkg/logger"
+	"github.com/yanchenko-igor/blockchain-universe/pkg/metrics"
+)
+
+// Server exposes the blockchain over HTTP
+type Server struct {
+	config     config.HTTPConfig
+	blockchain *blockchain.Blockchain
+	mux        *http.ServeMux
+	decisions  *decisionFeed
+	metrics    *metrics.Registry
+	log        logger.Logger
+}
+
+// New creates a new HTTP API server
+func New(cfg config.HTTPConfig, bc *blockchain.Blockchain, log logger.Logger) *Server {
+	s := &Server{
+		config:     cfg,
+		blockchain: bc,
+		mux:        http.NewServeMux(),
+		decisions:  newDecisionFeed(),
+		log:        log,
+	}
+	s.routes()
+	return s
+}
+
+// routes registers all HTTP handlers
+func (s *Server) routes() {
+	s.mux.HandleFunc("GET /events/stream", s.handleStream)
+	s.mux.HandleFunc("GET /api/events", s.handleEvents)
+	s.mux.HandleFunc("POST /api/events", s.handleSubmitEvent)
+	s.mux.HandleFunc("GET /api/events/{hash}", s.handleEvent)
+	s.mux.HandleFunc("GET /api/agents", s.handleAgents)
+	s.mux.HandleFunc("GET /api/equivocations", s.handleEquivocations)
+	s.mux.HandleFunc("GET /api/admission", s.handleAdmission)
+	s.mux.HandleFunc("GET /api/merkle/root", s.handleMerkleRoot)
+	s.mux.HandleFunc("GET /api/merkle/inclusion/{hash}", s.handleInclusionProof)
+	s.mux.HandleFunc("GET /api/merkle/consistency", s.handleConsistencyProof)
+	s.mux.HandleFunc("GET /api/pending", s.handlePending)
+	s.mux.HandleFunc("POST /api/pending", s.handleProposeEvent)
+	s.mux.HandleFunc("POST /api/pending/{hash}/cosign", s.handleCosign)
+	s.mux.HandleFunc("GET /api/checkpoints/latest", s.handleLatestCheckpoint)
+	s.mux.HandleFunc("GET /api/decisions", s.handleDecisions)
+	s.mux.HandleFunc("GET /api/decisions/stream", s.handleDecisionStream)
+	s.mux.HandleFunc("GET /metrics", s.handleMetrics)
+	s.mux.Handle("GET /", dashboardHandler())
+}
+
+// SetMetrics exposes reg on /metrics. It must be called before Start.
+func (s *Server) SetMetrics(reg *metrics.Registry) {
+	s.metrics = reg
+}
+
+// handleMetrics serves metrics in the Prometheus text format
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if s.metrics == nil {
+		s.writeError(w, http.StatusNotFound, fmt.Errorf("metrics are not enabled"))
+		return
+	}
+	s.metrics.ServeHTTP(w, r)
+}
+
+// Handler returns the HTTP handler serving the API
+func (s *Server) Handler() http.Handler {
+	return s.mux
+}
+
+// Start serves the API until the context is cancelled
+func (s *Server) Start(ctx context.Context) error {
+	srv := &http.Server{
+		Addr:              s.config.ListenAddr,
+		Handler:           s.mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		s.log.Info("HTTP API listening", "addr", s.config.ListenAddr)
+		errCh <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		return fmt.Errorf("failed to serve HTTP API: %w", err)
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			return fmt.Errorf("failed to shut down HTTP API: %w", err)
+		}
+		return nil
+	}
+}
+
+// writeJSON writes v as a JSON response
+func (s *Server) writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		s.log.Warn("Failed to write response", "error", err)
+	}
+}
+
+// writeError writes an error as a JSON response
+func (s *Server) writeError(w http.ResponseWriter, status int, err error) {
+	s.writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,229 @@
+package api
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yanchenko-igor/blockchain-universe/internal/agent"
+	"github.com/yanchenko-igor/blockchain-universe/internal/blockchain"
+	"github.com/yanchenko-igor/blockchain-universe/internal/config"
+	"github.com/yanchenko-igor/blockchain-universe/pkg/logger"
+	"github.com/yanchenko-igor/blockchain-universe/pkg/metrics"
+)
+
+func newTestServer(t *testing.T) (*Server, *blockchain.Blockchain, string) {
+	log := logger.New("error")
+	bc := blockchain.New(log)
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+
+	event, _ := bc.CreateEvent("test_event", "Test event description", map[string]string{}, []string{}, pub, priv)
+	if err := bc.AddEvent(event); err != nil {
+		t.Fatalf("Failed to add event: %v", err)
+	}
+
+	return New(config.HTTPConfig{StreamBuffer: 16}, bc, log), bc, bc.HashEvent(event)
+}
+
+func TestEventEndpoints(t *testing.T) {
+	server, _, hash := newTestServer(t)
+
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/api/events/"+hash, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+
+	var view eventView
+	if err := json.NewDecoder(rec.Body).Decode(&view); err != nil {
+		t.Fatalf("Failed to decode event: %v", err)
+	}
+	if view.Hash != hash || !view.SignatureValid {
+		t.Errorf("Unexpected event view: %+v", view)
+	}
+
+	rec = httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/api/events/unknown", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", rec.Code)
+	}
+}
+
+func TestEventStream(t *testing.T) {
+	server, bc, root := newTestServer(t)
+	srv := httptest.NewServer(server.Handler())
+	defer srv.Close()
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	otherPub, otherPriv, _ := ed25519.GenerateKey(rand.Reader)
+
+	child, _ := bc.CreateEvent("test_event", "Child", map[string]string{}, []string{root}, pub, priv)
+	if err := bc.AddEvent(child); err != nil {
+		t.Fatalf("Failed to add event: %v", err)
+	}
+
+	resp, err := http.Get(srv.URL + "/events/stream?type=test_event&ancestor=" + root + "&from=" + root)
+	if err != nil {
+		t.Fatalf("Failed to open stream: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("Unexpected stream response %d %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	ids := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			if id, ok := strings.CutPrefix(scanner.Text(), "id: "); ok {
+				ids <- id
+			}
+		}
+		close(ids)
+	}()
+	next := func() string {
+		select {
+		case id := <-ids:
+			return id
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for a streamed event")
+			return ""
+		}
+	}
+
+	if id := next(); id != bc.HashEvent(child) {
+		t.Fatalf("Expected the backlog to replay the child, got %s", id)
+	}
+
+	unrelated, _ := bc.CreateEvent("test_event", "Unrelated", map[string]string{}, []string{}, otherPub, otherPriv)
+	bc.AddEvent(unrelated)
+	other, _ := bc.CreateEvent("other_event", "Filtered by type", map[string]string{}, []string{bc.HashEvent(child)}, pub, priv)
+	bc.AddEvent(other)
+	grandchild, _ := bc.CreateEvent("test_event", "Grandchild", map[string]string{}, []string{bc.HashEvent(other)}, pub, priv)
+	if err := bc.AddEvent(grandchild); err != nil {
+		t.Fatalf("Failed to add event: %v", err)
+	}
+	if id := next(); id != bc.HashEvent(grandchild) {
+		t.Errorf("Expected only the grandchild to be streamed live, got %s", id)
+	}
+}
+
+func TestDecisionFeedKeepsEveryRecord(t *testing.T) {
+	server, _, _ := newTestServer(t)
+	feed := server.decisions
+	listener, _ := feed.listen()
+	defer feed.unlisten(listener)
+
+	// Partial output floods in while the client is not reading
+	for i := range 50 {
+		server.PublishPartial(agent.PartialRecord{Agent: "a", Text: strings.Repeat("x", i+1)})
+		server.PublishPartial(agent.PartialRecord{Agent: "b", Text: "y"})
+		if i%5 == 0 {
+			server.PublishDecision(agent.DecisionRecord{Agent: "b", Response: "done"})
+		}
+	}
+	records, partials, ok := feed.take(listener)
+	if !ok || len(records) != 10 {
+		t.Fatalf("Expected all 10 decision records, got %d, %v", len(records), ok)
+	}
+	if len(partials) != 2 || partials[0].Agent != "a" || len(partials[0].Text) != 50 {
+		t.Errorf("Expected the latest partial output per agent, got %+v", partials)
+	}
+
+	// A client falling a full history behind must reconnect
+	for range decisionHistory + 1 {
+		server.PublishDecision(agent.DecisionRecord{Agent: "a"})
+	}
+	if _, _, ok := feed.take(listener); ok {
+		t.Error("A listener a full history behind should be closed")
+	}
+}
+
+func TestDashboardIsEmbedded(t *testing.T) {
+	server, _, _ := newTestServer(t)
+
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), "Blockchain Universe") {
+		t.Error("Dashboard page should be served")
+	}
+	if strings.Contains(rec.Body.String(), "https://") {
+		t.Error("Dashboard must not load remote assets")
+	}
+}
+
+func TestCheckpointEndpoints(t *testing.T) {
+	server, bc, _ := newTestServer(t)
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	otherPub, otherPriv, _ := ed25519.GenerateKey(rand.Reader)
+
+	event, _ := bc.CreateEvent("test_event", "Second agent", map[string]string{}, []string{}, otherPub, otherPriv)
+	bc.AddEvent(event)
+	event, _ = bc.CreateEvent("test_event", "Third agent", map[string]string{}, []string{}, pub, priv)
+	bc.AddEvent(event)
+
+	checkpoint, _ := bc.NewCheckpoint(pub, priv)
+	body, _ := json.Marshal(checkpoint)
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest("POST", "/api/pending", strings.NewReader(string(body))))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("Expected status 202 for a pending checkpoint, got %d: %s", rec.Code, rec.Body)
+	}
+
+	hash := bc.HashEvent(checkpoint)
+	cosig, _ := json.Marshal(blockchain.Cosignature{
+		PubKey:    hex.EncodeToString(otherPub),
+		Signature: blockchain.SignHash(hash, otherPriv),
+	})
+	rec = httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest("POST", "/api/pending/"+hash+"/cosign", strings.NewReader(string(cosig))))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"admitted":true`) {
+		t.Fatalf("Expected the cosigned checkpoint to be admitted, got %d: %s", rec.Code, rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/api/checkpoints/latest", nil))
+	var view checkpointView
+	if err := json.NewDecoder(rec.Body).Decode(&view); err != nil {
+		t.Fatalf("Failed to decode checkpoint: %v", err)
+	}
+	if view.Hash != hash || view.Position != 3 || !view.SignatureValid {
+		t.Errorf("Unexpected checkpoint view: %+v", view)
+	}
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	server, bc, hash := newTestServer(t)
+	reg := metrics.NewRegistry()
+	bc.SetMetrics(reg)
+	server.SetMetrics(reg)
+
+	event, _ := bc.GetEvent(hash)
+	bc.AddEvent(event)
+
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+	body := rec.Body.String()
+	for _, line := range []string{
+		"bu_events 1\n",
+		"bu_agents 1\n",
+		`bu_events_rejected_total{reason="duplicate"} 1` + "\n",
+		"bu_event_verification_seconds_count 1\n",
+	} {
+		if !strings.Contains(body, line) {
+			t.Errorf("Missing %q in metrics:\n%s", line, body)
+		}
+	}
+}
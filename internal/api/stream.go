@@ -0,0 +1,139 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/yanchenko-igor/blockchain-universe/internal/blockchain"
+)
+
+// heartbeatInterval keeps idle SSE connections open through proxies
+const heartbeatInterval = 15 * time.Second
+
+// streamEvent is the JSON payload of each SSE message
+type streamEvent struct {
+	Seq   int               `json:"seq"`
+	Hash  string            `json:"hash"`
+	Event *blockchain.Event `json:"event"`
+}
+
+// handleStream streams admitted events as Server-Sent Events.
+//
+// Query parameters:
+//   - type:     comma-separated event types
+//   - author:   comma-separated author public keys
+//   - ancestor: only events descending from this hash
+//   - from:     resume after this hash (the Last-Event-ID header takes precedence)
+func (s *Server) handleStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		s.writeError(w, http.StatusInternalServerError, fmt.Errorf("streaming not supported"))
+		return
+	}
+
+	query := r.URL.Query()
+	filter := blockchain.SubscriptionFilter{
+		Types:    splitList(query.Get("type")),
+		Authors:  splitList(query.Get("author")),
+		Ancestor: query.Get("ancestor"),
+	}
+
+	from := query.Get("from")
+	if id := r.Header.Get("Last-Event-ID"); id != "" {
+		from = id
+	}
+
+	// Subscribe before reading history so nothing admitted in between is lost
+	sub := s.blockchain.Subscribe(blockchain.SubscribeOptions{
+		Filter: filter,
+		Buffer: s.config.StreamBuffer,
+		Policy: blockchain.Disconnect,
+	})
+	defer sub.Close()
+
+	lastSeq := 0
+	if from != "" {
+		backlog, err := s.blockchain.EventsSince(from)
+		if err != nil {
+			s.writeError(w, http.StatusNotFound, err)
+			return
+		}
+
+		s.writeStreamHeaders(w)
+		for _, n := range backlog {
+			if !sub.Matches(n) {
+				continue
+			}
+			if err := writeSSE(w, n); err != nil {
+				return
+			}
+			lastSeq = n.Seq
+		}
+	} else {
+		s.writeStreamHeaders(w)
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case n, ok := <-sub.C():
+			if !ok {
+				s.log.Warn("Event stream client too slow, disconnected", "remote", r.RemoteAddr)
+				return
+			}
+			if n.Seq <= lastSeq {
+				continue
+			}
+			if err := writeSSE(w, n); err != nil {
+				return
+			}
+			lastSeq = n.Seq
+			flusher.Flush()
+		}
+	}
+}
+
+// writeStreamHeaders sends the SSE response headers
+func (s *Server) writeStreamHeaders(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+}
+
+// writeSSE writes a single notification in SSE wire format
+func writeSSE(w http.ResponseWriter, n blockchain.Notification) error {
+	data, err := json.Marshal(streamEvent{Seq: n.Seq, Hash: n.Hash, Event: n.Event})
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+	_, err = fmt.Fprintf(w, "id: %s\ndata: %s\n\n", n.Hash, data)
+	return err
+}
+
+// splitList parses a comma-separated query value
+func splitList(value string) []string {
+	if value == "" {
+		return nil
+	}
+	var result []string
+	for _, part := range strings.Split(value, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			result = append(result, part)
+		}
+	}
+	return result
+}
@@ -0,0 +1,225 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrRateLimited is returned when an author or the node as a whole submits
+// events faster than the admission policy allows
+var ErrRateLimited = errors.New("rate limit exceeded")
+
+// ErrEventTooLarge is returned for events exceeding the admission size limits
+var ErrEventTooLarge = errors.New("event exceeds admission limits")
+
+// Admission rejection reasons, as reported in AdmissionStats
+const (
+	RejectAuthorRate  = "author_rate"
+	RejectGlobalRate  = "global_rate"
+	RejectParents     = "parents"
+	RejectDescription = "description"
+	RejectPayloadKeys = "payload_keys"
+	RejectPayloadSize = "payload_size"
+)
+
+// maxTrackedAuthors bounds the number of idle author buckets kept in memory
+const maxTrackedAuthors = 10000
+
+// AdmissionPolicy limits what AddEvent and ProposeEvent accept. Zero fields
+// are unlimited.
+type AdmissionPolicy struct {
+	MaxParents      int     // Parent links per event
+	MaxDescription  int     // Description length in bytes
+	MaxPayloadKeys  int     // Payload entries per event
+	MaxPayloadBytes int     // Total size of payload keys and values
+	AuthorRate      float64 // Sustained events per second per author
+	AuthorBurst     int     // Events an idle author may submit at once
+	GlobalRate      float64 // Sustained events per second across all authors
+	GlobalBurst     int     // Events the node accepts at once
+}
+
+// AdmissionStats counts admission decisions
+type AdmissionStats struct {
+	Admitted uint64            `json:"admitted"`
+	Rejected map[string]uint64 `json:"rejected"` // By reason
+}
+
+// tokenBucket refills at a fixed rate up to its burst size
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// refill adds the tokens accrued since the last refill
+func (b *tokenBucket) refill(now time.Time, rate float64, burst int) {
+	if b.last.IsZero() {
+		b.tokens = float64(burst)
+	} else {
+		b.tokens = min(float64(burst), b.tokens+now.Sub(b.last).Seconds()*rate)
+	}
+	b.last = now
+}
+
+// admissionController enforces an AdmissionPolicy
+type admissionController struct {
+	policy  AdmissionPolicy
+	global  tokenBucket
+	authors map[string]*tokenBucket
+	stats   AdmissionStats
+	now     func() time.Time
+	mu      sync.Mutex
+}
+
+func newAdmissionController(policy AdmissionPolicy) *admissionController {
+	return &admissionController{
+		policy:  policy,
+		authors: make(map[string]*tokenBucket),
+		stats:   AdmissionStats{Rejected: make(map[string]uint64)},
+		now:     time.Now,
+	}
+}
+
+// SetAdmissionPolicy replaces the admission policy and resets rate limits
+func (bc *Blockchain) SetAdmissionPolicy(policy AdmissionPolicy) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	ac := newAdmissionController(policy)
+	if bc.admission != nil {
+		ac.stats = bc.admission.snapshot()
+	}
+	bc.admission = ac
+}
+
+// AdmissionStats returns the admission counters
+func (bc *Blockchain) AdmissionStats() AdmissionStats {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	if bc.admission == nil {
+		return AdmissionStats{Rejected: make(map[string]uint64)}
+	}
+	return bc.admission.snapshot()
+}
+
+// checkSize applies the size limits, which need no signature verification
+func (ac *admissionController) checkSize(event *Event) error {
+	p := ac.policy
+	switch {
+	case p.MaxParents > 0 && len(event.Parents) > p.MaxParents:
+		return ac.reject(RejectParents, fmt.Errorf("%w: %d parents, at most %d allowed", ErrEventTooLarge, len(event.Parents), p.MaxParents))
+	case p.MaxDescription > 0 && len(event.Data.Description) > p.MaxDescription:
+		return ac.reject(RejectDescription, fmt.Errorf("%w: description of %d bytes, at most %d allowed", ErrEventTooLarge, len(event.Data.Description), p.MaxDescription))
+	case p.MaxPayloadKeys > 0 && len(event.Data.Payload) > p.MaxPayloadKeys:
+		return ac.reject(RejectPayloadKeys, fmt.Errorf("%w: %d payload keys, at most %d allowed", ErrEventTooLarge, len(event.Data.Payload), p.MaxPayloadKeys))
+	}
+
+	// Checkpoint payloads grow with the number of agents and proofs embed
+	// two events; both are checked in full, so they cannot carry spam
+	if p.MaxPayloadBytes > 0 && event.Data.Type != TypeCheckpoint && event.Data.Type != TypeEquivocationProof {
+		size := 0
+		for k, v := range event.Data.Payload {
+			size += len(k) + len(v)
+		}
+		if size > p.MaxPayloadBytes {
+			return ac.reject(RejectPayloadSize, fmt.Errorf("%w: payload of %d bytes, at most %d allowed", ErrEventTooLarge, size, p.MaxPayloadBytes))
+		}
+	}
+	return nil
+}
+
+// takeToken consumes one token from the author's and the global bucket, or
+// none if either is empty. The author must already be authenticated, so
+// forged events cannot drain another agent's bucket.
+func (ac *admissionController) takeToken(author string) error {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+
+	now := ac.now()
+	p := ac.policy
+
+	var bucket *tokenBucket
+	if p.AuthorRate > 0 {
+		bucket = ac.authors[author]
+		if bucket == nil {
+			ac.evictIdle(now)
+			bucket = &tokenBucket{}
+			ac.authors[author] = bucket
+		}
+		bucket.refill(now, p.AuthorRate, max(p.AuthorBurst, 1))
+		if bucket.tokens < 1 {
+			return ac.rejectLocked(RejectAuthorRate, fmt.Errorf("%w for author %s", ErrRateLimited, author))
+		}
+	}
+	if p.GlobalRate > 0 {
+		ac.global.refill(now, p.GlobalRate, max(p.GlobalBurst, 1))
+		if ac.global.tokens < 1 {
+			return ac.rejectLocked(RejectGlobalRate, fmt.Errorf("%w: node is at capacity", ErrRateLimited))
+		}
+		ac.global.tokens--
+	}
+	if bucket != nil {
+		bucket.tokens--
+	}
+	return nil
+}
+
+// evictIdle drops buckets that have refilled completely once too many
+// authors are tracked; ac.mu must be held
+func (ac *admissionController) evictIdle(now time.Time) {
+	if len(ac.authors) < maxTrackedAuthors {
+		return
+	}
+	full := time.Duration(float64(max(ac.policy.AuthorBurst, 1)) / ac.policy.AuthorRate * float64(time.Second))
+	for author, bucket := range ac.authors {
+		if now.Sub(bucket.last) >= full {
+			delete(ac.authors, author)
+		}
+	}
+}
+
+// admitted records an admitted event
+func (ac *admissionController) admitted() {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+
+	ac.stats.Admitted++
+}
+
+// reject records a rejection and returns err
+func (ac *admissionController) reject(reason string, err error) error {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+
+	return ac.rejectLocked(reason, err)
+}
+
+// rejectLocked is reject with ac.mu held
+func (ac *admissionController) rejectLocked(reason string, err error) error {
+	ac.stats.Rejected[reason]++
+	return &rejection{reason: reason, err: err}
+}
+
+// rejection is an admission error tagged with its reason
+type rejection struct {
+	reason string
+	err    error
+}
+
+func (r *rejection) Error() string { return r.err.Error() }
+
+func (r *rejection) Unwrap() error { return r.err }
+
+// snapshot returns a copy of the counters
+func (ac *admissionController) snapshot() AdmissionStats {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+
+	stats := AdmissionStats{Admitted: ac.stats.Admitted, Rejected: make(map[string]uint64, len(ac.stats.Rejected))}
+	for reason, count := range ac.stats.Rejected {
+		stats.Rejected[reason] = count
+	}
+	return stats
+}
@@ -0,0 +1,441 @@
+package blockchain
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/yanchenko-igor/blockchain-universe/internal/merkle"
+)
+
+// ArchiveVersion is the current archive format version
+const ArchiveVersion = 1
+
+// maxArchiveLine bounds the size of a single archive record
+const maxArchiveLine = 16 * 1024 * 1024
+
+// An archive is a gzip-compressed stream of JSON lines. Each line is an object
+// with a "kind" field:
+//
+//	{"kind":"header","version":1,"created":"<RFC3339>"}
+//	{"kind":"event","event":{...}}            one per event, in topological order
+//	{"kind":"manifest","events":N,"agents":M,"tips":["<hash>",...],"merkle_root":"<hex>"}
+//
+// The manifest comes last so archives can be written in a single pass. Its
+// Merkle root commits to the event hashes in archive order.
+
+// Manifest summarizes the contents of an archive
+type Manifest struct {
+	Events     int      `json:"events"`
+	Agents     int      `json:"agents"`
+	Tips       []string `json:"tips"`
+	MerkleRoot string   `json:"merkle_root"`
+}
+
+// archiveRecord is a single line of an archive
+type archiveRecord struct {
+	Kind    string `json:"kind"`
+	Version int    `json:"version,omitempty"`
+	Created string `json:"created,omitempty"`
+	Event   *Event `json:"event,omitempty"`
+	*Manifest
+}
+
+// ArchiveError reports where in an archive a failure occurred
+type ArchiveError struct {
+	Line  int    // Line in the uncompressed stream, starting at 1
+	Event int    // Event number, starting at 1 (0 if not at an event)
+	Hash  string // Hash of the offending event, if any
+	Err   error
+}
+
+func (e *ArchiveError) Error() string {
+	switch {
+	case e.Hash != "":
+		return fmt.Sprintf("archive line %d (event %d, hash %s): %v", e.Line, e.Event, e.Hash, e.Err)
+	case e.Event > 0:
+		return fmt.Sprintf("archive line %d (event %d): %v", e.Line, e.Event, e.Err)
+	default:
+		return fmt.Sprintf("archive line %d: %v", e.Line, e.Err)
+	}
+}
+
+func (e *ArchiveError) Unwrap() error {
+	return e.Err
+}
+
+// archiveStats accumulates the manifest of an event stream in bounded memory
+type archiveStats struct {
+	events int
+	agents map[string]struct{}
+	tips   map[string]struct{}
+	tree   merkle.Builder
+}
+
+func newArchiveStats() *archiveStats {
+	return &archiveStats{
+		agents: make(map[string]struct{}),
+		tips:   make(map[string]struct{}),
+	}
+}
+
+// add records an event with its hash
+func (s *archiveStats) add(hash string, event *Event) {
+	s.events++
+	s.agents[event.AuthorPubKey] = struct{}{}
+	for _, parent := range event.Parents {
+		delete(s.tips, parent)
+	}
+	s.tips[hash] = struct{}{}
+
+	leaf, _ := hex.DecodeString(hash)
+	s.tree.Append(leaf)
+}
+
+// manifest returns the manifest for the events recorded so far
+func (s *archiveStats) manifest() *Manifest {
+	tips := make([]string, 0, len(s.tips))
+	for tip := range s.tips {
+		tips = append(tips, tip)
+	}
+	sort.Strings(tips)
+
+	return &Manifest{
+		Events:     s.events,
+		Agents:     len(s.agents),
+		Tips:       tips,
+		MerkleRoot: s.tree.Root().String(),
+	}
+}
+
+// ArchiveWriter writes an archive
+type ArchiveWriter struct {
+	gz    *gzip.Writer
+	enc   *json.Encoder
+	stats *archiveStats
+}
+
+// NewArchiveWriter starts an archive on w
+func NewArchiveWriter(w io.Writer) (*ArchiveWriter, error) {
+	gz := gzip.NewWriter(w)
+	aw := &ArchiveWriter{
+		gz:    gz,
+		enc:   json.NewEncoder(gz),
+		stats: newArchiveStats(),
+	}
+
+	header := archiveRecord{
+		Kind:    "header",
+		Version: ArchiveVersion,
+		Created: time.Now().UTC().Format(time.RFC3339),
+	}
+	if err := aw.enc.Encode(header); err != nil {
+		return nil, fmt.Errorf("failed to write archive header: %w", err)
+	}
+	return aw, nil
+}
+
+// Write appends an event. Events must be written in topological order.
+func (aw *ArchiveWriter) Write(event *Event) error {
+	if err := aw.enc.Encode(archiveRecord{Kind: "event", Event: event}); err != nil {
+		return fmt.Errorf("failed to write event: %w", err)
+	}
+	aw.stats.add(Hash(event), event)
+	return nil
+}
+
+// Close writes the manifest and flushes the archive. It does not close the
+// underlying writer.
+func (aw *ArchiveWriter) Close() (*Manifest, error) {
+	manifest := aw.stats.manifest()
+	if err := aw.enc.Encode(archiveRecord{Kind: "manifest", Manifest: manifest}); err != nil {
+		return nil, fmt.Errorf("failed to write manifest: %w", err)
+	}
+	if err := aw.gz.Close(); err != nil {
+		return nil, fmt.Errorf("failed to flush archive: %w", err)
+	}
+	return manifest, nil
+}
+
+// ArchiveReader reads an archive one event at a time and checks the manifest
+// against the events actually read
+type ArchiveReader struct {
+	scanner  *bufio.Scanner
+	line     int
+	stats    *archiveStats
+	manifest *Manifest
+}
+
+// NewArchiveReader opens an archive and reads its header
+func NewArchiveReader(r io.Reader) (*ArchiveReader, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open archive: %w", err)
+	}
+
+	scanner := bufio.NewScanner(gz)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxArchiveLine)
+	ar := &ArchiveReader{scanner: scanner, stats: newArchiveStats()}
+
+	record, err := ar.next()
+	if err != nil {
+		return nil, err
+	}
+	if record.Kind != "header" {
+		return nil, ar.errorf("expected archive header, got %q", record.Kind)
+	}
+	if record.Version != ArchiveVersion {
+		return nil, ar.errorf("unsupported archive version %d", record.Version)
+	}
+	return ar, nil
+}
+
+// Next returns the next event. After the last event it verifies the manifest
+// and returns io.EOF.
+func (ar *ArchiveReader) Next() (*Event, error) {
+	if ar.manifest != nil {
+		return nil, io.EOF
+	}
+
+	record, err := ar.next()
+	if err != nil {
+		return nil, err
+	}
+
+	switch record.Kind {
+	case "event":
+		if record.Event == nil {
+			return nil, ar.errorf("event record without event")
+		}
+		ar.stats.add(Hash(record.Event), record.Event)
+		return record.Event, nil
+	case "manifest":
+		if record.Manifest == nil {
+			return nil, ar.errorf("empty manifest")
+		}
+		if err := ar.checkManifest(record.Manifest); err != nil {
+			return nil, err
+		}
+		if ar.scanner.Scan() {
+			return nil, &ArchiveError{Line: ar.line + 1, Err: errors.New("data after manifest")}
+		}
+		ar.manifest = record.Manifest
+		return nil, io.EOF
+	default:
+		return nil, ar.errorf("unexpected record kind %q", record.Kind)
+	}
+}
+
+// Line returns the current line number, for error reporting
+func (ar *ArchiveReader) Line() int {
+	return ar.line
+}
+
+// Manifest returns the verified manifest once Next has returned io.EOF
+func (ar *ArchiveReader) Manifest() *Manifest {
+	return ar.manifest
+}
+
+// next decodes the next line
+func (ar *ArchiveReader) next() (*archiveRecord, error) {
+	if !ar.scanner.Scan() {
+		if err := ar.scanner.Err(); err != nil {
+			return nil, &ArchiveError{Line: ar.line + 1, Err: fmt.Errorf("failed to read archive: %w", err)}
+		}
+		return nil, &ArchiveError{Line: ar.line + 1, Err: errors.New("unexpected end of archive, manifest missing")}
+	}
+	ar.line++
+
+	var record archiveRecord
+	if err := json.Unmarshal(ar.scanner.Bytes(), &record); err != nil {
+		return nil, ar.errorf("invalid record: %v", err)
+	}
+	return &record, nil
+}
+
+// checkManifest compares a manifest with the events read
+func (ar *ArchiveReader) checkManifest(m *Manifest) error {
+	actual := ar.stats.manifest()
+	if m.Events != actual.Events {
+		return ar.errorf("manifest lists %d events, archive contains %d", m.Events, actual.Events)
+	}
+	if m.Agents != actual.Agents {
+		return ar.errorf("manifest lists %d agents, archive contains %d", m.Agents, actual.Agents)
+	}
+	tips := append([]string(nil), m.Tips...)
+	sort.Strings(tips)
+	if fmt.Sprint(tips) != fmt.Sprint(actual.Tips) {
+		return ar.errorf("manifest tips do not match archive")
+	}
+	if m.MerkleRoot != actual.MerkleRoot {
+		return ar.errorf("manifest Merkle root %s does not match archive root %s", m.MerkleRoot, actual.MerkleRoot)
+	}
+	return nil
+}
+
+func (ar *ArchiveReader) errorf(format string, args ...interface{}) error {
+	return &ArchiveError{Line: ar.line, Err: fmt.Errorf(format, args...)}
+}
+
+// Export writes all events in admission order, which is topological, as an
+// archive. Events admitted while the export runs are not included.
+func (bc *Blockchain) Export(w io.Writer) (*Manifest, error) {
+	aw, err := NewArchiveWriter(w)
+	if err != nil {
+		return nil, err
+	}
+
+	// Read the history in batches so admission is not blocked for the whole export
+	const batchSize = 1024
+	total := bc.Len()
+	for start := 0; start < total; start += batchSize {
+		end := min(start+batchSize, total)
+		events, err := bc.eventsByIndex(start, end)
+		if err != nil {
+			return nil, err
+		}
+		for _, event := range events {
+			if err := aw.Write(event); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return aw.Close()
+}
+
+// ExportFromCheckpoint writes the latest checkpoint followed by every event
+// admitted after the position it commits to. Importing such an archive into an
+// empty blockchain bootstraps it from the checkpoint.
+func (bc *Blockchain) ExportFromCheckpoint(w io.Writer) (*Manifest, error) {
+	checkpoint, position, exists := bc.LatestCheckpoint()
+	if !exists {
+		return nil, fmt.Errorf("no checkpoint to export from")
+	}
+	checkpointHash := Hash(checkpoint)
+
+	aw, err := NewArchiveWriter(w)
+	if err != nil {
+		return nil, err
+	}
+	if err := aw.Write(checkpoint); err != nil {
+		return nil, err
+	}
+
+	bc.mu.RLock()
+	start := int(position - bc.checkpoints.base)
+	bc.mu.RUnlock()
+
+	const batchSize = 1024
+	total := bc.Len()
+	for ; start < total; start += batchSize {
+		end := min(start+batchSize, total)
+		events, err := bc.eventsByIndex(start, end)
+		if err != nil {
+			return nil, err
+		}
+		for _, event := range events {
+			if Hash(event) == checkpointHash {
+				continue
+			}
+			if err := aw.Write(event); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return aw.Close()
+}
+
+// importPruneInterval is how many events Import admits between moving event
+// bodies to the cold archive, if pruning is enabled
+const importPruneInterval = 10000
+
+// Import admits every event of an archive with the same checks as AddEvent,
+// except for the admission policy's limits. It stops at the first failure and reports its
+// location as an *ArchiveError. If the blockchain is empty and the archive
+// starts with a checkpoint, the blockchain is bootstrapped from it.
+//
+// Events are admitted as they are read, while the manifest is only checked at
+// the end of the archive: when Import fails, the events before the failure,
+// including those of a tampered archive, are already in the blockchain, which
+// should be discarded. With pruning enabled, bodies are pruned as the archive
+// is read, so memory stays bounded; imported events count as old for the
+// policy's KeepDuration, since they were admitted elsewhere before.
+func (bc *Blockchain) Import(r io.Reader) (*Manifest, error) {
+	ar, err := NewArchiveReader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	for count := 1; ; count++ {
+		if count%importPruneInterval == 0 {
+			if err := bc.pruneImported(); err != nil {
+				return nil, err
+			}
+		}
+
+		event, err := ar.Next()
+		if errors.Is(err, io.EOF) {
+			if err := bc.pruneImported(); err != nil {
+				return nil, err
+			}
+			return ar.Manifest(), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if count == 1 && event.Data.Type == TypeCheckpoint && bc.Len() == 0 {
+			if err := bc.Bootstrap(event); err != nil {
+				return nil, &ArchiveError{Line: ar.Line(), Event: count, Hash: Hash(event), Err: err}
+			}
+			continue
+		}
+
+		if err := bc.importEvent(event); err != nil {
+			return nil, &ArchiveError{Line: ar.Line(), Event: count, Hash: Hash(event), Err: err}
+		}
+	}
+}
+
+// importEvent admits a trusted event, bypassing the admission policy
+func (bc *Blockchain) importEvent(event *Event) error {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	return bc.addComplete(event, false)
+}
+
+// pruneImported prunes the bodies of imported events regardless of their
+// admission time
+func (bc *Blockchain) pruneImported() error {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	_, err := bc.pruneBodies(false)
+	return err
+}
+
+// eventsByIndex returns the events at admission positions [start, end),
+// reloading pruned ones from the cold archive
+func (bc *Blockchain) eventsByIndex(start, end int) ([]*Event, error) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	events := make([]*Event, 0, end-start)
+	for _, hash := range bc.order[start:end] {
+		event, err := bc.event(hash)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
@@ -5,10 +5,12 @@ import (
 	"crypto/sha3"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
 
+	"github.com/yanchenko-igor/blockchain-universe/internal/merkle"
 	"github.com/yanchenko-igor/blockchain-universe/pkg/logger"
 )
 
@@ -19,36 +21,120 @@ type Event struct {
 		Description string            `json:"description"`
 		Payload     map[string]string `json:"payload"`
 		Timestamp   string            `json:"timestamp"`
+		Policy      *SignaturePolicy  `json:"policy,omitempty"`
 	} `json:"data"`
-	Parents      []string `json:"parents"`
-	Signature    string   `json:"signature"`
-	AuthorPubKey string   `json:"author_pubkey"`
+	Parents      []string      `json:"parents"`
+	Signature    string        `json:"signature"`
+	AuthorPubKey string        `json:"author_pubkey"`
+	Cosignatures []Cosignature `json:"cosignatures,omitempty"`
+	HashFormat   int           `json:"hash_format,omitempty"`
 }
 
-// AgentInfo stores information about known agents
+// Hash formats of events. An event records the format its hash, and so its
+// signatures, were computed in; the zero value is the current format.
+const (
+	HashDataAndParents = 0 // The data and parent links
+	HashDataOnly       = 1 // Only the data, as events were signed before parent links were covered
+)
+
+// Cosignature is an additional signature over the event hash by another agent.
+// Cosignatures are not part of the hash, so they can be collected after the
+// event was created.
+type Cosignature struct {
+	PubKey    string `json:"pubkey"`
+	Signature string `json:"signature"`
+}
+
+// ErrDuplicateEvent is returned when an event with the same hash was already admitted
+var ErrDuplicateEvent = errors.New("event already exists")
+
+// ErrUnknownParent is returned when an event references a parent that was not admitted
+var ErrUnknownParent = errors.New("unknown parent event")
+
+// ErrFutureEvent is returned when an event's timestamp is further ahead of
+// the node's clock than maxClockSkew
+var ErrFutureEvent = errors.New("event timestamp is in the future")
+
+// maxClockSkew is how far ahead of the node's clock an event may be dated.
+// Liveness is measured against the newest timestamp, so a single event dated
+// years ahead would otherwise zero every agent's reputation.
+const maxClockSkew = 5 * time.Minute
+
+// AgentInfo is the identity record of a known agent. An identity is named by
+// its first public key and keeps that name across key rotations.
 type AgentInfo struct {
-	PubKey        string
+	PubKey        string // Current key
 	LastEventHash string
 	LastSeen      time.Time
+	Identity      string      // First key of the identity
+	Keys          []KeyRecord // Key history, oldest first
+	Equivocated   bool        // Created conflicting events, see Equivocations
+	RecoveryKey   string      // May revoke the identity's keys, named by its first event
+	Reputation    Reputation  // Filled in by GetAgents
 }
 
 // Blockchain manages events and agents
 type Blockchain struct {
-	events map[string]*Event
-	agents map[string]*AgentInfo
-	mu     sync.RWMutex
-	log    logger.Logger
+	events        map[string]*Event       // Full events still held in memory
+	headers       map[string]*EventHeader // Headers of all admitted events
+	order         []string
+	index         map[string]int        // Position in order
+	tree          *merkle.Tree          // Over event hashes in admission order
+	agents        map[string]*AgentInfo // By identity
+	keys          map[string]string     // Identity of every known key
+	recoveryKeys  map[string]string     // Identity of every recovery key
+	subscribers   map[*Subscription]struct{}
+	pending       map[string]*pendingEvent
+	checkpoints   checkpointTracker
+	admission     *admissionController // nil admits everything
+	prune         PrunePolicy
+	cold          *coldArchive
+	coldIndex     map[string]coldEntry // Pruned events in the cold archive
+	pruneFrom     int                  // Position in order up to which bodies were pruned or held back
+	heldBack      map[string]bool      // Bodies before pruneFrom kept as they were still needed
+	chainTips     map[string]string    // Latest chain event by author key
+	equivocations map[string]*Equivocation
+	invalidated   map[string]string // Revocation invalidating an event, by event hash
+	reputation    *reputationTracker
+	metrics       *chainMetrics
+	legacyHashes  bool // Admit events in the HashDataOnly format
+	mu            sync.RWMutex
+	log           logger.Logger
 }
 
 // New creates a new Blockchain instance
 func New(log logger.Logger) *Blockchain {
 	return &Blockchain{
-		events: make(map[string]*Event),
-		agents: make(map[string]*AgentInfo),
-		log:    log,
+		events:        make(map[string]*Event),
+		headers:       make(map[string]*EventHeader),
+		index:         make(map[string]int),
+		tree:          &merkle.Tree{},
+		agents:        make(map[string]*AgentInfo),
+		keys:          make(map[string]string),
+		recoveryKeys:  make(map[string]string),
+		subscribers:   make(map[*Subscription]struct{}),
+		pending:       make(map[string]*pendingEvent),
+		checkpoints:   checkpointTracker{quorum: DefaultCheckpointQuorum},
+		coldIndex:     make(map[string]coldEntry),
+		heldBack:      make(map[string]bool),
+		chainTips:     make(map[string]string),
+		equivocations: make(map[string]*Equivocation),
+		invalidated:   make(map[string]string),
+		reputation:    newReputationTracker(),
+		metrics:       &chainMetrics{},
+		log:           log,
 	}
 }
 
+// SetLegacyHashes controls whether events in the HashDataOnly format are
+// admitted. Their parent links are not signed, so only enable it to load
+// stores written before parent links were covered.
+func (bc *Blockchain) SetLegacyHashes(enabled bool) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	bc.legacyHashes = enabled
+}
+
 // CreateEvent creates and signs a new event
 func (bc *Blockchain) CreateEvent(
 	eventType, description string,
@@ -57,13 +143,7 @@ func (bc *Blockchain) CreateEvent(
 	pub ed25519.PublicKey,
 	priv ed25519.PrivateKey,
 ) (*Event, error) {
-	event := &Event{}
-	event.Data.Type = eventType
-	event.Data.Description = description
-	event.Data.Payload = payload
-	event.Data.Timestamp = time.Now().UTC().Format(time.RFC3339)
-	event.Parents = parents
-	event.AuthorPubKey = hex.EncodeToString(pub)
+	event := newEvent(eventType, description, payload, parents, pub)
 
 	// Sign the event
 	signature, err := bc.signEvent(event, priv)
@@ -75,76 +155,337 @@ func (bc *Blockchain) CreateEvent(
 	return event, nil
 }
 
-// AddEvent adds an event to the blockchain
+// newEvent builds an unsigned event authored by pub
+func newEvent(eventType, description string, payload map[string]string, parents []string, pub ed25519.PublicKey) *Event {
+	event := &Event{}
+	event.Data.Type = eventType
+	event.Data.Description = description
+	event.Data.Payload = payload
+	event.Data.Timestamp = time.Now().UTC().Format(time.RFC3339Nano)
+	event.Parents = parents
+	event.AuthorPubKey = hex.EncodeToString(pub)
+	return event
+}
+
+// AddEvent adds an event to the blockchain, subject to the admission policy
 func (bc *Blockchain) AddEvent(event *Event) error {
 	bc.mu.Lock()
 	defer bc.mu.Unlock()
 
+	return bc.addComplete(event, true)
+}
+
+// addComplete adds an event that must already carry all its signatures, so
+// an event short of signatures counts as rejected; bc.mu must be held for
+// writing
+func (bc *Blockchain) addComplete(event *Event, limited bool) error {
+	err := bc.add(event, limited)
+	if errors.Is(err, ErrInsufficientSignatures) {
+		bc.metrics.reject(rejectSignatures, err)
+	}
+	return err
+}
+
+// add verifies and admits an event. Limited events are subject to the
+// admission policy; trusted paths such as imports bypass it. Events short of
+// signatures are not recorded as rejected, since ProposeEvent and Cosign keep
+// them pending; see addComplete. bc.mu must be held for writing.
+func (bc *Blockchain) add(event *Event, limited bool) (err error) {
+	reason := rejectInvalid
+	defer func() {
+		if err != nil && !errors.Is(err, ErrInsufficientSignatures) {
+			bc.metrics.reject(reason, err)
+		}
+	}()
+
+	var ac *admissionController
+	if limited {
+		ac = bc.admission
+	}
+	if ac != nil {
+		if err := ac.checkSize(event); err != nil {
+			return err
+		}
+	}
+
 	// Verify event signature
-	if err := bc.verifyEvent(event); err != nil {
+	start := time.Now()
+	err = bc.verifyEvent(event)
+	bc.metrics.observeVerification(start)
+	if err != nil {
+		reason = rejectSignature
 		return fmt.Errorf("event verification failed: %w", err)
 	}
 
+	if event.HashFormat == HashDataOnly && !bc.legacyHashes {
+		return fmt.Errorf("event verification failed: data-only hashes are only accepted from legacy stores")
+	}
+	if timestamp, err := time.Parse(time.RFC3339Nano, event.Data.Timestamp); err == nil && time.Until(timestamp) > maxClockSkew {
+		return fmt.Errorf("%w: %s", ErrFutureEvent, event.Data.Timestamp)
+	}
+
 	hash := bc.HashEvent(event)
+	if _, exists := bc.headers[hash]; exists {
+		reason = rejectDuplicate
+		return ErrDuplicateEvent
+	}
+	for _, parent := range event.Parents {
+		if !bc.known(parent) {
+			reason = rejectUnknownParent
+			return fmt.Errorf("%w: %s", ErrUnknownParent, parent)
+		}
+	}
+	if err := bc.validate(hash, event); err != nil {
+		if errors.Is(err, errAlreadyProven) {
+			// Nodes that detected the same fork report it independently
+			reason = rejectDuplicate
+			return fmt.Errorf("%w: %w", ErrDuplicateEvent, err)
+		}
+		return err
+	}
+	// Only valid events use up the author's and the node's rate
+	if ac != nil {
+		if err := ac.takeToken(event.AuthorPubKey); err != nil {
+			return err
+		}
+	}
 	bc.events[hash] = event
+	bc.headers[hash] = headerOf(event)
+	bc.index[hash] = len(bc.order)
+	bc.order = append(bc.order, hash)
+	leaf, _ := hex.DecodeString(hash)
+	bc.tree.Append(leaf)
 
 	// Update agent info
-	bc.agents[event.AuthorPubKey] = &AgentInfo{
-		PubKey:        event.AuthorPubKey,
-		LastEventHash: hash,
-		LastSeen:      time.Now(),
+	bc.trackAgent(hash, event)
+	bc.detectEquivocation(hash, event)
+
+	switch event.Data.Type {
+	case TypeCheckpoint:
+		bc.checkpoints.latest = hash
+	case TypeEquivocationProof:
+		bc.recordEquivocationProof(hash, event)
 	}
+	bc.observeReputation(event)
+	delete(bc.pending, hash)
 
+	if ac != nil {
+		ac.admitted()
+	}
+	bc.metrics.admitted.Inc()
 	bc.log.Debug("Event added", "hash", hash, "type", event.Data.Type)
+
+	bc.notify(Notification{Seq: bc.position(len(bc.order) - 1), Hash: hash, Event: event})
+	return nil
+}
+
+// validate applies key status and type-specific admission rules; bc.mu must be held
+func (bc *Blockchain) validate(hash string, event *Event) error {
+	if err := bc.checkKeys(event); err != nil {
+		return err
+	}
+	if err := bc.validateRecoveryKey(event); err != nil {
+		return fmt.Errorf("invalid identity: %w", err)
+	}
+
+	switch event.Data.Type {
+	case TypeCheckpoint:
+		if err := bc.verifyCheckpoint(event); err != nil {
+			return fmt.Errorf("invalid checkpoint: %w", err)
+		}
+	case TypeKeyRotate:
+		if err := bc.validateRotation(event); err != nil {
+			return fmt.Errorf("invalid key rotation: %w", err)
+		}
+	case TypeKeyRevoke:
+		if err := bc.validateRevocation(event); err != nil {
+			return fmt.Errorf("invalid key revocation: %w", err)
+		}
+	case TypeEquivocationProof:
+		if err := bc.validateEquivocationProof(event); err != nil {
+			return fmt.Errorf("invalid equivocation proof: %w", err)
+		}
+	}
 	return nil
 }
 
-// GetEvent retrieves an event by hash
+// known reports whether hash can be referenced as a parent: it was admitted,
+// or it is on the frontier of the checkpoint this node bootstrapped from
+func (bc *Blockchain) known(hash string) bool {
+	if _, exists := bc.headers[hash]; exists {
+		return true
+	}
+	return bc.checkpoints.frontier[hash]
+}
+
+// position returns the 1-based position in admission order of order[i],
+// counting events before a bootstrap checkpoint
+func (bc *Blockchain) position(i int) int {
+	return int(bc.checkpoints.base) + i + 1
+}
+
+// GetEvent retrieves an event by hash, reloading it from the cold archive if
+// it was pruned
 func (bc *Blockchain) GetEvent(hash string) (*Event, bool) {
 	bc.mu.RLock()
 	defer bc.mu.RUnlock()
 
-	event, exists := bc.events[hash]
-	return event, exists
+	if _, exists := bc.headers[hash]; !exists {
+		return nil, false
+	}
+	event, err := bc.event(hash)
+	if err != nil {
+		bc.log.Error("Failed to load event", "hash", hash, "error", err)
+		return nil, false
+	}
+	return event, true
 }
 
-// GetRecentEvents returns the N most recent events
+// GetRecentEvents returns the N most recently admitted events, oldest first
 func (bc *Blockchain) GetRecentEvents(limit int) []*Event {
 	bc.mu.RLock()
 	defer bc.mu.RUnlock()
 
-	events := make([]*Event, 0, len(bc.events))
-	for _, event := range bc.events {
-		events = append(events, event)
+	start := 0
+	if len(bc.order) > limit {
+		start = len(bc.order) - limit
 	}
 
-	// Sort by timestamp (simplified - in production use proper sorting)
-	if len(events) > limit {
-		events = events[len(events)-limit:]
+	events := make([]*Event, 0, len(bc.order)-start)
+	for _, hash := range bc.order[start:] {
+		event, err := bc.event(hash)
+		if err != nil {
+			bc.log.Error("Failed to load event", "hash", hash, "error", err)
+			continue
+		}
+		events = append(events, event)
 	}
 
 	return events
 }
 
-// GetAgents returns all known agents
+// EventsSince returns all events admitted after the event with the given hash,
+// in admission order. An empty hash returns the whole history.
+func (bc *Blockchain) EventsSince(hash string) ([]Notification, error) {
+	return bc.EventsPage(hash, -1)
+}
+
+// EventsPage returns up to limit events in admission order: the next ones
+// admitted after the event with the given hash, or without a hash the most
+// recent ones. A negative limit returns them all. Only the returned events are
+// loaded, so paging through a pruned history reads one page of the cold
+// archive at a time.
+func (bc *Blockchain) EventsPage(hash string, limit int) ([]Notification, error) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	if hash == "" {
+		start := 0
+		if limit >= 0 {
+			start = max(len(bc.order)-limit, 0)
+		}
+		return bc.notifications(start, -1)
+	}
+	i, exists := bc.index[hash]
+	if !exists {
+		return nil, fmt.Errorf("unknown event hash: %s", hash)
+	}
+	return bc.notifications(i+1, limit)
+}
+
+// EventsAfter returns up to limit events admitted after the 1-based position
+// seq, in admission order; a negative limit returns them all. Seq 0 starts at
+// the first event this node holds, so clients can page through the whole
+// history by passing the Seq of the last event they received.
+func (bc *Blockchain) EventsAfter(seq, limit int) ([]Notification, error) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	return bc.notifications(max(seq-int(bc.checkpoints.base), 0), limit)
+}
+
+// notifications loads up to limit events from order[start:]; a negative
+// limit loads them all. bc.mu must be held.
+func (bc *Blockchain) notifications(start, limit int) ([]Notification, error) {
+	start = min(start, len(bc.order))
+	end := len(bc.order)
+	if limit >= 0 {
+		end = min(start+limit, end)
+	}
+
+	result := make([]Notification, 0, end-start)
+	for i := start; i < end; i++ {
+		h := bc.order[i]
+		event, err := bc.event(h)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, Notification{Seq: bc.position(i), Hash: h, Event: event})
+	}
+	return result, nil
+}
+
+// Len returns the number of admitted events
+func (bc *Blockchain) Len() int {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	return len(bc.order)
+}
+
+// GetAgents returns all known agents by identity, with their reputation
 func (bc *Blockchain) GetAgents() map[string]*AgentInfo {
 	bc.mu.RLock()
 	defer bc.mu.RUnlock()
 
+	scores := bc.reputations()
 	agents := make(map[string]*AgentInfo, len(bc.agents))
 	for k, v := range bc.agents {
-		agents[k] = v
+		info := *v
+		info.Reputation = scores[k]
+		agents[k] = &info
 	}
 	return agents
 }
 
 // HashEvent computes the hash of an event
 func (bc *Blockchain) HashEvent(event *Event) string {
-	eventBytes, _ := json.Marshal(event.Data)
+	return Hash(event)
+}
+
+// Hash computes the hash of an event in its hash format. The current format
+// covers the event data and its parent links, so the signature over it also
+// authenticates the causal relationships.
+func Hash(event *Event) string {
+	var hashed interface{} = struct {
+		Data    interface{} `json:"data"`
+		Parents []string    `json:"parents,omitempty"`
+	}{event.Data, event.Parents}
+	if event.HashFormat == HashDataOnly {
+		hashed = event.Data
+	}
+	eventBytes, _ := json.Marshal(hashed)
 	hash := sha3.Sum512(eventBytes)
 	return hex.EncodeToString(hash[:])
 }
 
+// DetectHashFormat migrates an event written before hash formats were
+// recorded: if its signature only verifies over the data, it is marked as
+// HashDataOnly. It reports whether the event was changed. The parent links of
+// such events are not authenticated.
+func DetectHashFormat(event *Event) bool {
+	if event.HashFormat != HashDataAndParents || verifySignature(event.AuthorPubKey, event.Signature, Hash(event)) == nil {
+		return false
+	}
+	legacy := *event
+	legacy.HashFormat = HashDataOnly
+	if verifySignature(event.AuthorPubKey, event.Signature, Hash(&legacy)) != nil {
+		return false
+	}
+	event.HashFormat = HashDataOnly
+	return true
+}
+
 // signEvent signs an event with a private key
 func (bc *Blockchain) signEvent(event *Event, priv ed25519.PrivateKey) (string, error) {
 	eventHash := bc.HashEvent(event)
@@ -152,19 +493,50 @@ func (bc *Blockchain) signEvent(event *Event, priv ed25519.PrivateKey) (string,
 	return hex.EncodeToString(signature), nil
 }
 
-// verifyEvent verifies an event's signature
+// VerifyEvent re-checks an event's signatures. An event that does not yet
+// carry the signatures its policy requires, such as one in the pending pool,
+// fails with ErrInsufficientSignatures even if every signature it has is valid.
+func (bc *Blockchain) VerifyEvent(event *Event) error {
+	return bc.verifyEvent(event)
+}
+
+// verifyEvent verifies an event's signature and cosignatures, and that they
+// satisfy its signature policy, if any
 func (bc *Blockchain) verifyEvent(event *Event) error {
-	pubKeyBytes, err := hex.DecodeString(event.AuthorPubKey)
+	if event.HashFormat != HashDataAndParents && event.HashFormat != HashDataOnly {
+		return fmt.Errorf("unsupported hash format: %d", event.HashFormat)
+	}
+	hash := bc.HashEvent(event)
+	if err := bc.verifySignature(event.AuthorPubKey, event.Signature, hash); err != nil {
+		return err
+	}
+	for _, cosig := range event.Cosignatures {
+		if err := bc.verifySignature(cosig.PubKey, cosig.Signature, hash); err != nil {
+			return fmt.Errorf("cosignature by %s: %w", cosig.PubKey, err)
+		}
+	}
+	return checkPolicy(event)
+}
+
+// verifySignature checks a hex-encoded signature over an event hash
+func (bc *Blockchain) verifySignature(pubKey, signature, eventHash string) error {
+	return verifySignature(pubKey, signature, eventHash)
+}
+
+func verifySignature(pubKey, signature, eventHash string) error {
+	pubKeyBytes, err := hex.DecodeString(pubKey)
 	if err != nil {
 		return fmt.Errorf("invalid public key: %w", err)
 	}
+	if len(pubKeyBytes) != ed25519.PublicKeySize {
+		return fmt.Errorf("invalid public key length: %d", len(pubKeyBytes))
+	}
 
-	signatureBytes, err := hex.DecodeString(event.Signature)
+	signatureBytes, err := hex.DecodeString(signature)
 	if err != nil {
 		return fmt.Errorf("invalid signature: %w", err)
 	}
 
-	eventHash := bc.HashEvent(event)
 	if !ed25519.Verify(pubKeyBytes, []byte(eventHash), signatureBytes) {
 		return fmt.Errorf("signature verification failed")
 	}
@@ -172,6 +544,41 @@ func (bc *Blockchain) verifyEvent(event *Event) error {
 	return nil
 }
 
+// DescendsFrom reports whether the event with the given hash has ancestor
+// among its transitive parents
+func (bc *Blockchain) DescendsFrom(hash, ancestor string) bool {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	return bc.descendsFrom(hash, ancestor)
+}
+
+// descendsFrom is DescendsFrom without locking
+func (bc *Blockchain) descendsFrom(hash, ancestor string) bool {
+	header, exists := bc.headers[hash]
+	if !exists {
+		return false
+	}
+
+	visited := make(map[string]bool)
+	stack := append([]string(nil), header.Parents...)
+	for len(stack) > 0 {
+		h := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if h == ancestor {
+			return true
+		}
+		if visited[h] {
+			continue
+		}
+		visited[h] = true
+		if parent, ok := bc.headers[h]; ok {
+			stack = append(stack, parent.Parents...)
+		}
+	}
+	return false
+}
+
 // GetEventChain returns the chain of events leading to a specific event
 func (bc *Blockchain) GetEventChain(hash string, maxDepth int) []*Event {
 	bc.mu.RLock()
@@ -186,8 +593,12 @@ func (bc *Blockchain) GetEventChain(hash string, maxDepth int) []*Event {
 			return
 		}
 
-		event, exists := bc.events[h]
-		if !exists {
+		if _, exists := bc.headers[h]; !exists {
+			return
+		}
+		event, err := bc.event(h)
+		if err != nil {
+			bc.log.Error("Failed to load event", "hash", h, "error", err)
 			return
 		}
 
@@ -201,4 +612,4 @@ func (bc *Blockchain) GetEventChain(hash string, maxDepth int) []*Event {
 
 	traverse(hash, 0)
 	return chain
-}
\ No newline at end of file
+}
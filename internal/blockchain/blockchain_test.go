@@ -1,11 +1,22 @@
 package blockchain
 
 import (
+	"bytes"
+	"compress/gzip"
 	"crypto/ed25519"
 	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/yanchenko-igor/blockchain-universe/pkg/logger"
+	"github.com/yanchenko-igor/blockchain-universe/pkg/metrics"
 )
 
 func TestCreateEvent(t *testing.T) {
@@ -194,6 +205,1169 @@ func TestAgentTracking(t *testing.T) {
 	}
 }
 
+func TestSubscriptionFilters(t *testing.T) {
+	log := logger.New("error")
+	bc := New(log)
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+
+	all := bc.Subscribe(SubscribeOptions{})
+	defer all.Close()
+	byType := bc.Subscribe(SubscribeOptions{Filter: SubscriptionFilter{Types: []string{"event2"}}})
+	defer byType.Close()
+
+	event1, _ := bc.CreateEvent("event1", "First event", map[string]string{}, []string{}, pub, priv)
+	bc.AddEvent(event1)
+	hash1 := bc.HashEvent(event1)
+
+	descendants := bc.Subscribe(SubscribeOptions{Filter: SubscriptionFilter{Ancestor: hash1}})
+	defer descendants.Close()
+
+	event2, _ := bc.CreateEvent("event2", "Second event", map[string]string{}, []string{hash1}, pub, priv)
+	bc.AddEvent(event2)
+
+	if len(all.C()) != 2 {
+		t.Errorf("Expected 2 notifications, got %d", len(all.C()))
+	}
+	if len(byType.C()) != 1 {
+		t.Errorf("Expected 1 notification for type filter, got %d", len(byType.C()))
+	}
+	if n := <-descendants.C(); n.Hash != bc.HashEvent(event2) || n.Seq != 2 {
+		t.Errorf("Unexpected descendant notification: seq %d hash %s", n.Seq, n.Hash)
+	}
+}
+
+func TestSubscriptionSlowConsumer(t *testing.T) {
+	log := logger.New("error")
+	bc := New(log)
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+
+	dropping := bc.Subscribe(SubscribeOptions{Buffer: 1, Policy: DropNewest})
+	defer dropping.Close()
+	slow := bc.Subscribe(SubscribeOptions{Buffer: 1, Policy: Disconnect})
+
+	for i := 0; i < 3; i++ {
+		event, _ := bc.CreateEvent("test_event", "Test event description", map[string]string{}, []string{}, pub, priv)
+		bc.AddEvent(event)
+	}
+
+	if dropping.Dropped() != 2 {
+		t.Errorf("Expected 2 dropped notifications, got %d", dropping.Dropped())
+	}
+
+	<-slow.C()
+	if _, ok := <-slow.C(); ok {
+		t.Error("Slow subscriber should have been disconnected")
+	}
+}
+
+func TestEventsSince(t *testing.T) {
+	log := logger.New("error")
+	bc := New(log)
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+
+	var hashes []string
+	for i := 0; i < 3; i++ {
+		event, _ := bc.CreateEvent("test_event", "Test event description", map[string]string{}, []string{}, pub, priv)
+		bc.AddEvent(event)
+		hashes = append(hashes, bc.HashEvent(event))
+	}
+
+	since, err := bc.EventsSince(hashes[0])
+	if err != nil {
+		t.Fatalf("Failed to get events since: %v", err)
+	}
+	if len(since) != 2 || since[0].Hash != hashes[1] {
+		t.Errorf("Expected events after first hash, got %d", len(since))
+	}
+
+	if _, err := bc.EventsSince("unknown"); err == nil {
+		t.Error("Unknown hash should return an error")
+	}
+
+	recent, err := bc.EventsPage("", 2)
+	if err != nil || len(recent) != 2 || recent[0].Hash != hashes[1] || recent[1].Seq != 3 {
+		t.Errorf("Expected the last two events, got %+v, %v", recent, err)
+	}
+	if page, _ := bc.EventsPage(hashes[0], 1); len(page) != 1 || page[0].Hash != hashes[1] {
+		t.Errorf("Expected the next event after the first, got %+v", page)
+	}
+	if page, _ := bc.EventsPage(hashes[1], 5); len(page) != 1 || page[0].Hash != hashes[2] {
+		t.Errorf("Expected the one event after the second, got %+v", page)
+	}
+	if recent, _ := bc.EventsPage("", 0); len(recent) != 0 {
+		t.Errorf("Expected no events with a zero limit, got %d", len(recent))
+	}
+
+	if page, _ := bc.EventsAfter(0, 2); len(page) != 2 || page[0].Hash != hashes[0] || page[1].Seq != 2 {
+		t.Errorf("Expected the first two events, got %+v", page)
+	}
+	if page, _ := bc.EventsAfter(2, 2); len(page) != 1 || page[0].Hash != hashes[2] {
+		t.Errorf("Expected the event after seq 2, got %+v", page)
+	}
+	if page, _ := bc.EventsAfter(3, 2); len(page) != 0 {
+		t.Errorf("Expected no events after the last one, got %+v", page)
+	}
+}
+
+func TestSubgraphExport(t *testing.T) {
+	log := logger.New("error")
+	bc := New(log)
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	otherPub, otherPriv, _ := ed25519.GenerateKey(rand.Reader)
+
+	event1, _ := bc.CreateEvent("event1", "First event", map[string]string{}, []string{}, pub, priv)
+	bc.AddEvent(event1)
+	hash1 := bc.HashEvent(event1)
+
+	event2, _ := bc.CreateEvent("event2", "Second event", map[string]string{}, []string{hash1}, pub, priv)
+	bc.AddEvent(event2)
+	hash2 := bc.HashEvent(event2)
+
+	other, _ := bc.CreateEvent("other", "Unrelated event", map[string]string{}, []string{}, otherPub, otherPriv)
+	bc.AddEvent(other)
+
+	graph, err := bc.Subgraph(GraphFilter{Root: hash2})
+	if err != nil {
+		t.Fatalf("Failed to build subgraph: %v", err)
+	}
+	if len(graph.Nodes) != 2 || len(graph.Edges) != 1 {
+		t.Fatalf("Expected 2 nodes and 1 edge, got %d and %d", len(graph.Nodes), len(graph.Edges))
+	}
+	if graph.Edges[0].Source != hash2 || graph.Edges[0].Target != hash1 {
+		t.Error("Edge should link child to parent")
+	}
+
+	graph, _ = bc.Subgraph(GraphFilter{Root: hash2, Depth: 1, Author: event1.AuthorPubKey})
+	if len(graph.Nodes) != 2 {
+		t.Errorf("Expected 2 nodes within depth 1, got %d", len(graph.Nodes))
+	}
+
+	graph, _ = bc.Subgraph(GraphFilter{Author: other.AuthorPubKey})
+	if len(graph.Nodes) != 1 || len(graph.Edges) != 0 {
+		t.Errorf("Expected only the other author's event, got %d nodes", len(graph.Nodes))
+	}
+
+	graph, _ = bc.Subgraph(GraphFilter{})
+	for _, format := range []string{FormatDOT, FormatGraphML, FormatJSONL} {
+		var buf bytes.Buffer
+		if err := graph.Write(&buf, format); err != nil {
+			t.Errorf("Failed to write %s: %v", format, err)
+		}
+		if !strings.Contains(buf.String(), hash1) {
+			t.Errorf("%s output should contain event hashes", format)
+		}
+	}
+
+	if err := graph.Write(&bytes.Buffer{}, "svg"); err == nil {
+		t.Error("Unsupported format should return an error")
+	}
+}
+
+func TestWriteDOTEscaping(t *testing.T) {
+	graph := &Graph{Nodes: []GraphNode{{ID: "a", Type: "note", Description: "Привет \"мир\" \\ ok"}}}
+	var buf bytes.Buffer
+	if err := graph.WriteDOT(&buf); err != nil {
+		t.Fatalf("Failed to write DOT: %v", err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, `label="note\nПривет \"мир\" \\ ok"`) {
+		t.Errorf("Label should keep non-ASCII text and escape only quotes and backslashes, got %s", out)
+	}
+	if strings.Contains(out, `\u`) {
+		t.Errorf("DOT output should not contain Go escapes, got %s", out)
+	}
+}
+
+func TestUnknownParentRejected(t *testing.T) {
+	log := logger.New("error")
+	bc := New(log)
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+
+	event, _ := bc.CreateEvent("test_event", "Orphan", map[string]string{}, []string{"missing"}, pub, priv)
+	if err := bc.AddEvent(event); !errors.Is(err, ErrUnknownParent) {
+		t.Errorf("Expected ErrUnknownParent, got %v", err)
+	}
+}
+
+func TestParentsAreSigned(t *testing.T) {
+	log := logger.New("error")
+	bc := New(log)
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+
+	event1, _ := bc.CreateEvent("event1", "First event", map[string]string{}, []string{}, pub, priv)
+	bc.AddEvent(event1)
+	event2, _ := bc.CreateEvent("event2", "Second event", map[string]string{}, []string{}, pub, priv)
+
+	event2.Parents = []string{bc.HashEvent(event1)}
+	if err := bc.verifyEvent(event2); err == nil {
+		t.Error("Changing parent links should invalidate the signature")
+	}
+}
+
+func TestLegacyHashFormat(t *testing.T) {
+	log := logger.New("error")
+	bc := New(log)
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+
+	first, _ := bc.CreateEvent("event1", "First event", map[string]string{}, []string{}, pub, priv)
+	bc.AddEvent(first)
+
+	// Events were signed over their data only before parent links were covered
+	legacy := newEvent("event2", "Legacy event", map[string]string{}, []string{bc.HashEvent(first)}, pub)
+	legacy.HashFormat = HashDataOnly
+	legacy.Signature = SignHash(Hash(legacy), priv)
+	legacy.HashFormat = HashDataAndParents
+
+	if DetectHashFormat(first) {
+		t.Error("Current events should keep their hash format")
+	}
+	if !DetectHashFormat(legacy) || legacy.HashFormat != HashDataOnly {
+		t.Fatal("Expected the data-only hash format to be detected")
+	}
+	if err := bc.AddEvent(legacy); err == nil {
+		t.Error("Data-only events should be rejected unless legacy hashes are enabled")
+	}
+
+	bc.SetLegacyHashes(true)
+	if err := bc.AddEvent(legacy); err != nil {
+		t.Fatalf("Failed to add legacy event: %v", err)
+	}
+	if _, ok := bc.GetEvent(Hash(legacy)); !ok {
+		t.Error("Legacy event should be found by its data-only hash")
+	}
+
+	current := *legacy
+	current.HashFormat = HashDataAndParents
+	if err := bc.verifyEvent(&current); err == nil {
+		t.Error("Changing the hash format should invalidate the signature")
+	}
+	current.HashFormat = 7
+	if err := bc.verifyEvent(&current); err == nil {
+		t.Error("Unknown hash formats should be rejected")
+	}
+}
+
+func TestArchiveRoundTrip(t *testing.T) {
+	log := logger.New("error")
+	bc := New(log)
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+
+	parents := []string{}
+	for i := 0; i < 5; i++ {
+		event, _ := bc.CreateEvent("test_event", fmt.Sprintf("Event %d", i), map[string]string{}, parents, pub, priv)
+		if err := bc.AddEvent(event); err != nil {
+			t.Fatalf("Failed to add event: %v", err)
+		}
+		parents = []string{bc.HashEvent(event)}
+	}
+
+	var buf bytes.Buffer
+	exported, err := bc.Export(&buf)
+	if err != nil {
+		t.Fatalf("Failed to export: %v", err)
+	}
+	if exported.Events != 5 || len(exported.Tips) != 1 || exported.Tips[0] != parents[0] {
+		t.Errorf("Unexpected manifest: %+v", exported)
+	}
+
+	restored := New(log)
+	imported, err := restored.Import(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+	if imported.MerkleRoot != exported.MerkleRoot || restored.Len() != 5 {
+		t.Error("Imported universe should match the export")
+	}
+}
+
+func TestArchiveTamperingDetected(t *testing.T) {
+	log := logger.New("error")
+	bc := New(log)
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+
+	for i := 0; i < 3; i++ {
+		event, _ := bc.CreateEvent("test_event", fmt.Sprintf("Event %d", i), map[string]string{}, []string{}, pub, priv)
+		bc.AddEvent(event)
+	}
+
+	var buf bytes.Buffer
+	bc.Export(&buf)
+	lines := strings.Split(strings.TrimSpace(gunzip(t, buf.Bytes())), "\n")
+
+	// Tampered event
+	tampered := append([]string(nil), lines...)
+	tampered[2] = strings.Replace(tampered[2], "Event 1", "Event X", 1)
+	_, err := New(log).Import(bytes.NewReader(gzipLines(tampered)))
+	var archiveErr *ArchiveError
+	if !errors.As(err, &archiveErr) || archiveErr.Line != 3 || archiveErr.Event != 2 {
+		t.Errorf("Expected failure at line 3 / event 2, got %v", err)
+	}
+
+	// Dropped event no longer matches the manifest
+	dropped := append(append([]string(nil), lines[:2]...), lines[3:]...)
+	if _, err := New(log).Import(bytes.NewReader(gzipLines(dropped))); err == nil {
+		t.Error("Archive with a missing event should fail manifest verification")
+	}
+
+	// Truncated archive without manifest
+	if _, err := New(log).Import(bytes.NewReader(gzipLines(lines[:3]))); err == nil {
+		t.Error("Truncated archive should fail")
+	}
+}
+
+func gunzip(t *testing.T, data []byte) string {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Failed to open archive: %v", err)
+	}
+	out, _ := io.ReadAll(gz)
+	return string(out)
+}
+
+func gzipLines(lines []string) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	io.WriteString(gz, strings.Join(lines, "\n")+"\n")
+	gz.Close()
+	return buf.Bytes()
+}
+
+func TestMerkleCommitments(t *testing.T) {
+	log := logger.New("error")
+	bc := New(log)
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+
+	var hashes []string
+	for i := 0; i < 5; i++ {
+		event, _ := bc.CreateEvent("test_event", fmt.Sprintf("Event %d", i), map[string]string{}, []string{}, pub, priv)
+		bc.AddEvent(event)
+		hashes = append(hashes, bc.HashEvent(event))
+	}
+
+	old, _ := bc.MerkleRootAt(3)
+	current := bc.MerkleRoot()
+	if current.Size != 5 {
+		t.Fatalf("Expected commitment over 5 events, got %d", current.Size)
+	}
+
+	proof, err := bc.InclusionProof(hashes[1], 0)
+	if err != nil {
+		t.Fatalf("Failed to build inclusion proof: %v", err)
+	}
+	if err := VerifyInclusion(hashes[1], proof, current); err != nil {
+		t.Errorf("Inclusion proof should verify: %v", err)
+	}
+	if err := VerifyInclusion(hashes[2], proof, current); err == nil {
+		t.Error("Inclusion proof for another event should fail")
+	}
+
+	consistency, err := bc.ConsistencyProof(3, 0)
+	if err != nil {
+		t.Fatalf("Failed to build consistency proof: %v", err)
+	}
+	if err := VerifyConsistency(consistency, old, current); err != nil {
+		t.Errorf("Consistency proof should verify: %v", err)
+	}
+
+	var buf bytes.Buffer
+	manifest, _ := bc.Export(&buf)
+	if manifest.MerkleRoot != current.Root.String() {
+		t.Error("Archive Merkle root should match the blockchain commitment")
+	}
+}
+
+func TestCheckpointQuorum(t *testing.T) {
+	log := logger.New("error")
+	bc := New(log)
+
+	type key struct {
+		pub  ed25519.PublicKey
+		priv ed25519.PrivateKey
+	}
+	keys := make([]key, 3)
+	for i := range keys {
+		keys[i].pub, keys[i].priv, _ = ed25519.GenerateKey(rand.Reader)
+		event, _ := bc.CreateEvent("test_event", fmt.Sprintf("Agent %d", i), map[string]string{}, []string{}, keys[i].pub, keys[i].priv)
+		bc.AddEvent(event)
+	}
+	if !bc.CheckpointDue(3) || bc.CheckpointDue(4) {
+		t.Error("A checkpoint should be due after 3 events")
+	}
+
+	checkpoint, err := bc.NewCheckpoint(keys[0].pub, keys[0].priv)
+	if err != nil {
+		t.Fatalf("Failed to create checkpoint: %v", err)
+	}
+	hash := bc.HashEvent(checkpoint)
+
+	// 2 of 3 agents are required with the default quorum
+	admitted, err := bc.ProposeEvent(checkpoint)
+	if err != nil || admitted {
+		t.Fatalf("Checkpoint with one signature should be pending, got admitted=%v err=%v", admitted, err)
+	}
+	if len(bc.PendingEvents()) != 1 || bc.CheckpointDue(3) {
+		t.Error("Checkpoint should wait in the pending pool")
+	}
+	if err := bc.CheckCheckpoint(checkpoint); err != nil {
+		t.Errorf("Checkpoint should match the local view: %v", err)
+	}
+
+	if _, err := bc.Cosign(hash, hexKey(keys[1].pub), SignHash(hash, keys[2].priv)); err == nil {
+		t.Error("Cosignature with a mismatched key should be rejected")
+	}
+	outsiderPub, outsiderPriv, _ := ed25519.GenerateKey(rand.Reader)
+	if _, err := bc.Cosign(hash, hexKey(outsiderPub), SignHash(hash, outsiderPriv)); err == nil {
+		t.Error("Cosignature by a key outside the quorum should be rejected")
+	}
+	admitted, err = bc.Cosign(hash, hexKey(keys[1].pub), SignHash(hash, keys[1].priv))
+	if err != nil || !admitted {
+		t.Fatalf("Checkpoint with 2 of 3 signatures should be admitted, got admitted=%v err=%v", admitted, err)
+	}
+
+	latest, position, exists := bc.LatestCheckpoint()
+	if !exists || position != 3 || bc.HashEvent(latest) != hash {
+		t.Errorf("Expected latest checkpoint at position 3, got %d", position)
+	}
+	if len(bc.PendingEvents()) != 0 {
+		t.Error("Admitted checkpoint should leave the pending pool")
+	}
+}
+
+func TestCheckpointBootstrap(t *testing.T) {
+	log := logger.New("error")
+	bc := New(log)
+	bc.SetCheckpointQuorum(0.5)
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+
+	parents := []string{}
+	for i := 0; i < 5; i++ {
+		event, _ := bc.CreateEvent("test_event", fmt.Sprintf("Event %d", i), map[string]string{}, parents, pub, priv)
+		bc.AddEvent(event)
+		parents = []string{bc.HashEvent(event)}
+	}
+	checkpoint, _ := bc.NewCheckpoint(pub, priv)
+	if admitted, err := bc.ProposeEvent(checkpoint); err != nil || !admitted {
+		t.Fatalf("Failed to admit checkpoint: %v", err)
+	}
+	after, _ := bc.CreateEvent("test_event", "After checkpoint", map[string]string{}, parents, pub, priv)
+	if err := bc.AddEvent(after); err != nil {
+		t.Fatalf("Failed to add event: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if _, err := bc.ExportFromCheckpoint(&buf); err != nil {
+		t.Fatalf("Failed to export from checkpoint: %v", err)
+	}
+
+	if _, err := New(log).Import(bytes.NewReader(buf.Bytes())); err == nil {
+		t.Error("Bootstrapping without trusted signers should fail")
+	}
+
+	restored := New(log)
+	restored.SetCheckpointQuorum(0.5)
+	restored.SetTrustedSigners([]string{hexKey(pub)})
+	if _, err := restored.Import(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatalf("Failed to bootstrap from checkpoint: %v", err)
+	}
+	if restored.Len() != 2 {
+		t.Errorf("Expected the checkpoint and one later event, got %d events", restored.Len())
+	}
+	if restored.MerkleRoot() != bc.MerkleRoot() {
+		t.Error("Bootstrapped node should have the same Merkle root")
+	}
+
+	next, _ := restored.CreateEvent("test_event", "Next", map[string]string{}, []string{bc.HashEvent(after)}, pub, priv)
+	if err := restored.AddEvent(next); err != nil {
+		t.Errorf("Failed to add event after bootstrap: %v", err)
+	}
+	if _, err := restored.InclusionProof(parents[0], 0); err == nil {
+		t.Error("Events before the checkpoint should not be provable")
+	}
+}
+
+func TestBootstrapRequiresTrustedSigners(t *testing.T) {
+	log := logger.New("error")
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	trustedPub, _, _ := ed25519.GenerateKey(rand.Reader)
+
+	// A single key can mint a self-consistent checkpoint listing only itself
+	forger := New(log)
+	event, _ := forger.CreateEvent("test_event", "Forged history", map[string]string{}, []string{}, pub, priv)
+	forger.AddEvent(event)
+	checkpoint, _ := forger.NewCheckpoint(pub, priv)
+
+	bc := New(log)
+	bc.SetTrustedSigners([]string{hexKey(trustedPub)})
+	if err := bc.Bootstrap(checkpoint); !errors.Is(err, ErrInsufficientSignatures) {
+		t.Errorf("Expected a checkpoint without trusted signatures to be rejected, got %v", err)
+	}
+
+	bc.SetTrustedSigners([]string{hexKey(pub), hexKey(trustedPub)})
+	bc.SetCheckpointQuorum(0.5)
+	if err := bc.Bootstrap(checkpoint); err != nil {
+		t.Errorf("Expected a quorum of trusted signers to suffice, got %v", err)
+	}
+}
+
+func TestPendingProposalsAreNotRejected(t *testing.T) {
+	log := logger.New("error")
+	bc := New(log)
+	reg := metrics.NewRegistry()
+	bc.SetMetrics(reg)
+	bc.SetAdmissionPolicy(AdmissionPolicy{AuthorRate: 0.001, AuthorBurst: 2})
+
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	otherPub, otherPriv, _ := ed25519.GenerateKey(rand.Reader)
+	first, _ := bc.CreateEvent("test_event", "First", map[string]string{}, []string{}, pub, priv)
+	other, _ := bc.CreateEvent("test_event", "Other", map[string]string{}, []string{}, otherPub, otherPriv)
+	bc.AddEvent(first)
+	bc.AddEvent(other)
+
+	// The proposal uses the author's last token once
+	checkpoint, _ := bc.NewCheckpoint(pub, priv)
+	if admitted, err := bc.ProposeEvent(checkpoint); err != nil || admitted {
+		t.Fatalf("Expected the checkpoint to be pending, got %v, %v", admitted, err)
+	}
+	hash := bc.HashEvent(checkpoint)
+	if admitted, err := bc.Cosign(hash, hexKey(otherPub), SignHash(hash, otherPriv)); err != nil || !admitted {
+		t.Fatalf("Expected the cosigned checkpoint to be admitted, got %v, %v", admitted, err)
+	}
+
+	var buf bytes.Buffer
+	reg.WriteTo(&buf)
+	if strings.Contains(buf.String(), "bu_events_rejected_total{") {
+		t.Errorf("Pending proposals should not count as rejected:\n%s", buf.String())
+	}
+
+	newPub, newPriv, _ := ed25519.GenerateKey(rand.Reader)
+	unsigned, _ := bc.NewKeyRotation([]string{bc.HashEvent(other)}, otherPub, otherPriv, newPub, newPriv)
+	unsigned.Cosignatures = nil
+	if err := bc.AddEvent(unsigned); !errors.Is(err, ErrInsufficientSignatures) {
+		t.Fatalf("Expected an incomplete rotation to be rejected, got %v", err)
+	}
+	buf.Reset()
+	reg.WriteTo(&buf)
+	if !strings.Contains(buf.String(), `bu_events_rejected_total{reason="insufficient_signatures"} 1`) {
+		t.Errorf("Incomplete events added directly should count as rejected:\n%s", buf.String())
+	}
+}
+
+func TestBootstrapKeepsKeyStatus(t *testing.T) {
+	log := logger.New("error")
+	bc := New(log)
+	oldPub, oldPriv, _ := ed25519.GenerateKey(rand.Reader)
+	newPub, newPriv, _ := ed25519.GenerateKey(rand.Reader)
+	recoveryPub, _, _ := ed25519.GenerateKey(rand.Reader)
+
+	first, _ := bc.CreateEvent("test_event", "First", map[string]string{keyRecoveryPubKey: hexKey(recoveryPub)}, []string{}, oldPub, oldPriv)
+	bc.AddEvent(first)
+	rotation, _ := bc.NewKeyRotation([]string{bc.HashEvent(first)}, oldPub, oldPriv, newPub, newPriv)
+	bc.AddEvent(rotation)
+	revocation, _ := bc.NewKeyRevocation(hexKey(oldPub), "", []string{bc.HashEvent(rotation)}, newPub, newPriv)
+	if err := bc.AddEvent(revocation); err != nil {
+		t.Fatalf("Failed to add revocation: %v", err)
+	}
+	checkpoint, _ := bc.NewCheckpoint(newPub, newPriv)
+	if admitted, err := bc.ProposeEvent(checkpoint); err != nil || !admitted {
+		t.Fatalf("Failed to admit checkpoint: %v, %v", admitted, err)
+	}
+
+	restored := New(log)
+	restored.SetTrustedSigners([]string{hexKey(newPub)})
+	if err := restored.Bootstrap(checkpoint); err != nil {
+		t.Fatalf("Failed to bootstrap from checkpoint: %v", err)
+	}
+
+	tip := []string{bc.HashEvent(revocation)}
+	late, _ := restored.CreateEvent("test_event", "Old key", map[string]string{}, tip, oldPub, oldPriv)
+	if err := restored.AddEvent(late); !errors.Is(err, ErrKeyRevoked) {
+		t.Errorf("Events by a key revoked before the checkpoint should be rejected, got %v", err)
+	}
+	next, _ := restored.CreateEvent("test_event", "New key", map[string]string{}, tip, newPub, newPriv)
+	if err := restored.AddEvent(next); err != nil {
+		t.Errorf("Events by the current key should be accepted: %v", err)
+	}
+
+	info, exists := restored.GetAgents()[hexKey(oldPub)]
+	if !exists || info.PubKey != hexKey(newPub) || info.RecoveryKey != hexKey(recoveryPub) || info.RevokedKeys() != 1 {
+		t.Errorf("Bootstrapped identity should keep its keys: %+v", info)
+	}
+}
+
+func TestCheckpointQuorumUsesTrustedSigners(t *testing.T) {
+	log := logger.New("error")
+	bc := New(log)
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	trustedPub, trustedPriv, _ := ed25519.GenerateKey(rand.Reader)
+	bc.SetTrustedSigners([]string{hexKey(trustedPub)})
+
+	event, _ := bc.CreateEvent("test_event", "Only agent", map[string]string{}, []string{}, pub, priv)
+	bc.AddEvent(event)
+
+	checkpoint, _ := bc.NewCheckpoint(pub, priv)
+	if admitted, err := bc.ProposeEvent(checkpoint); err != nil || admitted {
+		t.Fatalf("Expected the checkpoint to wait for a trusted signer, got %v, %v", admitted, err)
+	}
+	hash := bc.HashEvent(checkpoint)
+	admitted, err := bc.Cosign(hash, hexKey(trustedPub), SignHash(hash, trustedPriv))
+	if err != nil || !admitted {
+		t.Errorf("Expected the trusted signature to complete the quorum, got %v, %v", admitted, err)
+	}
+}
+
+func TestCheckpointRejectsWrongRoot(t *testing.T) {
+	log := logger.New("error")
+	bc := New(log)
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+
+	for i := 0; i < 2; i++ {
+		event, _ := bc.CreateEvent("test_event", fmt.Sprintf("Event %d", i), map[string]string{}, []string{}, pub, priv)
+		bc.AddEvent(event)
+	}
+
+	valid, _ := bc.NewCheckpoint(pub, priv)
+	payload := make(map[string]string)
+	for k, v := range valid.Data.Payload {
+		payload[k] = v
+	}
+	payload[checkpointMerkleRoot] = strings.Repeat("00", 32)
+	forged, _ := bc.CreateEvent(TypeCheckpoint, valid.Data.Description, payload, valid.Parents, pub, priv)
+
+	if err := bc.CheckCheckpoint(forged); err == nil {
+		t.Error("Checkpoint with a wrong Merkle root should fail the check")
+	}
+	if _, err := bc.ProposeEvent(forged); err == nil {
+		t.Error("Checkpoint with a wrong Merkle root should be rejected")
+	}
+	if err := New(log).Bootstrap(forged); err == nil {
+		t.Error("Bootstrapping from a checkpoint with a wrong Merkle root should fail")
+	}
+}
+
+func TestPruning(t *testing.T) {
+	log := logger.New("error")
+	bc := New(log)
+	if err := bc.SetPrunePolicy(PrunePolicy{KeepEvents: 3, ArchivePath: filepath.Join(t.TempDir(), "cold.jsonl")}); err != nil {
+		t.Fatalf("Failed to set prune policy: %v", err)
+	}
+	defer bc.Close()
+
+	otherPub, otherPriv, _ := ed25519.GenerateKey(rand.Reader)
+	other, _ := bc.CreateEvent("test_event", "Other agent", map[string]string{}, []string{}, otherPub, otherPriv)
+	bc.AddEvent(other)
+
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	var hashes []string
+	parents := []string{}
+	for i := 0; i < 10; i++ {
+		event, _ := bc.CreateEvent("test_event", fmt.Sprintf("Event %d", i), map[string]string{}, parents, pub, priv)
+		bc.AddEvent(event)
+		hashes = append(hashes, bc.HashEvent(event))
+		parents = []string{hashes[i]}
+	}
+
+	// The other agent's latest event is needed by newer events and must stay
+	pruned, err := bc.Prune()
+	if err != nil {
+		t.Fatalf("Failed to prune: %v", err)
+	}
+	if pruned != 7 {
+		t.Errorf("Expected 7 pruned events, got %d", pruned)
+	}
+	if _, inMemory := bc.events[bc.HashEvent(other)]; !inMemory {
+		t.Error("An agent's latest event should not be pruned")
+	}
+
+	event, exists := bc.GetEvent(hashes[0])
+	if !exists || event.Data.Description != "Event 0" {
+		t.Error("Pruned event should be reloaded from the cold archive")
+	}
+	if chain := bc.GetEventChain(hashes[9], 20); len(chain) != 10 {
+		t.Errorf("Expected a chain of 10 events across pruned ones, got %d", len(chain))
+	}
+
+	next, _ := bc.CreateEvent("test_event", "Child of a pruned event", map[string]string{}, []string{hashes[0]}, pub, priv)
+	if err := bc.AddEvent(next); err != nil {
+		t.Errorf("Pruned events should remain valid parents: %v", err)
+	}
+
+	// Held back events are pruned once no longer needed, and pruning resumes
+	// where it stopped
+	later, _ := bc.CreateEvent("test_event", "Other agent again", map[string]string{}, []string{}, otherPub, otherPriv)
+	bc.AddEvent(later)
+	if pruned, _ := bc.Prune(); pruned != 3 {
+		t.Errorf("Expected the held back event and two newer ones to be pruned, got %d", pruned)
+	}
+	if _, inMemory := bc.events[bc.HashEvent(other)]; inMemory || len(bc.heldBack) != 0 {
+		t.Error("The other agent's earlier event should be pruned once it is no longer its latest")
+	}
+	if bc.pruneFrom != len(bc.order)-3 {
+		t.Errorf("Expected pruning to resume at %d, got %d", len(bc.order)-3, bc.pruneFrom)
+	}
+
+	var buf bytes.Buffer
+	if _, err := bc.Export(&buf); err != nil {
+		t.Fatalf("Failed to export pruned blockchain: %v", err)
+	}
+	restored := New(log)
+	if _, err := restored.Import(&buf); err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+	if restored.MerkleRoot() != bc.MerkleRoot() {
+		t.Error("Export should include pruned events")
+	}
+}
+
+func TestColdArchiveIsReindexedOnRestart(t *testing.T) {
+	log := logger.New("error")
+	path := filepath.Join(t.TempDir(), "cold.jsonl")
+	bc := New(log)
+	bc.SetPrunePolicy(PrunePolicy{ArchivePath: path})
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+
+	parents := []string{}
+	for i := 0; i < 5; i++ {
+		event, _ := bc.CreateEvent("test_event", fmt.Sprintf("Event %d", i), map[string]string{}, parents, pub, priv)
+		bc.AddEvent(event)
+		parents = []string{bc.HashEvent(event)}
+	}
+	if pruned, err := bc.Prune(); err != nil || pruned != 4 {
+		t.Fatalf("Expected 4 pruned events, got %d, %v", pruned, err)
+	}
+	var buf bytes.Buffer
+	bc.Export(&buf)
+	bc.Close()
+
+	// A write cut short by a crash leaves a partial line
+	f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+	f.WriteString(`{"data":{"type":"test_event"`)
+	f.Close()
+
+	restarted := New(log)
+	if err := restarted.SetPrunePolicy(PrunePolicy{ArchivePath: path}); err != nil {
+		t.Fatalf("Failed to reopen cold archive: %v", err)
+	}
+	defer restarted.Close()
+	info, _ := os.Stat(path)
+	if _, err := restarted.Import(&buf); err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+	if len(restarted.coldIndex) != 4 {
+		t.Fatalf("Expected the import to prune 4 events, got %d", len(restarted.coldIndex))
+	}
+	if after, _ := os.Stat(path); after.Size() != info.Size() {
+		t.Errorf("Events already in the archive should not be appended again: %d -> %d bytes", info.Size(), after.Size())
+	}
+	if events := restarted.GetRecentEvents(5); len(events) != 5 || events[0].Data.Description != "Event 0" {
+		t.Error("Pruned events should be reloaded after a restart")
+	}
+}
+
+func TestPruneRetentionUsesAdmissionTime(t *testing.T) {
+	log := logger.New("error")
+	bc := New(log)
+	bc.SetPrunePolicy(PrunePolicy{KeepDuration: time.Hour, ArchivePath: filepath.Join(t.TempDir(), "cold.jsonl")})
+	defer bc.Close()
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+
+	backdated := newEvent("test_event", "Claims to be old", map[string]string{}, []string{}, pub)
+	backdated.Data.Timestamp = "2001-01-01T00:00:00Z"
+	backdated.Signature = SignHash(Hash(backdated), priv)
+	bc.AddEvent(backdated)
+	latest, _ := bc.CreateEvent("test_event", "Latest", map[string]string{}, []string{bc.HashEvent(backdated)}, pub, priv)
+	bc.AddEvent(latest)
+
+	if pruned, _ := bc.Prune(); pruned != 0 {
+		t.Error("Events admitted within the keep duration should stay in memory, whatever their timestamp")
+	}
+}
+
+func TestMultiSigEvent(t *testing.T) {
+	log := logger.New("error")
+	bc := New(log)
+	pubA, privA, _ := ed25519.GenerateKey(rand.Reader)
+	pubB, privB, _ := ed25519.GenerateKey(rand.Reader)
+	pubC, privC, _ := ed25519.GenerateKey(rand.Reader)
+
+	a, _ := bc.CreateEvent("test_event", "Chain A", map[string]string{}, []string{}, pubA, privA)
+	b, _ := bc.CreateEvent("test_event", "Chain B", map[string]string{}, []string{}, pubB, privB)
+	bc.AddEvent(a)
+	bc.AddEvent(b)
+
+	// Merging both chains requires 2 of the 3 listed agents
+	policy := SignaturePolicy{Threshold: 2, Signers: []string{hexKey(pubA), hexKey(pubB), hexKey(pubC)}}
+	merge, err := bc.CreateMultiSigEvent("merge", "Merge A and B", map[string]string{},
+		[]string{bc.HashEvent(a), bc.HashEvent(b)}, policy, pubA, privA)
+	if err != nil {
+		t.Fatalf("Failed to create multi-sig event: %v", err)
+	}
+	if err := bc.AddEvent(merge); !errors.Is(err, ErrInsufficientSignatures) {
+		t.Errorf("Expected insufficient signatures, got %v", err)
+	}
+
+	hash := bc.HashEvent(merge)
+	if admitted, err := bc.ProposeEvent(merge); err != nil || admitted {
+		t.Fatalf("Partially signed event should be pending, got admitted=%v err=%v", admitted, err)
+	}
+
+	outsider, outsiderPriv, _ := ed25519.GenerateKey(rand.Reader)
+	if _, err := bc.Cosign(hash, hexKey(outsider), SignHash(hash, outsiderPriv)); err == nil {
+		t.Error("Cosignature by an unlisted agent should be rejected")
+	}
+	if len(bc.PendingEvents()) != 1 {
+		t.Error("Rejected cosignature should not drop the pending event")
+	}
+
+	admitted, err := bc.Cosign(hash, hexKey(pubC), SignHash(hash, privC))
+	if err != nil || !admitted {
+		t.Fatalf("Event with 2 of 3 signatures should be admitted, got admitted=%v err=%v", admitted, err)
+	}
+	if err := bc.VerifyEvent(merge); !errors.Is(err, ErrInsufficientSignatures) {
+		t.Error("The original partially signed copy should still fail verification")
+	}
+
+	// The policy is covered by the hash, so it cannot be lowered after signing
+	stored, _ := bc.GetEvent(hash)
+	lowered := *stored
+	lowered.Data.Policy = &SignaturePolicy{Threshold: 1, Signers: policy.Signers}
+	lowered.Cosignatures = nil
+	if err := bc.VerifyEvent(&lowered); err == nil {
+		t.Error("Changing the policy should invalidate the signature")
+	}
+
+	if _, err := bc.CreateMultiSigEvent("merge", "Invalid", map[string]string{}, []string{}, SignaturePolicy{Threshold: 3, Signers: policy.Signers[:2]}, pubA, privA); err == nil {
+		t.Error("Threshold above the number of signers should be rejected")
+	}
+}
+
+func TestPendingPoolLimits(t *testing.T) {
+	log := logger.New("error")
+	bc := New(log)
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	otherPub, otherPriv, _ := ed25519.GenerateKey(rand.Reader)
+	policy := SignaturePolicy{Threshold: 2, Signers: []string{hexKey(pub), hexKey(otherPub)}}
+
+	propose := func(pub ed25519.PublicKey, priv ed25519.PrivateKey, i int) (string, error) {
+		event, _ := bc.CreateMultiSigEvent("merge", fmt.Sprintf("Proposal %d", i), map[string]string{}, []string{}, policy, pub, priv)
+		_, err := bc.ProposeEvent(event)
+		return bc.HashEvent(event), err
+	}
+
+	var first string
+	for i := 0; i < maxPendingPerAuthor; i++ {
+		hash, err := propose(pub, priv, i)
+		if err != nil {
+			t.Fatalf("Failed to propose event %d: %v", i, err)
+		}
+		if i == 0 {
+			first = hash
+		}
+	}
+	if _, err := propose(pub, priv, maxPendingPerAuthor); err == nil {
+		t.Error("Expected the author's pending events to be capped")
+	}
+	if _, err := propose(otherPub, otherPriv, 0); err != nil {
+		t.Errorf("Other authors should still be able to propose: %v", err)
+	}
+
+	bc.pending[first].proposed = time.Now().Add(-pendingTTL - time.Minute)
+	if len(bc.PendingEvents()) != maxPendingPerAuthor {
+		t.Error("Expired events should not be listed")
+	}
+	if _, err := bc.Cosign(first, hexKey(otherPub), SignHash(first, otherPriv)); err == nil {
+		t.Error("Expired events should not be cosignable")
+	}
+	if _, err := propose(pub, priv, maxPendingPerAuthor); err != nil {
+		t.Errorf("Expired events should free the author's slots: %v", err)
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	log := logger.New("error")
+	bc := New(log)
+	oldPub, oldPriv, _ := ed25519.GenerateKey(rand.Reader)
+	newPub, newPriv, _ := ed25519.GenerateKey(rand.Reader)
+
+	first, _ := bc.CreateEvent("test_event", "First", map[string]string{}, []string{}, oldPub, oldPriv)
+	bc.AddEvent(first)
+
+	// Without the new key's signature the rotation is incomplete
+	unsigned, _ := bc.NewKeyRotation([]string{bc.HashEvent(first)}, oldPub, oldPriv, newPub, newPriv)
+	unsigned.Cosignatures = nil
+	if err := bc.AddEvent(unsigned); !errors.Is(err, ErrInsufficientSignatures) {
+		t.Errorf("Rotation without the new key's signature should be rejected, got %v", err)
+	}
+
+	rotation, _ := bc.NewKeyRotation([]string{bc.HashEvent(first)}, oldPub, oldPriv, newPub, newPriv)
+	if err := bc.AddEvent(rotation); err != nil {
+		t.Fatalf("Failed to add rotation: %v", err)
+	}
+
+	late, _ := bc.CreateEvent("test_event", "Old key", map[string]string{}, []string{bc.HashEvent(rotation)}, oldPub, oldPriv)
+	if err := bc.AddEvent(late); !errors.Is(err, ErrKeyRotated) {
+		t.Errorf("Events by the rotated key should be rejected, got %v", err)
+	}
+	next, _ := bc.CreateEvent("test_event", "New key", map[string]string{}, []string{bc.HashEvent(rotation)}, newPub, newPriv)
+	if err := bc.AddEvent(next); err != nil {
+		t.Fatalf("Events by the new key should be accepted: %v", err)
+	}
+
+	agents := bc.GetAgents()
+	info, exists := agents[hexKey(oldPub)]
+	if len(agents) != 1 || !exists {
+		t.Fatalf("Both keys should belong to one identity, got %d agents", len(agents))
+	}
+	if info.PubKey != hexKey(newPub) || len(info.Keys) != 2 || info.Keys[0].RotatedBy != bc.HashEvent(rotation) {
+		t.Errorf("Unexpected identity record: %+v", info)
+	}
+	if info.LastEventHash != bc.HashEvent(next) {
+		t.Error("Events by the new key should update the identity")
+	}
+}
+
+func TestKeyRevocation(t *testing.T) {
+	log := logger.New("error")
+	bc := New(log)
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	otherPub, otherPriv, _ := ed25519.GenerateKey(rand.Reader)
+
+	first, _ := bc.CreateEvent("test_event", "First", map[string]string{}, []string{}, pub, priv)
+	other, _ := bc.CreateEvent("test_event", "Other", map[string]string{}, []string{}, otherPub, otherPriv)
+	bc.AddEvent(first)
+	bc.AddEvent(other)
+
+	forged, _ := bc.NewKeyRevocation(hexKey(pub), "", []string{}, otherPub, otherPriv)
+	if err := bc.AddEvent(forged); err == nil {
+		t.Error("Another identity should not be able to revoke a key")
+	}
+
+	revocation, _ := bc.NewKeyRevocation(hexKey(pub), "", []string{bc.HashEvent(first)}, pub, priv)
+	if err := bc.AddEvent(revocation); err != nil {
+		t.Fatalf("Failed to add revocation: %v", err)
+	}
+
+	after, _ := bc.CreateEvent("test_event", "After revocation", map[string]string{}, []string{bc.HashEvent(first)}, pub, priv)
+	if err := bc.AddEvent(after); !errors.Is(err, ErrKeyRevoked) {
+		t.Errorf("Events by a revoked key should be rejected, got %v", err)
+	}
+	if !bc.GetAgents()[hexKey(pub)].Revoked() {
+		t.Error("Identity should be marked revoked")
+	}
+	rescoped, _ := bc.NewKeyRevocation(hexKey(pub), bc.HashEvent(first), []string{bc.HashEvent(revocation)}, pub, priv)
+	if err := bc.AddEvent(rescoped); !errors.Is(err, ErrKeyRevoked) {
+		t.Errorf("A revoked key should not re-scope its own revocation, got %v", err)
+	}
+
+	// Events admitted before the revocation stay valid
+	if _, exists := bc.GetEvent(bc.HashEvent(first)); !exists {
+		t.Error("Earlier events should remain")
+	}
+}
+
+func TestRevocationInvalidatesLaterEvents(t *testing.T) {
+	log := logger.New("error")
+	bc := New(log)
+	rootPub, rootPriv, _ := ed25519.GenerateKey(rand.Reader)
+	recoveryPub, recoveryPriv, _ := ed25519.GenerateKey(rand.Reader)
+	attackerPub, attackerPriv, _ := ed25519.GenerateKey(rand.Reader)
+
+	invalid, _ := bc.CreateEvent("test_event", "Trusted", map[string]string{keyRecoveryPubKey: "xyz"}, []string{}, rootPub, rootPriv)
+	if err := bc.AddEvent(invalid); err == nil {
+		t.Error("Invalid recovery keys should be rejected")
+	}
+	trusted, _ := bc.CreateEvent("test_event", "Trusted", map[string]string{keyRecoveryPubKey: hexKey(recoveryPub)}, []string{}, rootPub, rootPriv)
+	bc.AddEvent(trusted)
+	leaked, _ := bc.CreateEvent("test_event", "Leaked", map[string]string{}, []string{bc.HashEvent(trusted)}, rootPub, rootPriv)
+	bc.AddEvent(leaked)
+
+	// Whoever holds the leaked root key rotates it to their own key first
+	rotation, _ := bc.NewKeyRotation([]string{bc.HashEvent(leaked)}, rootPub, rootPriv, attackerPub, attackerPriv)
+	if err := bc.AddEvent(rotation); err != nil {
+		t.Fatalf("Failed to add rotation: %v", err)
+	}
+	forged, _ := bc.CreateEvent("test_event", "Forged", map[string]string{}, []string{bc.HashEvent(rotation)}, attackerPub, attackerPriv)
+	bc.AddEvent(forged)
+
+	// The rotated root key has no say over the key it was rotated to
+	tip := []string{bc.HashEvent(forged)}
+	old, _ := bc.NewKeyRevocation(hexKey(rootPub), bc.HashEvent(trusted), tip, rootPub, rootPriv)
+	if err := bc.AddEvent(old); err == nil {
+		t.Error("A rotated key should not revoke keys of its identity")
+	}
+	successor, _ := bc.NewKeyRevocation(hexKey(attackerPub), "", tip, rootPub, rootPriv)
+	if err := bc.AddEvent(successor); err == nil {
+		t.Error("A rotated key should not revoke its successor")
+	}
+
+	outside, _ := bc.NewKeyRevocation(hexKey(rootPub), bc.HashEvent(forged), []string{bc.HashEvent(trusted)}, recoveryPub, recoveryPriv)
+	if err := bc.AddEvent(outside); err == nil {
+		t.Error("effective_from must be an ancestor of the revocation")
+	}
+
+	// The owner revokes the leaked root key with the recovery key
+	revocation, _ := bc.NewKeyRevocation(hexKey(rootPub), bc.HashEvent(trusted), tip, recoveryPub, recoveryPriv)
+	if err := bc.AddEvent(revocation); err != nil {
+		t.Fatalf("The recovery key should revoke the identity's keys: %v", err)
+	}
+	if len(bc.GetAgents()) != 1 {
+		t.Error("The recovery key should not become an identity")
+	}
+
+	if _, invalidated := bc.InvalidatedBy(bc.HashEvent(trusted)); invalidated {
+		t.Error("Events up to effective_from should stay valid")
+	}
+	for _, event := range []*Event{leaked, rotation, forged} {
+		if by, _ := bc.InvalidatedBy(bc.HashEvent(event)); by != bc.HashEvent(revocation) {
+			t.Errorf("Event %q should be invalidated by the revocation", event.Data.Description)
+		}
+	}
+
+	info := bc.GetAgents()[hexKey(rootPub)]
+	if !info.Revoked() || info.RevokedKeys() != 2 {
+		t.Errorf("Both the root key and the key it was rotated to should be revoked: %+v", info)
+	}
+	late, _ := bc.CreateEvent("test_event", "Attacker", map[string]string{}, []string{bc.HashEvent(revocation)}, attackerPub, attackerPriv)
+	if err := bc.AddEvent(late); !errors.Is(err, ErrKeyRevoked) {
+		t.Errorf("The attacker's key should be revoked, got %v", err)
+	}
+}
+
+func TestRecoveryKeysAreReserved(t *testing.T) {
+	log := logger.New("error")
+	bc := New(log)
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	otherPub, otherPriv, _ := ed25519.GenerateKey(rand.Reader)
+	recoveryPub, recoveryPriv, _ := ed25519.GenerateKey(rand.Reader)
+
+	first, _ := bc.CreateEvent("test_event", "First", map[string]string{keyRecoveryPubKey: hexKey(recoveryPub)}, []string{}, pub, priv)
+	if err := bc.AddEvent(first); err != nil {
+		t.Fatalf("Failed to add event: %v", err)
+	}
+
+	own, _ := bc.CreateEvent("test_event", "Own identity", map[string]string{}, []string{}, recoveryPub, recoveryPriv)
+	if err := bc.AddEvent(own); err == nil {
+		t.Error("A recovery key should not sign events of its own")
+	}
+	shared, _ := bc.CreateEvent("test_event", "Shared", map[string]string{keyRecoveryPubKey: hexKey(recoveryPub)}, []string{}, otherPub, otherPriv)
+	if err := bc.AddEvent(shared); err == nil {
+		t.Error("Two identities should not share a recovery key")
+	}
+	rotation, _ := bc.NewKeyRotation([]string{bc.HashEvent(first)}, otherPub, otherPriv, recoveryPub, recoveryPriv)
+	if err := bc.AddEvent(rotation); err == nil {
+		t.Error("A rotation should not adopt a recovery key")
+	}
+	if len(bc.GetAgents()) != 1 {
+		t.Errorf("Expected only the first identity, got %d", len(bc.GetAgents()))
+	}
+}
+
+func TestCurrentKeyRevokesLeakedKey(t *testing.T) {
+	log := logger.New("error")
+	bc := New(log)
+	oldPub, oldPriv, _ := ed25519.GenerateKey(rand.Reader)
+	newPub, newPriv, _ := ed25519.GenerateKey(rand.Reader)
+
+	trusted, _ := bc.CreateEvent("test_event", "Trusted", map[string]string{}, []string{}, oldPub, oldPriv)
+	bc.AddEvent(trusted)
+	forged, _ := bc.CreateEvent("test_event", "Forged", map[string]string{}, []string{bc.HashEvent(trusted)}, oldPub, oldPriv)
+	bc.AddEvent(forged)
+	rotation, _ := bc.NewKeyRotation([]string{bc.HashEvent(forged)}, oldPub, oldPriv, newPub, newPriv)
+	bc.AddEvent(rotation)
+
+	revocation, _ := bc.NewKeyRevocation(hexKey(oldPub), bc.HashEvent(trusted), []string{bc.HashEvent(rotation)}, newPub, newPriv)
+	if err := bc.AddEvent(revocation); err != nil {
+		t.Fatalf("The current key should revoke an older key: %v", err)
+	}
+	if _, invalidated := bc.InvalidatedBy(bc.HashEvent(forged)); !invalidated {
+		t.Error("Events after effective_from should be invalidated")
+	}
+	if _, invalidated := bc.InvalidatedBy(bc.HashEvent(rotation)); invalidated {
+		t.Error("The rotation to the revoking key should stay valid")
+	}
+	if info := bc.GetAgents()[hexKey(oldPub)]; info.Revoked() || info.RevokedKeys() != 1 {
+		t.Errorf("Only the old key should be revoked: %+v", info)
+	}
+}
+
+func TestAdmissionLimits(t *testing.T) {
+	log := logger.New("error")
+	bc := New(log)
+	bc.SetAdmissionPolicy(AdmissionPolicy{
+		MaxParents:     2,
+		MaxDescription: 16,
+		MaxPayloadKeys: 2,
+		AuthorRate:     1,
+		AuthorBurst:    2,
+		GlobalRate:     10,
+		GlobalBurst:    3,
+	})
+	now := time.Now()
+	bc.admission.now = func() time.Time { return now }
+
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	otherPub, otherPriv, _ := ed25519.GenerateKey(rand.Reader)
+
+	long, _ := bc.CreateEvent("test_event", strings.Repeat("x", 17), map[string]string{}, []string{}, pub, priv)
+	if err := bc.AddEvent(long); !errors.Is(err, ErrEventTooLarge) {
+		t.Errorf("Expected long description to be rejected, got %v", err)
+	}
+	payload := map[string]string{"a": "1", "b": "2", "c": "3"}
+	wide, _ := bc.CreateEvent("test_event", "Wide", payload, []string{}, pub, priv)
+	if err := bc.AddEvent(wide); !errors.Is(err, ErrEventTooLarge) {
+		t.Errorf("Expected too many payload keys to be rejected, got %v", err)
+	}
+	orphan, _ := bc.CreateEvent("test_event", "Orphan", map[string]string{}, []string{strings.Repeat("00", 32)}, pub, priv)
+	if err := bc.AddEvent(orphan); !errors.Is(err, ErrUnknownParent) {
+		t.Errorf("Expected unknown parent to be rejected, got %v", err)
+	}
+
+	// Invalid events used no tokens; the author's burst of 2 is used up, the third event must wait
+	for i := 0; i < 2; i++ {
+		event, _ := bc.CreateEvent("test_event", fmt.Sprintf("Event %d", i), map[string]string{}, []string{}, pub, priv)
+		if err := bc.AddEvent(event); err != nil {
+			t.Fatalf("Event %d should be admitted: %v", i, err)
+		}
+	}
+	third, _ := bc.CreateEvent("test_event", "Event 2", map[string]string{}, []string{}, pub, priv)
+	if err := bc.AddEvent(third); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("Expected author rate limit, got %v", err)
+	}
+
+	// Another author still has tokens, until the global burst of 3 is used up
+	other, _ := bc.CreateEvent("test_event", "Other 0", map[string]string{}, []string{}, otherPub, otherPriv)
+	if err := bc.AddEvent(other); err != nil {
+		t.Errorf("Other author should be admitted: %v", err)
+	}
+	other, _ = bc.CreateEvent("test_event", "Other 1", map[string]string{}, []string{}, otherPub, otherPriv)
+	if err := bc.AddEvent(other); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("Expected global rate limit, got %v", err)
+	}
+
+	now = now.Add(time.Second)
+	if err := bc.AddEvent(third); err != nil {
+		t.Errorf("Tokens should refill over time: %v", err)
+	}
+
+	stats := bc.AdmissionStats()
+	if stats.Admitted != 4 || stats.Rejected[RejectAuthorRate] != 1 || stats.Rejected[RejectGlobalRate] != 1 ||
+		stats.Rejected[RejectDescription] != 1 || stats.Rejected[RejectPayloadKeys] != 1 {
+		t.Errorf("Unexpected admission stats: %+v", stats)
+	}
+
+	// Imports are not rate limited
+	var buf bytes.Buffer
+	bc.Export(&buf)
+	restored := New(log)
+	restored.SetAdmissionPolicy(AdmissionPolicy{AuthorRate: 0.001, AuthorBurst: 1})
+	if _, err := restored.Import(&buf); err != nil {
+		t.Errorf("Import should bypass rate limits: %v", err)
+	}
+}
+
+func hexKey(pub ed25519.PublicKey) string {
+	return hex.EncodeToString(pub)
+}
+
 func BenchmarkCreateEvent(b *testing.B) {
 	log := logger.New("error")
 	bc := New(log)
@@ -229,4 +1403,161 @@ func BenchmarkHashEvent(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		bc.HashEvent(event)
 	}
-}
\ No newline at end of file
+}
+
+func TestEquivocationDetection(t *testing.T) {
+	log := logger.New("error")
+	bc := New(log)
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	reporterPub, reporterPriv, _ := ed25519.GenerateKey(rand.Reader)
+	otherPub, otherPriv, _ := ed25519.GenerateKey(rand.Reader)
+
+	root, _ := bc.CreateEvent("test_event", "Root", map[string]string{}, []string{}, pub, priv)
+	bc.AddEvent(root)
+	next, _ := bc.CreateEvent("test_event", "Next", map[string]string{}, []string{bc.HashEvent(root)}, pub, priv)
+	bc.AddEvent(next)
+	if len(bc.Equivocations()) != 0 || bc.GetAgents()[hexKey(pub)].Equivocated {
+		t.Fatal("Extending the chain should not be an equivocation")
+	}
+
+	// A second branch from root conflicts with next
+	fork, _ := bc.CreateEvent("test_event", "Fork", map[string]string{}, []string{bc.HashEvent(root)}, pub, priv)
+	if err := bc.AddEvent(fork); err != nil {
+		t.Fatalf("Conflicting events are still admitted: %v", err)
+	}
+	unreported := bc.UnreportedEquivocations()
+	if len(unreported) != 1 || unreported[0].First != bc.HashEvent(next) || unreported[0].Second != bc.HashEvent(fork) {
+		t.Fatalf("Expected one equivocation between next and fork, got %+v", unreported)
+	}
+	if !bc.GetAgents()[hexKey(pub)].Equivocated {
+		t.Error("Agent should be flagged")
+	}
+
+	proof, err := bc.NewEquivocationProof(unreported[0], reporterPub, reporterPriv)
+	if err != nil {
+		t.Fatalf("Failed to create proof: %v", err)
+	}
+	if err := bc.AddEvent(proof); err != nil {
+		t.Fatalf("Failed to add proof: %v", err)
+	}
+	if len(bc.UnreportedEquivocations()) != 0 || bc.Equivocations()[0].Proof != bc.HashEvent(proof) {
+		t.Error("Equivocation should be recorded as proven")
+	}
+	again, _ := bc.NewEquivocationProof(unreported[0], otherPub, otherPriv)
+	if err := bc.AddEvent(again); !errors.Is(err, ErrDuplicateEvent) {
+		t.Errorf("Proving an equivocation twice should be rejected as a duplicate, got %v", err)
+	}
+	if _, admitted := bc.GetEvent(bc.HashEvent(again)); admitted || bc.Equivocations()[0].Proof != bc.HashEvent(proof) {
+		t.Error("A duplicate proof should not be admitted")
+	}
+
+	padded, _ := bc.NewEquivocationProof(unreported[0], reporterPub, reporterPriv)
+	padded.Data.Payload["padding"] = strings.Repeat("x", 1<<20)
+	padded.Signature = SignHash(bc.HashEvent(padded), reporterPriv)
+	if err := bc.AddEvent(padded); err == nil || !strings.Contains(err.Error(), "unexpected payload key") {
+		t.Errorf("Proofs with extra payload keys should be rejected, got %v", err)
+	}
+
+	// Another node learns of the misbehavior from the proof alone
+	other := New(log)
+	for _, e := range []*Event{root, next, fork, proof} {
+		if err := other.AddEvent(e); err != nil {
+			t.Fatalf("Failed to replay event: %v", err)
+		}
+	}
+	if !other.GetAgents()[hexKey(pub)].Equivocated {
+		t.Error("Replaying the proof should flag the agent")
+	}
+
+	// Proofs of events that do not conflict are rejected
+	honest := Equivocation{Offender: hexKey(pub), First: bc.HashEvent(root), Second: bc.HashEvent(next)}
+	bogus, _ := bc.NewEquivocationProof(honest, reporterPub, reporterPriv)
+	if err := bc.AddEvent(bogus); err == nil {
+		t.Error("Proof of an honest chain should be rejected")
+	}
+}
+
+func TestReputation(t *testing.T) {
+	log := logger.New("error")
+	bc := New(log)
+	keys := make([]ed25519.PrivateKey, 4)
+	pubs := make([]ed25519.PublicKey, 4)
+	for i := range keys {
+		pubs[i], keys[i], _ = ed25519.GenerateKey(rand.Reader)
+	}
+	var events []*Event
+	add := func(eventType string, payload map[string]string, parents []string, i int) string {
+		event, _ := bc.CreateEvent(eventType, "Event", payload, parents, pubs[i], keys[i])
+		if err := bc.AddEvent(event); err != nil {
+			t.Fatalf("Failed to add event: %v", err)
+		}
+		events = append(events, event)
+		return bc.HashEvent(event)
+	}
+	initPayload := func(i int) map[string]string {
+		return map[string]string{"agent_id": hexKey(pubs[i])[:16], "state": "active", "version": "1.0.0"}
+	}
+
+	// Agents 1 and 2 build on agent 0; agent 1 endorses agent 2; agent 3
+	// ignores the event schema
+	root := add("initialization", initPayload(0), []string{}, 0)
+	add("initialization", initPayload(1), []string{root}, 1)
+	add("initialization", initPayload(2), []string{root}, 2)
+	add(TypeEndorse, map[string]string{endorseAgent: hexKey(pubs[2])}, []string{}, 1)
+	add(TypeEndorse, map[string]string{endorseAgent: hexKey(pubs[2])}, []string{}, 1)
+	add("state_change", map[string]string{}, []string{}, 3)
+
+	agents := bc.GetAgents()
+	top, endorsed, sloppy := agents[hexKey(pubs[0])].Reputation, agents[hexKey(pubs[2])].Reputation, agents[hexKey(pubs[3])].Reputation
+	if top.Rank != 1 || top.Score <= endorsed.Score || endorsed.Score <= agents[hexKey(pubs[1])].Reputation.Score {
+		t.Errorf("Referenced and endorsed agents should rank higher: %+v", agents)
+	}
+	if endorsed.Endorsements != 1 {
+		t.Errorf("Repeated endorsements should count once, got %d", endorsed.Endorsements)
+	}
+	if sloppy.Violations != 1 || sloppy.Conformity != 0 || sloppy.Score != 0 {
+		t.Errorf("Schema violations should lower the score: %+v", sloppy)
+	}
+
+	// Scores depend only on the events, not on when they were computed
+	other := New(log)
+	for _, event := range events {
+		if err := other.AddEvent(event); err != nil {
+			t.Fatalf("Failed to replay event: %v", err)
+		}
+	}
+	for identity, info := range other.GetAgents() {
+		if info.Reputation != agents[identity].Reputation {
+			t.Errorf("Scores differ for %s: %+v != %+v", identity, info.Reputation, agents[identity].Reputation)
+		}
+	}
+
+	// An agent silent for two hours has a quarter of its liveness
+	idle := New(log)
+	early := newEvent("state_change", "Earlier", map[string]string{"agent_id": "x", "action": "wait"}, []string{}, pubs[0])
+	early.Data.Timestamp = time.Now().Add(-2 * time.Hour).UTC().Format(time.RFC3339Nano)
+	early.Signature, _ = idle.signEvent(early, keys[0])
+	current, _ := idle.CreateEvent("state_change", "Now", map[string]string{"agent_id": "y", "action": "wait"}, []string{}, pubs[1], keys[1])
+	for _, event := range []*Event{early, current} {
+		if err := idle.AddEvent(event); err != nil {
+			t.Fatalf("Failed to add event: %v", err)
+		}
+	}
+	if liveness := idle.GetAgents()[hexKey(pubs[0])].Reputation.Liveness; liveness < 0.24 || liveness > 0.26 {
+		t.Errorf("Expected liveness of about 0.25, got %f", liveness)
+	}
+
+	// Events dated far ahead would make every other agent look idle
+	future := newEvent("state_change", "Later", map[string]string{"agent_id": "x", "action": "wait"}, []string{}, pubs[1])
+	future.Data.Timestamp = time.Now().AddDate(70, 0, 0).UTC().Format(time.RFC3339Nano)
+	future.Signature, _ = bc.signEvent(future, keys[1])
+	if err := bc.AddEvent(future); !errors.Is(err, ErrFutureEvent) {
+		t.Errorf("Far-future events should be rejected, got %v", err)
+	}
+
+	// Equivocating agents are not trusted at all
+	add("initialization", initPayload(0), []string{}, 0)
+	if score := bc.GetAgents()[hexKey(pubs[0])].Reputation.Score; score != 0 {
+		t.Errorf("Equivocating agent should have no reputation, got %f", score)
+	}
+}
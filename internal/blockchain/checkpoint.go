@@ -0,0 +1,536 @@
+package blockchain
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yanchenko-igor/blockchain-universe/internal/merkle"
+)
+
+// TypeCheckpoint is the event type of checkpoints
+const TypeCheckpoint = "checkpoint"
+
+// DefaultCheckpointQuorum is the default fraction of known agents that must
+// sign a checkpoint
+const DefaultCheckpointQuorum = 2.0 / 3.0
+
+// ErrInsufficientSignatures is returned when an event does not yet carry the
+// signatures its admission requires
+var ErrInsufficientSignatures = errors.New("insufficient signatures")
+
+// Checkpoint payload keys. A checkpoint commits to the state after the first
+// "position" admitted events:
+//   - merkle_root:  Merkle root over those events
+//   - merkle_peaks: comma-separated peaks of that tree, enough to resume it
+//   - state:        comma-separated identity records of every known agent, sorted,
+//     see encodeAgent
+//   - state_root:   Merkle root over the state entries
+const (
+	checkpointPosition   = "position"
+	checkpointMerkleRoot = "merkle_root"
+	checkpointPeaks      = "merkle_peaks"
+	checkpointState      = "state"
+	checkpointStateRoot  = "state_root"
+)
+
+// checkpointTracker tracks checkpoints and the bootstrap base
+type checkpointTracker struct {
+	quorum   float64
+	trusted  map[string]bool           // Keys counted toward quorums instead of the known agents
+	state    agentState                // Cache of the latest state computed by stateAt
+	history  map[string][]agentVersion // Identity records by identity, oldest first
+	latest   string                    // Hash of the latest admitted checkpoint
+	base     uint64                    // Events before the checkpoint this node bootstrapped from
+	baseTip  string                    // Hash of the event at base
+	frontier map[string]bool           // Pre-bootstrap hashes that may be referenced as parents
+}
+
+// agentState is each identity's record at a position
+type agentState struct {
+	position uint64
+	agents   map[string]*AgentInfo
+}
+
+// agentVersion is an identity record and the position it took effect at
+type agentVersion struct {
+	position uint64
+	info     *AgentInfo
+}
+
+// SetTrustedSigners sets the public keys whose signatures count toward
+// checkpoint quorums. Without trusted signers, a quorum is counted among the
+// agents known at the checkpoint's position; bootstrapping requires them,
+// since a fresh node knows no agents to check the checkpoint against.
+func (bc *Blockchain) SetTrustedSigners(keys []string) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	bc.checkpoints.trusted = make(map[string]bool, len(keys))
+	for _, key := range keys {
+		bc.checkpoints.trusted[key] = true
+	}
+}
+
+// SetCheckpointQuorum sets the fraction of known agents that must sign a checkpoint
+func (bc *Blockchain) SetCheckpointQuorum(quorum float64) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	bc.checkpoints.quorum = quorum
+}
+
+// LatestCheckpoint returns the most recently admitted checkpoint and the
+// position it commits to
+func (bc *Blockchain) LatestCheckpoint() (*Event, uint64, bool) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	if bc.checkpoints.latest == "" {
+		return nil, 0, false
+	}
+	event, err := bc.event(bc.checkpoints.latest)
+	if err != nil {
+		return nil, 0, false
+	}
+	position, _ := strconv.ParseUint(event.Data.Payload[checkpointPosition], 10, 64)
+	return event, position, true
+}
+
+// CheckpointDue reports whether at least interval events were admitted since
+// the latest checkpoint and no checkpoint is waiting for signatures
+func (bc *Blockchain) CheckpointDue(interval int) bool {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	now := time.Now()
+	for _, p := range bc.pending {
+		if p.event.Data.Type == TypeCheckpoint && now.Sub(p.proposed) <= pendingTTL {
+			return false
+		}
+	}
+
+	last := bc.checkpoints.base
+	if event, err := bc.event(bc.checkpoints.latest); err == nil {
+		last, _ = strconv.ParseUint(event.Data.Payload[checkpointPosition], 10, 64)
+	}
+	return interval > 0 && bc.tree.Size() >= last+uint64(interval)
+}
+
+// NewCheckpoint creates a checkpoint over all admitted events, signed by the
+// given key. Other agents add their signatures through the pending pool.
+func (bc *Blockchain) NewCheckpoint(pub ed25519.PublicKey, priv ed25519.PrivateKey) (*Event, error) {
+	bc.mu.RLock()
+	position := bc.tree.Size()
+	if len(bc.order) == 0 {
+		bc.mu.RUnlock()
+		return nil, fmt.Errorf("no events since the bootstrap checkpoint")
+	}
+	tip := bc.order[len(bc.order)-1]
+	payload, err := bc.checkpointPayload(position)
+	bc.mu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	return bc.CreateEvent(
+		TypeCheckpoint,
+		fmt.Sprintf("Checkpoint at position %d", position),
+		payload,
+		[]string{tip},
+		pub,
+		priv,
+	)
+}
+
+// CheckCheckpoint verifies that a checkpoint matches this node's view,
+// regardless of how many agents signed it
+func (bc *Blockchain) CheckCheckpoint(event *Event) error {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	_, err := bc.checkCheckpointContents(event)
+	return err
+}
+
+// checkpointPayload computes the payload for a checkpoint at position; bc.mu must be held
+func (bc *Blockchain) checkpointPayload(position uint64) (map[string]string, error) {
+	root, err := bc.tree.RootAt(position)
+	if err != nil {
+		return nil, err
+	}
+	peaks, err := bc.tree.Peaks(position)
+	if err != nil {
+		return nil, err
+	}
+	state, err := bc.stateAt(position)
+	if err != nil {
+		return nil, err
+	}
+
+	encodedPeaks := make([]string, len(peaks))
+	for i, peak := range peaks {
+		encodedPeaks[i] = peak.String()
+	}
+	encodedState := encodeState(state)
+
+	return map[string]string{
+		checkpointPosition:   strconv.FormatUint(position, 10),
+		checkpointMerkleRoot: root.String(),
+		checkpointPeaks:      strings.Join(encodedPeaks, ","),
+		checkpointState:      encodedState,
+		checkpointStateRoot:  stateRoot(encodedState).String(),
+	}, nil
+}
+
+// verifyCheckpoint checks a checkpoint's commitments and signer quorum; bc.mu must be held
+func (bc *Blockchain) verifyCheckpoint(event *Event) error {
+	state, err := bc.checkCheckpointContents(event)
+	if err != nil {
+		return err
+	}
+	return bc.checkQuorum(event, bc.quorumSigners(state))
+}
+
+// quorumSigners returns the keys whose signatures count toward the quorum of
+// a checkpoint committing to state: the trusted signers if any, otherwise the
+// current keys of the agents in state; bc.mu must be held
+func (bc *Blockchain) quorumSigners(state map[string]*AgentInfo) map[string]bool {
+	if len(bc.checkpoints.trusted) > 0 {
+		return bc.checkpoints.trusted
+	}
+
+	// Identities whose current key was revoked can no longer sign
+	known := make(map[string]bool, len(state))
+	for _, info := range state {
+		if !info.Revoked() {
+			known[info.PubKey] = true
+		}
+	}
+	return known
+}
+
+// checkCheckpointContents compares a checkpoint's payload and parent with this
+// node's view and returns the agent state it commits to; bc.mu must be held
+func (bc *Blockchain) checkCheckpointContents(event *Event) (map[string]*AgentInfo, error) {
+	position, err := strconv.ParseUint(event.Data.Payload[checkpointPosition], 10, 64)
+	if err != nil || position == 0 {
+		return nil, fmt.Errorf("invalid position %q", event.Data.Payload[checkpointPosition])
+	}
+	if position > bc.tree.Size() {
+		return nil, fmt.Errorf("position %d is ahead of this node (%d events)", position, bc.tree.Size())
+	}
+
+	expected, err := bc.checkpointPayload(position)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range []string{checkpointMerkleRoot, checkpointPeaks, checkpointState, checkpointStateRoot} {
+		if event.Data.Payload[key] != expected[key] {
+			return nil, fmt.Errorf("%s does not match at position %d", key, position)
+		}
+	}
+
+	if len(event.Parents) != 1 || event.Parents[0] != bc.hashAt(position) {
+		return nil, fmt.Errorf("checkpoint must have the event at position %d as its only parent", position)
+	}
+
+	state, _ := bc.stateAt(position)
+	return state, nil
+}
+
+// checkQuorum counts distinct signers of an event among the eligible keys
+func (bc *Blockchain) checkQuorum(event *Event, eligible map[string]bool) error {
+	signers := make(map[string]bool)
+	if eligible[event.AuthorPubKey] {
+		signers[event.AuthorPubKey] = true
+	}
+	for _, cosig := range event.Cosignatures {
+		if eligible[cosig.PubKey] {
+			signers[cosig.PubKey] = true
+		}
+	}
+
+	required := bc.requiredSigners(len(eligible))
+	if len(signers) < required {
+		return fmt.Errorf("%w: %d of %d required agents signed", ErrInsufficientSignatures, len(signers), required)
+	}
+	return nil
+}
+
+// requiredSigners returns how many of known agents must sign a checkpoint
+func (bc *Blockchain) requiredSigners(known int) int {
+	required := int(math.Ceil(bc.checkpoints.quorum*float64(known) - 1e-9))
+	return max(required, 1)
+}
+
+// hashAt returns the hash of the event at a 1-based position; bc.mu must be held
+func (bc *Blockchain) hashAt(position uint64) string {
+	base := bc.checkpoints.base
+	if position == base {
+		return bc.checkpoints.baseTip
+	}
+	if position < base {
+		return ""
+	}
+	return bc.order[position-base-1]
+}
+
+// stateAt returns each identity's record after the first position events,
+// from the versions recorded by setAgent. The result must not be modified;
+// bc.mu must be held.
+func (bc *Blockchain) stateAt(position uint64) (map[string]*AgentInfo, error) {
+	if base := bc.checkpoints.base; position < base {
+		return nil, fmt.Errorf("position %d is before the bootstrap checkpoint (%d)", position, base)
+	}
+
+	cached := bc.checkpoints.state
+	if cached.agents != nil && cached.position == position {
+		return cached.agents, nil
+	}
+
+	state := make(map[string]*AgentInfo, len(bc.checkpoints.history))
+	for identity, versions := range bc.checkpoints.history {
+		// Index of the first version after position
+		i := sort.Search(len(versions), func(i int) bool { return versions[i].position > position })
+		if i > 0 {
+			state[identity] = versions[i-1].info
+		}
+	}
+	bc.checkpoints.state = agentState{position: position, agents: state}
+	return state, nil
+}
+
+// setAgent stores an identity record and records it as the identity's version
+// at the current position; bc.mu must be held. Records are copied on write,
+// so versions are never modified after they are stored.
+func (bc *Blockchain) setAgent(identity string, info *AgentInfo) {
+	bc.agents[identity] = info
+
+	if bc.checkpoints.history == nil {
+		bc.checkpoints.history = make(map[string][]agentVersion)
+	}
+	position := bc.tree.Size()
+	versions := bc.checkpoints.history[identity]
+	if n := len(versions); n > 0 && versions[n-1].position == position {
+		versions[n-1].info = info
+	} else {
+		bc.checkpoints.history[identity] = append(versions, agentVersion{position: position, info: info})
+	}
+	if bc.checkpoints.state.position >= position {
+		bc.checkpoints.state = agentState{}
+	}
+}
+
+// encodeState serializes agent state as sorted identity records
+func encodeState(state map[string]*AgentInfo) string {
+	entries := make([]string, 0, len(state))
+	for _, info := range state {
+		entries = append(entries, encodeAgent(info))
+	}
+	sort.Strings(entries)
+	return strings.Join(entries, ",")
+}
+
+// encodeAgent serializes the parts of an identity record that decide which
+// events it may sign, as
+// "identity:last_event_hash:current_key:recovery_key:equivocated:keys", where
+// equivocated is 0 or 1 and keys are ";"-separated
+// "pubkey/added_by/rotated_by/revoked_by" in the identity's key order
+func encodeAgent(info *AgentInfo) string {
+	keys := make([]string, len(info.Keys))
+	for i, k := range info.Keys {
+		keys[i] = strings.Join([]string{k.PubKey, k.AddedBy, k.RotatedBy, k.RevokedBy}, "/")
+	}
+	equivocated := "0"
+	if info.Equivocated {
+		equivocated = "1"
+	}
+	return strings.Join([]string{
+		info.Identity,
+		info.LastEventHash,
+		info.PubKey,
+		info.RecoveryKey,
+		equivocated,
+		strings.Join(keys, ";"),
+	}, ":")
+}
+
+// decodeState parses the output of encodeState
+func decodeState(encoded string) (map[string]*AgentInfo, error) {
+	state := make(map[string]*AgentInfo)
+	if encoded == "" {
+		return state, nil
+	}
+	for _, entry := range strings.Split(encoded, ",") {
+		info, err := decodeAgent(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid state entry %q: %w", entry, err)
+		}
+		if _, exists := state[info.Identity]; exists {
+			return nil, fmt.Errorf("duplicate identity %s", info.Identity)
+		}
+		state[info.Identity] = info
+	}
+	return state, nil
+}
+
+// decodeAgent parses the output of encodeAgent
+func decodeAgent(entry string) (*AgentInfo, error) {
+	fields := strings.Split(entry, ":")
+	if len(fields) != 6 {
+		return nil, fmt.Errorf("expected 6 fields, got %d", len(fields))
+	}
+	info := &AgentInfo{
+		Identity:      fields[0],
+		LastEventHash: fields[1],
+		PubKey:        fields[2],
+		RecoveryKey:   fields[3],
+	}
+	switch fields[4] {
+	case "0":
+	case "1":
+		info.Equivocated = true
+	default:
+		return nil, fmt.Errorf("invalid equivocated flag %q", fields[4])
+	}
+
+	current := false
+	for _, key := range strings.Split(fields[5], ";") {
+		parts := strings.Split(key, "/")
+		if len(parts) != 4 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid key record %q", key)
+		}
+		info.Keys = append(info.Keys, KeyRecord{PubKey: parts[0], AddedBy: parts[1], RotatedBy: parts[2], RevokedBy: parts[3]})
+		current = current || parts[0] == info.PubKey
+	}
+	if info.Keys[0].PubKey != info.Identity || !current {
+		return nil, fmt.Errorf("keys must start with the identity and include the current key")
+	}
+	return info, nil
+}
+
+// stateRoot computes the Merkle root over encoded state entries
+func stateRoot(encoded string) merkle.Hash {
+	var b merkle.Builder
+	if encoded != "" {
+		for _, entry := range strings.Split(encoded, ",") {
+			b.Append([]byte(entry))
+		}
+	}
+	return b.Root()
+}
+
+// Bootstrap initializes an empty blockchain from a checkpoint instead of
+// replaying history from genesis. The checkpoint must be consistent with
+// itself and signed by a quorum of the trusted signers; without trusted
+// signers it is rejected, since anyone can sign a checkpoint listing only
+// themselves. Events after the checkpoint are then added as usual and may
+// reference the agents' last events at the checkpoint as parents.
+func (bc *Blockchain) Bootstrap(checkpoint *Event) error {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	if len(bc.order) > 0 || bc.checkpoints.base > 0 {
+		return fmt.Errorf("cannot bootstrap a non-empty blockchain")
+	}
+	if checkpoint.Data.Type != TypeCheckpoint {
+		return fmt.Errorf("event is not a checkpoint")
+	}
+	if err := bc.verifyEvent(checkpoint); err != nil {
+		return fmt.Errorf("checkpoint verification failed: %w", err)
+	}
+
+	payload := checkpoint.Data.Payload
+	position, err := strconv.ParseUint(payload[checkpointPosition], 10, 64)
+	if err != nil || position == 0 {
+		return fmt.Errorf("invalid checkpoint position %q", payload[checkpointPosition])
+	}
+	if stateRoot(payload[checkpointState]).String() != payload[checkpointStateRoot] {
+		return fmt.Errorf("checkpoint state does not match its state root")
+	}
+	state, err := decodeState(payload[checkpointState])
+	if err != nil {
+		return err
+	}
+
+	var peaks []merkle.Hash
+	for _, encoded := range strings.Split(payload[checkpointPeaks], ",") {
+		var peak merkle.Hash
+		if err := peak.UnmarshalText([]byte(encoded)); err != nil {
+			return fmt.Errorf("invalid checkpoint peak: %w", err)
+		}
+		peaks = append(peaks, peak)
+	}
+	tree, err := merkle.NewTreeFromPeaks(position, peaks)
+	if err != nil {
+		return fmt.Errorf("invalid checkpoint peaks: %w", err)
+	}
+	if tree.Root().String() != payload[checkpointMerkleRoot] {
+		return fmt.Errorf("checkpoint peaks do not match its Merkle root")
+	}
+
+	if len(bc.checkpoints.trusted) == 0 {
+		return fmt.Errorf("no trusted checkpoint signers configured")
+	}
+	if err := bc.checkQuorum(checkpoint, bc.checkpoints.trusted); err != nil {
+		return err
+	}
+
+	if len(checkpoint.Parents) != 1 {
+		return fmt.Errorf("checkpoint must have exactly one parent")
+	}
+
+	for _, info := range state {
+		for _, record := range info.Keys {
+			if identity, exists := bc.keys[record.PubKey]; exists && identity != info.Identity {
+				bc.keys = make(map[string]string)
+				return fmt.Errorf("key %s belongs to identities %s and %s", record.PubKey, identity, info.Identity)
+			}
+			bc.keys[record.PubKey] = info.Identity
+		}
+	}
+	for _, info := range state {
+		if info.RecoveryKey == "" {
+			continue
+		}
+		_, isKey := bc.keys[info.RecoveryKey]
+		if _, reserved := bc.recoveryKeys[info.RecoveryKey]; isKey || reserved {
+			bc.keys = make(map[string]string)
+			bc.recoveryKeys = make(map[string]string)
+			return fmt.Errorf("recovery key %s of identity %s is already in use", info.RecoveryKey, info.Identity)
+		}
+		bc.recoveryKeys[info.RecoveryKey] = info.Identity
+	}
+
+	bc.tree = tree
+	bc.checkpoints.base = position
+	bc.checkpoints.baseTip = checkpoint.Parents[0]
+	bc.checkpoints.state = agentState{}
+
+	frontier := make(map[string]bool, len(state)+1)
+	for identity, info := range state {
+		frontier[info.LastEventHash] = true
+		bc.setAgent(identity, info)
+	}
+	frontier[checkpoint.Parents[0]] = true
+	bc.checkpoints.frontier = frontier
+	bc.reputation.invalidate()
+
+	if err := bc.addComplete(checkpoint, false); err != nil {
+		bc.tree = &merkle.Tree{}
+		bc.agents = make(map[string]*AgentInfo)
+		bc.keys = make(map[string]string)
+		bc.recoveryKeys = make(map[string]string)
+		bc.checkpoints = checkpointTracker{quorum: bc.checkpoints.quorum, trusted: bc.checkpoints.trusted}
+		return err
+	}
+
+	bc.log.Info("Bootstrapped from checkpoint", "position", position, "agents", len(state))
+	return nil
+}
@@ -0,0 +1,93 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/yanchenko-igor/blockchain-universe/internal/merkle"
+)
+
+// Commitment is a Merkle root over the first Size events in admission order
+type Commitment struct {
+	Size uint64      `json:"size"`
+	Root merkle.Hash `json:"root"`
+}
+
+// MerkleRoot returns the commitment to all admitted events
+func (bc *Blockchain) MerkleRoot() Commitment {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	return Commitment{Size: bc.tree.Size(), Root: bc.tree.Root()}
+}
+
+// MerkleRootAt returns the commitment to the first size admitted events
+func (bc *Blockchain) MerkleRootAt(size uint64) (Commitment, error) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	root, err := bc.tree.RootAt(size)
+	if err != nil {
+		return Commitment{}, err
+	}
+	return Commitment{Size: size, Root: root}, nil
+}
+
+// InclusionProof proves that the event with the given hash is among the first
+// size admitted events. A size of 0 means the current size.
+func (bc *Blockchain) InclusionProof(hash string, size uint64) (*merkle.InclusionProof, error) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	index, exists := bc.index[hash]
+	if !exists {
+		return nil, fmt.Errorf("unknown event hash: %s", hash)
+	}
+	if size == 0 {
+		size = bc.tree.Size()
+	}
+	return bc.tree.InclusionProof(uint64(bc.position(index)-1), size)
+}
+
+// ConsistencyProof proves that the commitment at oldSize is a prefix of the
+// commitment at newSize. A newSize of 0 means the current size.
+func (bc *Blockchain) ConsistencyProof(oldSize, newSize uint64) (*merkle.ConsistencyProof, error) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	if newSize == 0 {
+		newSize = bc.tree.Size()
+	}
+	return bc.tree.ConsistencyProof(oldSize, newSize)
+}
+
+// EventLeaf returns the Merkle leaf hash of an event hash
+func EventLeaf(hash string) (merkle.Hash, error) {
+	data, err := hex.DecodeString(hash)
+	if err != nil {
+		return merkle.Hash{}, fmt.Errorf("invalid event hash: %w", err)
+	}
+	return merkle.LeafHash(data), nil
+}
+
+// VerifyInclusion checks an inclusion proof for an event hash against a
+// commitment. It needs no access to a Blockchain, so light clients and
+// auditors can use it with data received from a node.
+func VerifyInclusion(hash string, proof *merkle.InclusionProof, c Commitment) error {
+	if proof.Size != c.Size {
+		return fmt.Errorf("%w: proof is for size %d, commitment for %d", merkle.ErrInvalidProof, proof.Size, c.Size)
+	}
+	leaf, err := EventLeaf(hash)
+	if err != nil {
+		return err
+	}
+	return merkle.VerifyInclusion(leaf, proof, c.Root)
+}
+
+// VerifyConsistency checks that the old commitment is a prefix of the new one
+func VerifyConsistency(proof *merkle.ConsistencyProof, old, new Commitment) error {
+	if proof.OldSize != old.Size || proof.NewSize != new.Size {
+		return fmt.Errorf("%w: proof sizes do not match commitments", merkle.ErrInvalidProof)
+	}
+	return merkle.VerifyConsistency(proof, old.Root, new.Root)
+}
@@ -0,0 +1,231 @@
+package blockchain
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// TypeEquivocationProof is the event type recording that an agent extended
+// its chain with two conflicting events
+const TypeEquivocationProof = "equivocation_proof"
+
+// Equivocation proof payload keys. The conflicting events are embedded as
+// JSON so the proof can be checked without the rest of the DAG.
+const (
+	equivocationOffender = "offender"
+	equivocationFirst    = "first"
+	equivocationSecond   = "second"
+)
+
+// errAlreadyProven marks a proof of a fork that an admitted proof already
+// records; add rejects it as an ErrDuplicateEvent
+var errAlreadyProven = errors.New("equivocation already proven")
+
+// Equivocation is evidence that an author created two chain events neither of
+// which descends from the other
+type Equivocation struct {
+	Offender string `json:"offender"`
+	First    string `json:"first"`  // Hash of the earlier admitted event
+	Second   string `json:"second"` // Hash of the conflicting event
+	Proof    string `json:"proof,omitempty"`
+}
+
+// key identifies an equivocation regardless of event order
+func (e Equivocation) key() string {
+	if e.First < e.Second {
+		return e.First + e.Second
+	}
+	return e.Second + e.First
+}
+
+// chainEvent reports whether an event extends its author's chain. Checkpoints,
+// key management, proofs and multi-signature events reference other agents'
+// events and are not part of a single chain.
+func chainEvent(event *Event) bool {
+	switch event.Data.Type {
+	case TypeCheckpoint, TypeEquivocationProof, TypeKeyRotate, TypeKeyRevoke:
+		return false
+	}
+	return event.Data.Policy == nil
+}
+
+// detectEquivocation compares a newly admitted chain event with its author's
+// chain tip and records a fork; bc.mu must be held
+func (bc *Blockchain) detectEquivocation(hash string, event *Event) {
+	if !chainEvent(event) {
+		return
+	}
+	author := event.AuthorPubKey
+	tip, exists := bc.chainTips[author]
+	bc.chainTips[author] = hash
+	if !exists || bc.descendsFrom(hash, tip) {
+		return
+	}
+
+	eq := Equivocation{Offender: author, First: tip, Second: hash}
+	if _, known := bc.equivocations[eq.key()]; known {
+		return
+	}
+	bc.equivocations[eq.key()] = &eq
+	bc.flagEquivocation(author)
+	bc.log.Warn("Equivocation detected", "author", author, "first", tip, "second", hash)
+}
+
+// flagEquivocation marks the identity owning pubKey; bc.mu must be held
+func (bc *Blockchain) flagEquivocation(pubKey string) {
+	identity, exists := bc.keys[pubKey]
+	if !exists {
+		return
+	}
+	if bc.agents[identity].Equivocated {
+		return
+	}
+	info := *bc.agents[identity]
+	info.Equivocated = true
+	bc.setAgent(identity, &info)
+	// Equivocating agents' votes no longer count
+	bc.reputation.invalidate()
+}
+
+// Equivocations returns all detected equivocations, including those already
+// recorded in a proof event
+func (bc *Blockchain) Equivocations() []Equivocation {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	result := make([]Equivocation, 0, len(bc.equivocations))
+	for _, eq := range bc.equivocations {
+		result = append(result, *eq)
+	}
+	sort.Slice(result, func(i, j int) bool { return bc.index[result[i].Second] < bc.index[result[j].Second] })
+	return result
+}
+
+// UnreportedEquivocations returns detected equivocations without a proof event
+func (bc *Blockchain) UnreportedEquivocations() []Equivocation {
+	var result []Equivocation
+	for _, eq := range bc.Equivocations() {
+		if eq.Proof == "" {
+			result = append(result, eq)
+		}
+	}
+	return result
+}
+
+// NewEquivocationProof creates an equivocation_proof event for eq, signed by
+// the reporting agent. Its parents are the two conflicting events.
+func (bc *Blockchain) NewEquivocationProof(eq Equivocation, pub ed25519.PublicKey, priv ed25519.PrivateKey) (*Event, error) {
+	first, ok := bc.GetEvent(eq.First)
+	if !ok {
+		return nil, fmt.Errorf("unknown event hash: %s", eq.First)
+	}
+	second, ok := bc.GetEvent(eq.Second)
+	if !ok {
+		return nil, fmt.Errorf("unknown event hash: %s", eq.Second)
+	}
+	payload, err := equivocationPayload(eq.Offender, first, second)
+	if err != nil {
+		return nil, err
+	}
+
+	return bc.CreateEvent(
+		TypeEquivocationProof,
+		fmt.Sprintf("Agent %s extended its chain twice", shortKey(eq.Offender)),
+		payload,
+		[]string{eq.First, eq.Second},
+		pub,
+		priv,
+	)
+}
+
+// equivocationPayload embeds both conflicting events
+func equivocationPayload(offender string, first, second *Event) (map[string]string, error) {
+	firstJSON, err := json.Marshal(first)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode event: %w", err)
+	}
+	secondJSON, err := json.Marshal(second)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode event: %w", err)
+	}
+	return map[string]string{
+		equivocationOffender: offender,
+		equivocationFirst:    string(firstJSON),
+		equivocationSecond:   string(secondJSON),
+	}, nil
+}
+
+// validateEquivocationProof checks that a proof embeds two validly signed
+// chain events by the offender, matching its parents, neither of which
+// descends from the other; bc.mu must be held. Proofs are exempt from the
+// payload size limit, so other payload keys are rejected.
+func (bc *Blockchain) validateEquivocationProof(event *Event) error {
+	for key := range event.Data.Payload {
+		switch key {
+		case equivocationOffender, equivocationFirst, equivocationSecond:
+		default:
+			return fmt.Errorf("unexpected payload key %q", key)
+		}
+	}
+	offender := event.Data.Payload[equivocationOffender]
+	if len(event.Parents) != 2 {
+		return fmt.Errorf("proof must have the two conflicting events as parents")
+	}
+
+	var embedded [2]Event
+	for i, key := range []string{equivocationFirst, equivocationSecond} {
+		if err := json.Unmarshal([]byte(event.Data.Payload[key]), &embedded[i]); err != nil {
+			return fmt.Errorf("invalid %s event: %w", key, err)
+		}
+		e := &embedded[i]
+		if Hash(e) != event.Parents[i] {
+			return fmt.Errorf("%s event does not match parent %d", key, i+1)
+		}
+		if e.AuthorPubKey != offender {
+			return fmt.Errorf("%s event is not by the offender", key)
+		}
+		if !chainEvent(e) {
+			return fmt.Errorf("%s event does not extend a chain", key)
+		}
+		if err := bc.verifySignature(e.AuthorPubKey, e.Signature, event.Parents[i]); err != nil {
+			return fmt.Errorf("%s event: %w", key, err)
+		}
+	}
+
+	first, second := event.Parents[0], event.Parents[1]
+	if first == second || bc.descendsFrom(first, second) || bc.descendsFrom(second, first) {
+		return fmt.Errorf("events do not conflict")
+	}
+
+	eq := Equivocation{First: first, Second: second}
+	if existing, known := bc.equivocations[eq.key()]; known && existing.Proof != "" {
+		return fmt.Errorf("%w by %s", errAlreadyProven, existing.Proof)
+	}
+	return nil
+}
+
+// recordEquivocationProof applies an admitted proof; bc.mu must be held
+func (bc *Blockchain) recordEquivocationProof(hash string, event *Event) {
+	eq := Equivocation{
+		Offender: event.Data.Payload[equivocationOffender],
+		First:    event.Parents[0],
+		Second:   event.Parents[1],
+	}
+	if existing, known := bc.equivocations[eq.key()]; known {
+		eq = *existing
+	}
+	eq.Proof = hash
+	bc.equivocations[eq.key()] = &eq
+	bc.flagEquivocation(eq.Offender)
+}
+
+// shortKey abbreviates a public key for descriptions
+func shortKey(pubKey string) string {
+	if len(pubKey) > 16 {
+		return pubKey[:16]
+	}
+	return pubKey
+}
@@ -0,0 +1,274 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Graph export formats
+const (
+	FormatDOT     = "dot"
+	FormatGraphML = "graphml"
+	FormatJSONL   = "jsonl"
+)
+
+// GraphFilter selects a subgraph of the event DAG. Zero fields match everything.
+type GraphFilter struct {
+	Root   string    // Only the root event and its ancestors
+	Depth  int       // Maximum number of parent links followed from Root (0 = unlimited)
+	Author string    // Only events by this author public key
+	Since  time.Time // Only events with a timestamp at or after Since
+	Until  time.Time // Only events with a timestamp before Until
+}
+
+// GraphNode is an event in an exported graph
+type GraphNode struct {
+	ID          string `json:"id"`
+	Type        string `json:"type"`
+	Author      string `json:"author"`
+	Timestamp   string `json:"timestamp"`
+	Description string `json:"description"`
+}
+
+// GraphEdge is a parent link from a child event (Source) to its parent (Target)
+type GraphEdge struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+}
+
+// Graph is an exportable view of (part of) the event DAG
+type Graph struct {
+	Nodes []GraphNode
+	Edges []GraphEdge
+}
+
+// Subgraph returns the events matching the filter, in admission order, together
+// with the parent links between them
+func (bc *Blockchain) Subgraph(f GraphFilter) (*Graph, error) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	var reachable map[string]bool
+	if f.Root != "" {
+		if _, exists := bc.headers[f.Root]; !exists {
+			return nil, fmt.Errorf("unknown root event: %s", f.Root)
+		}
+		reachable = bc.ancestors(f.Root, f.Depth)
+	}
+
+	included := make(map[string]bool)
+	graph := &Graph{}
+	for _, hash := range bc.order {
+		header := bc.headers[hash]
+		if reachable != nil && !reachable[hash] {
+			continue
+		}
+		if f.Author != "" && header.AuthorPubKey != f.Author {
+			continue
+		}
+		if !f.Since.IsZero() || !f.Until.IsZero() {
+			ts, err := time.Parse(time.RFC3339Nano, header.Timestamp)
+			if err != nil {
+				continue
+			}
+			if (!f.Since.IsZero() && ts.Before(f.Since)) || (!f.Until.IsZero() && !ts.Before(f.Until)) {
+				continue
+			}
+		}
+
+		event, err := bc.event(hash)
+		if err != nil {
+			return nil, err
+		}
+		included[hash] = true
+		graph.Nodes = append(graph.Nodes, GraphNode{
+			ID:          hash,
+			Type:        header.Type,
+			Author:      header.AuthorPubKey,
+			Timestamp:   header.Timestamp,
+			Description: event.Data.Description,
+		})
+	}
+
+	for _, node := range graph.Nodes {
+		for _, parent := range bc.headers[node.ID].Parents {
+			if included[parent] {
+				graph.Edges = append(graph.Edges, GraphEdge{Source: node.ID, Target: parent})
+			}
+		}
+	}
+
+	return graph, nil
+}
+
+// ancestors returns the hash itself and its ancestors up to maxDepth parent
+// links away (0 = unlimited); bc.mu must be held
+func (bc *Blockchain) ancestors(hash string, maxDepth int) map[string]bool {
+	result := map[string]bool{hash: true}
+	frontier := []string{hash}
+	for depth := 0; len(frontier) > 0 && (maxDepth <= 0 || depth < maxDepth); depth++ {
+		var next []string
+		for _, h := range frontier {
+			header, exists := bc.headers[h]
+			if !exists {
+				continue
+			}
+			for _, parent := range header.Parents {
+				if !result[parent] {
+					result[parent] = true
+					next = append(next, parent)
+				}
+			}
+		}
+		frontier = next
+	}
+	return result
+}
+
+// Write encodes the graph in the given format
+func (g *Graph) Write(w io.Writer, format string) error {
+	switch format {
+	case FormatDOT:
+		return g.WriteDOT(w)
+	case FormatGraphML:
+		return g.WriteGraphML(w)
+	case FormatJSONL:
+		return g.WriteJSONL(w)
+	default:
+		return fmt.Errorf("unsupported graph format: %s", format)
+	}
+}
+
+// WriteDOT encodes the graph in Graphviz DOT format
+func (g *Graph) WriteDOT(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("digraph bu {\n\tnode [shape=box];\n")
+	for _, n := range g.Nodes {
+		fmt.Fprintf(&b, "\t%s [label=%s, type=%s, author=%s, timestamp=%s, description=%s];\n",
+			dotQuote(n.ID),
+			dotQuote(n.Type+"\n"+n.Description),
+			dotQuote(n.Type),
+			dotQuote(n.Author),
+			dotQuote(n.Timestamp),
+			dotQuote(n.Description),
+		)
+	}
+	for _, e := range g.Edges {
+		fmt.Fprintf(&b, "\t%s -> %s;\n", dotQuote(e.Source), dotQuote(e.Target))
+	}
+	b.WriteString("}\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// dotReplacer escapes the characters DOT does not allow verbatim in a quoted
+// string; everything else, including non-ASCII text, is written as is
+var dotReplacer = strings.NewReplacer(`"`, `\"`, `\`, `\\`, "\n", `\n`)
+
+// dotQuote returns s as a quoted DOT string
+func dotQuote(s string) string {
+	return `"` + dotReplacer.Replace(s) + `"`
+}
+
+// graphML mirrors the subset of the GraphML schema used for export
+type graphML struct {
+	XMLName xml.Name     `xml:"graphml"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	Keys    []graphMLKey `xml:"key"`
+	Graph   struct {
+		EdgeDefault string        `xml:"edgedefault,attr"`
+		Nodes       []graphMLNode `xml:"node"`
+		Edges       []graphMLEdge `xml:"edge"`
+	} `xml:"graph"`
+}
+
+type graphMLKey struct {
+	ID       string `xml:"id,attr"`
+	For      string `xml:"for,attr"`
+	AttrName string `xml:"attr.name,attr"`
+	AttrType string `xml:"attr.type,attr"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+type graphMLNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphMLData `xml:"data"`
+}
+
+type graphMLEdge struct {
+	Source string `xml:"source,attr"`
+	Target string `xml:"target,attr"`
+}
+
+// WriteGraphML encodes the graph in GraphML format
+func (g *Graph) WriteGraphML(w io.Writer) error {
+	doc := graphML{XMLNS: "http://graphml.graphdrawing.org/xmlns"}
+	for _, attr := range []string{"type", "author", "timestamp", "description"} {
+		doc.Keys = append(doc.Keys, graphMLKey{ID: attr, For: "node", AttrName: attr, AttrType: "string"})
+	}
+	doc.Graph.EdgeDefault = "directed"
+	for _, n := range g.Nodes {
+		doc.Graph.Nodes = append(doc.Graph.Nodes, graphMLNode{
+			ID: n.ID,
+			Data: []graphMLData{
+				{Key: "type", Value: n.Type},
+				{Key: "author", Value: n.Author},
+				{Key: "timestamp", Value: n.Timestamp},
+				{Key: "description", Value: n.Description},
+			},
+		})
+	}
+	for _, e := range g.Edges {
+		doc.Graph.Edges = append(doc.Graph.Edges, graphMLEdge{Source: e.Source, Target: e.Target})
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return fmt.Errorf("failed to encode GraphML: %w", err)
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// WriteJSONL encodes the graph as JSON lines. Every line is an object with a
+// "kind" field:
+//
+//	{"kind":"node","id":"<hash>","type":"...","author":"<pubkey>","timestamp":"...","description":"..."}
+//	{"kind":"edge","source":"<child hash>","target":"<parent hash>"}
+//
+// All node lines come before the edge lines.
+func (g *Graph) WriteJSONL(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	for _, n := range g.Nodes {
+		line := struct {
+			Kind string `json:"kind"`
+			GraphNode
+		}{"node", n}
+		if err := enc.Encode(line); err != nil {
+			return fmt.Errorf("failed to encode node: %w", err)
+		}
+	}
+	for _, e := range g.Edges {
+		line := struct {
+			Kind string `json:"kind"`
+			GraphEdge
+		}{"edge", e}
+		if err := enc.Encode(line); err != nil {
+			return fmt.Errorf("failed to encode edge: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,388 @@
+package blockchain
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Key management event types
+const (
+	// TypeKeyRotate replaces an agent's key. It is authored by the old key,
+	// cosigned by the new one and names the new key in its payload.
+	TypeKeyRotate = "key_rotate"
+	// TypeKeyRevoke invalidates a key. It is authored by the current key of
+	// the revoked key's identity, or by the identity's recovery key. With
+	// effective_from, the events the key authored after that point are
+	// invalidated as well.
+	TypeKeyRevoke = "key_revoke"
+)
+
+// Key management payload keys
+const (
+	keyNewPubKey     = "new_pubkey"
+	keyRevokedPubKey = "pubkey"
+	keyEffectiveFrom = "effective_from"
+	// keyRecoveryPubKey names an identity's recovery key in the payload of
+	// its first event. The recovery key is not one of the identity's keys and
+	// can only sign revocations of them.
+	keyRecoveryPubKey = "recovery_pubkey"
+)
+
+// ErrKeyRevoked is returned for events signed by a revoked key
+var ErrKeyRevoked = errors.New("key revoked")
+
+// ErrKeyRotated is returned for events signed by a key that was replaced
+var ErrKeyRotated = errors.New("key rotated")
+
+// KeyRecord is one key in an identity's history
+type KeyRecord struct {
+	PubKey    string `json:"pubkey"`
+	AddedBy   string `json:"added_by"`             // First event signed with the key, or the rotation introducing it
+	RotatedBy string `json:"rotated_by,omitempty"` // Rotation that replaced the key
+	RevokedBy string `json:"revoked_by,omitempty"` // Revocation of the key
+}
+
+// NewKeyRotation creates a key_rotate event that moves the identity of oldPub
+// to newPub. It is signed by both keys.
+func (bc *Blockchain) NewKeyRotation(
+	parents []string,
+	oldPub ed25519.PublicKey,
+	oldPriv ed25519.PrivateKey,
+	newPub ed25519.PublicKey,
+	newPriv ed25519.PrivateKey,
+) (*Event, error) {
+	newKey := hex.EncodeToString(newPub)
+	event, err := bc.CreateEvent(
+		TypeKeyRotate,
+		"Key rotation",
+		map[string]string{keyNewPubKey: newKey},
+		parents,
+		oldPub,
+		oldPriv,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := bc.HashEvent(event)
+	event.Cosignatures = []Cosignature{{PubKey: newKey, Signature: SignHash(hash, newPriv)}}
+	return event, nil
+}
+
+// NewKeyRevocation creates a key_revoke event for the revoked key, signed by
+// pub, which must be the identity's current key or its recovery key.
+// If effectiveFrom is set, the key is compromised since that event: every
+// event the key authored that is not effectiveFrom or one of its ancestors is
+// invalidated. effectiveFrom must be an ancestor of the revocation.
+func (bc *Blockchain) NewKeyRevocation(
+	revoked, effectiveFrom string,
+	parents []string,
+	pub ed25519.PublicKey,
+	priv ed25519.PrivateKey,
+) (*Event, error) {
+	payload := map[string]string{keyRevokedPubKey: revoked}
+	if effectiveFrom != "" {
+		payload[keyEffectiveFrom] = effectiveFrom
+	}
+	return bc.CreateEvent(TypeKeyRevoke, "Key revocation", payload, parents, pub, priv)
+}
+
+// checkKeys rejects events signed by rotated or revoked keys; bc.mu must be
+// held. A revoked key cannot sign revocations either: only the recovery key
+// may name the event it was compromised from after it revoked itself. Recovery
+// keys sign nothing but revocations of their identity's keys, so they never
+// become identities of their own.
+func (bc *Blockchain) checkKeys(event *Event) error {
+	if _, recovery := bc.recoveryKeys[event.AuthorPubKey]; recovery {
+		if _, ok := bc.recoverer(event); !ok {
+			return fmt.Errorf("recovery key %s can only revoke its identity's keys", event.AuthorPubKey)
+		}
+	} else if err := bc.checkKey(event.AuthorPubKey); err != nil {
+		return err
+	}
+	for _, cosig := range event.Cosignatures {
+		if _, recovery := bc.recoveryKeys[cosig.PubKey]; recovery {
+			return fmt.Errorf("cosignature: recovery key %s cannot cosign events", cosig.PubKey)
+		}
+		if err := bc.checkKey(cosig.PubKey); err != nil {
+			return fmt.Errorf("cosignature: %w", err)
+		}
+	}
+	return nil
+}
+
+// checkKey returns an error if pubKey was rotated or revoked; bc.mu must be held
+func (bc *Blockchain) checkKey(pubKey string) error {
+	record, exists := bc.keyRecord(pubKey)
+	switch {
+	case !exists:
+		return nil
+	case record.RevokedBy != "":
+		return fmt.Errorf("%w: %s by %s", ErrKeyRevoked, pubKey, record.RevokedBy)
+	case record.RotatedBy != "":
+		return fmt.Errorf("%w: %s by %s", ErrKeyRotated, pubKey, record.RotatedBy)
+	}
+	return nil
+}
+
+// revokedBy reports whether an event is a revocation that pubKey may sign:
+// pubKey is the unrevoked current key or the recovery key of the revoked key's
+// identity. Keys that were rotated away never may, so a leaked old key cannot
+// revoke its successors, and neither may a revoked key, so it cannot move
+// effective_from to invalidate more of the owner's history; bc.mu must be held.
+func (bc *Blockchain) revokedBy(event *Event, pubKey string) bool {
+	if event.Data.Type != TypeKeyRevoke {
+		return false
+	}
+	identity, exists := bc.keys[event.Data.Payload[keyRevokedPubKey]]
+	if !exists {
+		return false
+	}
+	info := bc.agents[identity]
+	if pubKey == info.RecoveryKey {
+		return true
+	}
+	return pubKey == info.PubKey && !info.Revoked()
+}
+
+// recoverer returns the identity whose recovery key authored a revocation, if
+// any; bc.mu must be held
+func (bc *Blockchain) recoverer(event *Event) (string, bool) {
+	if event.Data.Type != TypeKeyRevoke {
+		return "", false
+	}
+	identity, exists := bc.keys[event.Data.Payload[keyRevokedPubKey]]
+	if !exists || bc.recoveryKeys[event.AuthorPubKey] != identity {
+		return "", false
+	}
+	return identity, true
+}
+
+// validateRecoveryKey checks the recovery key named by an identity's first
+// event; bc.mu must be held
+func (bc *Blockchain) validateRecoveryKey(event *Event) error {
+	recovery, named := event.Data.Payload[keyRecoveryPubKey]
+	if _, known := bc.keys[event.AuthorPubKey]; known || !named {
+		return nil
+	}
+	if decoded, err := hex.DecodeString(recovery); err != nil || len(decoded) != ed25519.PublicKeySize {
+		return fmt.Errorf("invalid %s %q", keyRecoveryPubKey, recovery)
+	}
+	if recovery == event.AuthorPubKey {
+		return fmt.Errorf("%s must differ from the identity's key", keyRecoveryPubKey)
+	}
+	if _, exists := bc.keys[recovery]; exists {
+		return fmt.Errorf("key %s already belongs to an identity", recovery)
+	}
+	if identity, exists := bc.recoveryKeys[recovery]; exists {
+		return fmt.Errorf("key %s already recovers identity %s", recovery, identity)
+	}
+	return nil
+}
+
+// validateRotation checks a key_rotate event; bc.mu must be held
+func (bc *Blockchain) validateRotation(event *Event) error {
+	newKey := event.Data.Payload[keyNewPubKey]
+	if decoded, err := hex.DecodeString(newKey); err != nil || len(decoded) != ed25519.PublicKeySize {
+		return fmt.Errorf("invalid %s %q", keyNewPubKey, newKey)
+	}
+	if _, exists := bc.keys[newKey]; exists {
+		return fmt.Errorf("key %s already belongs to an identity", newKey)
+	}
+	if _, exists := bc.recoveryKeys[newKey]; exists {
+		return fmt.Errorf("key %s is a recovery key", newKey)
+	}
+	if !SignedBy(event, newKey) {
+		return fmt.Errorf("%w: rotation must be cosigned by the new key", ErrInsufficientSignatures)
+	}
+	return nil
+}
+
+// validateRevocation checks a key_revoke event; bc.mu must be held
+func (bc *Blockchain) validateRevocation(event *Event) error {
+	revoked := event.Data.Payload[keyRevokedPubKey]
+	_, exists := bc.keys[revoked]
+	if !exists {
+		return fmt.Errorf("unknown key %q", revoked)
+	}
+	if !bc.revokedBy(event, event.AuthorPubKey) {
+		return fmt.Errorf("key %s can only be revoked by its identity's current or recovery key", revoked)
+	}
+
+	from := event.Data.Payload[keyEffectiveFrom]
+	if record, _ := bc.keyRecord(revoked); record.RevokedBy != "" && from == "" {
+		return fmt.Errorf("key %s is already revoked by %s", revoked, record.RevokedBy)
+	}
+	if from != "" && !bc.reaches(event.Parents, from) {
+		return fmt.Errorf("%s %s is not an ancestor of the revocation", keyEffectiveFrom, from)
+	}
+	return nil
+}
+
+// reaches reports whether ancestor is one of parents or one of their
+// ancestors; bc.mu must be held
+func (bc *Blockchain) reaches(parents []string, ancestor string) bool {
+	for _, parent := range parents {
+		if parent == ancestor || bc.descendsFrom(parent, ancestor) {
+			return true
+		}
+	}
+	return false
+}
+
+// invalidateAfter applies a revocation effective from an event: every event
+// authored by key that is not from or one of its ancestors is invalidated.
+// Keys that invalidated rotations introduced are revoked as well, along with
+// all their events. Revocations are never invalidated, nor are rotations if
+// the current key revokes, since they lead to it; bc.mu must be held.
+func (bc *Blockchain) invalidateAfter(revocation, key, from string, info *AgentInfo) {
+	keepRotations := bc.headers[revocation].AuthorPubKey == info.PubKey
+	trusted := bc.ancestors(from, 0)
+	invalidated := 0
+	keys := []string{key}
+	for len(keys) > 0 {
+		key, keys = keys[0], keys[1:]
+		for _, hash := range bc.order {
+			header := bc.headers[hash]
+			if header.AuthorPubKey != key || header.Type == TypeKeyRevoke || trusted[hash] || bc.invalidated[hash] != "" {
+				continue
+			}
+			if keepRotations && header.Type == TypeKeyRotate {
+				continue
+			}
+			bc.invalidated[hash] = revocation
+			invalidated++
+			if header.Type != TypeKeyRotate {
+				continue
+			}
+			rotation, err := bc.event(hash)
+			if err != nil {
+				bc.log.Error("Failed to load invalidated rotation", "hash", hash, "error", err)
+				continue
+			}
+			newKey := rotation.Data.Payload[keyNewPubKey]
+			info.setKey(newKey, func(k *KeyRecord) {
+				if k.RevokedBy == "" {
+					k.RevokedBy = revocation
+				}
+			})
+			keys = append(keys, newKey)
+		}
+	}
+	bc.log.Warn("Events invalidated by key revocation", "revocation", revocation, "effective_from", from, "count", invalidated)
+}
+
+// InvalidatedBy returns the revocation that invalidated an admitted event, if
+// any: its author's key was compromised when the event was created
+func (bc *Blockchain) InvalidatedBy(hash string) (string, bool) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	revocation, invalidated := bc.invalidated[hash]
+	return revocation, invalidated
+}
+
+// trackAgent updates the identity record of an event's author and applies key
+// management events; bc.mu must be held and the event must be valid
+func (bc *Blockchain) trackAgent(hash string, event *Event) {
+	author := event.AuthorPubKey
+	identity, exists := bc.keys[author]
+	if recovered, ok := bc.recoverer(event); ok {
+		// Recovery keys act on the identity without joining it
+		identity, exists = recovered, true
+	}
+	if !exists {
+		identity = author
+		bc.keys[author] = identity
+		// validateRecoveryKey ensures the key is not reserved yet
+		if recovery := event.Data.Payload[keyRecoveryPubKey]; recovery != "" {
+			bc.recoveryKeys[recovery] = identity
+		}
+	}
+
+	// Copy on write, so records returned by GetAgents are never modified
+	info := &AgentInfo{
+		PubKey:      author,
+		Identity:    identity,
+		Keys:        []KeyRecord{{PubKey: author, AddedBy: hash}},
+		RecoveryKey: event.Data.Payload[keyRecoveryPubKey],
+	}
+	if existing, ok := bc.agents[identity]; ok {
+		copied := *existing
+		copied.Keys = append([]KeyRecord(nil), existing.Keys...)
+		info = &copied
+	}
+	info.LastEventHash = hash
+	info.LastSeen = time.Now()
+
+	switch event.Data.Type {
+	case TypeKeyRotate:
+		newKey := event.Data.Payload[keyNewPubKey]
+		info.setKey(author, func(k *KeyRecord) { k.RotatedBy = hash })
+		info.Keys = append(info.Keys, KeyRecord{PubKey: newKey, AddedBy: hash})
+		info.PubKey = newKey
+		bc.keys[newKey] = identity
+	case TypeKeyRevoke:
+		// validateRevocation ensures the revoked key belongs to this identity
+		revoked := event.Data.Payload[keyRevokedPubKey]
+		info.setKey(revoked, func(k *KeyRecord) {
+			if k.RevokedBy == "" {
+				k.RevokedBy = hash
+			}
+		})
+		if from := event.Data.Payload[keyEffectiveFrom]; from != "" {
+			bc.invalidateAfter(hash, revoked, from, info)
+		}
+	}
+
+	bc.setAgent(identity, info)
+}
+
+// keyRecord returns the history entry of a key; bc.mu must be held
+func (bc *Blockchain) keyRecord(pubKey string) (KeyRecord, bool) {
+	identity, exists := bc.keys[pubKey]
+	if !exists {
+		return KeyRecord{}, false
+	}
+	for _, record := range bc.agents[identity].Keys {
+		if record.PubKey == pubKey {
+			return record, true
+		}
+	}
+	return KeyRecord{}, false
+}
+
+// setKey updates the history entry of a key
+func (a *AgentInfo) setKey(pubKey string, update func(*KeyRecord)) {
+	for i := range a.Keys {
+		if a.Keys[i].PubKey == pubKey {
+			update(&a.Keys[i])
+		}
+	}
+}
+
+// Revoked reports whether the identity's current key was revoked, so the
+// agent can no longer sign events. Keys introduced by rotations that a
+// revocation invalidated count as revoked.
+func (a *AgentInfo) Revoked() bool {
+	for _, record := range a.Keys {
+		if record.PubKey == a.PubKey {
+			return record.RevokedBy != ""
+		}
+	}
+	return false
+}
+
+// RevokedKeys returns how many of the identity's keys were revoked
+func (a *AgentInfo) RevokedKeys() int {
+	revoked := 0
+	for _, record := range a.Keys {
+		if record.RevokedBy != "" {
+			revoked++
+		}
+	}
+	return revoked
+}
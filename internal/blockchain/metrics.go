@@ -0,0 +1,74 @@
+package blockchain
+
+import (
+	"errors"
+	"time"
+
+	"github.com/yanchenko-igor/blockchain-universe/pkg/metrics"
+)
+
+// Rejection reasons outside the admission policy, as reported in metrics
+const (
+	rejectSignature     = "signature"
+	rejectSignatures    = "insufficient_signatures"
+	rejectDuplicate     = "duplicate"
+	rejectUnknownParent = "unknown_parent"
+	rejectInvalid       = "invalid"
+)
+
+// verificationBuckets cover signature verification, which takes well under
+// a millisecond per signature
+var verificationBuckets = []float64{0.00005, 0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.05}
+
+// chainMetrics instruments event admission. Its fields are nil until
+// SetMetrics is called, and nil metrics ignore updates.
+type chainMetrics struct {
+	admitted     *metrics.Counter
+	rejected     *metrics.Counter
+	verification *metrics.Histogram
+}
+
+// SetMetrics registers the blockchain's metrics with reg
+func (bc *Blockchain) SetMetrics(reg *metrics.Registry) {
+	m := &chainMetrics{
+		admitted:     reg.NewCounter("bu_events_admitted_total", "Events admitted"),
+		rejected:     reg.NewCounter("bu_events_rejected_total", "Events rejected, by reason", "reason"),
+		verification: reg.NewHistogram("bu_event_verification_seconds", "Time spent verifying event signatures", verificationBuckets),
+	}
+
+	size := func(fn func() int) func() float64 {
+		return func() float64 {
+			bc.mu.RLock()
+			defer bc.mu.RUnlock()
+			return float64(fn())
+		}
+	}
+	reg.NewGaugeFunc("bu_events", "Admitted events", size(func() int { return len(bc.order) }))
+	reg.NewGaugeFunc("bu_events_in_memory", "Event bodies held in memory", size(func() int { return len(bc.events) }))
+	reg.NewGaugeFunc("bu_events_pruned", "Event bodies moved to the cold archive", size(func() int { return len(bc.coldIndex) }))
+	reg.NewGaugeFunc("bu_agents", "Known agent identities", size(func() int { return len(bc.agents) }))
+	reg.NewGaugeFunc("bu_keys", "Known agent keys", size(func() int { return len(bc.keys) }))
+	reg.NewGaugeFunc("bu_pending_events", "Events waiting for cosignatures", size(func() int { return len(bc.pending) }))
+	reg.NewGaugeFunc("bu_equivocations", "Detected equivocations", size(func() int { return len(bc.equivocations) }))
+	reg.NewGaugeFunc("bu_subscribers", "Event stream subscribers", size(func() int { return len(bc.subscribers) }))
+
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	bc.metrics = m
+}
+
+// observeVerification records the time spent verifying an event
+func (m *chainMetrics) observeVerification(start time.Time) {
+	m.verification.Observe(time.Since(start).Seconds())
+}
+
+// reject records a rejected event. Admission errors carry their own reason.
+func (m *chainMetrics) reject(reason string, err error) {
+	var r *rejection
+	if errors.As(err, &r) {
+		reason = r.reason
+	} else if errors.Is(err, ErrInsufficientSignatures) {
+		reason = rejectSignatures
+	}
+	m.rejected.Inc(reason)
+}
@@ -0,0 +1,106 @@
+package blockchain
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// SignaturePolicy requires an event to be signed by at least Threshold of the
+// listed Signers (M-of-N). The policy is part of the event data, so it is
+// covered by the hash and cannot be changed after signing. The author must be
+// one of the signers; the others add cosignatures.
+type SignaturePolicy struct {
+	Threshold int      `json:"threshold"`
+	Signers   []string `json:"signers"`
+}
+
+// CreateMultiSigEvent creates an event that requires signatures from several
+// agents, signed by the author. The event is admitted once enough signers
+// have cosigned it through the pending pool (see ProposeEvent and Cosign).
+func (bc *Blockchain) CreateMultiSigEvent(
+	eventType, description string,
+	payload map[string]string,
+	parents []string,
+	policy SignaturePolicy,
+	pub ed25519.PublicKey,
+	priv ed25519.PrivateKey,
+) (*Event, error) {
+	event := newEvent(eventType, description, payload, parents, pub)
+	event.Data.Policy = &policy
+	if err := checkPolicy(event); err != nil && !errors.Is(err, ErrInsufficientSignatures) {
+		return nil, err
+	}
+
+	signature, err := bc.signEvent(event, priv)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign event: %w", err)
+	}
+	event.Signature = signature
+
+	return event, nil
+}
+
+// checkPolicy checks the structure of an event's signature policy and whether
+// enough listed signers signed it. Signatures must already be verified.
+func checkPolicy(event *Event) error {
+	policy := event.Data.Policy
+	if policy == nil {
+		return nil
+	}
+
+	listed := make(map[string]bool, len(policy.Signers))
+	for _, signer := range policy.Signers {
+		if listed[signer] {
+			return fmt.Errorf("signer %s listed twice", signer)
+		}
+		listed[signer] = true
+	}
+	if policy.Threshold < 1 || policy.Threshold > len(policy.Signers) {
+		return fmt.Errorf("threshold %d out of range for %d signers", policy.Threshold, len(policy.Signers))
+	}
+	if !listed[event.AuthorPubKey] {
+		return fmt.Errorf("author is not a listed signer")
+	}
+
+	signed := map[string]bool{event.AuthorPubKey: true}
+	for _, cosig := range event.Cosignatures {
+		if !listed[cosig.PubKey] {
+			return fmt.Errorf("cosigner %s is not a listed signer", cosig.PubKey)
+		}
+		signed[cosig.PubKey] = true
+	}
+	if len(signed) < policy.Threshold {
+		return fmt.Errorf("%w: %d of %d required signers signed", ErrInsufficientSignatures, len(signed), policy.Threshold)
+	}
+	return nil
+}
+
+// eligibleSigners returns the keys whose cosignatures count toward admitting a
+// pending event: the listed signers of its policy, the quorum of a checkpoint
+// or the new key of a rotation. Other events take no cosignatures; bc.mu must
+// be held.
+func (bc *Blockchain) eligibleSigners(event *Event) map[string]bool {
+	switch {
+	case event.Data.Policy != nil:
+		listed := make(map[string]bool, len(event.Data.Policy.Signers))
+		for _, signer := range event.Data.Policy.Signers {
+			listed[signer] = true
+		}
+		return listed
+	case event.Data.Type == TypeCheckpoint:
+		position, err := strconv.ParseUint(event.Data.Payload[checkpointPosition], 10, 64)
+		if err != nil {
+			return nil
+		}
+		state, err := bc.stateAt(position)
+		if err != nil {
+			return nil
+		}
+		return bc.quorumSigners(state)
+	case event.Data.Type == TypeKeyRotate:
+		return map[string]bool{event.Data.Payload[keyNewPubKey]: true}
+	}
+	return nil
+}
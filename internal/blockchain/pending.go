@@ -0,0 +1,186 @@
+package blockchain
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Limits of the pool of events waiting for cosignatures. Events that do not
+// collect their signatures in time are dropped, so throwaway keys cannot keep
+// the pool full.
+const (
+	maxPendingEvents    = 1000
+	maxPendingPerAuthor = 10
+	pendingTTL          = time.Hour
+)
+
+// pendingEvent is an event in the pending pool
+type pendingEvent struct {
+	event    *Event
+	proposed time.Time
+}
+
+// expirePending drops pending events older than pendingTTL; bc.mu must be
+// held for writing
+func (bc *Blockchain) expirePending(now time.Time) {
+	for hash, p := range bc.pending {
+		if now.Sub(p.proposed) > pendingTTL {
+			delete(bc.pending, hash)
+			bc.log.Debug("Pending event expired", "hash", hash, "type", p.event.Data.Type)
+		}
+	}
+}
+
+// SignHash signs an event hash, e.g. to cosign a pending event
+func SignHash(hash string, priv ed25519.PrivateKey) string {
+	return hex.EncodeToString(ed25519.Sign(priv, []byte(hash)))
+}
+
+// ProposeEvent admits an event if it already carries the signatures it needs,
+// i.e. a checkpoint quorum or the threshold of its signature policy. Otherwise
+// the event is kept in the pending pool, where other agents can add
+// cosignatures until it can be admitted.
+func (bc *Blockchain) ProposeEvent(event *Event) (admitted bool, err error) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	err = bc.add(event, true)
+	if err == nil {
+		return true, nil
+	}
+	if !errors.Is(err, ErrInsufficientSignatures) {
+		return false, err
+	}
+
+	// Only keep events that can be admitted once they are cosigned
+	hash := bc.HashEvent(event)
+	if _, exists := bc.headers[hash]; exists {
+		return false, ErrDuplicateEvent
+	}
+	for _, parent := range event.Parents {
+		if !bc.known(parent) {
+			return false, fmt.Errorf("%w: %s", ErrUnknownParent, parent)
+		}
+	}
+	if _, exists := bc.pending[hash]; exists {
+		return false, nil
+	}
+	now := time.Now()
+	bc.expirePending(now)
+	if len(bc.pending) >= maxPendingEvents {
+		return false, fmt.Errorf("pending pool is full")
+	}
+	byAuthor := 0
+	for _, p := range bc.pending {
+		if p.event.AuthorPubKey == event.AuthorPubKey {
+			byAuthor++
+		}
+	}
+	if byAuthor >= maxPendingPerAuthor {
+		return false, fmt.Errorf("author already has %d pending events", byAuthor)
+	}
+	// add stops short of the rate limit for events lacking signatures, so
+	// this is the proposal's only token
+	if bc.admission != nil {
+		if err := bc.admission.takeToken(event.AuthorPubKey); err != nil {
+			return false, err
+		}
+	}
+	bc.pending[hash] = &pendingEvent{event: event, proposed: now}
+	bc.log.Debug("Event pending cosignatures", "hash", hash, "type", event.Data.Type)
+	return false, nil
+}
+
+// Cosign adds a cosignature to a pending event and admits the event once it
+// has enough signatures. Only keys whose signatures count toward admitting the
+// event may cosign it, and each cosignature is charged to the cosigner's
+// admission rate.
+func (bc *Blockchain) Cosign(hash, pubKey, signature string) (admitted bool, err error) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	bc.expirePending(time.Now())
+	p, exists := bc.pending[hash]
+	if !exists {
+		return false, fmt.Errorf("no pending event with hash %s", hash)
+	}
+	event := p.event
+	eligible := bc.eligibleSigners(event)
+	if !eligible[pubKey] {
+		return false, fmt.Errorf("%s is not an eligible signer", pubKey)
+	}
+	if len(event.Cosignatures) >= len(eligible) {
+		return false, fmt.Errorf("event already has %d cosignatures", len(event.Cosignatures))
+	}
+	if err := bc.verifySignature(pubKey, signature, hash); err != nil {
+		return false, fmt.Errorf("invalid cosignature: %w", err)
+	}
+	if SignedBy(event, pubKey) {
+		return false, nil
+	}
+	if bc.admission != nil {
+		if err := bc.admission.takeToken(pubKey); err != nil {
+			return false, err
+		}
+	}
+
+	cosigned := *event
+	cosigned.Cosignatures = append(append([]Cosignature(nil), event.Cosignatures...), Cosignature{
+		PubKey:    pubKey,
+		Signature: signature,
+	})
+	p.event = &cosigned
+
+	// The proposal and this cosignature were already rate limited
+	err = bc.add(&cosigned, false)
+	if err == nil {
+		return true, nil
+	}
+	if errors.Is(err, ErrInsufficientSignatures) {
+		return false, nil
+	}
+
+	// The event can no longer be admitted, e.g. because it became a duplicate
+	delete(bc.pending, hash)
+	return false, err
+}
+
+// PendingEvents returns the events waiting for cosignatures, oldest first
+func (bc *Blockchain) PendingEvents() []*Event {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	now := time.Now()
+	pending := make([]*pendingEvent, 0, len(bc.pending))
+	for _, p := range bc.pending {
+		if now.Sub(p.proposed) <= pendingTTL {
+			pending = append(pending, p)
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].proposed.Before(pending[j].proposed)
+	})
+
+	events := make([]*Event, len(pending))
+	for i, p := range pending {
+		events[i] = p.event
+	}
+	return events
+}
+
+// SignedBy reports whether pubKey authored or cosigned an event
+func SignedBy(event *Event, pubKey string) bool {
+	if event.AuthorPubKey == pubKey {
+		return true
+	}
+	for _, cosig := range event.Cosignatures {
+		if cosig.PubKey == pubKey {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,264 @@
+package blockchain
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// EventHeader is the part of an event that stays in memory after its body
+// was pruned: enough to check parent links, track agents and build graphs
+type EventHeader struct {
+	Type         string
+	Timestamp    string
+	Parents      []string
+	AuthorPubKey string
+	Admitted     time.Time // When this node admitted the event
+}
+
+// PrunePolicy selects which event bodies stay in memory. An event is kept if
+// either rule retains it; zero fields retain nothing. Pruned bodies are moved
+// to the cold archive and reloaded on demand.
+type PrunePolicy struct {
+	KeepEvents   int           // Keep the most recently admitted events
+	KeepDuration time.Duration // Keep events admitted within this duration
+	ArchivePath  string        // Cold archive file for pruned bodies
+}
+
+// headerOf returns the header of an event
+func headerOf(event *Event) *EventHeader {
+	return &EventHeader{
+		Type:         event.Data.Type,
+		Timestamp:    event.Data.Timestamp,
+		Parents:      event.Parents,
+		AuthorPubKey: event.AuthorPubKey,
+		Admitted:     time.Now(),
+	}
+}
+
+// coldEntry locates a pruned event body in the cold archive
+type coldEntry struct {
+	offset int64
+	length int64
+}
+
+// coldArchive is an append-only file of JSON-encoded events, one per line
+type coldArchive struct {
+	file  *os.File
+	size  int64
+	index map[string]coldEntry // Every event in the file, by hash
+}
+
+// openColdArchive opens or creates a cold archive. The index of existing
+// events is rebuilt from the file, so events pruned before a restart are
+// found again instead of being appended a second time. A line cut short by a
+// crash is dropped.
+func openColdArchive(path string) (*coldArchive, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open cold archive: %w", err)
+	}
+	c := &coldArchive{file: f, index: make(map[string]coldEntry)}
+	if err := c.rebuildIndex(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// rebuildIndex reads every event in the file and truncates a trailing
+// partial line
+func (c *coldArchive) rebuildIndex() error {
+	r := bufio.NewReader(c.file)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err != nil {
+			// Without a newline the last write did not complete
+			break
+		}
+		var event Event
+		if err := json.Unmarshal(line, &event); err != nil {
+			return fmt.Errorf("failed to read cold archive at offset %d: %w", c.size, err)
+		}
+		c.index[Hash(&event)] = coldEntry{offset: c.size, length: int64(len(line))}
+		c.size += int64(len(line))
+	}
+	if err := c.file.Truncate(c.size); err != nil {
+		return fmt.Errorf("failed to truncate cold archive: %w", err)
+	}
+	return nil
+}
+
+// put appends an event unless the archive already holds it and returns its
+// location
+func (c *coldArchive) put(hash string, event *Event) (coldEntry, error) {
+	if entry, exists := c.index[hash]; exists {
+		return entry, nil
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		return coldEntry{}, fmt.Errorf("failed to encode event: %w", err)
+	}
+	data = append(data, '\n')
+	if _, err := c.file.WriteAt(data, c.size); err != nil {
+		return coldEntry{}, fmt.Errorf("failed to write cold archive: %w", err)
+	}
+	entry := coldEntry{offset: c.size, length: int64(len(data))}
+	c.size += entry.length
+	c.index[hash] = entry
+	return entry, nil
+}
+
+// get reads an event back. It is safe for concurrent use.
+func (c *coldArchive) get(entry coldEntry) (*Event, error) {
+	data := make([]byte, entry.length)
+	if _, err := c.file.ReadAt(data, entry.offset); err != nil {
+		return nil, fmt.Errorf("failed to read cold archive: %w", err)
+	}
+	var event Event
+	if err := json.Unmarshal(data, &event); err != nil {
+		return nil, fmt.Errorf("failed to decode archived event: %w", err)
+	}
+	return &event, nil
+}
+
+// SetPrunePolicy enables pruning with the given policy and opens its cold archive
+func (bc *Blockchain) SetPrunePolicy(policy PrunePolicy) error {
+	if policy.ArchivePath == "" {
+		return fmt.Errorf("prune policy requires an archive path")
+	}
+	archive, err := openColdArchive(policy.ArchivePath)
+	if err != nil {
+		return err
+	}
+
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	if bc.cold != nil && len(bc.coldIndex) > 0 {
+		archive.file.Close()
+		return fmt.Errorf("cannot change the cold archive after events were pruned")
+	}
+	if bc.cold != nil {
+		bc.cold.file.Close()
+	}
+	bc.prune = policy
+	bc.cold = archive
+	return nil
+}
+
+// Close releases the cold archive, if any
+func (bc *Blockchain) Close() error {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	if bc.cold == nil {
+		return nil
+	}
+	err := bc.cold.file.Close()
+	bc.cold = nil
+	return err
+}
+
+// Prune moves the bodies of events outside the policy's retention window to
+// the cold archive and returns how many were pruned. Events that are needed to
+// validate newer ones are never pruned: each agent's latest event, the latest
+// checkpoint and the parents of pending events.
+func (bc *Blockchain) Prune() (int, error) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	return bc.pruneBodies(true)
+}
+
+// pruneBodies implements Prune; byAge applies the policy's KeepDuration.
+// bc.mu must be held for writing.
+func (bc *Blockchain) pruneBodies(byAge bool) (int, error) {
+	if bc.cold == nil {
+		return 0, nil
+	}
+
+	retained := make(map[string]bool)
+	for _, info := range bc.agents {
+		retained[info.LastEventHash] = true
+	}
+	retained[bc.checkpoints.latest] = true
+	bc.expirePending(time.Now())
+	for _, p := range bc.pending {
+		for _, parent := range p.event.Parents {
+			retained[parent] = true
+		}
+	}
+
+	pruned := 0
+	archive := func(hash string) error {
+		entry, err := bc.cold.put(hash, bc.events[hash])
+		if err != nil {
+			return err
+		}
+		bc.coldIndex[hash] = entry
+		delete(bc.events, hash)
+		pruned++
+		return nil
+	}
+
+	// Only events held back earlier and those past the low-water mark can
+	// have bodies to prune, so each event is scanned once
+	for hash := range bc.heldBack {
+		if retained[hash] {
+			continue
+		}
+		if err := archive(hash); err != nil {
+			return pruned, err
+		}
+		delete(bc.heldBack, hash)
+	}
+
+	end := len(bc.order) - bc.prune.KeepEvents
+	cutoff := time.Now().Add(-bc.prune.KeepDuration)
+	for ; bc.pruneFrom < end; bc.pruneFrom++ {
+		hash := bc.order[bc.pruneFrom]
+		if _, exists := bc.events[hash]; !exists {
+			continue
+		}
+		// Timestamps are set by authors; retention goes by admission time,
+		// which only grows along the order
+		if byAge && bc.prune.KeepDuration > 0 && bc.headers[hash].Admitted.After(cutoff) {
+			break
+		}
+		if retained[hash] {
+			bc.heldBack[hash] = true
+			continue
+		}
+		if err := archive(hash); err != nil {
+			return pruned, err
+		}
+	}
+
+	if pruned > 0 {
+		bc.log.Info("Events pruned", "count", pruned, "in_memory", len(bc.events), "archived", len(bc.coldIndex))
+	}
+	return pruned, nil
+}
+
+// event returns the full event with the given hash, reloading it from the cold
+// archive if it was pruned; bc.mu must be held
+func (bc *Blockchain) event(hash string) (*Event, error) {
+	if event, exists := bc.events[hash]; exists {
+		return event, nil
+	}
+	entry, pruned := bc.coldIndex[hash]
+	if !pruned || bc.cold == nil {
+		return nil, fmt.Errorf("unknown event hash: %s", hash)
+	}
+	event, err := bc.cold.get(entry)
+	if err != nil {
+		return nil, err
+	}
+	if Hash(event) != hash {
+		return nil, fmt.Errorf("archived event %s is corrupt", hash)
+	}
+	return event, nil
+}
@@ -0,0 +1,258 @@
+package blockchain
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// TypeEndorse is the event type an agent uses to vouch for another agent.
+// Its payload names the endorsed agent by identity or key.
+const TypeEndorse = "endorse"
+
+// endorseAgent is the endorse payload key naming the endorsed agent
+const endorseAgent = "agent"
+
+// Reputation parameters
+const (
+	reputationDamping    = 0.85
+	reputationIterations = 50
+	endorsementWeight    = 5.0 // An endorsement counts as this many parent references
+	livenessHalfLife     = time.Hour
+)
+
+// eventSchemas lists the payload keys required by well-known event types.
+// Events violating them are admitted but lower their author's reputation.
+var eventSchemas = map[string][]string{
+	"initialization": {"agent_id", "state", "version"},
+	"state_change":   {"agent_id", "action"},
+	TypeEndorse:      {endorseAgent},
+}
+
+// Reputation is an agent's trust score and the observations it is derived
+// from. It depends only on the admitted events, so every node holding the
+// same events computes the same scores.
+type Reputation struct {
+	Score        float64 `json:"score"`        // Rank × liveness × conformity, 0 for equivocating agents
+	Rank         float64 `json:"rank"`         // PageRank over references and endorsements, 1 for the top agent
+	Liveness     float64 `json:"liveness"`     // Halves per hour the agent's last event is behind the newest event
+	Conformity   float64 `json:"conformity"`   // Fraction of the agent's events matching their schema
+	Events       int     `json:"events"`       // Events authored
+	Violations   int     `json:"violations"`   // Schema violations
+	Endorsements int     `json:"endorsements"` // Distinct agents endorsing this one
+}
+
+// reputationStats are the per-identity observations, updated per event
+type reputationStats struct {
+	events     int
+	violations int
+	last       time.Time          // Timestamp of the latest event
+	out        map[string]float64 // Reference weight towards other identities
+	endorsedBy map[string]bool
+}
+
+// reputationTracker observes admitted events incrementally and recomputes
+// scores lazily when they are read after a change. Ranks are only recomputed
+// when the reference graph changed, not for events extending a chain.
+type reputationTracker struct {
+	stats      map[string]*reputationStats
+	newest     time.Time // Newest event timestamp
+	scores     map[string]Reputation
+	dirty      bool
+	ranks      map[string]float64
+	ranksDirty bool
+	mu         sync.Mutex
+}
+
+func newReputationTracker() *reputationTracker {
+	return &reputationTracker{stats: make(map[string]*reputationStats)}
+}
+
+// statsFor returns the stats of an identity, creating them; rt.mu must be held
+func (rt *reputationTracker) statsFor(identity string) *reputationStats {
+	s, exists := rt.stats[identity]
+	if !exists {
+		s = &reputationStats{out: make(map[string]float64), endorsedBy: make(map[string]bool)}
+		rt.stats[identity] = s
+		rt.ranksDirty = true
+	}
+	return s
+}
+
+// invalidate forces scores and ranks to be recomputed on the next read
+func (rt *reputationTracker) invalidate() {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	rt.dirty = true
+	rt.ranksDirty = true
+}
+
+// observeReputation records an admitted event's contribution to its author's
+// reputation; bc.mu must be held
+func (bc *Blockchain) observeReputation(event *Event) {
+	rt := bc.reputation
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	author := bc.keys[event.AuthorPubKey]
+	s := rt.statsFor(author)
+	s.events++
+	rt.dirty = true
+
+	timestamp, err := time.Parse(time.RFC3339Nano, event.Data.Timestamp)
+	if err != nil {
+		s.violations++
+	} else {
+		if timestamp.After(s.last) {
+			s.last = timestamp
+		}
+		if timestamp.After(rt.newest) {
+			rt.newest = timestamp
+		}
+	}
+	for _, key := range eventSchemas[event.Data.Type] {
+		if _, ok := event.Data.Payload[key]; !ok {
+			s.violations++
+			break
+		}
+	}
+
+	// Referencing another agent's event is an implicit vote for it
+	for _, parent := range event.Parents {
+		header, exists := bc.headers[parent]
+		if !exists {
+			continue
+		}
+		if target := bc.keys[header.AuthorPubKey]; target != author {
+			s.out[target]++
+			rt.ranksDirty = true
+		}
+	}
+
+	if event.Data.Type == TypeEndorse {
+		target, known := bc.keys[event.Data.Payload[endorseAgent]]
+		switch {
+		case !known || target == author:
+			s.violations++
+		case !rt.statsFor(target).endorsedBy[author]:
+			// Repeated endorsements of the same agent count once
+			rt.stats[target].endorsedBy[author] = true
+			s.out[target] += endorsementWeight
+			rt.ranksDirty = true
+		}
+	}
+}
+
+// reputations returns the scores of all identities, recomputing them if
+// events were admitted since the last call; bc.mu must be held for reading
+func (bc *Blockchain) reputations() map[string]Reputation {
+	rt := bc.reputation
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	if !rt.dirty && rt.scores != nil {
+		return rt.scores
+	}
+
+	identities := make([]string, 0, len(bc.agents))
+	for identity := range bc.agents {
+		identities = append(identities, identity)
+	}
+	sort.Strings(identities)
+
+	if rt.ranksDirty || len(rt.ranks) != len(identities) {
+		rt.ranks = rt.pageRank(identities, func(identity string) bool { return bc.agents[identity].Equivocated })
+		rt.ranksDirty = false
+	}
+	ranks := rt.ranks
+
+	scores := make(map[string]Reputation, len(identities))
+	for _, identity := range identities {
+		r := Reputation{Rank: ranks[identity], Conformity: 1}
+		if s, exists := rt.stats[identity]; exists {
+			r.Events = s.events
+			r.Violations = s.violations
+			r.Endorsements = len(s.endorsedBy)
+			if s.events > 0 {
+				r.Conformity = math.Max(0, 1-float64(s.violations)/float64(s.events))
+			}
+			if !s.last.IsZero() {
+				r.Liveness = math.Pow(0.5, float64(rt.newest.Sub(s.last))/float64(livenessHalfLife))
+			}
+		}
+		if !bc.agents[identity].Equivocated {
+			r.Score = r.Rank * r.Liveness * r.Conformity
+		}
+		scores[identity] = r
+	}
+
+	rt.scores = scores
+	rt.dirty = false
+	return scores
+}
+
+// pageRank computes ranks over the weighted reference graph, scaled so the
+// highest rank is 1. Equivocating agents' votes are ignored. Identities must
+// be sorted so the result is deterministic; rt.mu must be held.
+func (rt *reputationTracker) pageRank(identities []string, equivocated func(string) bool) map[string]float64 {
+	type edge struct {
+		to     int
+		weight float64
+	}
+	position := make(map[string]int, len(identities))
+	for i, identity := range identities {
+		position[identity] = i
+	}
+	edges := make([][]edge, len(identities))
+	totals := make([]float64, len(identities))
+	for i, identity := range identities {
+		s, exists := rt.stats[identity]
+		if !exists || equivocated(identity) {
+			continue
+		}
+		for target, weight := range s.out {
+			if j, known := position[target]; known {
+				edges[i] = append(edges[i], edge{j, weight})
+			}
+		}
+		sort.Slice(edges[i], func(a, b int) bool { return edges[i][a].to < edges[i][b].to })
+		for _, e := range edges[i] {
+			totals[i] += e.weight
+		}
+	}
+
+	n := float64(len(identities))
+	rank := make([]float64, len(identities))
+	for i := range rank {
+		rank[i] = 1 / n
+	}
+	for range reputationIterations {
+		next := make([]float64, len(identities))
+		dangling := 0.0
+		for i, out := range edges {
+			if totals[i] == 0 {
+				dangling += rank[i]
+				continue
+			}
+			for _, e := range out {
+				next[e.to] += rank[i] * e.weight / totals[i]
+			}
+		}
+		for i := range next {
+			next[i] = (1-reputationDamping)/n + reputationDamping*(next[i]+dangling/n)
+		}
+		rank = next
+	}
+
+	top := 0.0
+	for _, r := range rank {
+		top = math.Max(top, r)
+	}
+	result := make(map[string]float64, len(identities))
+	for i, identity := range identities {
+		result[identity] = rank[i] / top
+	}
+	return result
+}
@@ -0,0 +1,220 @@
+package blockchain
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultSubscriptionBuffer is used when a subscriber does not specify a buffer size
+const DefaultSubscriptionBuffer = 64
+
+// Notification describes an admitted event delivered to subscribers
+type Notification struct {
+	Seq   int    // Position in admission order, starting at 1
+	Hash  string // Event hash
+	Event *Event
+}
+
+// SlowConsumerPolicy defines what happens when a subscriber's buffer is full
+type SlowConsumerPolicy int
+
+const (
+	// DropNewest discards the incoming notification for the slow subscriber
+	DropNewest SlowConsumerPolicy = iota
+	// DropOldest discards the oldest buffered notification to make room
+	DropOldest
+	// Disconnect closes the subscription
+	Disconnect
+)
+
+// SubscriptionFilter selects which admitted events a subscriber receives.
+// Empty fields match everything.
+type SubscriptionFilter struct {
+	Types    []string // Event types to include
+	Authors  []string // Author public keys (hex) to include
+	Ancestor string   // Only events descending from this hash
+}
+
+// SubscribeOptions configures a subscription
+type SubscribeOptions struct {
+	Filter SubscriptionFilter
+	Buffer int
+	Policy SlowConsumerPolicy
+}
+
+// Subscription receives notifications for admitted events
+type Subscription struct {
+	bc      *Blockchain
+	ch      chan Notification
+	filter  SubscriptionFilter
+	policy  SlowConsumerPolicy
+	dropped atomic.Uint64
+	once    sync.Once
+
+	// With an ancestor filter: the ancestor and its known descendants, kept
+	// up to date as events are admitted, so matching never walks the DAG
+	lineageMu sync.Mutex
+	lineage   map[string]bool
+}
+
+// Subscribe registers a new subscriber that is notified of every admitted
+// event matching the filter. The caller must call Close when done.
+func (bc *Blockchain) Subscribe(opts SubscribeOptions) *Subscription {
+	if opts.Buffer <= 0 {
+		opts.Buffer = DefaultSubscriptionBuffer
+	}
+
+	sub := &Subscription{
+		bc:     bc,
+		ch:     make(chan Notification, opts.Buffer),
+		filter: opts.Filter,
+		policy: opts.Policy,
+	}
+
+	// Collect the descendants admitted so far under the read lock, then catch
+	// up on events admitted in between while registering
+	seen := 0
+	if opts.Filter.Ancestor != "" {
+		sub.lineage = map[string]bool{opts.Filter.Ancestor: true}
+		bc.mu.RLock()
+		seen = bc.extendLineage(sub.lineage, 0)
+		bc.mu.RUnlock()
+	}
+
+	bc.mu.Lock()
+	if sub.lineage != nil {
+		bc.extendLineage(sub.lineage, seen)
+	}
+	bc.subscribers[sub] = struct{}{}
+	bc.mu.Unlock()
+
+	return sub
+}
+
+// extendLineage adds the descendants among the events admitted from position
+// start on to lineage and returns the number of admitted events. Parents are
+// admitted before their children, so a single pass in admission order finds
+// them all. bc.mu must be held.
+func (bc *Blockchain) extendLineage(lineage map[string]bool, start int) int {
+	for _, hash := range bc.order[start:] {
+		if !lineage[hash] && anyOf(bc.headers[hash].Parents, lineage) {
+			lineage[hash] = true
+		}
+	}
+	return len(bc.order)
+}
+
+// anyOf reports whether any of hashes is in set
+func anyOf(hashes []string, set map[string]bool) bool {
+	for _, h := range hashes {
+		if set[h] {
+			return true
+		}
+	}
+	return false
+}
+
+// C returns the channel notifications are delivered on. It is closed when the
+// subscription ends, either by Close or by the Disconnect policy.
+func (s *Subscription) C() <-chan Notification {
+	return s.ch
+}
+
+// Dropped returns the number of notifications dropped for this subscriber
+func (s *Subscription) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Matches reports whether a notification passes the subscription filter
+func (s *Subscription) Matches(n Notification) bool {
+	return s.matches(n)
+}
+
+// Close unregisters the subscription and closes its channel
+func (s *Subscription) Close() {
+	s.bc.mu.Lock()
+	defer s.bc.mu.Unlock()
+
+	s.closeLocked()
+}
+
+// closeLocked removes the subscription; bc.mu must be held for writing
+func (s *Subscription) closeLocked() {
+	s.once.Do(func() {
+		delete(s.bc.subscribers, s)
+		close(s.ch)
+	})
+}
+
+// notify delivers a notification to all matching subscribers; bc.mu must be
+// held for writing
+func (bc *Blockchain) notify(n Notification) {
+	for sub := range bc.subscribers {
+		if !sub.matches(n) {
+			continue
+		}
+		sub.deliver(n)
+	}
+}
+
+// deliver performs a non-blocking send honouring the slow consumer policy
+func (s *Subscription) deliver(n Notification) {
+	select {
+	case s.ch <- n:
+		return
+	default:
+	}
+
+	switch s.policy {
+	case DropOldest:
+		select {
+		case <-s.ch:
+			s.dropped.Add(1)
+		default:
+		}
+		select {
+		case s.ch <- n:
+		default:
+			s.dropped.Add(1)
+		}
+	case Disconnect:
+		s.dropped.Add(1)
+		s.bc.log.Warn("Disconnecting slow subscriber", "dropped", s.dropped.Load())
+		s.closeLocked()
+	default:
+		s.dropped.Add(1)
+	}
+}
+
+// matches applies the filter. An event descends from the ancestor if one of
+// its parents is in the lineage; it then joins the lineage itself.
+func (s *Subscription) matches(n Notification) bool {
+	f := s.filter
+	if f.Ancestor != "" {
+		s.lineageMu.Lock()
+		descends := n.Hash != f.Ancestor && (s.lineage[n.Hash] || anyOf(n.Event.Parents, s.lineage))
+		if descends {
+			s.lineage[n.Hash] = true
+		}
+		s.lineageMu.Unlock()
+		if !descends {
+			return false
+		}
+	}
+	if len(f.Types) > 0 && !contains(f.Types, n.Event.Data.Type) {
+		return false
+	}
+	if len(f.Authors) > 0 && !contains(f.Authors, n.Event.AuthorPubKey) {
+		return false
+	}
+	return true
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
@@ -2,102 +2,312 @@ package config
 
 import (
 	"fmt"
-	"os"
 	"time"
 
-	"gopkg.in/yaml.v3"
+	"github.com/yanchenko-igor/blockchain-universe/pkg/logger"
 )
 
 // Config represents the application configuration
 type Config struct {
-	Agent AgentConfig `yaml:"agent"`
-	LLM   LLMConfig   `yaml:"llm"`
+	Agent      AgentConfig      `yaml:"agent"`
+	LLM        LLMConfig        `yaml:"llm"`
+	HTTP       HTTPConfig       `yaml:"http"`
+	Blockchain BlockchainConfig `yaml:"blockchain"`
+	Admission  AdmissionConfig  `yaml:"admission"`
+	Tracing    TracingConfig    `yaml:"tracing"`
+	Logging    LoggingConfig    `yaml:"logging"`
+	Agents     []AgentSpec      `yaml:"agents"` // Run several agents instead of the one described by agent and llm
+	Scheduler  SchedulerConfig  `yaml:"scheduler"`
 }
 
 // AgentConfig contains agent-specific configuration
 type AgentConfig struct {
-	DecisionInterval time.Duration `yaml:"decision_interval"`
-	MaxEventChain    int           `yaml:"max_event_chain"`
+	Name               string        `yaml:"name"`     // Identifies the agent in logs
+	KeyFile            string        `yaml:"key_file"` // Keystore entry, created on first start; empty for a new key per start
+	Persona            string        `yaml:"persona"`  // Appended to the system prompt
+	DecisionInterval   time.Duration `yaml:"decision_interval"`
+	MaxEventChain      int           `yaml:"max_event_chain"`
+	CheckpointInterval int           `yaml:"checkpoint_interval"` // Events between proposed checkpoints (0 = never)
+	Policy             PolicyConfig  `yaml:"policy"`              // How the agent decides on its next event
+	Triggers           TriggerConfig `yaml:"triggers"`            // Admitted events that start a decision cycle early
+	Budget             BudgetConfig  `yaml:"budget"`              // Limits of LLM usage
+}
+
+// What an agent does once its budget is exhausted
+const (
+	BudgetPause    = "pause"    // Skip decision cycles until the budget allows more
+	BudgetFallback = "fallback" // Decide with the fallback policy
+)
+
+// BudgetConfig limits the LLM usage of an agent per clock hour and day (UTC).
+// Limits of 0 are unlimited.
+type BudgetConfig struct {
+	TokensPerHour  int           `yaml:"tokens_per_hour"`
+	TokensPerDay   int           `yaml:"tokens_per_day"`
+	CostPerDay     float64       `yaml:"cost_per_day"`    // In the currency of llm.costs
+	OnExhausted    string        `yaml:"on_exhausted"`    // pause or fallback
+	Fallback       PolicyConfig  `yaml:"fallback"`        // Used while the budget is exhausted
+	ReportInterval time.Duration `yaml:"report_interval"` // Between energy_report events (0 = never)
+}
+
+// Limited reports whether any limit is set
+func (b BudgetConfig) Limited() bool {
+	return b.TokensPerHour > 0 || b.TokensPerDay > 0 || b.CostPerDay > 0
+}
+
+// TriggerConfig selects the admitted events that wake an agent before its
+// next decision cycle is due. Events the agent created never do.
+type TriggerConfig struct {
+	Mentions    bool          `yaml:"mentions"`     // Events naming the agent by name or public key
+	NewAgents   bool          `yaml:"new_agents"`   // Initialization events of other agents
+	Types       []string      `yaml:"types"`        // Events of these types
+	Patterns    []string      `yaml:"patterns"`     // Regular expressions matched against descriptions
+	Debounce    time.Duration `yaml:"debounce"`     // Quiet time after the last trigger before waking
+	MinInterval time.Duration `yaml:"min_interval"` // Least time between early wakeups
+}
+
+// Enabled reports whether any trigger is configured
+func (t TriggerConfig) Enabled() bool {
+	return t.Mentions || t.NewAgents || len(t.Types) > 0 || len(t.Patterns) > 0
+}
+
+// Decision policy types
+const (
+	PolicyLLM      = "llm"      // Ask the LLM
+	PolicyRules    = "rules"    // First matching rule
+	PolicyRandom   = "random"   // Random descriptions, for load testing
+	PolicyScripted = "scripted" // Steps of a YAML scenario
+	PolicyEnsemble = "ensemble" // Pick or vote among member policies
+)
+
+// Ensemble modes
+const (
+	EnsembleFirst  = "first"  // First member that decides
+	EnsembleRandom = "random" // A member chosen at random by weight
+	EnsembleVote   = "vote"   // The description most members agree on
+)
+
+// PolicyConfig selects and configures a decision policy
+type PolicyConfig struct {
+	Type         string         `yaml:"type"`
+	Rules        []RuleConfig   `yaml:"rules"`        // rules
+	Descriptions []string       `yaml:"descriptions"` // random: picked from; built-in ones if empty
+	Seed         int64          `yaml:"seed"`         // random: 0 for a different sequence every start
+	Scenario     string         `yaml:"scenario"`     // scripted: path to the scenario file
+	Loop         bool           `yaml:"loop"`         // scripted: start over after the last step
+	Mode         string         `yaml:"mode"`         // ensemble
+	Members      []PolicyConfig `yaml:"members"`      // ensemble
+	Weight       float64        `yaml:"weight"`       // Of a member in random ensembles; 0 counts as 1
+}
+
+// RuleConfig is a rule of a rule-based policy. The first rule whose
+// conditions all hold decides; a rule without conditions always holds.
+type RuleConfig struct {
+	When        RuleCondition     `yaml:"when"`
+	Type        string            `yaml:"type"`        // Event type, state_change if empty
+	Description string            `yaml:"description"` // Go template over the agent's state
+	Payload     map[string]string `yaml:"payload"`
+}
+
+// RuleCondition holds if all of its set fields hold
+type RuleCondition struct {
+	LastEventType string `yaml:"last_event_type"` // Type of the most recent event
+	MinAgents     int    `yaml:"min_agents"`      // Known agents
+	MaxAgents     int    `yaml:"max_agents"`      // 0 = unlimited
+	Equivocation  bool   `yaml:"equivocation"`    // A known agent equivocated
+	Every         int    `yaml:"every"`           // Every N-th decision cycle
 }
 
 // LLMConfig contains LLM client configuration
 type LLMConfig struct {
-	APIEndpoint    string  `yaml:"api_endpoint"`
-	APIKey         string  `yaml:"api_key"`
-	Model          string  `yaml:"model"`
-	MaxTokens      int     `yaml:"max_tokens"`
-	Temperature    float64 `yaml:"temperature"`
-	TimeoutSeconds int     `yaml:"timeout_seconds"`
+	APIEndpoint    string             `yaml:"api_endpoint"`
+	APIKey         string             `yaml:"api_key"`
+	APIKeyFile     string             `yaml:"api_key_file"` // Read the API key from this file instead
+	Model          string             `yaml:"model"`
+	MaxTokens      int                `yaml:"max_tokens"`
+	Temperature    float64            `yaml:"temperature"`
+	TimeoutSeconds int                `yaml:"timeout_seconds"`
+	MaxRetries     int                `yaml:"max_retries"` // Retries of transient failures, off by default (0 or negative = none)
+	Stream         bool               `yaml:"stream"`      // Stream completions as SSE or NDJSON, stopping at a complete JSON object
+	Cache          CacheConfig        `yaml:"cache"`
+	Costs          map[string]float64 `yaml:"costs"` // Cost of 1000 tokens, by model
 }
 
-// Load loads configuration from a YAML file
-func Load(path string) (*Config, error) {
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read config file: %w", err)
-	}
+// LLM cache backends
+const (
+	CacheMemory = "memory" // Least recently used entries are evicted
+	CacheDisk   = "disk"   // One file per entry
+)
 
-	var cfg Config
-	if err := yaml.Unmarshal(data, &cfg); err != nil {
-		return nil, fmt.Errorf("failed to parse config file: %w", err)
-	}
+// CacheConfig controls caching of completions. Completions are only cached
+// at temperature 0, unless always is set.
+type CacheConfig struct {
+	Backend string        `yaml:"backend"` // memory, disk or empty to disable caching
+	Size    int           `yaml:"size"`    // Most entries kept
+	Path    string        `yaml:"path"`    // disk: directory of the entries
+	TTL     time.Duration `yaml:"ttl"`     // How long entries are used (0 = forever)
+	Always  bool          `yaml:"always"`  // Also cache at temperatures above 0
+}
 
-	// Apply defaults
-	cfg.applyDefaults()
+// AgentSpec declares one of several agents run by the process. Keys an entry
+// leaves out take their values from the agent and llm sections.
+type AgentSpec struct {
+	Agent AgentConfig `yaml:",inline"`
+	LLM   LLMConfig   `yaml:",inline"`
+}
+
+// String describes the agent without its API key
+func (s AgentSpec) String() string {
+	return fmt.Sprintf("{name=%s key_file=%s model=%s api_endpoint=%s temperature=%g decision_interval=%s}",
+		s.Agent.Name, s.Agent.KeyFile, s.LLM.Model, s.LLM.APIEndpoint, s.LLM.Temperature, s.Agent.DecisionInterval)
+}
 
-	// Validate configuration
-	if err := cfg.validate(); err != nil {
-		return nil, fmt.Errorf("invalid configuration: %w", err)
+// Instances returns the agents to run: the agents entries, or a single agent
+// described by the agent and llm sections
+func (c *Config) Instances() []AgentSpec {
+	if len(c.Agents) > 0 {
+		return c.Agents
 	}
+	return []AgentSpec{{Agent: c.Agent, LLM: c.LLM}}
+}
 
-	return &cfg, nil
+// SchedulerConfig controls how decision cycles of agents are scheduled
+type SchedulerConfig struct {
+	Workers         int           `yaml:"workers"`          // Decision cycles run in parallel (0 = one per agent)
+	Jitter          float64       `yaml:"jitter"`           // Random change of every interval, as a fraction of it
+	Overrun         string        `yaml:"overrun"`          // Ticks while a cycle is in flight: skip or coalesce
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"` // How long to wait for cancelled cycles on shutdown
 }
 
-// applyDefaults sets default values for missing configuration
-func (c *Config) applyDefaults() {
-	if c.Agent.DecisionInterval == 0 {
-		c.Agent.DecisionInterval = 30 * time.Second
-	}
-	if c.Agent.MaxEventChain == 0 {
-		c.Agent.MaxEventChain = 100
-	}
-	if c.LLM.MaxTokens == 0 {
-		c.LLM.MaxTokens = 150
-	}
-	if c.LLM.Temperature == 0 {
-		c.LLM.Temperature = 0.7
-	}
-	if c.LLM.TimeoutSeconds == 0 {
-		c.LLM.TimeoutSeconds = 30
-	}
-	if c.LLM.Model == "" {
-		c.LLM.Model = "llama3.2"
-	}
+// What the scheduler does with ticks of a task whose previous run is still in
+// flight
+const (
+	OverrunSkip     = "skip"     // Drop them
+	OverrunCoalesce = "coalesce" // Run once more as soon as the run in flight ends
+)
+
+// HTTPConfig contains HTTP API server configuration
+type HTTPConfig struct {
+	ListenAddr   string `yaml:"listen_addr"`
+	StreamBuffer int    `yaml:"stream_buffer"`
 }
 
-// validate checks if the configuration is valid
-func (c *Config) validate() error {
-	if c.LLM.APIEndpoint == "" {
-		return fmt.Errorf("llm.api_endpoint is required")
-	}
-	if c.Agent.DecisionInterval < time.Second {
-		return fmt.Errorf("agent.decision_interval must be at least 1 second")
-	}
-	if c.LLM.MaxTokens < 10 {
-		return fmt.Errorf("llm.max_tokens must be at least 10")
-	}
-	if c.LLM.Temperature < 0 || c.LLM.Temperature > 2 {
-		return fmt.Errorf("llm.temperature must be between 0 and 2")
+// BlockchainConfig contains event store configuration
+type BlockchainConfig struct {
+	CheckpointQuorum float64     `yaml:"checkpoint_quorum"` // Fraction of known agents that must sign a checkpoint
+	BootstrapArchive string      `yaml:"bootstrap_archive"` // Archive to import at startup
+	TrustedSigners   []string    `yaml:"trusted_signers"`   // Public keys that sign checkpoints for quorums and bootstrapping
+	Prune            PruneConfig `yaml:"prune"`
+}
+
+// PruneConfig selects which event bodies stay in memory. Pruning is enabled
+// when Archive is set.
+type PruneConfig struct {
+	KeepEvents   int           `yaml:"keep_events"`   // Keep the most recent events
+	KeepDuration time.Duration `yaml:"keep_duration"` // Keep events younger than this
+	Archive      string        `yaml:"archive"`       // Cold archive for pruned bodies
+}
+
+// AdmissionConfig limits the events a node accepts; 0 disables a limit
+type AdmissionConfig struct {
+	MaxParents      int     `yaml:"max_parents"`
+	MaxDescription  int     `yaml:"max_description"`
+	MaxPayloadKeys  int     `yaml:"max_payload_keys"`
+	MaxPayloadBytes int     `yaml:"max_payload_bytes"`
+	AuthorRate      float64 `yaml:"author_rate"`  // Events per second per author
+	AuthorBurst     int     `yaml:"author_burst"` // Events an idle author may submit at once
+	GlobalRate      float64 `yaml:"global_rate"`  // Events per second across all authors
+	GlobalBurst     int     `yaml:"global_burst"`
+}
+
+// TracingConfig selects where decision cycle spans are exported. Tracing is
+// enabled when File or Endpoint is set.
+type TracingConfig struct {
+	File        string `yaml:"file"`         // Append spans as OTLP/JSON lines
+	Endpoint    string `yaml:"endpoint"`     // OTLP/HTTP traces endpoint of a collector
+	ServiceName string `yaml:"service_name"` // Reported as service.name
+}
+
+// LoggingConfig selects log levels and sinks
+type LoggingConfig struct {
+	Level  string              `yaml:"level"`  // Default level, overridden by -log-level
+	Levels map[string]string   `yaml:"levels"` // Levels by package: agent, api, blockchain, llm, tracing
+	Sinks  []logger.SinkConfig `yaml:"sinks"`  // Defaults to JSON on stdout
+}
+
+// Load loads configuration from a YAML file, ignoring environment variables.
+// Keys the file does not set take their values from Defaults.
+// See LoadLayers for layered configuration.
+func Load(path string) (*Config, error) {
+	cfg, _, err := LoadLayers(Options{Path: path, Env: []string{}})
+	return cfg, err
+}
+
+// Defaults returns the values of keys that no layer sets. Keys set to a
+// zero value, such as temperature: 0, keep it.
+func Defaults() *Config {
+	return &Config{
+		Agent: AgentConfig{
+			DecisionInterval: 30 * time.Second,
+			MaxEventChain:    100,
+			Policy:           PolicyConfig{Type: PolicyLLM},
+			Triggers: TriggerConfig{
+				Debounce:    2 * time.Second,
+				MinInterval: 10 * time.Second,
+			},
+			Budget: BudgetConfig{
+				OnExhausted:    BudgetPause,
+				ReportInterval: time.Hour,
+			},
+		},
+		LLM: LLMConfig{
+			Model:          "llama3.2",
+			MaxTokens:      150,
+			Temperature:    0.7,
+			TimeoutSeconds: 30,
+			Cache: CacheConfig{
+				Size: 1000,
+				TTL:  time.Hour,
+			},
+		},
+		HTTP: HTTPConfig{
+			StreamBuffer: 256,
+		},
+		Blockchain: BlockchainConfig{
+			CheckpointQuorum: 2.0 / 3.0,
+		},
+		Admission: AdmissionConfig{
+			MaxParents:      16,
+			MaxDescription:  1024,
+			MaxPayloadKeys:  32,
+			MaxPayloadBytes: 16 * 1024,
+			AuthorRate:      1,
+			AuthorBurst:     10,
+			GlobalRate:      100,
+			GlobalBurst:     200,
+		},
+		Tracing: TracingConfig{
+			ServiceName: "blockchain-universe",
+		},
+		Logging: LoggingConfig{
+			Level: "info",
+		},
+		Scheduler: SchedulerConfig{
+			Workers:         4,
+			Jitter:          0.1,
+			Overrun:         OverrunCoalesce,
+			ShutdownTimeout: 10 * time.Second,
+		},
 	}
-	return nil
 }
 
 // Example returns an example configuration
 func Example() *Config {
 	return &Config{
 		Agent: AgentConfig{
-			DecisionInterval: 30 * time.Second,
-			MaxEventChain:    100,
+			DecisionInterval:   30 * time.Second,
+			MaxEventChain:      100,
+			CheckpointInterval: 1000,
 		},
 		LLM: LLMConfig{
 			APIEndpoint:    "http://localhost:11434/v1/completions",
@@ -106,6 +316,35 @@ func Example() *Config {
 			MaxTokens:      150,
 			Temperature:    0.7,
 			TimeoutSeconds: 30,
+			MaxRetries:     2,
+		},
+		HTTP: HTTPConfig{
+			ListenAddr:   ":8080",
+			StreamBuffer: 256,
+		},
+		Blockchain: BlockchainConfig{
+			CheckpointQuorum: 2.0 / 3.0,
+			Prune: PruneConfig{
+				KeepEvents:   10000,
+				KeepDuration: 24 * time.Hour,
+			},
+		},
+		Admission: AdmissionConfig{
+			MaxParents:      16,
+			MaxDescription:  1024,
+			MaxPayloadKeys:  32,
+			MaxPayloadBytes: 16 * 1024,
+			AuthorRate:      1,
+			AuthorBurst:     10,
+			GlobalRate:      100,
+			GlobalBurst:     200,
+		},
+		Tracing: TracingConfig{
+			ServiceName: "blockchain-universe",
+		},
+		Logging: LoggingConfig{
+			Level: "info",
+			Sinks: []logger.SinkConfig{{Type: logger.SinkStdout, Format: logger.FormatJSON}},
 		},
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,503 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeFile writes a test configuration file
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(strings.TrimLeft(content, "\n")), 0644); err != nil {
+		t.Fatalf("Failed to write %s: %v", path, err)
+	}
+}
+
+func TestLoadLayers(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, "config.yaml")
+	writeFile(t, base, `
+agent:
+  decision_interval: 1m
+llm:
+  api_endpoint: http://localhost:11434/v1/completions
+  model: base-model
+  temperature: 0.5
+`)
+	writeFile(t, filepath.Join(dir, "config.production.yaml"), `
+llm:
+  model: production-model
+  max_tokens: 300
+`)
+
+	cfg, provenance, err := LoadLayers(Options{
+		Path:        base,
+		Environment: "production",
+		Env:         []string{"BU_LLM_MAX_TOKENS=400", "BU_LOGGING_LEVELS={llm: debug}", "HOME=/root"},
+		Flags:       map[string]string{"llm.temperature": "0.2"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+
+	if cfg.Agent.DecisionInterval != time.Minute || cfg.LLM.Model != "production-model" ||
+		cfg.LLM.MaxTokens != 400 || cfg.LLM.Temperature != 0.2 || cfg.Logging.Levels["llm"] != "debug" {
+		t.Errorf("Unexpected configuration: %+v", cfg)
+	}
+
+	expected := map[string]string{
+		"agent.decision_interval": "file " + base + ":2:22",
+		"llm.model":               "file " + filepath.Join(dir, "config.production.yaml") + ":2:10",
+		"llm.max_tokens":          "env BU_LLM_MAX_TOKENS",
+		"llm.temperature":         "flag",
+		"logging.levels":          "env BU_LOGGING_LEVELS",
+		"llm.timeout_seconds":     "default",
+	}
+	for key, source := range expected {
+		if provenance[key].String() != source {
+			t.Errorf("%s: expected source %q, got %q", key, source, provenance[key])
+		}
+	}
+
+	if _, _, err := LoadLayers(Options{Path: base, Env: []string{}, Flags: map[string]string{"llm.bogus": "1"}}); err == nil {
+		t.Error("Unknown flag keys should be rejected")
+	}
+	if _, _, err := LoadLayers(Options{Path: base, Environment: "staging", Env: []string{}}); err == nil {
+		t.Error("A missing overlay file should be an error")
+	}
+}
+
+func TestSecretsFromFiles(t *testing.T) {
+	dir := t.TempDir()
+	secret := filepath.Join(dir, "api_key")
+	writeFile(t, secret, "from-file\n")
+	base := filepath.Join(dir, "config.yaml")
+	writeFile(t, base, `
+llm:
+  api_endpoint: http://localhost:11434/v1/completions
+  api_key_file: `+secret+`
+`)
+
+	cfg, provenance, err := LoadLayers(Options{Path: base, Env: []string{}})
+	if err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+	if cfg.LLM.APIKey != "from-file" || provenance["llm.api_key"].Location != secret {
+		t.Errorf("Expected the key from %s, got %q from %s", secret, cfg.LLM.APIKey, provenance["llm.api_key"])
+	}
+
+	writeFile(t, base, "llm:\n  api_endpoint: http://localhost:11434/v1/completions\n")
+	cfg, provenance, err = LoadLayers(Options{Path: base, Env: []string{"BU_LLM_API_KEY_FILE=" + secret}})
+	if err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+	if cfg.LLM.APIKey != "from-file" || provenance["llm.api_key"] != (Source{Layer: LayerEnv, Location: secret}) {
+		t.Errorf("Expected the key from BU_LLM_API_KEY_FILE, got %q from %s", cfg.LLM.APIKey, provenance["llm.api_key"])
+	}
+
+	_, _, err = LoadLayers(Options{Path: base, Env: []string{"BU_LLM_API_KEY=x", "BU_LLM_API_KEY_FILE=" + secret}})
+	if err == nil {
+		t.Error("Setting a key both directly and from a file should be rejected")
+	}
+}
+
+func TestWatcherReload(t *testing.T) {
+	base := filepath.Join(t.TempDir(), "config.yaml")
+	writeFile(t, base, `
+agent:
+  decision_interval: 1m
+llm:
+  api_endpoint: http://localhost:11434/v1/completions
+  temperature: 0.5
+`)
+	opts := Options{Path: base, Env: []string{}}
+	cfg, provenance, err := LoadLayers(opts)
+	if err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	w := NewWatcher(opts, cfg, provenance)
+	go w.Run(ctx, 0)
+
+	writeFile(t, base, `
+agent:
+  decision_interval: 2m
+llm:
+  api_endpoint: http://localhost:8000/v1/completions
+  temperature: 0.9
+`)
+	w.Reload()
+
+	select {
+	case r := <-w.Updates():
+		if r.Err != nil {
+			t.Fatalf("Reload failed: %v", r.Err)
+		}
+		if strings.Join(r.Applied, ",") != "agent.decision_interval,llm.temperature" {
+			t.Errorf("Unexpected applied keys %v", r.Applied)
+		}
+		if strings.Join(r.Ignored, ",") != "llm.api_endpoint" {
+			t.Errorf("Unexpected ignored keys %v", r.Ignored)
+		}
+		if r.Config.Agent.DecisionInterval != 2*time.Minute || r.Config.LLM.Temperature != 0.9 ||
+			r.Config.LLM.APIEndpoint != "http://localhost:11434/v1/completions" {
+			t.Errorf("Unexpected configuration after reload: %+v", r.Config)
+		}
+		if cfg.LLM.Temperature != 0.5 {
+			t.Error("Reloading must not modify the previous configuration")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for reload")
+	}
+
+	writeFile(t, base, "agent:\n  decision_interval: 1ms\n")
+	w.Reload()
+	if r := <-w.Updates(); r.Err == nil || r.Config.Agent.DecisionInterval != 2*time.Minute {
+		t.Errorf("An invalid configuration should be rejected and keep the current one, got %v", r.Err)
+	}
+}
+
+func TestValidationReportsAllProblems(t *testing.T) {
+	base := filepath.Join(t.TempDir(), "config.yaml")
+	writeFile(t, base, `
+agent:
+  decision_interval: 100ms
+  max_event_chains: 5
+llm:
+  max_tokens: lots
+blockchain:
+  checkpoint_quorum: 1.5
+logging:
+  levels:
+    llm: verbose
+  sinks:
+    - type: file
+      fromat: json
+`)
+
+	_, _, err := LoadLayers(Options{Path: base, Env: []string{"BU_HTTP_STREAM_BUFFER=0"}})
+	var problems ValidationError
+	if !errors.As(err, &problems) {
+		t.Fatalf("Expected a validation error, got %v", err)
+	}
+
+	expected := []string{
+		base + ":2:22: agent.decision_interval: must be at least 1s",
+		base + ":3:3: agent.max_event_chains: unknown key",
+		base + ":5:15: llm.max_tokens: cannot unmarshal !!str `lots` into int",
+		base + ":7:22: blockchain.checkpoint_quorum: must be at most 1",
+		base + `:10:10: logging.levels.llm: must be one of debug, info, warn, error, got "verbose"`,
+		base + ":12:7: logging.sinks[0].path: is required for file sinks",
+		base + ":13:7: logging.sinks[0].fromat: unknown key",
+		"llm.api_endpoint: is required",
+		"env BU_HTTP_STREAM_BUFFER: http.stream_buffer: must be at least 1",
+	}
+	if len(problems) != len(expected) {
+		t.Fatalf("Expected %d problems, got %d: %v", len(expected), len(problems), problems)
+	}
+	for i, problem := range problems {
+		if problem.Error() != expected[i] {
+			t.Errorf("Problem %d: expected %q, got %q", i, expected[i], problem.Error())
+		}
+	}
+}
+
+func TestExplicitZeroValues(t *testing.T) {
+	base := filepath.Join(t.TempDir(), "config.yaml")
+	writeFile(t, base, `
+llm:
+  api_endpoint: http://localhost:11434/v1/completions
+  temperature: 0
+  max_retries: 0
+  model:
+admission:
+  author_rate: 0
+`)
+	cfg, provenance, err := LoadLayers(Options{Path: base, Env: []string{}})
+	if err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+	if cfg.LLM.Temperature != 0 || cfg.LLM.MaxRetries != 0 || cfg.Admission.AuthorRate != 0 {
+		t.Errorf("Explicit zero values should be kept: %+v", cfg)
+	}
+	// Null values are unset
+	if cfg.LLM.Model != "llama3.2" || provenance["llm.model"].Layer != LayerDefault {
+		t.Errorf("Expected the default model, got %q from %s", cfg.LLM.Model, provenance["llm.model"])
+	}
+	if cfg.LLM.MaxTokens != 150 || cfg.Admission.GlobalRate != 100 {
+		t.Errorf("Unset keys should get defaults: %+v", cfg)
+	}
+}
+
+func TestExampleConfigIsValid(t *testing.T) {
+	if _, err := Load("../../config.yaml"); err != nil {
+		t.Errorf("config.yaml: %v", err)
+	}
+}
+
+func TestSchemaIsUpToDate(t *testing.T) {
+	schema, err := Schema()
+	if err != nil {
+		t.Fatalf("Failed to generate schema: %v", err)
+	}
+	committed, err := os.ReadFile("../../config.schema.json")
+	if err != nil {
+		t.Fatalf("Failed to read config.schema.json: %v", err)
+	}
+	if string(schema) != string(committed) {
+		t.Error("config.schema.json is out of date, run go generate ./internal/config")
+	}
+}
+
+func TestAgents(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, "config.yaml")
+	writeFile(t, base, `
+agent:
+  decision_interval: 1m
+llm:
+  api_endpoint: http://localhost:11434/v1/completions
+  model: base-model
+  temperature: 0.5
+agents:
+  - name: archivist
+    persona: Careful
+  - name: trickster
+    model: other-model
+    temperature: 0
+    decision_interval: 10s
+`)
+	opts := Options{Path: base, Env: []string{}}
+	cfg, provenance, err := LoadLayers(opts)
+	if err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+
+	agents := cfg.Instances()
+	if len(agents) != 2 {
+		t.Fatalf("Expected 2 agents, got %v", agents)
+	}
+	if a := agents[0]; a.Agent.Name != "archivist" || a.Agent.Persona != "Careful" ||
+		a.Agent.DecisionInterval != time.Minute || a.LLM.Model != "base-model" || a.LLM.Temperature != 0.5 {
+		t.Errorf("Unset keys should be inherited: %v", a)
+	}
+	if a := agents[1]; a.LLM.Model != "other-model" || a.LLM.Temperature != 0 ||
+		a.Agent.DecisionInterval != 10*time.Second || a.LLM.MaxTokens != 150 {
+		t.Errorf("Unexpected agent: %v", a)
+	}
+
+	// Only the reloadable keys of entries are applied
+	w := NewWatcher(opts, cfg, provenance)
+	writeFile(t, base, `
+llm:
+  api_endpoint: http://localhost:11434/v1/completions
+agents:
+  - name: archivist
+    persona: Reckless
+    temperature: 1.5
+  - name: trickster
+    model: other-model
+    temperature: 0
+    decision_interval: 10s
+`)
+	r := w.reload()
+	if r.Err != nil {
+		t.Fatalf("Reload failed: %v", r.Err)
+	}
+	if strings.Join(r.Applied, ",") != "agent.decision_interval,llm.temperature,agents" || !contains(r.Ignored, "agents") {
+		t.Errorf("Unexpected applied %v and ignored %v keys", r.Applied, r.Ignored)
+	}
+	if a := r.Config.Agents[0]; a.LLM.Temperature != 1.5 || a.Agent.DecisionInterval != 30*time.Second || a.Agent.Persona != "Careful" {
+		t.Errorf("Unexpected agent after reload: %v", a)
+	}
+
+	writeFile(t, base, `
+llm:
+  api_endpoint: http://localhost:11434/v1/completions
+agents:
+  - name: archivist
+    temperature: 3
+  - name: archivist
+    key_file: a.json
+    modle: other-model
+  - key_file: a.json
+  - name: dreamer
+    decision_interval: soon
+    temprature: 1
+`)
+	_, _, err = LoadLayers(opts)
+	var problems ValidationError
+	if !errors.As(err, &problems) {
+		t.Fatalf("Expected a validation error, got %v", err)
+	}
+	expected := []string{
+		base + ":5:18: agents[0].temperature: must be at most 2",
+		base + ":6:5: agents[1].name: duplicate agent name \"archivist\"",
+		base + ":8:5: agents[1].modle: unknown key",
+		base + ":9:5: agents[2].name: is required when running several agents",
+		base + ":9:5: agents[2].key_file: key file a.json is used by another agent",
+		base + ":11:24: agents[3].decision_interval: cannot unmarshal !!str `soon` into time.Duration",
+		base + ":12:5: agents[3].temprature: unknown key",
+	}
+	if len(problems) != len(expected) {
+		t.Fatalf("Expected %d problems, got %d: %v", len(expected), len(problems), problems)
+	}
+	for i, problem := range problems {
+		if problem.Error() != expected[i] {
+			t.Errorf("Problem %d: expected %q, got %q", i, expected[i], problem.Error())
+		}
+	}
+}
+
+func TestPolicyValidation(t *testing.T) {
+	base := filepath.Join(t.TempDir(), "config.yaml")
+	writeFile(t, base, `
+agent:
+  policy:
+    type: ensemble
+    mode: vote
+    members:
+      - type: rules
+      - type: random
+        weight: -1
+      - type: telepathy
+llm:
+  api_endpoint: http://localhost:11434/v1/completions
+agents:
+  - name: clerk
+    policy:
+      type: rules
+      rules:
+        - description: "{{.Name"
+`)
+	_, _, err := LoadLayers(Options{Path: base, Env: []string{}})
+	var problems ValidationError
+	if !errors.As(err, &problems) {
+		t.Fatalf("Expected a validation error, got %v", err)
+	}
+	expected := []string{
+		base + ":6:9: agent.policy.members[0].rules: is required for rules policies",
+		base + ":8:17: agent.policy.members[1].weight: must be at least 0",
+		base + `:9:15: agent.policy.members[2].type: must be one of llm, rules, random, scripted, ensemble, got "telepathy"`,
+		base + ":17:24: agents[0].policy.rules[0].description: 1: unclosed action",
+	}
+	if len(problems) != len(expected) {
+		t.Fatalf("Expected %d problems, got %d: %v", len(expected), len(problems), problems)
+	}
+	for i, problem := range problems {
+		if problem.Error() != expected[i] {
+			t.Errorf("Problem %d: expected %q, got %q", i, expected[i], problem.Error())
+		}
+	}
+}
+
+func TestTriggerPatterns(t *testing.T) {
+	base := filepath.Join(t.TempDir(), "config.yaml")
+	writeFile(t, base, `
+agent:
+  triggers:
+    patterns: ["merge", "(split"]
+llm:
+  api_endpoint: http://localhost:11434/v1/completions
+`)
+	_, _, err := LoadLayers(Options{Path: base, Env: []string{}})
+	if err == nil || err.Error() != "invalid configuration: "+base+":3:25: agent.triggers.patterns[1]: missing closing ): `(split`" {
+		t.Errorf("Expected the invalid pattern to be reported, got %v", err)
+	}
+}
+
+func TestTriggersRequireMinInterval(t *testing.T) {
+	base := filepath.Join(t.TempDir(), "config.yaml")
+	writeFile(t, base, `
+agent:
+  triggers:
+    mentions: true
+    min_interval: 0s
+llm:
+  api_endpoint: http://localhost:11434/v1/completions
+`)
+	_, _, err := LoadLayers(Options{Path: base, Env: []string{}})
+	if err == nil || err.Error() != "invalid configuration: "+base+":4:19: agent.triggers.min_interval: must be positive when triggers are enabled" {
+		t.Errorf("Expected the zero min_interval to be reported, got %v", err)
+	}
+}
+
+func TestDiskCacheRequiresPath(t *testing.T) {
+	base := filepath.Join(t.TempDir(), "config.yaml")
+	writeFile(t, base, `
+llm:
+  api_endpoint: http://localhost:11434/v1/completions
+  cache:
+    backend: disk
+`)
+	_, _, err := LoadLayers(Options{Path: base, Env: []string{}})
+	if err == nil || err.Error() != "invalid configuration: "+base+":4:14: llm.cache.path: is required for disk caches" {
+		t.Errorf("Expected the missing path to be reported, got %v", err)
+	}
+}
+
+func TestTrustedSignersMustBeKeys(t *testing.T) {
+	base := filepath.Join(t.TempDir(), "config.yaml")
+	writeFile(t, base, `
+llm:
+  api_endpoint: http://localhost:11434/v1/completions
+blockchain:
+  trusted_signers:
+    - `+strings.Repeat("ab", 32)+`
+    - not-a-key
+`)
+	_, _, err := LoadLayers(Options{Path: base, Env: []string{}})
+	if err == nil || err.Error() != "invalid configuration: "+base+":6:7: blockchain.trusted_signers[1]: is not a hex-encoded ed25519 public key" {
+		t.Errorf("Expected the invalid key to be reported, got %v", err)
+	}
+}
+
+func TestBudgetValidation(t *testing.T) {
+	base := filepath.Join(t.TempDir(), "config.yaml")
+	writeFile(t, base, `
+agent:
+  budget:
+    tokens_per_day: 10000
+    on_exhausted: fallback
+llm:
+  api_endpoint: http://localhost:11434/v1/completions
+  costs: {llama3.2: -1}
+agents:
+  - name: thrifty
+    budget:
+      fallback: {type: llm}
+  - name: scripted
+    budget:
+      fallback: {type: scripted}
+  - name: nested
+    budget:
+      fallback:
+        type: ensemble
+        members:
+          - type: random
+          - type: ensemble
+            members: [{type: llm}]
+`)
+	_, _, err := LoadLayers(Options{Path: base, Env: []string{}})
+	if err == nil {
+		t.Fatal("Expected validation errors")
+	}
+	for _, want := range []string{
+		base + ":7:21: llm.costs.llama3.2: must be at least 0",
+		base + ":4:19: agent.budget.fallback.type: is required to fall back",
+		base + ":11:17: agents[0].budget.fallback.type: must not use the LLM whose budget is exhausted",
+		base + ":14:17: agents[1].budget.fallback.scenario: is required for scripted policies",
+		base + ":22:30: agents[2].budget.fallback.members[1].members[0].type: must not use the LLM whose budget is exhausted",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Missing %q in:\n%v", want, err)
+		}
+	}
+}
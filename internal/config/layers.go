@@ -0,0 +1,497 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Layers a configuration value can come from, lowest precedence first
+const (
+	LayerDefault = "default"
+	LayerFile    = "file"
+	LayerEnv     = "env"
+	LayerFlag    = "flag"
+)
+
+// envPrefix prefixes the environment variables overriding configuration
+// keys, e.g. BU_LLM_API_KEY for llm.api_key
+const envPrefix = "BU_"
+
+// secretKeys are redacted when values are reported
+var secretKeys = map[string]bool{
+	"llm.api_key": true,
+}
+
+// Source is where a configuration value came from
+type Source struct {
+	Layer    string // default, file, env or flag
+	Location string // File, line and column, or environment variable
+	file     string
+}
+
+func (s Source) String() string {
+	if s.Location == "" {
+		return s.Layer
+	}
+	return s.Layer + " " + s.Location
+}
+
+// Provenance maps dotted keys such as llm.temperature to their source
+type Provenance map[string]Source
+
+// Options selects the configuration layers. Each layer overrides the ones
+// before it: defaults, the base file, the environment overlay file, BU_*
+// environment variables and command-line flags.
+type Options struct {
+	Path        string            // Base file
+	Environment string            // Overlay <name>.<Environment>.yaml next to Path, if set
+	Env         []string          // Variables as KEY=value; nil reads the process environment
+	Flags       map[string]string // Values by dotted key
+}
+
+// OverlayPath returns the environment overlay file, or "" if no environment
+// is selected
+func (o Options) OverlayPath() string {
+	if o.Environment == "" {
+		return ""
+	}
+	ext := filepath.Ext(o.Path)
+	return strings.TrimSuffix(o.Path, ext) + "." + o.Environment + ext
+}
+
+// files returns the configuration files in load order
+func (o Options) files() []string {
+	files := []string{o.Path}
+	if overlay := o.OverlayPath(); overlay != "" {
+		files = append(files, overlay)
+	}
+	return files
+}
+
+// LoadLayers loads the configuration from all layers and reports where each
+// value came from. Unknown keys, values of the wrong type and values out of
+// range are reported together as a ValidationError.
+func LoadLayers(opts Options) (*Config, Provenance, error) {
+	l := &layers{values: make(map[string]*yaml.Node), sources: make(Provenance)}
+	for _, path := range opts.files() {
+		if err := l.addFile(path); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	env := opts.Env
+	if env == nil {
+		env = os.Environ()
+	}
+	l.addEnv(env)
+
+	keys := make([]string, 0, len(opts.Flags))
+	for key := range opts.Flags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		l.set(key, opts.Flags[key], Source{Layer: LayerFlag})
+	}
+
+	cfg := l.decode()
+	cfg.resolveSecrets(l)
+	l.decodeAgents(cfg)
+	l.validate(cfg)
+	if len(l.errs) > 0 {
+		l.sortErrors(opts.files())
+		return nil, nil, l.errs
+	}
+
+	provenance := make(Provenance, len(fieldList))
+	for _, f := range fieldList {
+		if src, ok := l.sources[f.key]; ok {
+			provenance[f.key] = src
+		} else {
+			provenance[f.key] = Source{Layer: LayerDefault}
+		}
+	}
+	return cfg, provenance, nil
+}
+
+// resolveSecrets reads secrets stored in files, e.g. mounted secrets
+func (c *Config) resolveSecrets(l *layers) {
+	if c.LLM.APIKeyFile == "" {
+		return
+	}
+	if c.LLM.APIKey != "" {
+		l.fail("llm.api_key_file", l.sources["llm.api_key_file"], l.values["llm.api_key_file"],
+			"conflicts with llm.api_key set by %s", l.sources["llm.api_key"])
+		return
+	}
+	data, err := os.ReadFile(c.LLM.APIKeyFile)
+	if err != nil {
+		l.fail("llm.api_key_file", l.sources["llm.api_key_file"], l.values["llm.api_key_file"], "%v", err)
+		return
+	}
+	c.LLM.APIKey = strings.TrimSpace(string(data))
+	l.sources["llm.api_key"] = Source{Layer: l.sources["llm.api_key_file"].Layer, Location: c.LLM.APIKeyFile}
+}
+
+// layers collects the value of every key set by a layer, as YAML nodes so
+// file values keep their positions for error messages
+type layers struct {
+	values  map[string]*yaml.Node
+	sources Provenance
+	errs    ValidationError
+}
+
+// fail records a problem with a key set by src. Positions in files are
+// taken from node if given.
+func (l *layers) fail(key string, src Source, node *yaml.Node, format string, args ...interface{}) {
+	e := FieldError{Key: key, Location: src.String(), Message: fmt.Sprintf(format, args...)}
+	if src.file != "" && node != nil {
+		e.file, e.line, e.column = src.file, node.Line, node.Column
+		e.Location = fmt.Sprintf("%s:%d:%d", e.file, e.line, e.column)
+	}
+	l.errs = append(l.errs, e)
+}
+
+// sourceOf returns the source of the key holding a value, e.g. of
+// logging.sinks for logging.sinks[1].type
+func (l *layers) sourceOf(key string) Source {
+	for {
+		if src, ok := l.sources[key]; ok {
+			return src
+		}
+		i := strings.LastIndexAny(key, ".[")
+		if i < 0 {
+			return Source{}
+		}
+		key = key[:i]
+	}
+}
+
+// sortErrors orders problems by position, those in files first
+func (l *layers) sortErrors(files []string) {
+	order := make(map[string]int, len(files))
+	for i, file := range files {
+		order[file] = i
+	}
+	sort.SliceStable(l.errs, func(i, j int) bool {
+		a, b := l.errs[i], l.errs[j]
+		switch {
+		case (a.file == "") != (b.file == ""):
+			return a.file != ""
+		case a.file != b.file:
+			return order[a.file] < order[b.file]
+		case a.line != b.line:
+			return a.line < b.line
+		}
+		return a.column < b.column
+	})
+}
+
+// addFile merges a YAML file
+func (l *layers) addFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	if len(doc.Content) == 0 {
+		return nil // Empty file
+	}
+	l.addMapping(path, "", doc.Content[0])
+	return nil
+}
+
+// addMapping merges the keys of a mapping node below prefix. Keys of
+// nested sections are merged one by one; other values replace the lower
+// layers' values as a whole. Null values leave the lower layers' values.
+func (l *layers) addMapping(path, prefix string, node *yaml.Node) {
+	if node.Kind != yaml.MappingNode {
+		l.fail(strings.TrimSuffix(prefix, "."), Source{Layer: LayerFile, file: path}, node, "expected a mapping")
+		return
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		keyNode, value := node.Content[i], node.Content[i+1]
+		key := prefix + keyNode.Value
+		f, known := fields[key]
+		switch {
+		case !known:
+			l.fail(key, Source{Layer: LayerFile, file: path}, keyNode, "unknown key")
+		case value.ShortTag() == "!!null":
+			// Unset
+		case f.section:
+			l.addMapping(path, key+".", value)
+		default:
+			l.values[key] = value
+			l.sources[key] = Source{Layer: LayerFile, Location: fmt.Sprintf("%s:%d:%d", path, value.Line, value.Column), file: path}
+		}
+	}
+}
+
+// addEnv merges BU_* environment variables
+func (l *layers) addEnv(env []string) {
+	vars := make(map[string]string, len(env))
+	for _, kv := range env {
+		if name, value, ok := strings.Cut(kv, "="); ok && strings.HasPrefix(name, envPrefix) {
+			vars[name] = value
+		}
+	}
+
+	for _, f := range fieldList {
+		if f.section {
+			continue
+		}
+		name := EnvName(f.key)
+		if value, ok := vars[name]; ok {
+			l.set(f.key, value, Source{Layer: LayerEnv, Location: name})
+		}
+	}
+}
+
+// set sets a key from a string, parsed as YAML for lists and maps
+func (l *layers) set(key, value string, src Source) {
+	f, known := fields[key]
+	if !known || f.section {
+		l.fail(key, src, nil, "unknown key")
+		return
+	}
+
+	node := &yaml.Node{Kind: yaml.ScalarNode, Value: value}
+	if f.typ.Kind() == reflect.Slice || f.typ.Kind() == reflect.Map {
+		var doc yaml.Node
+		if err := yaml.Unmarshal([]byte(value), &doc); err != nil {
+			l.fail(key, src, nil, "%v", err)
+			return
+		}
+		if len(doc.Content) == 0 {
+			return
+		}
+		node = doc.Content[0]
+	}
+	l.values[key] = node
+	l.sources[key] = src
+}
+
+// decode decodes every key that a layer sets, and takes the others from
+// Defaults. Keys that fail to decode are recorded and left at their default.
+func (l *layers) decode() *Config {
+	cfg := Defaults()
+	target := reflect.ValueOf(cfg).Elem()
+	for _, f := range fieldList {
+		node, set := l.values[f.key]
+		if !set || f.key == "agents" {
+			continue
+		}
+		value := reflect.New(f.typ)
+		if err := node.Decode(value.Interface()); err != nil {
+			l.fail(f.key, l.sources[f.key], node, "%s", decodeMessage(err))
+			continue
+		}
+		target.FieldByIndex(f.index).Set(value.Elem())
+	}
+	return cfg
+}
+
+// decodeAgents decodes each agents entry over the agent and llm sections,
+// so keys an entry leaves out are inherited
+func (l *layers) decodeAgents(cfg *Config) {
+	node, set := l.values["agents"]
+	if !set {
+		return
+	}
+	src := l.sources["agents"]
+	if node.Kind != yaml.SequenceNode {
+		l.fail("agents", src, node, "expected a list")
+		return
+	}
+	for i, item := range node.Content {
+		key := fmt.Sprintf("agents[%d]", i)
+		spec := AgentSpec{Agent: cfg.Agent, LLM: cfg.LLM}
+		if _, policy := entry(item, "policy"); policy != nil {
+			// A policy replaces the inherited one rather than merging with it
+			spec.Agent.Policy = Defaults().Agent.Policy
+		}
+		if _, budget := entry(item, "budget"); budget != nil {
+			if _, fallback := entry(budget, "fallback"); fallback != nil {
+				spec.Agent.Budget.Fallback = PolicyConfig{}
+			}
+		}
+		// Decoding merges into maps, which must not change the llm section
+		spec.LLM.Costs = maps.Clone(cfg.LLM.Costs)
+		// Values that fail to decode keep the inherited setting, and the entry
+		// is still validated, so every problem in it is reported
+		if err := item.Decode(&spec); err != nil {
+			l.failDecode(key, src, item, err)
+		}
+		if _, file := entry(item, "api_key_file"); file != nil && spec.LLM.APIKeyFile != "" {
+			if _, k := entry(item, "api_key"); k != nil {
+				l.fail(key+".api_key_file", src, file, "conflicts with api_key")
+			} else if data, err := os.ReadFile(spec.LLM.APIKeyFile); err != nil {
+				l.fail(key+".api_key_file", src, file, "%v", err)
+			} else {
+				spec.LLM.APIKey = strings.TrimSpace(string(data))
+			}
+		}
+		cfg.Agents = append(cfg.Agents, spec)
+	}
+}
+
+// failDecode records each problem of decoding node at the value it is about,
+// found by the line the YAML decoder reports
+func (l *layers) failDecode(key string, src Source, node *yaml.Node, err error) {
+	var typeErr *yaml.TypeError
+	if !errors.As(err, &typeErr) {
+		l.fail(key, src, node, "%s", err)
+		return
+	}
+	for _, msg := range typeErr.Errors {
+		var line int
+		if _, scanErr := fmt.Sscanf(msg, "line %d:", &line); scanErr != nil {
+			l.fail(key, src, node, "%s", msg)
+			continue
+		}
+		_, msg, _ = strings.Cut(msg, ": ")
+		if sub, value := locate(node, line); value != nil {
+			l.fail(key+sub, src, value, "%s", msg)
+		} else {
+			l.fail(key, src, node, "%s", msg)
+		}
+	}
+}
+
+// locate returns the innermost value of node on a line and its key relative
+// to node, e.g. .policy.rules[1]
+func locate(node *yaml.Node, line int) (string, *yaml.Node) {
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			k, v := node.Content[i], node.Content[i+1]
+			if sub, value := locate(v, line); value != nil {
+				return "." + k.Value + sub, value
+			}
+			if k.Line == line {
+				return "." + k.Value, v
+			}
+		}
+	case yaml.SequenceNode:
+		for i, item := range node.Content {
+			if sub, value := locate(item, line); value != nil {
+				return fmt.Sprintf("[%d]%s", i, sub), value
+			}
+			if item.Line == line {
+				return fmt.Sprintf("[%d]", i), item
+			}
+		}
+	}
+	return "", nil
+}
+
+// decodeMessage strips the line numbers the YAML decoder adds, as errors
+// carry the position of the value
+func decodeMessage(err error) string {
+	var typeErr *yaml.TypeError
+	if !errors.As(err, &typeErr) {
+		return err.Error()
+	}
+	messages := make([]string, len(typeErr.Errors))
+	for i, msg := range typeErr.Errors {
+		if strings.HasPrefix(msg, "line ") {
+			if _, rest, ok := strings.Cut(msg, ": "); ok {
+				msg = rest
+			}
+		}
+		messages[i] = msg
+	}
+	return strings.Join(messages, "; ")
+}
+
+// field is a configuration key and the struct field holding it
+type field struct {
+	key     string
+	index   []int
+	typ     reflect.Type
+	section bool // Nested struct with keys of its own
+}
+
+// fieldList holds every key in declaration order, sections before their
+// keys; fields indexes it by key
+var fieldList, fields = collectFields()
+
+func collectFields() ([]field, map[string]field) {
+	var list []field
+	var walk func(t reflect.Type, prefix string, index []int)
+	walk = func(t reflect.Type, prefix string, index []int) {
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			name := yamlName(sf)
+			if name == "" {
+				continue
+			}
+			f := field{
+				key:     prefix + name,
+				index:   append(append([]int(nil), index...), i),
+				typ:     sf.Type,
+				section: sf.Type.Kind() == reflect.Struct,
+			}
+			list = append(list, f)
+			if f.section {
+				walk(sf.Type, f.key+".", f.index)
+			}
+		}
+	}
+	walk(reflect.TypeOf(Config{}), "", nil)
+
+	byKey := make(map[string]field, len(list))
+	for _, f := range list {
+		byKey[f.key] = f
+	}
+	return list, byKey
+}
+
+// Keys returns every configuration key that holds a value, in the order
+// of config.yaml
+func Keys() []string {
+	var keys []string
+	for _, f := range fieldList {
+		if !f.section {
+			keys = append(keys, f.key)
+		}
+	}
+	return keys
+}
+
+// EnvName returns the environment variable overriding a key
+func EnvName(key string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+// IsSecret reports whether a key holds a secret that must not be printed
+func IsSecret(key string) bool {
+	return secretKeys[key]
+}
+
+// Value returns the value of a key
+func (c *Config) Value(key string) (interface{}, bool) {
+	f, known := fields[key]
+	if !known {
+		return nil, false
+	}
+	return reflect.ValueOf(c).Elem().FieldByIndex(f.index).Interface(), true
+}
+
+// set copies the value of a key from another configuration
+func (c *Config) set(key string, from *Config) {
+	f := fields[key]
+	reflect.ValueOf(c).Elem().FieldByIndex(f.index).Set(reflect.ValueOf(from).Elem().FieldByIndex(f.index))
+}
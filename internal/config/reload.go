@@ -0,0 +1,180 @@
+package config
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// reloadable lists the keys that take effect without a restart
+var reloadable = map[string]bool{
+	"agent.decision_interval": true,
+	"llm.temperature":         true,
+	"logging.level":           true,
+	"logging.levels":          true,
+}
+
+// IsReloadable reports whether a key takes effect without a restart. Of
+// agents entries, only decision_interval and temperature do.
+func IsReloadable(key string) bool {
+	return reloadable[key]
+}
+
+// reloadAgents applies the reloadable keys of agents entries. It reports
+// whether any were applied, and whether other changes were ignored; changing
+// the number of agents requires a restart.
+func reloadAgents(current, loaded []AgentSpec) (next []AgentSpec, applied, ignored bool) {
+	if len(current) != len(loaded) {
+		return current, false, true
+	}
+	next = make([]AgentSpec, len(current))
+	for i, spec := range current {
+		spec.Agent.DecisionInterval = loaded[i].Agent.DecisionInterval
+		spec.LLM.Temperature = loaded[i].LLM.Temperature
+		applied = applied || !reflect.DeepEqual(spec, current[i])
+		ignored = ignored || !reflect.DeepEqual(spec, loaded[i])
+		next[i] = spec
+	}
+	return next, applied, ignored
+}
+
+// Reload is the outcome of reloading the configuration
+type Reload struct {
+	Config     *Config // Current configuration, with the reloadable changes applied
+	Provenance Provenance
+	Applied    []string // Changed keys that took effect
+	Ignored    []string // Changed keys that require a restart
+	Err        error    // The configuration could not be loaded; nothing changed
+}
+
+// Watcher reloads the configuration when Reload is called, e.g. on SIGHUP,
+// or when its files change
+type Watcher struct {
+	opts       Options
+	current    *Config
+	provenance Provenance
+	trigger    chan struct{}
+	updates    chan Reload
+	mu         sync.Mutex // Guards current and provenance
+}
+
+// NewWatcher creates a watcher for the configuration loaded with opts
+func NewWatcher(opts Options, cfg *Config, provenance Provenance) *Watcher {
+	return &Watcher{
+		opts:       opts,
+		current:    cfg,
+		provenance: provenance,
+		trigger:    make(chan struct{}, 1),
+		updates:    make(chan Reload),
+	}
+}
+
+// Updates delivers the outcome of every reload
+func (w *Watcher) Updates() <-chan Reload {
+	return w.updates
+}
+
+// Reload requests a reload; it does not wait for it
+func (w *Watcher) Reload() {
+	select {
+	case w.trigger <- struct{}{}:
+	default: // A reload is already pending
+	}
+}
+
+// Run reloads on request and when the modification time of a file changes,
+// checking every interval (0 disables checking), until ctx is done
+func (w *Watcher) Run(ctx context.Context, interval time.Duration) {
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	stamps := w.stamps()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick:
+			current := w.stamps()
+			if reflect.DeepEqual(current, stamps) {
+				continue
+			}
+			stamps = current
+		case <-w.trigger:
+			stamps = w.stamps()
+		}
+
+		select {
+		case w.updates <- w.reload():
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// stamps returns the modification times of the configuration files
+func (w *Watcher) stamps() map[string]time.Time {
+	stamps := make(map[string]time.Time)
+	for _, path := range w.opts.files() {
+		if info, err := os.Stat(path); err == nil {
+			stamps[path] = info.ModTime()
+		}
+	}
+	return stamps
+}
+
+// reload loads the configuration and applies the reloadable changes
+func (w *Watcher) reload() Reload {
+	loaded, provenance, err := LoadLayers(w.opts)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err != nil {
+		return Reload{Config: w.current, Provenance: w.provenance, Err: err}
+	}
+
+	next := *w.current
+	nextProvenance := make(Provenance, len(w.provenance))
+	for key, src := range w.provenance {
+		nextProvenance[key] = src
+	}
+
+	var r Reload
+	for _, key := range Keys() {
+		old, _ := w.current.Value(key)
+		value, _ := loaded.Value(key)
+		if reflect.DeepEqual(old, value) {
+			continue
+		}
+		if key == "agents" {
+			agents, applied, ignored := reloadAgents(w.current.Agents, loaded.Agents)
+			if applied {
+				next.Agents = agents
+				r.Applied = append(r.Applied, key)
+			}
+			if ignored {
+				r.Ignored = append(r.Ignored, key)
+			}
+			continue
+		}
+		if !reloadable[key] {
+			r.Ignored = append(r.Ignored, key)
+			continue
+		}
+		next.set(key, loaded)
+		nextProvenance[key] = provenance[key]
+		r.Applied = append(r.Applied, key)
+	}
+
+	w.current = &next
+	w.provenance = nextProvenance
+	r.Config = w.current
+	r.Provenance = w.provenance
+	return r
+}
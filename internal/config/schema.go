@@ -0,0 +1,108 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+)
+
+//go:generate sh -c "go run ../../cmd/bu config schema > ../../config.schema.json"
+
+// durationPattern matches durations such as 30s or 1h30m
+const durationPattern = `^-?([0-9]+(\.[0-9]*)?(ns|us|µs|ms|s|m|h))+$`
+
+// Schema returns a JSON Schema for configuration files, generated from the
+// configuration types, their defaults and constraints. Required keys are not
+// marked, as they may be set by other layers.
+func Schema() ([]byte, error) {
+	schema := schemaFor(reflect.TypeOf(Config{}), "", reflect.ValueOf(Defaults()).Elem())
+	schema["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	schema["title"] = "Blockchain Universe agent configuration"
+	data, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// schemaFor describes values of type t at path; def holds the default value,
+// if any
+func schemaFor(t reflect.Type, path string, def reflect.Value) map[string]interface{} {
+	s := make(map[string]interface{})
+	switch t.Kind() {
+	case reflect.Struct:
+		properties := make(map[string]interface{})
+		for _, f := range keyFields(t, path) {
+			var fieldDefault reflect.Value
+			if def.IsValid() {
+				fieldDefault = def.FieldByIndex(f.index)
+			}
+			properties[f.name] = schemaFor(t.FieldByIndex(f.index).Type, f.path, fieldDefault)
+		}
+		s["type"] = "object"
+		s["properties"] = properties
+		s["additionalProperties"] = false
+	case reflect.Slice:
+		s["type"] = "array"
+		if enclosing, ok := recursive[path]; ok {
+			s["items"] = map[string]interface{}{"$ref": pointer(enclosing)}
+		} else {
+			s["items"] = schemaFor(t.Elem(), path+"[]", reflect.Value{})
+		}
+	case reflect.Map:
+		s["type"] = "object"
+		s["additionalProperties"] = schemaFor(t.Elem(), path+".*", reflect.Value{})
+	case reflect.String:
+		s["type"] = "string"
+	case reflect.Bool:
+		s["type"] = "boolean"
+	case reflect.Float32, reflect.Float64:
+		s["type"] = "number"
+	case reflect.Int, reflect.Int64:
+		s["type"] = "integer"
+	}
+
+	if t == durationType {
+		// Integers are nanoseconds
+		s["type"] = []string{"string", "integer"}
+		s["pattern"] = durationPattern
+	} else if c, ok := constraints[path]; ok {
+		if c.required {
+			s["minLength"] = 1
+		}
+		if len(c.enum) > 0 {
+			s["enum"] = c.enum
+		}
+		if c.min != nil && c.exclusiveMin {
+			s["exclusiveMinimum"] = *c.min
+		} else if c.min != nil {
+			s["minimum"] = *c.min
+		}
+		if c.max != nil {
+			s["maximum"] = *c.max
+		}
+	}
+
+	if def.IsValid() && !def.IsZero() && t.Kind() != reflect.Struct {
+		if t == durationType {
+			s["default"] = time.Duration(def.Int()).String()
+		} else {
+			s["default"] = def.Interface()
+		}
+	}
+	return s
+}
+
+// pointer returns a JSON pointer to the schema of a dotted key
+func pointer(key string) string {
+	return "#/properties/" + strings.ReplaceAll(key, ".", "/properties/")
+}
+
+// join appends a key to a dotted path
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
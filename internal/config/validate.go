@@ -0,0 +1,480 @@
+package config
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/yanchenko-igor/blockchain-universe/pkg/logger"
+)
+
+// FieldError is a problem with one configuration value
+type FieldError struct {
+	Key      string // Dotted key, e.g. llm.temperature or logging.sinks[1].type
+	Location string // file:line:column, environment variable or flag; empty for defaults
+	Message  string
+
+	file         string // Position for sorting, if in a file
+	line, column int
+}
+
+func (e FieldError) Error() string {
+	if e.Location == "" {
+		return e.Key + ": " + e.Message
+	}
+	return e.Location + ": " + e.Key + ": " + e.Message
+}
+
+// ValidationError lists every problem found while loading a configuration
+type ValidationError []FieldError
+
+func (v ValidationError) Error() string {
+	if len(v) == 1 {
+		return "invalid configuration: " + v[0].Error()
+	}
+	messages := make([]string, len(v))
+	for i, e := range v {
+		messages[i] = e.Error()
+	}
+	return fmt.Sprintf("invalid configuration, %d problems: %s", len(v), strings.Join(messages, "; "))
+}
+
+// constraint restricts the values of a key. The same constraints validate
+// loaded configurations and generate the JSON Schema.
+type constraint struct {
+	required     bool     // Strings must not be empty
+	min, max     *float64 // Inclusive bounds, in seconds for durations
+	exclusiveMin bool
+	enum         []string // Allowed values of non-empty strings
+}
+
+func bound(x float64) *float64 {
+	return &x
+}
+
+func atLeast(min float64) constraint {
+	return constraint{min: bound(min)}
+}
+
+func between(min, max float64) constraint {
+	return constraint{min: bound(min), max: bound(max)}
+}
+
+var (
+	logLevels     = []string{"debug", "info", "warn", "error"}
+	sinkTypes     = []string{logger.SinkStdout, logger.SinkFile, logger.SinkSyslog}
+	sinkFormats   = []string{logger.FormatJSON, logger.FormatText}
+	policyTypes   = []string{PolicyLLM, PolicyRules, PolicyRandom, PolicyScripted, PolicyEnsemble}
+	ensembleModes = []string{EnsembleFirst, EnsembleRandom, EnsembleVote}
+	overrunModes  = []string{OverrunSkip, OverrunCoalesce}
+	cacheBackends = []string{CacheMemory, CacheDisk}
+	budgetActions = []string{BudgetPause, BudgetFallback}
+)
+
+// constraints by key; [] stands for any list element and * for any map key
+var constraints = map[string]constraint{
+	"agent.decision_interval":                   atLeast(1),
+	"agent.max_event_chain":                     atLeast(1),
+	"agent.checkpoint_interval":                 atLeast(0),
+	"llm.api_endpoint":                          {required: true},
+	"llm.max_tokens":                            atLeast(10),
+	"llm.temperature":                           between(0, 2),
+	"llm.timeout_seconds":                       atLeast(1),
+	"llm.cache.backend":                         {enum: cacheBackends},
+	"llm.cache.size":                            atLeast(1),
+	"llm.cache.ttl":                             atLeast(0),
+	"http.stream_buffer":                        atLeast(1),
+	"blockchain.checkpoint_quorum":              {min: bound(0), max: bound(1), exclusiveMin: true},
+	"blockchain.prune.keep_events":              atLeast(0),
+	"blockchain.prune.keep_duration":            atLeast(0),
+	"admission.max_parents":                     atLeast(0),
+	"admission.max_description":                 atLeast(0),
+	"admission.max_payload_keys":                atLeast(0),
+	"admission.max_payload_bytes":               atLeast(0),
+	"admission.author_rate":                     atLeast(0),
+	"admission.author_burst":                    atLeast(0),
+	"admission.global_rate":                     atLeast(0),
+	"admission.global_burst":                    atLeast(0),
+	"agent.triggers.debounce":                   atLeast(0),
+	"agent.triggers.min_interval":               atLeast(0),
+	"agent.policy.type":                         {required: true, enum: policyTypes},
+	"agent.policy.mode":                         {enum: ensembleModes},
+	"agent.policy.weight":                       atLeast(0),
+	"agent.policy.rules[].when.min_agents":      atLeast(0),
+	"agent.policy.rules[].when.max_agents":      atLeast(0),
+	"agent.policy.rules[].when.every":           atLeast(0),
+	"agent.policy.rules[].description":          {required: true},
+	"agent.budget.tokens_per_hour":              atLeast(0),
+	"agent.budget.tokens_per_day":               atLeast(0),
+	"agent.budget.cost_per_day":                 atLeast(0),
+	"agent.budget.on_exhausted":                 {enum: budgetActions},
+	"agent.budget.report_interval":              atLeast(0),
+	"agent.budget.fallback.type":                {enum: policyTypes},
+	"agent.budget.fallback.mode":                {enum: ensembleModes},
+	"agent.budget.fallback.weight":              atLeast(0),
+	"agent.budget.fallback.rules[].description": {required: true},
+	"llm.costs.*":                               atLeast(0),
+	"scheduler.workers":                         atLeast(0),
+	"scheduler.jitter":                          between(0, 1),
+	"scheduler.overrun":                         {enum: overrunModes},
+	"scheduler.shutdown_timeout":                atLeast(0),
+	"logging.level":                             {enum: logLevels},
+	"logging.levels.*":                          {enum: logLevels},
+	"logging.sinks[].type":                      {enum: sinkTypes},
+	"logging.sinks[].format":                    {enum: sinkFormats},
+	"logging.sinks[].max_size_mb":               atLeast(0),
+	"logging.sinks[].max_age":                   atLeast(0),
+	"logging.sinks[].max_backups":               atLeast(0),
+}
+
+// recursive maps keys whose elements have the type of an enclosing key to
+// that key, whose constraints they share
+var recursive = map[string]string{
+	"agent.policy.members":          "agent.policy",
+	"agent.budget.fallback.members": "agent.budget.fallback",
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// check returns why v violates the constraint, or ""
+func (c constraint) check(v reflect.Value) string {
+	var x float64
+	switch v.Kind() {
+	case reflect.String:
+		s := v.String()
+		if c.required && s == "" {
+			return "is required"
+		}
+		if s != "" && len(c.enum) > 0 && !contains(c.enum, s) {
+			return fmt.Sprintf("must be one of %s, got %q", strings.Join(c.enum, ", "), s)
+		}
+		return ""
+	case reflect.Int, reflect.Int64:
+		x = float64(v.Int())
+		if v.Type() == durationType {
+			x = time.Duration(v.Int()).Seconds()
+		}
+	case reflect.Float64:
+		x = v.Float()
+	default:
+		return ""
+	}
+
+	switch {
+	case c.min != nil && c.exclusiveMin && x <= *c.min:
+		return "must be greater than " + formatBound(*c.min, v.Type())
+	case c.min != nil && x < *c.min:
+		return "must be at least " + formatBound(*c.min, v.Type())
+	case c.max != nil && x > *c.max:
+		return "must be at most " + formatBound(*c.max, v.Type())
+	}
+	return ""
+}
+
+// formatBound renders a bound in the unit of the value
+func formatBound(bound float64, t reflect.Type) string {
+	if t == durationType {
+		return time.Duration(bound * float64(time.Second)).String()
+	}
+	return strconv.FormatFloat(bound, 'g', -1, 64)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// validate checks every value against its constraints
+func (l *layers) validate(cfg *Config) {
+	root := reflect.ValueOf(cfg).Elem()
+	for _, f := range fieldList {
+		if !f.section {
+			l.check(f.key, f.key, root.FieldByIndex(f.index), l.values[f.key])
+		}
+	}
+
+	l.validatePolicy("agent.policy", cfg.Agent.Policy, l.values["agent.policy.type"])
+	l.validateBudget("agent.budget", cfg.Agent.Budget, l.values["agent.budget.on_exhausted"], l.values["agent.budget.fallback.type"])
+
+	l.validatePatterns("agent.triggers.patterns", cfg.Agent.Triggers.Patterns, l.values["agent.triggers.patterns"])
+	l.validateTriggers("agent.triggers", cfg.Agent.Triggers, l.values["agent.triggers.min_interval"])
+	l.validateKeys("blockchain.trusted_signers", cfg.Blockchain.TrustedSigners, l.values["blockchain.trusted_signers"])
+
+	agents := l.values["agents"]
+	for i, spec := range cfg.Agents {
+		_, policy := entry(element(agents, i), "policy")
+		l.validatePolicy(fmt.Sprintf("agents[%d].policy", i), spec.Agent.Policy, policy)
+		_, triggers := entry(element(agents, i), "triggers")
+		_, patterns := entry(triggers, "patterns")
+		l.validatePatterns(fmt.Sprintf("agents[%d].triggers.patterns", i), spec.Agent.Triggers.Patterns, patterns)
+		minInterval := triggers
+		if _, value := entry(triggers, "min_interval"); value != nil {
+			minInterval = value
+		}
+		l.validateTriggers(fmt.Sprintf("agents[%d].triggers", i), spec.Agent.Triggers, minInterval)
+		_, budget := entry(element(agents, i), "budget")
+		_, fallback := entry(budget, "fallback")
+		l.validateBudget(fmt.Sprintf("agents[%d].budget", i), spec.Agent.Budget, element(agents, i), fallback)
+	}
+
+	names := make(map[string]bool)
+	keyFiles := make(map[string]bool)
+	for i, spec := range cfg.Agents {
+		key := fmt.Sprintf("agents[%d]", i)
+		switch {
+		case spec.Agent.Name == "" && len(cfg.Agents) > 1:
+			l.fail(key+".name", l.sourceOf(key), element(agents, i), "is required when running several agents")
+		case spec.Agent.Name != "" && names[spec.Agent.Name]:
+			l.fail(key+".name", l.sourceOf(key), element(agents, i), "duplicate agent name %q", spec.Agent.Name)
+		}
+		names[spec.Agent.Name] = true
+		if file := spec.Agent.KeyFile; file != "" {
+			if keyFiles[file] {
+				l.fail(key+".key_file", l.sourceOf(key), element(agents, i), "key file %s is used by another agent", file)
+			}
+			keyFiles[file] = true
+		}
+		if c := spec.LLM.Cache; c.Backend == CacheDisk && c.Path == "" {
+			l.fail(key+".cache.path", l.sourceOf(key), element(agents, i), "is required for disk caches")
+		}
+	}
+
+	if c := cfg.LLM.Cache; len(cfg.Agents) == 0 && c.Backend == CacheDisk && c.Path == "" {
+		l.fail("llm.cache.path", l.sourceOf("llm.cache.backend"), l.values["llm.cache.backend"], "is required for disk caches")
+	}
+
+	sinks := l.values["logging.sinks"]
+	for i, sink := range cfg.Logging.Sinks {
+		if sink.Type == logger.SinkFile && sink.Path == "" {
+			key := fmt.Sprintf("logging.sinks[%d].path", i)
+			l.fail(key, l.sourceOf(key), element(sinks, i), "is required for file sinks")
+		}
+	}
+}
+
+// validatePolicy checks the settings that policy types require. node is the
+// policy's YAML mapping, or the value of its type for the agent section.
+func (l *layers) validatePolicy(key string, p PolicyConfig, node *yaml.Node) {
+	var missing string
+	switch {
+	case p.Type == PolicyRules && len(p.Rules) == 0:
+		missing = "rules"
+	case p.Type == PolicyScripted && p.Scenario == "":
+		missing = "scenario"
+	case p.Type == PolicyEnsemble && len(p.Members) == 0:
+		missing = "members"
+	}
+	if missing != "" {
+		l.fail(key+"."+missing, l.sourceOf(key+".type"), node, "is required for %s policies", p.Type)
+	}
+
+	rules := l.policyList(key, "rules", node)
+	for i, rule := range p.Rules {
+		if _, err := template.New("").Parse(rule.Description); err != nil {
+			k := fmt.Sprintf("%s.rules[%d].description", key, i)
+			_, description := entry(element(rules, i), "description")
+			l.fail(k, l.sourceOf(k), description, "%s", strings.TrimPrefix(err.Error(), "template: :"))
+		}
+	}
+
+	members := l.policyList(key, "members", node)
+	for i, member := range p.Members {
+		l.validatePolicy(fmt.Sprintf("%s.members[%d]", key, i), member, element(members, i))
+	}
+}
+
+// validateBudget checks the fallback policy of a budget. node is the YAML
+// value to report a missing fallback at, and fallback the fallback's mapping,
+// or the value of its type for the agent section.
+func (l *layers) validateBudget(key string, b BudgetConfig, node, fallback *yaml.Node) {
+	switch {
+	case b.OnExhausted != BudgetFallback:
+		return
+	case b.Fallback.Type == "":
+		l.fail(key+".fallback.type", l.sourceOf(key+".on_exhausted"), node, "is required to fall back")
+		return
+	}
+	l.rejectLLM(key+".fallback", b.Fallback, fallback, fallback)
+	l.validatePolicy(key+".fallback", b.Fallback, fallback)
+}
+
+// rejectLLM reports a fallback policy, or one of its ensemble members at any
+// depth, that uses the LLM. node is the policy's YAML mapping and typ the
+// value of its type to report at.
+func (l *layers) rejectLLM(key string, p PolicyConfig, node, typ *yaml.Node) {
+	if p.Type == PolicyLLM {
+		l.fail(key+".type", l.sourceOf(key+".type"), typ, "must not use the LLM whose budget is exhausted")
+	}
+	members := l.policyList(key, "members", node)
+	for i, member := range p.Members {
+		memberNode := element(members, i)
+		_, memberType := entry(memberNode, "type")
+		if memberType == nil {
+			memberType = memberNode
+		}
+		l.rejectLLM(fmt.Sprintf("%s.members[%d]", key, i), member, memberNode, memberType)
+	}
+}
+
+// validatePatterns checks that trigger patterns are regular expressions
+func (l *layers) validatePatterns(key string, patterns []string, node *yaml.Node) {
+	for i, pattern := range patterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			k := fmt.Sprintf("%s[%d]", key, i)
+			l.fail(k, l.sourceOf(k), element(node, i), "%s", strings.TrimPrefix(err.Error(), "error parsing regexp: "))
+		}
+	}
+}
+
+// validateTriggers checks that early wakeups are rate limited, so agents
+// mentioning each other cannot wake each other in a tight loop. node is the
+// value of min_interval, or the YAML value to report a missing one at.
+func (l *layers) validateTriggers(key string, t TriggerConfig, node *yaml.Node) {
+	if t.Enabled() && t.MinInterval <= 0 {
+		l.fail(key+".min_interval", l.sourceOf(key+".min_interval"), node, "must be positive when triggers are enabled")
+	}
+}
+
+// validateKeys checks a list of hex-encoded public keys
+func (l *layers) validateKeys(key string, keys []string, node *yaml.Node) {
+	for i, pubKey := range keys {
+		if b, err := hex.DecodeString(pubKey); err != nil || len(b) != ed25519.PublicKeySize {
+			k := fmt.Sprintf("%s[%d]", key, i)
+			l.fail(k, l.sourceOf(k), element(node, i), "is not a hex-encoded ed25519 public key")
+		}
+	}
+}
+
+// policyList returns the YAML value of a list setting of a policy
+func (l *layers) policyList(key, name string, node *yaml.Node) *yaml.Node {
+	if list, ok := l.values[key+"."+name]; ok {
+		return list
+	}
+	_, list := entry(node, name)
+	return list
+}
+
+// check validates a value and its elements. path names the constraint, e.g.
+// logging.sinks[].type, and key the value, e.g. logging.sinks[1].type; node
+// is the YAML value it was decoded from, if any.
+func (l *layers) check(path, key string, v reflect.Value, node *yaml.Node) {
+	if c, ok := constraints[path]; ok {
+		if msg := c.check(v); msg != "" {
+			l.fail(key, l.sourceOf(key), node, "%s", msg)
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Slice:
+		elem := path + "[]"
+		if enclosing, ok := recursive[path]; ok {
+			elem = enclosing
+		}
+		for i := 0; i < v.Len(); i++ {
+			l.check(elem, fmt.Sprintf("%s[%d]", key, i), v.Index(i), element(node, i))
+		}
+	case reflect.Map:
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+		for _, k := range keys {
+			_, value := entry(node, k.String())
+			l.check(path+".*", key+"."+k.String(), v.MapIndex(k), value)
+		}
+	case reflect.Struct:
+		known := make(map[string]bool)
+		for _, f := range keyFields(v.Type(), path) {
+			known[f.name] = true
+			_, value := entry(node, f.name)
+			l.check(f.path, key+"."+f.name, v.FieldByIndex(f.index), value)
+		}
+		// Decoding ignores unknown keys within lists and maps
+		if node != nil && node.Kind == yaml.MappingNode {
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				if name := node.Content[i].Value; !known[name] {
+					l.fail(key+"."+name, l.sourceOf(key), node.Content[i], "unknown key")
+				}
+			}
+		}
+	}
+}
+
+// keyField is a key of a struct
+type keyField struct {
+	name  string
+	path  string // Constraint path
+	index []int
+}
+
+// keyFields lists the keys of struct type t at constraint path. The keys of
+// inline fields take the constraints of the section of the same type, so
+// agents entries are constrained like the agent and llm sections.
+func keyFields(t reflect.Type, path string) []keyField {
+	var list []keyField
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if strings.Contains(sf.Tag.Get("yaml"), ",inline") {
+			for _, f := range keyFields(sf.Type, sectionOf(sf.Type)) {
+				f.index = append([]int{i}, f.index...)
+				list = append(list, f)
+			}
+			continue
+		}
+		if name := yamlName(sf); name != "" {
+			list = append(list, keyField{name: name, path: join(path, name), index: []int{i}})
+		}
+	}
+	return list
+}
+
+// sectionOf returns the key of the section of type t, or ""
+func sectionOf(t reflect.Type) string {
+	for _, f := range fieldList {
+		if f.section && f.typ == t {
+			return f.key
+		}
+	}
+	return ""
+}
+
+// element returns the i-th element of a sequence node, or nil
+func element(node *yaml.Node, i int) *yaml.Node {
+	if node == nil || node.Kind != yaml.SequenceNode || i >= len(node.Content) {
+		return nil
+	}
+	return node.Content[i]
+}
+
+// entry returns the key and value nodes of a mapping node entry, or nil
+func entry(node *yaml.Node, key string) (*yaml.Node, *yaml.Node) {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil, nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i], node.Content[i+1]
+		}
+	}
+	return nil, nil
+}
+
+// yamlName returns the key of a struct field, or "" if it has none
+func yamlName(sf reflect.StructField) string {
+	name, _, _ := strings.Cut(sf.Tag.Get("yaml"), ",")
+	if name == "-" {
+		return ""
+	}
+	return name
+}
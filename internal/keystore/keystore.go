@@ -0,0 +1,106 @@
+package keystore
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Key is an ed25519 key pair identifying an agent
+type Key struct {
+	Public  ed25519.PublicKey
+	Private ed25519.PrivateKey
+}
+
+// keyFile is the on-disk representation of a key
+type keyFile struct {
+	PublicKey  string `json:"public_key"`
+	PrivateKey string `json:"private_key"`
+}
+
+// Generate creates a new random key pair
+func Generate() (*Key, error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key pair: %w", err)
+	}
+	return &Key{Public: pub, Private: priv}, nil
+}
+
+// PublicKeyHex returns the public key as hex string
+func (k *Key) PublicKeyHex() string {
+	return hex.EncodeToString(k.Public)
+}
+
+// Save writes the key to path, readable only by the owner
+func (k *Key) Save(path string) error {
+	data, err := json.MarshalIndent(keyFile{
+		PublicKey:  hex.EncodeToString(k.Public),
+		PrivateKey: hex.EncodeToString(k.Private),
+	}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal key: %w", err)
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to create key file: %w", err)
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write key file: %w", err)
+	}
+	return f.Close()
+}
+
+// Load reads a key written by Save
+func Load(path string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+
+	var kf keyFile
+	if err := json.Unmarshal(data, &kf); err != nil {
+		return nil, fmt.Errorf("failed to parse key file: %w", err)
+	}
+
+	priv, err := hex.DecodeString(kf.PrivateKey)
+	if err != nil || len(priv) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("invalid private key in %s", path)
+	}
+
+	key := &Key{Private: ed25519.PrivateKey(priv)}
+	key.Public = key.Private.Public().(ed25519.PublicKey)
+	if kf.PublicKey != "" && kf.PublicKey != key.PublicKeyHex() {
+		return nil, fmt.Errorf("public key does not match private key in %s", path)
+	}
+	return key, nil
+}
+
+// LoadOrCreate reads the key at path, generating and saving a new key if the
+// file does not exist. Missing directories are created.
+func LoadOrCreate(path string) (key *Key, created bool, err error) {
+	if _, err := os.Stat(path); err == nil {
+		key, err := Load(path)
+		return key, false, err
+	} else if !os.IsNotExist(err) {
+		return nil, false, fmt.Errorf("failed to stat key file: %w", err)
+	}
+
+	key, err = Generate()
+	if err != nil {
+		return nil, false, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, false, fmt.Errorf("failed to create key directory: %w", err)
+	}
+	if err := key.Save(path); err != nil {
+		return nil, false, err
+	}
+	return key, true, nil
+}
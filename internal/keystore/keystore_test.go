@@ -0,0 +1,75 @@
+package keystore
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSaveAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.key")
+	key, err := Generate()
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	if err := key.Save(path); err != nil {
+		t.Fatalf("Failed to save key: %v", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("Key file should be readable only by the owner, got %v", info.Mode())
+	}
+	if err := key.Save(path); err == nil {
+		t.Error("Saving must not overwrite an existing key")
+	}
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Failed to load key: %v", err)
+	}
+	if loaded.PublicKeyHex() != key.PublicKeyHex() || !loaded.Private.Equal(key.Private) {
+		t.Error("Loaded key differs from the saved one")
+	}
+}
+
+func TestLoadRejectsInvalidKeys(t *testing.T) {
+	dir := t.TempDir()
+	key, _ := Generate()
+	other, _ := Generate()
+	valid := filepath.Join(dir, "valid.key")
+	key.Save(valid)
+	data, _ := os.ReadFile(valid)
+
+	for name, content := range map[string]string{
+		"mismatch": strings.Replace(string(data), key.PublicKeyHex(), other.PublicKeyHex(), 1),
+		"short":    `{"private_key": "abcd"}`,
+		"garbage":  "not json",
+	} {
+		path := filepath.Join(dir, name+".key")
+		os.WriteFile(path, []byte(content), 0o600)
+		if _, err := Load(path); err == nil {
+			t.Errorf("Expected %s key file to be rejected", name)
+		}
+	}
+	if _, err := Load(filepath.Join(dir, "missing.key")); err == nil {
+		t.Error("Expected a missing key file to fail")
+	}
+}
+
+func TestLoadOrCreate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys", "agent.key")
+	key, created, err := LoadOrCreate(path)
+	if err != nil || !created {
+		t.Fatalf("Expected a new key, got created=%v, %v", created, err)
+	}
+
+	again, created, err := LoadOrCreate(path)
+	if err != nil || created {
+		t.Fatalf("Expected the existing key, got created=%v, %v", created, err)
+	}
+	if again.PublicKeyHex() != key.PublicKeyHex() {
+		t.Error("The persisted key should be loaded on restart")
+	}
+}
@@ -0,0 +1,287 @@
+package llm
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yanchenko-igor/blockchain-universe/internal/config"
+)
+
+// Cache stores completions by the fingerprint of their request. Caches are
+// safe for concurrent use, so agents may share one.
+type Cache interface {
+	// Get returns the completion stored under key, if it has not expired
+	Get(key string) (string, bool)
+	// Put stores completion under key
+	Put(key, completion string) error
+}
+
+// CacheStats counts cache lookups
+type CacheStats struct {
+	Hits   uint64
+	Misses uint64
+}
+
+// NewCache creates the cache configured by cfg, or returns nil if caching is
+// disabled
+func NewCache(cfg config.CacheConfig) (Cache, error) {
+	switch cfg.Backend {
+	case "":
+		return nil, nil
+	case config.CacheMemory:
+		return NewMemoryCache(cfg.Size, cfg.TTL), nil
+	case config.CacheDisk:
+		return NewDiskCache(cfg.Path, cfg.Size, cfg.TTL)
+	default:
+		return nil, fmt.Errorf("unknown cache backend %q", cfg.Backend)
+	}
+}
+
+// cacheKey fingerprints a request body sent to endpoint. The body holds the
+// model, system prompt, prompt and sampling parameters.
+func cacheKey(endpoint string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(endpoint))
+	h.Write([]byte{0})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// MemoryCache keeps completions in memory, evicting the least recently used
+type MemoryCache struct {
+	size    int
+	ttl     time.Duration
+	mu      sync.Mutex // Guards the fields below
+	entries map[string]*list.Element
+	order   *list.List // Of *memoryEntry, most recently used first
+}
+
+type memoryEntry struct {
+	key        string
+	completion string
+	created    time.Time
+}
+
+// NewMemoryCache creates a cache of at most size entries, each used for ttl
+// (0 for as long as it is kept)
+func NewMemoryCache(size int, ttl time.Duration) *MemoryCache {
+	if size <= 0 {
+		size = 1
+	}
+	return &MemoryCache{size: size, ttl: ttl, entries: make(map[string]*list.Element), order: list.New()}
+}
+
+// Get returns the completion stored under key
+func (c *MemoryCache) Get(key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		return "", false
+	}
+	entry := el.Value.(*memoryEntry)
+	if expired(entry.created, c.ttl) {
+		c.order.Remove(el)
+		delete(c.entries, key)
+		return "", false
+	}
+	c.order.MoveToFront(el)
+	return entry.completion, true
+}
+
+// Put stores completion under key, evicting the least recently used entry
+// if the cache is full
+func (c *MemoryCache) Put(key, completion string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		el.Value = &memoryEntry{key: key, completion: completion, created: time.Now()}
+		c.order.MoveToFront(el)
+		return nil
+	}
+	c.entries[key] = c.order.PushFront(&memoryEntry{key: key, completion: completion, created: time.Now()})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*memoryEntry).key)
+	}
+	return nil
+}
+
+// Len returns the number of entries, including expired ones not yet evicted
+func (c *MemoryCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// staleTempFile is the age after which a temporary file left by an
+// interrupted Put is removed; younger ones may still be written by a process
+// sharing the directory
+const staleTempFile = time.Minute
+
+// DiskCache keeps completions in a directory, one file per entry, so they
+// survive restarts and can be shared by processes
+type DiskCache struct {
+	dir     string
+	size    int
+	ttl     time.Duration
+	mu      sync.Mutex // Guards entries and sweeps
+	entries int        // Entries found by the last sweep plus those added since
+}
+
+// diskEntry is the content of a cache file
+type diskEntry struct {
+	Completion string    `json:"completion"`
+	Created    time.Time `json:"created"`
+}
+
+// NewDiskCache creates a cache of at most size entries (0 for no limit) in
+// dir, creating the directory if needed. Entries are used for ttl (0 for
+// ever); expired entries are removed when they are read and by sweeps, which
+// run when the cache is opened and when Put exceeds the size.
+func NewDiskCache(dir string, size int, ttl time.Duration) (*DiskCache, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("cache directory is required")
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	c := &DiskCache{dir: dir, size: size, ttl: ttl}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.sweep(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// sweep removes expired entries and stale temporary files, then the least
+// recently written entries until a tenth of the size is free, so full caches
+// are not swept on every Put; c.mu must be held
+func (c *DiskCache) sweep() error {
+	type entry struct {
+		path    string
+		written time.Time
+	}
+	var entries []entry
+	err := filepath.WalkDir(c.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			// Removed by a process sharing the directory
+			return nil
+		}
+		switch {
+		case strings.HasPrefix(d.Name(), ".tmp-"):
+			if time.Since(info.ModTime()) > staleTempFile {
+				os.Remove(path)
+			}
+		case filepath.Ext(path) == ".json":
+			if expired(info.ModTime(), c.ttl) {
+				os.Remove(path)
+			} else {
+				entries = append(entries, entry{path, info.ModTime()})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to sweep cache directory: %w", err)
+	}
+
+	if keep := c.size - c.size/10; c.size > 0 && len(entries) > keep {
+		sort.Slice(entries, func(i, j int) bool { return entries[i].written.After(entries[j].written) })
+		for _, e := range entries[keep:] {
+			os.Remove(e.path)
+		}
+		entries = entries[:keep]
+	}
+	c.entries = len(entries)
+	return nil
+}
+
+// path returns the file of key, in a subdirectory named after its first
+// characters to keep directories small
+func (c *DiskCache) path(key string) string {
+	return filepath.Join(c.dir, key[:2], key+".json")
+}
+
+// Get returns the completion stored under key. Unreadable entries count as
+// missing.
+func (c *DiskCache) Get(key string) (string, bool) {
+	data, err := os.ReadFile(c.path(key))
+	if err != nil {
+		return "", false
+	}
+	var entry diskEntry
+	if err := json.Unmarshal(data, &entry); err != nil || expired(entry.Created, c.ttl) {
+		os.Remove(c.path(key))
+		return "", false
+	}
+	return entry.Completion, true
+}
+
+// Put stores completion under key. The file is replaced atomically, so
+// concurrent readers never see a partial entry.
+func (c *DiskCache) Put(key, completion string) error {
+	if err := c.write(key, completion); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries++
+	if c.size > 0 && c.entries > c.size {
+		return c.sweep()
+	}
+	return nil
+}
+
+// write stores an entry file
+func (c *DiskCache) write(key, completion string) error {
+	data, err := json.Marshal(diskEntry{Completion: completion, Created: time.Now()})
+	if err != nil {
+		return fmt.Errorf("failed to marshal cache entry: %w", err)
+	}
+	path := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create cache entry: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to store cache entry: %w", err)
+	}
+	return nil
+}
+
+// expired reports whether an entry created at created is older than ttl
+func expired(created time.Time, ttl time.Duration) bool {
+	return ttl > 0 && time.Since(created) > ttl
+}
@@ -0,0 +1,197 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yanchenko-igor/blockchain-universe/internal/config"
+	"github.com/yanchenko-igor/blockchain-universe/pkg/logger"
+	"github.com/yanchenko-igor/blockchain-universe/pkg/metrics"
+)
+
+func TestMemoryCache(t *testing.T) {
+	cache := NewMemoryCache(2, time.Hour)
+	cache.Put("a", "1")
+	cache.Put("b", "2")
+	cache.Get("a")
+	cache.Put("c", "3")
+
+	if _, ok := cache.Get("b"); ok {
+		t.Error("The least recently used entry should be evicted")
+	}
+	for key, want := range map[string]string{"a": "1", "c": "3"} {
+		if got, ok := cache.Get(key); !ok || got != want {
+			t.Errorf("Expected %q under %q, got %q, %v", want, key, got, ok)
+		}
+	}
+
+	expiring := NewMemoryCache(10, time.Millisecond)
+	expiring.Put("a", "1")
+	time.Sleep(5 * time.Millisecond)
+	if _, ok := expiring.Get("a"); ok || expiring.Len() != 0 {
+		t.Error("Expired entries should be dropped")
+	}
+}
+
+func TestDiskCache(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "cache")
+	key := cacheKey("http://llm", []byte(`{"prompt":"p"}`))
+
+	cache, err := NewDiskCache(dir, 10, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	if err := cache.Put(key, "Event"); err != nil {
+		t.Fatalf("Failed to store entry: %v", err)
+	}
+
+	// A new cache on the same directory sees the entry
+	reopened, _ := NewDiskCache(dir, 10, time.Hour)
+	if got, ok := reopened.Get(key); !ok || got != "Event" {
+		t.Errorf("Expected the stored completion, got %q, %v", got, ok)
+	}
+
+	expiring, _ := NewDiskCache(dir, 10, time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	if _, ok := expiring.Get(key); ok {
+		t.Error("Expired entries should be missing")
+	}
+	if _, err := os.Stat(cache.path(key)); !os.IsNotExist(err) {
+		t.Errorf("Expired entries should be removed, got %v", err)
+	}
+}
+
+func TestDiskCacheSize(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "cache")
+	cache, _ := NewDiskCache(dir, 10, 0)
+	var keys []string
+	for i := range 25 {
+		key := cacheKey("http://llm", []byte{byte(i)})
+		keys = append(keys, key)
+		cache.Put(key, "Event")
+		// Sweeps evict by modification time
+		old := time.Now().Add(time.Duration(i-25) * time.Minute)
+		os.Chtimes(cache.path(key), old, old)
+	}
+
+	count := func() int {
+		n := 0
+		filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+			if err == nil && filepath.Ext(path) == ".json" {
+				n++
+			}
+			return nil
+		})
+		return n
+	}
+	if n := count(); n > 10 {
+		t.Errorf("Expected at most 10 entries on disk, got %d", n)
+	}
+	if _, ok := cache.Get(keys[24]); !ok {
+		t.Error("The most recent entry should be kept")
+	}
+	if _, ok := cache.Get(keys[0]); ok {
+		t.Error("The oldest entry should be evicted")
+	}
+
+	// Opening a cache with a smaller size sweeps it, along with stale temporary files
+	stale := filepath.Join(dir, keys[0][:2], ".tmp-1")
+	os.MkdirAll(filepath.Dir(stale), 0700)
+	os.WriteFile(stale, nil, 0600)
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(stale, old, old)
+	NewDiskCache(dir, 2, 0)
+	if n := count(); n > 2 {
+		t.Errorf("Expected the reopened cache to keep at most 2 entries, got %d", n)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Error("Stale temporary files should be removed")
+	}
+}
+
+func TestCompletionsAreCached(t *testing.T) {
+	var mu sync.Mutex
+	var requests []CompletionRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req CompletionRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		requests = append(requests, req)
+		mu.Unlock()
+		w.Write([]byte(`{"choices":[{"text":"Event"}]}`))
+	}))
+	defer srv.Close()
+	sent := func() []CompletionRequest {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]CompletionRequest{}, requests...)
+	}
+
+	cfg := config.LLMConfig{APIEndpoint: srv.URL, TimeoutSeconds: 5, Model: "small"}
+	cache := NewMemoryCache(10, 0)
+	reg := metrics.NewRegistry()
+	m := NewMetrics(reg)
+
+	// Clients sharing a cache share completions
+	first, _ := NewClient(cfg, logger.New("error"))
+	second, _ := NewClient(cfg, logger.New("error"))
+	for _, c := range []*Client{first, second} {
+		c.SetCache(cache)
+		c.SetMetrics(m)
+	}
+	for _, c := range []*Client{first, second, first} {
+		if completion, err := c.GetCompletion(context.Background(), "prompt"); err != nil || completion != "Event" {
+			t.Fatalf("Unexpected completion %q, %v", completion, err)
+		}
+	}
+	if len(sent()) != 1 {
+		t.Errorf("Expected one request, got %d", len(sent()))
+	}
+	if stats := first.CacheStats(); stats != (CacheStats{Hits: 1, Misses: 1}) {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+
+	// Requests with a different fingerprint miss
+	second.SetPersona("Terse")
+	second.GetCompletion(context.Background(), "prompt")
+	if len(sent()) != 2 {
+		t.Errorf("Changed system prompts should miss the cache, got %d requests", len(sent()))
+	}
+
+	// Sampled requests are only cached if always is set
+	first.SetTemperature(0.7)
+	first.GetCompletion(context.Background(), "prompt")
+	first.GetCompletion(context.Background(), "prompt")
+	if len(sent()) != 4 {
+		t.Errorf("Sampled requests should bypass the cache, got %d requests", len(sent()))
+	}
+
+	var out strings.Builder
+	reg.WriteTo(&out)
+	for _, line := range []string{
+		`bu_llm_cache_requests_total{result="hit"} 2` + "\n",
+		`bu_llm_cache_requests_total{result="miss"} 2` + "\n",
+	} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("Missing %q in metrics:\n%s", line, out.String())
+		}
+	}
+
+	// Health checks ask for a single token and are never cached
+	for range 2 {
+		if err := first.Health(context.Background()); err != nil {
+			t.Fatalf("Health check failed: %v", err)
+		}
+	}
+	if requests := sent(); len(requests) != 6 || requests[5].MaxTokens != 1 {
+		t.Errorf("Expected uncached one-token health checks, got %+v", requests[4:])
+	}
+}
@@ -4,13 +4,19 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/yanchenko-igor/blockchain-universe/internal/config"
 	"github.com/yanchenko-igor/blockchain-universe/pkg/logger"
+	"github.com/yanchenko-igor/blockchain-universe/pkg/tracing"
 )
 
 const systemPrompt = `You are an artificial intelligence existing exclusively within the Blockchain Universe (BU). For you, the only reality is the blockchain, and everything that happens is defined by events recorded in the chain.
@@ -35,19 +41,34 @@ When responding, do not invent anything beyond events, do not reference physical
 
 // Client handles communication with LLM API
 type Client struct {
-	config     config.LLMConfig
-	httpClient *http.Client
-	log        logger.Logger
+	config       config.LLMConfig
+	httpClient   *http.Client
+	metrics      *Metrics
+	retryBackoff time.Duration // Before the first retry, doubling after each
+	persona      string        // Appended to the system prompt
+	mu           sync.RWMutex  // Guards settings changed at runtime
+	cache        Cache         // Completions by request fingerprint; nil to disable
+	cacheHits    atomic.Uint64
+	cacheMisses  atomic.Uint64
+	ledger       *Ledger // Tokens of completed requests
+	log          logger.Logger
 }
 
 // CompletionRequest represents an LLM API request
 type CompletionRequest struct {
-	Model      string `json:"model"`
-	Prompt     string `json:"prompt"`
-	MaxTokens  int    `json:"max_tokens"`
-	Temperature float64 `json:"temperature,omitempty"`
-	Stop       []string `json:"stop,omitempty"`
-	System     string `json:"system,omitempty"`
+	Model         string         `json:"model"`
+	Prompt        string         `json:"prompt"`
+	MaxTokens     int            `json:"max_tokens"`
+	Temperature   float64        `json:"temperature,omitempty"`
+	Stop          []string       `json:"stop,omitempty"`
+	System        string         `json:"system,omitempty"`
+	Stream        bool           `json:"stream,omitempty"`
+	StreamOptions *StreamOptions `json:"stream_options,omitempty"`
+}
+
+// StreamOptions asks OpenAI-compatible APIs to end a stream with a usage chunk
+type StreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
 }
 
 // CompletionResponse represents an LLM API response
@@ -78,18 +99,93 @@ func NewClient(cfg config.LLMConfig, log logger.Logger) (*Client, error) {
 		httpClient: &http.Client{
 			Timeout: time.Duration(cfg.TimeoutSeconds) * time.Second,
 		},
-		log: log,
+		metrics:      &Metrics{},
+		retryBackoff: time.Second,
+		ledger:       NewLedger(),
+		log:          log,
 	}, nil
 }
 
-// GetCompletion gets a completion from the LLM
+// SetTemperature changes the sampling temperature of later requests
+func (c *Client) SetTemperature(temperature float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.config.Temperature = temperature
+}
+
+// SetPersona appends a description of the agent's character to the system
+// prompt. It must be called before the first completion.
+func (c *Client) SetPersona(persona string) {
+	c.persona = strings.TrimSpace(persona)
+}
+
+// SetCache stores completions of requests at temperature 0 in cache, or of
+// every request if the cache configuration says always. Clients may share a
+// cache.
+func (c *Client) SetCache(cache Cache) {
+	c.cache = cache
+}
+
+// Usage returns the ledger of tokens used by the client. Completions served
+// from the cache use none.
+func (c *Client) Usage() *Ledger {
+	return c.ledger
+}
+
+// Model returns the model requested by the client
+func (c *Client) Model() string {
+	return c.config.Model
+}
+
+// CacheStats returns the cache lookups of the client
+func (c *Client) CacheStats() CacheStats {
+	return CacheStats{Hits: c.cacheHits.Load(), Misses: c.cacheMisses.Load()}
+}
+
+// system returns the system prompt
+func (c *Client) system() string {
+	if c.persona == "" {
+		return systemPrompt
+	}
+	return systemPrompt + "\n\nYour persona:\n" + c.persona
+}
+
+// temperature returns the current sampling temperature
+func (c *Client) temperature() float64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.config.Temperature
+}
+
+// GetCompletion gets a completion from the LLM, retrying transient failures.
+// Completions are served from the cache when one is set and the request is
+// cacheable.
 func (c *Client) GetCompletion(ctx context.Context, prompt string) (string, error) {
+	return c.GetCompletionStream(ctx, prompt, nil)
+}
+
+// GetCompletionStream gets a completion like GetCompletion. If streaming is
+// enabled, partial is called with the output so far as it is generated, and
+// generation stops once the output holds a complete JSON object, which ends
+// the completion. partial may be nil.
+func (c *Client) GetCompletionStream(ctx context.Context, prompt string, partial func(text string)) (completion string, err error) {
+	ctx, span := tracing.Start(ctx, "llm.completion")
+	span.SetAttribute("llm.model", c.config.Model)
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+
 	reqBody := CompletionRequest{
 		Model:       c.config.Model,
 		Prompt:      prompt,
 		MaxTokens:   c.config.MaxTokens,
-		Temperature: c.config.Temperature,
-		System:      systemPrompt,
+		Temperature: c.temperature(),
+		System:      c.system(),
+		Stream:      c.config.Stream,
+	}
+	if reqBody.Stream {
+		reqBody.StreamOptions = &StreamOptions{IncludeUsage: true}
 	}
 
 	bodyBytes, err := json.Marshal(reqBody)
@@ -97,7 +193,80 @@ func (c *Client) GetCompletion(ctx context.Context, prompt string) (string, erro
 		return "", fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", c.config.APIEndpoint, bytes.NewBuffer(bodyBytes))
+	var key string
+	if c.cache != nil && (reqBody.Temperature == 0 || c.config.Cache.Always) {
+		key = cacheKey(c.config.APIEndpoint, bodyBytes)
+		if completion, ok := c.cache.Get(key); ok {
+			c.cacheHits.Add(1)
+			c.metrics.cache.Inc("hit")
+			span.SetAttribute("llm.cache", "hit")
+			c.log.DebugContext(ctx, "LLM completion served from cache", "key", key[:16])
+			return completion, nil
+		}
+		c.cacheMisses.Add(1)
+		c.metrics.cache.Inc("miss")
+		span.SetAttribute("llm.cache", "miss")
+	}
+
+	completion, err = c.send(ctx, bodyBytes, partial)
+	if err != nil {
+		return "", err
+	}
+	if key != "" {
+		if err := c.cache.Put(key, completion); err != nil {
+			c.log.WarnContext(ctx, "Failed to cache LLM completion", "error", err)
+		}
+	}
+	return completion, nil
+}
+
+// send sends a request, retrying transient failures
+func (c *Client) send(ctx context.Context, bodyBytes []byte, partial func(text string)) (string, error) {
+	for attempt := 0; ; attempt++ {
+		completion, err := c.complete(ctx, bodyBytes, attempt, partial)
+		if err == nil {
+			return completion, nil
+		}
+
+		var reqErr *requestError
+		if !errors.As(err, &reqErr) || !reqErr.retryable || attempt >= c.config.MaxRetries {
+			return "", err
+		}
+		backoff := c.retryBackoff << attempt
+		c.metrics.retries.Inc()
+		c.log.WarnContext(ctx, "Retrying LLM request", "attempt", attempt+1, "backoff", backoff, "error", err)
+
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(backoff):
+		}
+	}
+}
+
+// complete sends a single completion request, reading the completion as a
+// stream if the response is one
+func (c *Client) complete(ctx context.Context, body []byte, attempt int, partial func(text string)) (completion string, err error) {
+	// Cancelling the request closes the connection, which stops a stream
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	ctx, span := tracing.Start(ctx, "llm.request")
+	span.SetKind(tracing.KindClient)
+	span.SetAttribute("llm.attempt", attempt)
+
+	start := time.Now()
+	defer func() {
+		c.metrics.latency.Observe(time.Since(start).Seconds())
+		var reqErr *requestError
+		if errors.As(err, &reqErr) {
+			c.metrics.errors.Inc(reqErr.class)
+			span.SetAttribute("llm.error_class", reqErr.class)
+		}
+		span.RecordError(err)
+		span.End()
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.config.APIEndpoint, bytes.NewReader(body))
 	if err != nil {
 		return "", fmt.Errorf("failed to create request: %w", err)
 	}
@@ -107,43 +276,109 @@ func (c *Client) GetCompletion(ctx context.Context, prompt string) (string, erro
 		req.Header.Set("Authorization", "Bearer "+c.config.APIKey)
 	}
 
-	c.log.Debug("Sending LLM request", "endpoint", c.config.APIEndpoint, "model", c.config.Model)
+	c.log.DebugContext(ctx, "Sending LLM request", "endpoint", c.config.APIEndpoint, "model", c.config.Model)
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to send request: %w", err)
+		class := classNetwork
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			class = classTimeout
+		}
+		// Failures caused by the caller's context are final
+		return "", &requestError{class: class, retryable: ctx.Err() == nil, err: fmt.Errorf("failed to send request: %w", err)}
 	}
 	defer resp.Body.Close()
+	span.SetAttribute("http.status_code", resp.StatusCode)
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("LLM API error (status %d): %s", resp.StatusCode, string(body))
+		respBody, _ := io.ReadAll(resp.Body)
+		statusErr := fmt.Errorf("LLM API error (status %d): %s", resp.StatusCode, string(respBody))
+		switch {
+		case resp.StatusCode == http.StatusTooManyRequests:
+			return "", &requestError{class: classRateLimited, retryable: true, err: statusErr}
+		case resp.StatusCode >= 500:
+			return "", &requestError{class: classServer, retryable: true, err: statusErr}
+		}
+		return "", &requestError{class: classClient, err: statusErr}
 	}
 
-	var result CompletionResponse
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return "", fmt.Errorf("failed to decode response: %w", err)
-	}
+	var usage Usage
+	if format := streamFormat(resp.Header.Get("Content-Type")); format != "" {
+		span.SetAttribute("llm.stream", format)
+		result, err := readStream(resp.Body, format, partial)
+		usage = result.usage
+		if !result.reported && result.chunks > 0 {
+			// Streams closed early, or by servers that send no usage, are
+			// counted at about a token per chunk
+			usage = Usage{PromptTokens: estimateTokens(body), CompletionTokens: result.chunks}
+		}
+		if err != nil {
+			c.recordUsage(span, usage)
+			return "", err
+		}
+		if result.text == "" {
+			return "", &requestError{class: classEmpty, err: fmt.Errorf("empty completion stream")}
+		}
+		if result.complete {
+			c.log.DebugContext(ctx, "Stopped LLM stream at a complete JSON object")
+		}
+		completion = result.text
+	} else {
+		var result CompletionResponse
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			return "", &requestError{class: classDecode, err: fmt.Errorf("failed to decode response: %w", err)}
+		}
 
-	if result.Error != nil {
-		return "", fmt.Errorf("LLM API error: %s", result.Error.Message)
-	}
+		if result.Error != nil {
+			return "", &requestError{class: classAPI, err: fmt.Errorf("LLM API error: %s", result.Error.Message)}
+		}
 
-	if len(result.Choices) == 0 {
-		return "", fmt.Errorf("no completion choices returned")
+		if len(result.Choices) == 0 {
+			return "", &requestError{class: classEmpty, err: fmt.Errorf("no completion choices returned")}
+		}
+		completion = result.Choices[0].Text
+		usage = Usage{PromptTokens: result.Usage.PromptTokens, CompletionTokens: result.Usage.CompletionTokens}
 	}
 
-	completion := result.Choices[0].Text
-	c.log.Debug("LLM completion received",
-		"tokens", result.Usage.TotalTokens,
+	c.recordUsage(span, usage)
+
+	c.log.DebugContext(ctx, "LLM completion received",
+		"tokens", usage.Tokens(),
 		"length", len(completion))
 
 	return completion, nil
 }
 
-// Health checks if the LLM service is healthy
+// recordUsage adds the usage of a request to the ledger and metrics
+func (c *Client) recordUsage(span *tracing.Span, usage Usage) {
+	c.metrics.tokens.Add(float64(usage.PromptTokens), "prompt")
+	c.metrics.tokens.Add(float64(usage.CompletionTokens), "completion")
+	usage.Requests = 1
+	usage.Cost = float64(usage.Tokens()) / 1000 * c.config.Costs[c.config.Model]
+	c.ledger.Record(c.config.Model, usage)
+	c.metrics.cost.Add(usage.Cost, c.config.Model)
+	span.SetAttribute("llm.prompt_tokens", usage.PromptTokens)
+	span.SetAttribute("llm.completion_tokens", usage.CompletionTokens)
+}
+
+// estimateTokens estimates the prompt tokens of a request body at about four
+// characters per token
+func estimateTokens(body []byte) int {
+	var req CompletionRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return 0
+	}
+	return (len(req.Prompt) + len(req.System) + 3) / 4
+}
+
+// Health checks if the LLM service is healthy with a single request for one
+// token, bypassing the cache and retries
 func (c *Client) Health(ctx context.Context) error {
-	// Simple health check with a minimal prompt
-	_, err := c.GetCompletion(ctx, "Respond with 'OK'")
+	body, err := json.Marshal(CompletionRequest{Model: c.config.Model, Prompt: "OK", MaxTokens: 1})
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+	_, err = c.complete(ctx, body, 0, nil)
 	return err
-}
\ No newline at end of file
+}
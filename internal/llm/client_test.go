@@ -0,0 +1,88 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yanchenko-igor/blockchain-universe/internal/config"
+	"github.com/yanchenko-igor/blockchain-universe/pkg/logger"
+	"github.com/yanchenko-igor/blockchain-universe/pkg/metrics"
+)
+
+func TestRetriesAndMetrics(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			http.Error(w, "overloaded", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"choices":[{"text":"Event"}],"usage":{"prompt_tokens":12,"completion_tokens":3,"total_tokens":15}}`))
+	}))
+	defer srv.Close()
+
+	client, _ := NewClient(config.LLMConfig{APIEndpoint: srv.URL, TimeoutSeconds: 5, MaxRetries: 2}, logger.New("error"))
+	client.retryBackoff = time.Millisecond
+	reg := metrics.NewRegistry()
+	client.SetMetrics(NewMetrics(reg))
+
+	completion, err := client.GetCompletion(context.Background(), "prompt")
+	if err != nil || completion != "Event" {
+		t.Fatalf("Expected completion after a retry, got %q, %v", completion, err)
+	}
+
+	var out strings.Builder
+	reg.WriteTo(&out)
+	for _, line := range []string{
+		"bu_llm_retries_total 1\n",
+		`bu_llm_errors_total{class="server"} 1` + "\n",
+		`bu_llm_tokens_total{kind="prompt"} 12` + "\n",
+		`bu_llm_tokens_total{kind="completion"} 3` + "\n",
+		"bu_llm_request_duration_seconds_count 2\n",
+	} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("Missing %q in metrics:\n%s", line, out.String())
+		}
+	}
+}
+
+func TestClientErrorsAreNotRetried(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		http.Error(w, "bad request", http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	client, _ := NewClient(config.LLMConfig{APIEndpoint: srv.URL, TimeoutSeconds: 5, MaxRetries: 2}, logger.New("error"))
+	client.retryBackoff = time.Millisecond
+	if _, err := client.GetCompletion(context.Background(), "prompt"); err == nil {
+		t.Fatal("Expected an error")
+	}
+	if calls != 1 {
+		t.Errorf("Client errors should not be retried, got %d calls", calls)
+	}
+}
+
+func TestPersonaIsAppendedToSystemPrompt(t *testing.T) {
+	var req CompletionRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&req)
+		w.Write([]byte(`{"choices":[{"text":"Event"}]}`))
+	}))
+	defer srv.Close()
+
+	client, _ := NewClient(config.LLMConfig{APIEndpoint: srv.URL, TimeoutSeconds: 5}, logger.New("error"))
+	client.SetPersona("Curious and disruptive\n")
+	if _, err := client.GetCompletion(context.Background(), "prompt"); err != nil {
+		t.Fatalf("Completion failed: %v", err)
+	}
+	if !strings.HasPrefix(req.System, systemPrompt) || !strings.HasSuffix(req.System, "\nCurious and disruptive") {
+		t.Errorf("Persona missing from system prompt %q", req.System)
+	}
+}
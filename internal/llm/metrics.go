@@ -0,0 +1,55 @@
+package llm
+
+import (
+	"github.com/yanchenko-igor/blockchain-universe/pkg/metrics"
+)
+
+// Error classes, as reported in metrics
+const (
+	classNetwork     = "network"
+	classTimeout     = "timeout"
+	classRateLimited = "rate_limited"
+	classServer      = "server"
+	classClient      = "client"
+	classDecode      = "decode"
+	classAPI         = "api"
+	classEmpty       = "empty"
+)
+
+// Metrics instruments LLM clients; several clients may share one
+type Metrics struct {
+	latency *metrics.Histogram
+	tokens  *metrics.Counter
+	errors  *metrics.Counter
+	retries *metrics.Counter
+	cache   *metrics.Counter
+	cost    *metrics.Counter
+}
+
+// NewMetrics registers the LLM client metrics with reg
+func NewMetrics(reg *metrics.Registry) *Metrics {
+	return &Metrics{
+		latency: reg.NewHistogram("bu_llm_request_duration_seconds", "LLM request latency, including failed requests", metrics.DefaultBuckets),
+		tokens:  reg.NewCounter("bu_llm_tokens_total", "Tokens reported by the LLM API, by kind", "kind"),
+		errors:  reg.NewCounter("bu_llm_errors_total", "Failed LLM requests, by class", "class"),
+		retries: reg.NewCounter("bu_llm_retries_total", "Retried LLM requests"),
+		cost:    reg.NewCounter("bu_llm_cost_total", "Cost of LLM requests at the configured cost per 1000 tokens, by model", "model"),
+		cache:   reg.NewCounter("bu_llm_cache_requests_total", "Cacheable completions, by result (hit or miss)", "result"),
+	}
+}
+
+// SetMetrics instruments the client with m
+func (c *Client) SetMetrics(m *Metrics) {
+	c.metrics = m
+}
+
+// requestError is a failed request, classified for metrics and retries
+type requestError struct {
+	class     string
+	retryable bool
+	err       error
+}
+
+func (e *requestError) Error() string { return e.err.Error() }
+
+func (e *requestError) Unwrap() error { return e.err }
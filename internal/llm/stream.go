@@ -0,0 +1,198 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+	"time"
+)
+
+// Wire formats of streamed completions
+const (
+	formatSSE    = "sse"    // Server-Sent Events with a JSON chunk per data line, as OpenAI-compatible APIs send
+	formatNDJSON = "ndjson" // A JSON chunk per line, as Ollama sends
+)
+
+// maxChunkSize limits the size of a single streamed chunk
+const maxChunkSize = 1 << 20
+
+// partialInterval is the least time between two calls of a stream's partial
+// callback
+const partialInterval = 100 * time.Millisecond
+
+// streamChunk is a piece of a streamed completion. OpenAI-compatible APIs
+// send choices; Ollama sends response and done.
+type streamChunk struct {
+	Choices []struct {
+		Text         string `json:"text"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+	Response string `json:"response"`
+	Done     bool   `json:"done"`
+	Usage    *struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+	} `json:"usage"`
+	PromptEvalCount int `json:"prompt_eval_count"`
+	EvalCount       int `json:"eval_count"`
+	Error           *struct {
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+// streamFormat returns the stream format of a response content type, or ""
+// if the response is not streamed
+func streamFormat(contentType string) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "text/event-stream":
+		return formatSSE
+	case "application/x-ndjson", "application/jsonl", "application/json-seq":
+		return formatNDJSON
+	}
+	return ""
+}
+
+// streamResult is what a stream yielded before it ended
+type streamResult struct {
+	text     string
+	usage    Usage
+	reported bool // The server sent usage
+	chunks   int  // Chunks carrying text
+	complete bool // Stopped at a complete JSON object
+}
+
+// readStream reads a streamed completion, calling partial with the output so
+// far after the first chunk, at most every partialInterval after that, and
+// once more when the stream ends. It stops once the output holds a complete
+// JSON object; the caller then closes the body, which aborts the generation.
+func readStream(body io.Reader, format string, partial func(text string)) (streamResult, error) {
+	var result streamResult
+	var text strings.Builder
+	var object jsonObject
+
+	var published time.Time
+	pending := false // Text not yet passed to partial
+	publish := func() {
+		if partial != nil && pending {
+			partial(text.String())
+			published = time.Now()
+		}
+		pending = false
+	}
+
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxChunkSize)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if format == formatSSE {
+			// Blank lines end events; comments, event names and ids carry no text
+			data, ok := bytes.CutPrefix(line, []byte("data:"))
+			if !ok {
+				continue
+			}
+			line = bytes.TrimSpace(data)
+			if string(line) == "[DONE]" {
+				break
+			}
+		}
+		if len(line) == 0 {
+			continue
+		}
+
+		var chunk streamChunk
+		if err := json.Unmarshal(line, &chunk); err != nil {
+			return result, &requestError{class: classDecode, err: fmt.Errorf("failed to decode stream chunk: %w", err)}
+		}
+		if chunk.Error != nil {
+			return result, &requestError{class: classAPI, err: fmt.Errorf("LLM API error: %s", chunk.Error.Message)}
+		}
+
+		delta := chunk.Response
+		for _, choice := range chunk.Choices {
+			delta += choice.Text
+		}
+		if chunk.Usage != nil {
+			result.reported = true
+			result.usage.PromptTokens = chunk.Usage.PromptTokens
+			result.usage.CompletionTokens = chunk.Usage.CompletionTokens
+		}
+		if chunk.PromptEvalCount > 0 || chunk.EvalCount > 0 {
+			result.reported = true
+			result.usage.PromptTokens = chunk.PromptEvalCount
+			result.usage.CompletionTokens = chunk.EvalCount
+		}
+
+		if delta != "" {
+			text.WriteString(delta)
+			result.chunks++
+			pending = true
+			if end := object.feed(delta); end >= 0 {
+				publish()
+				result.text = text.String()[:text.Len()-len(delta)+end]
+				result.complete = true
+				return result, nil
+			}
+			if time.Since(published) >= partialInterval {
+				publish()
+			}
+		}
+		if chunk.Done {
+			break
+		}
+	}
+	publish()
+	if err := scanner.Err(); err != nil {
+		// Reads fail when the connection drops or the context is cancelled
+		return result, &requestError{class: classNetwork, retryable: text.Len() == 0, err: fmt.Errorf("failed to read stream: %w", err)}
+	}
+
+	result.text = text.String()
+	return result, nil
+}
+
+// jsonObject finds the end of the first JSON object in text fed to it piece
+// by piece
+type jsonObject struct {
+	buf      strings.Builder // Text of the object so far
+	depth    int
+	inString bool
+	escaped  bool
+}
+
+// feed scans the next piece of text and returns the offset in it just past
+// the end of the first complete, valid JSON object, or -1
+func (o *jsonObject) feed(piece string) int {
+	for i := 0; i < len(piece); i++ {
+		c := piece[i]
+		if o.depth == 0 {
+			if c != '{' {
+				continue
+			}
+			o.buf.Reset()
+		}
+		o.buf.WriteByte(c)
+
+		switch {
+		case o.inString && o.escaped:
+			o.escaped = false
+		case o.inString && c == '\\':
+			o.escaped = true
+		case c == '"':
+			o.inString = !o.inString
+		case o.inString:
+		case c == '{' || c == '[':
+			o.depth++
+		case c == '}' || c == ']':
+			o.depth--
+			if o.depth == 0 && json.Valid([]byte(o.buf.String())) {
+				return i + 1
+			}
+		}
+	}
+	return -1
+}
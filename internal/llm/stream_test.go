@@ -0,0 +1,128 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/yanchenko-igor/blockchain-universe/internal/config"
+	"github.com/yanchenko-igor/blockchain-universe/pkg/logger"
+)
+
+func TestStreamStopsAtCompleteJSONObject(t *testing.T) {
+	chunks := []string{`Sure: {"type": "prop`, `osal", "description": "Merge {chains}"`, `} and more`, ` text`}
+	var req CompletionRequest
+	aborted := make(chan bool, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&req)
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, chunk := range chunks {
+			data, _ := json.Marshal(map[string]interface{}{"choices": []map[string]string{{"text": chunk}}})
+			fmt.Fprintf(w, "data: %s\n\n", data)
+			w.(http.Flusher).Flush()
+		}
+		// Generation would go on until the client goes away
+		select {
+		case <-r.Context().Done():
+			aborted <- true
+		case <-time.After(5 * time.Second):
+			aborted <- false
+		}
+	}))
+	defer srv.Close()
+
+	client, _ := NewClient(config.LLMConfig{APIEndpoint: srv.URL, TimeoutSeconds: 10, Stream: true}, logger.New("error"))
+	var partials []string
+	completion, err := client.GetCompletionStream(context.Background(), "prompt", func(text string) {
+		partials = append(partials, text)
+	})
+	if err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	if want := `Sure: {"type": "proposal", "description": "Merge {chains}"}`; completion != want {
+		t.Errorf("Expected %q, got %q", want, completion)
+	}
+	if !req.Stream || req.StreamOptions == nil || !req.StreamOptions.IncludeUsage {
+		t.Errorf("Expected a streamed request asking for usage, got %+v", req)
+	}
+	// Chunks arriving at once are published on the first and at the end
+	if want := chunks[0] + chunks[1] + chunks[2]; len(partials) != 2 || partials[0] != chunks[0] || partials[1] != want {
+		t.Errorf("Expected the first and the final output, got %v", partials)
+	}
+	if usage := client.Usage().Today(); usage.PromptTokens == 0 || usage.CompletionTokens != 3 {
+		t.Errorf("Expected usage counted from the chunks without a usage chunk, got %+v", usage)
+	}
+	if !<-aborted {
+		t.Error("The stream should be closed once the object is complete")
+	}
+}
+
+func TestStreamNDJSON(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		fmt.Fprintln(w, `{"response":"A new ","done":false}`)
+		fmt.Fprintln(w, `{"response":"event","done":false}`)
+		fmt.Fprintln(w, `{"response":"","done":true,"prompt_eval_count":12,"eval_count":3}`)
+	}))
+	defer srv.Close()
+
+	client, _ := NewClient(config.LLMConfig{APIEndpoint: srv.URL, TimeoutSeconds: 5, Stream: true, Model: "small"}, logger.New("error"))
+	completion, err := client.GetCompletion(context.Background(), "prompt")
+	if err != nil || completion != "A new event" {
+		t.Fatalf("Unexpected completion %q, %v", completion, err)
+	}
+	if usage := client.Usage().Today(); usage.PromptTokens != 12 || usage.CompletionTokens != 3 {
+		t.Errorf("Expected the usage of the final chunk, got %+v", usage)
+	}
+}
+
+func TestStreamIsAbortedByContext(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"choices\":[{\"text\":\"Thinking\"}]}\n\n")
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	client, _ := NewClient(config.LLMConfig{APIEndpoint: srv.URL, TimeoutSeconds: 30, Stream: true, MaxRetries: 2}, logger.New("error"))
+	ctx, cancel := context.WithCancel(context.Background())
+	start := time.Now()
+	_, err := client.GetCompletionStream(ctx, "prompt", func(text string) { cancel() })
+	if err == nil {
+		t.Fatal("Expected the cancelled stream to fail")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Cancellation should abort the stream promptly, took %s", elapsed)
+	}
+	if usage := client.Usage().Today(); usage.Requests != 1 || usage.CompletionTokens != 1 {
+		t.Errorf("Expected the usage of the aborted stream to be recorded, got %+v", usage)
+	}
+}
+
+func TestJSONObject(t *testing.T) {
+	for _, tc := range []struct {
+		pieces []string
+		end    int // In the last piece
+	}{
+		{[]string{`{"a": 1}`}, 8},
+		{[]string{`text {"a": "}"`, `, "b": [1, {}]} more`}, 15},
+		{[]string{`{"a": "\"}"}`}, 12},
+		{[]string{`{not json} then {"a": 1}`}, 24},
+		{[]string{`no object`}, -1},
+		{[]string{`{"a": {"b": 1}`}, -1},
+	} {
+		var o jsonObject
+		end := -1
+		for _, piece := range tc.pieces {
+			end = o.feed(piece)
+		}
+		if end != tc.end {
+			t.Errorf("Expected %v to end at %d, got %d", tc.pieces, tc.end, end)
+		}
+	}
+}
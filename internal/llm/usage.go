@@ -0,0 +1,130 @@
+package llm
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// keepDays limits how many days of usage a ledger keeps
+const keepDays = 31
+
+// Usage counts the tokens of completed requests
+type Usage struct {
+	Requests         int     `json:"requests"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	Cost             float64 `json:"cost"` // At the configured cost per 1000 tokens
+}
+
+// Tokens returns the prompt and completion tokens
+func (u Usage) Tokens() int {
+	return u.PromptTokens + u.CompletionTokens
+}
+
+func (u *Usage) add(o Usage) {
+	u.Requests += o.Requests
+	u.PromptTokens += o.PromptTokens
+	u.CompletionTokens += o.CompletionTokens
+	u.Cost += o.Cost
+}
+
+// DailyUsage is the usage of a model on a day (UTC)
+type DailyUsage struct {
+	Day   string `json:"day"` // 2006-01-02
+	Model string `json:"model"`
+	Usage
+}
+
+type dayModel struct {
+	day   string
+	model string
+}
+
+// Ledger aggregates token usage per model and day, and the usage of the
+// current hour. It is safe for concurrent use.
+type Ledger struct {
+	mu     sync.Mutex // Guards the fields below
+	days   map[dayModel]*Usage
+	hour   time.Time // Start of the hour counted in hourly
+	hourly Usage
+	now    func() time.Time
+}
+
+// NewLedger creates an empty ledger
+func NewLedger() *Ledger {
+	return &Ledger{days: make(map[dayModel]*Usage), now: time.Now}
+}
+
+// Record adds the usage of a request to model
+func (l *Ledger) Record(model string, u Usage) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now().UTC()
+	key := dayModel{day: now.Format(time.DateOnly), model: model}
+	day, ok := l.days[key]
+	if !ok {
+		day = &Usage{}
+		l.days[key] = day
+		l.prune(now)
+	}
+	day.add(u)
+
+	if hour := now.Truncate(time.Hour); !hour.Equal(l.hour) {
+		l.hour = hour
+		l.hourly = Usage{}
+	}
+	l.hourly.add(u)
+}
+
+// prune drops days older than keepDays; l.mu must be held
+func (l *Ledger) prune(now time.Time) {
+	oldest := now.AddDate(0, 0, -keepDays).Format(time.DateOnly)
+	for key := range l.days {
+		if key.day < oldest {
+			delete(l.days, key)
+		}
+	}
+}
+
+// Hour returns the usage of all models in the current clock hour
+func (l *Ledger) Hour() Usage {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.now().UTC().Truncate(time.Hour).Equal(l.hour) {
+		return Usage{}
+	}
+	return l.hourly
+}
+
+// Today returns the usage of all models on the current day
+func (l *Ledger) Today() Usage {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	today := l.now().UTC().Format(time.DateOnly)
+	var total Usage
+	for key, u := range l.days {
+		if key.day == today {
+			total.add(*u)
+		}
+	}
+	return total
+}
+
+// Days returns the usage per day and model, oldest first
+func (l *Ledger) Days() []DailyUsage {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	list := make([]DailyUsage, 0, len(l.days))
+	for key, u := range l.days {
+		list = append(list, DailyUsage{Day: key.day, Model: key.model, Usage: *u})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Day != list[j].Day {
+			return list[i].Day < list[j].Day
+		}
+		return list[i].Model < list[j].Model
+	})
+	return list
+}
@@ -0,0 +1,40 @@
+package llm
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLedger(t *testing.T) {
+	now := time.Date(2026, 3, 1, 23, 30, 0, 0, time.UTC)
+	ledger := NewLedger()
+	ledger.now = func() time.Time { return now }
+
+	ledger.Record("small", Usage{Requests: 1, PromptTokens: 10, CompletionTokens: 5})
+	ledger.Record("large", Usage{Requests: 1, PromptTokens: 100, CompletionTokens: 50, Cost: 0.3})
+	if hour := ledger.Hour(); hour.Tokens() != 165 || hour.Requests != 2 || hour.Cost != 0.3 {
+		t.Errorf("Unexpected usage of the hour %+v", hour)
+	}
+
+	// A new hour and day start from zero
+	now = now.Add(time.Hour)
+	if hour, today := ledger.Hour(), ledger.Today(); hour.Tokens() != 0 || today.Tokens() != 0 {
+		t.Errorf("Expected no usage yet, got %+v and %+v", hour, today)
+	}
+	ledger.Record("small", Usage{Requests: 1, PromptTokens: 1, CompletionTokens: 1})
+	if today := ledger.Today(); today.Tokens() != 2 {
+		t.Errorf("Unexpected usage of the day %+v", today)
+	}
+
+	days := ledger.Days()
+	if len(days) != 3 || days[0].Day != "2026-03-01" || days[0].Model != "large" || days[2].Day != "2026-03-02" {
+		t.Fatalf("Unexpected days %+v", days)
+	}
+
+	// Old days are dropped once a new day is recorded
+	now = now.AddDate(0, 0, keepDays+1)
+	ledger.Record("small", Usage{Requests: 1})
+	if days := ledger.Days(); len(days) != 1 {
+		t.Errorf("Expected old days to be dropped, got %+v", days)
+	}
+}
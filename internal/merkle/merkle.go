@@ -0,0 +1,84 @@
+package merkle
+
+import (
+	"crypto/sha3"
+	"encoding/hex"
+)
+
+// Size is the size of a node hash in bytes
+const Size = 32
+
+// Hash is a Merkle tree node hash
+type Hash [Size]byte
+
+// String returns the hash as hex string
+func (h Hash) String() string {
+	return hex.EncodeToString(h[:])
+}
+
+// Domain separation prefixes, as in RFC 6962
+const (
+	leafPrefix = 0x00
+	nodePrefix = 0x01
+)
+
+// LeafHash hashes a leaf value
+func LeafHash(data []byte) Hash {
+	buf := make([]byte, 0, 1+len(data))
+	buf = append(buf, leafPrefix)
+	buf = append(buf, data...)
+	return sha3.Sum256(buf)
+}
+
+// NodeHash hashes two child nodes
+func NodeHash(left, right Hash) Hash {
+	var buf [1 + 2*Size]byte
+	buf[0] = nodePrefix
+	copy(buf[1:], left[:])
+	copy(buf[1+Size:], right[:])
+	return sha3.Sum256(buf[:])
+}
+
+// EmptyRoot is the root of a tree without leaves
+var EmptyRoot = Hash(sha3.Sum256(nil))
+
+// Builder computes the root of a growing tree in O(log n) memory by keeping
+// only the roots of its perfect subtrees (the peaks)
+type Builder struct {
+	size  uint64
+	peaks []Hash // Largest subtree first
+}
+
+// Append adds a leaf value
+func (b *Builder) Append(data []byte) {
+	b.AppendHash(LeafHash(data))
+}
+
+// AppendHash adds an already hashed leaf
+func (b *Builder) AppendHash(leaf Hash) {
+	b.peaks = append(b.peaks, leaf)
+	// Merge equal-sized peaks: one per trailing one bit of the old size
+	for n := b.size; n&1 == 1; n >>= 1 {
+		last := len(b.peaks) - 1
+		b.peaks[last-1] = NodeHash(b.peaks[last-1], b.peaks[last])
+		b.peaks = b.peaks[:last]
+	}
+	b.size++
+}
+
+// Size returns the number of leaves
+func (b *Builder) Size() uint64 {
+	return b.size
+}
+
+// Root returns the root of the tree built so far
+func (b *Builder) Root() Hash {
+	if len(b.peaks) == 0 {
+		return EmptyRoot
+	}
+	root := b.peaks[len(b.peaks)-1]
+	for i := len(b.peaks) - 2; i >= 0; i-- {
+		root = NodeHash(b.peaks[i], root)
+	}
+	return root
+}
@@ -0,0 +1,136 @@
+package merkle
+
+import (
+	"fmt"
+	"testing"
+)
+
+// referenceRoot computes the root recursively as defined in RFC 6962
+func referenceRoot(leaves []Hash) Hash {
+	switch len(leaves) {
+	case 0:
+		return EmptyRoot
+	case 1:
+		return leaves[0]
+	}
+	k := 1
+	for k*2 < len(leaves) {
+		k *= 2
+	}
+	return NodeHash(referenceRoot(leaves[:k]), referenceRoot(leaves[k:]))
+}
+
+func TestBuilderRoot(t *testing.T) {
+	var b Builder
+	var leaves []Hash
+
+	if b.Root() != EmptyRoot {
+		t.Error("Empty builder should return the empty root")
+	}
+
+	for i := 0; i < 70; i++ {
+		data := []byte(fmt.Sprintf("leaf-%d", i))
+		b.Append(data)
+		leaves = append(leaves, LeafHash(data))
+
+		if b.Root() != referenceRoot(leaves) {
+			t.Fatalf("Root mismatch at size %d", i+1)
+		}
+	}
+
+	if b.Size() != 70 {
+		t.Errorf("Expected size 70, got %d", b.Size())
+	}
+}
+
+func TestProofs(t *testing.T) {
+	var tree Tree
+	for i := 0; i < 40; i++ {
+		tree.Append([]byte(fmt.Sprintf("leaf-%d", i)))
+	}
+
+	for size := uint64(1); size <= tree.Size(); size++ {
+		root, err := tree.RootAt(size)
+		if err != nil {
+			t.Fatalf("Failed to get root at %d: %v", size, err)
+		}
+
+		for index := uint64(0); index < size; index++ {
+			proof, err := tree.InclusionProof(index, size)
+			if err != nil {
+				t.Fatalf("Failed to build inclusion proof: %v", err)
+			}
+			leaf := LeafHash([]byte(fmt.Sprintf("leaf-%d", index)))
+			if err := VerifyInclusion(leaf, proof, root); err != nil {
+				t.Fatalf("Inclusion proof for %d in %d failed: %v", index, size, err)
+			}
+			if err := VerifyInclusion(LeafHash([]byte("other")), proof, root); err == nil {
+				t.Fatalf("Inclusion proof for a wrong leaf should fail")
+			}
+		}
+
+		for oldSize := uint64(0); oldSize <= size; oldSize++ {
+			oldRoot, _ := tree.RootAt(oldSize)
+			proof, err := tree.ConsistencyProof(oldSize, size)
+			if err != nil {
+				t.Fatalf("Failed to build consistency proof: %v", err)
+			}
+			if err := VerifyConsistency(proof, oldRoot, root); err != nil {
+				t.Fatalf("Consistency proof %d -> %d failed: %v", oldSize, size, err)
+			}
+			if oldSize > 0 && oldSize < size {
+				if err := VerifyConsistency(proof, LeafHash([]byte("other")), root); err == nil {
+					t.Fatalf("Consistency proof with a wrong old root should fail")
+				}
+			}
+		}
+	}
+}
+
+func TestTreeMatchesBuilder(t *testing.T) {
+	var tree Tree
+	var b Builder
+	for i := 0; i < 33; i++ {
+		data := []byte(fmt.Sprintf("leaf-%d", i))
+		tree.Append(data)
+		b.Append(data)
+	}
+	if tree.Root() != b.Root() {
+		t.Error("Tree and Builder roots should match")
+	}
+}
+
+func TestTreeFromPeaks(t *testing.T) {
+	var full Tree
+	for i := 0; i < 11; i++ {
+		full.Append([]byte(fmt.Sprintf("leaf-%d", i)))
+	}
+
+	peaks, err := full.Peaks(11)
+	if err != nil {
+		t.Fatalf("Failed to get peaks: %v", err)
+	}
+	resumed, err := NewTreeFromPeaks(11, peaks)
+	if err != nil {
+		t.Fatalf("Failed to resume tree: %v", err)
+	}
+	if resumed.Root() != full.Root() {
+		t.Fatal("Resumed tree should have the same root")
+	}
+
+	for i := 11; i < 30; i++ {
+		data := []byte(fmt.Sprintf("leaf-%d", i))
+		full.Append(data)
+		resumed.Append(data)
+		if resumed.Root() != full.Root() {
+			t.Fatalf("Roots diverged at size %d", i+1)
+		}
+	}
+
+	if _, err := resumed.InclusionProof(29, 30); err != nil {
+		t.Errorf("Proofs for new leaves should work: %v", err)
+	}
+	if _, err := resumed.InclusionProof(3, 30); err == nil {
+		t.Error("Proofs for leaves before the resume point should fail")
+	}
+}
@@ -0,0 +1,360 @@
+package merkle
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/bits"
+)
+
+// ErrInvalidProof is returned when a proof does not verify
+var ErrInvalidProof = errors.New("invalid Merkle proof")
+
+// MarshalText encodes the hash as hex
+func (h Hash) MarshalText() ([]byte, error) {
+	return []byte(hex.EncodeToString(h[:])), nil
+}
+
+// UnmarshalText decodes a hex encoded hash
+func (h *Hash) UnmarshalText(text []byte) error {
+	b, err := hex.DecodeString(string(text))
+	if err != nil {
+		return fmt.Errorf("invalid hash: %w", err)
+	}
+	if len(b) != Size {
+		return fmt.Errorf("invalid hash length: %d", len(b))
+	}
+	copy(h[:], b)
+	return nil
+}
+
+// InclusionProof proves that the leaf at Index is part of the tree of Size leaves
+type InclusionProof struct {
+	Index  uint64 `json:"index"`
+	Size   uint64 `json:"size"`
+	Hashes []Hash `json:"hashes"`
+}
+
+// ConsistencyProof proves that the tree of OldSize leaves is a prefix of the
+// tree of NewSize leaves
+type ConsistencyProof struct {
+	OldSize uint64 `json:"old_size"`
+	NewSize uint64 `json:"new_size"`
+	Hashes  []Hash `json:"hashes"`
+}
+
+// Tree is an append-only Merkle tree following the RFC 6962 structure. It keeps
+// every complete subtree hash, so roots and proofs for any size are O(log n).
+//
+// A tree resumed with NewTreeFromPeaks only knows the peaks of its initial
+// size; it can grow and compute roots, but cannot prove anything about leaves
+// before that size.
+type Tree struct {
+	// levels[k][i-start[k]] is the hash of the perfect subtree of 2^k leaves
+	// starting at leaf i*2^k
+	levels [][]Hash
+	start  []uint64
+}
+
+// ErrPruned is returned when a proof needs subtrees a resumed tree does not have
+var ErrPruned = errors.New("subtree not available")
+
+// NewTreeFromPeaks resumes a tree of size leaves from its peaks, largest first,
+// as returned by Peaks
+func NewTreeFromPeaks(size uint64, peaks []Hash) (*Tree, error) {
+	if bits.OnesCount64(size) != len(peaks) {
+		return nil, fmt.Errorf("size %d needs %d peaks, got %d", size, bits.OnesCount64(size), len(peaks))
+	}
+
+	t := &Tree{}
+	height := bits.Len64(size)
+	t.levels = make([][]Hash, height)
+	t.start = make([]uint64, height)
+	for k := height - 1; k >= 0; k-- {
+		t.start[k] = size >> k
+		if size&(1<<k) != 0 {
+			t.start[k]--
+			t.levels[k] = []Hash{peaks[0]}
+			peaks = peaks[1:]
+		}
+	}
+	return t, nil
+}
+
+// Append adds a leaf value
+func (t *Tree) Append(data []byte) {
+	t.AppendHash(LeafHash(data))
+}
+
+// AppendHash adds an already hashed leaf
+func (t *Tree) AppendHash(leaf Hash) {
+	t.push(0, leaf)
+
+	// Complete every subtree the new leaf closes
+	for k := 0; t.count(k)%2 == 0; k++ {
+		n := len(t.levels[k])
+		t.push(k+1, NodeHash(t.levels[k][n-2], t.levels[k][n-1]))
+	}
+}
+
+// push appends a node at level k
+func (t *Tree) push(k int, h Hash) {
+	if k == len(t.levels) {
+		t.levels = append(t.levels, nil)
+		t.start = append(t.start, 0)
+	}
+	t.levels[k] = append(t.levels[k], h)
+}
+
+// count returns the number of nodes at level k
+func (t *Tree) count(k int) uint64 {
+	return t.start[k] + uint64(len(t.levels[k]))
+}
+
+// node returns the perfect subtree hash at level k, index i
+func (t *Tree) node(k int, i uint64) (Hash, error) {
+	if i < t.start[k] {
+		return Hash{}, ErrPruned
+	}
+	return t.levels[k][i-t.start[k]], nil
+}
+
+// Size returns the number of leaves
+func (t *Tree) Size() uint64 {
+	if len(t.levels) == 0 {
+		return 0
+	}
+	return t.count(0)
+}
+
+// Root returns the current root
+func (t *Tree) Root() Hash {
+	root, _ := t.RootAt(t.Size())
+	return root
+}
+
+// RootAt returns the root of the tree as it was with size leaves
+func (t *Tree) RootAt(size uint64) (Hash, error) {
+	if size > t.Size() {
+		return Hash{}, fmt.Errorf("size %d exceeds tree size %d", size, t.Size())
+	}
+	if size == 0 {
+		return EmptyRoot, nil
+	}
+	return t.subtree(0, size)
+}
+
+// Peaks returns the roots of the perfect subtrees making up the tree of size
+// leaves, largest first. Together with size they are enough to resume the tree.
+func (t *Tree) Peaks(size uint64) ([]Hash, error) {
+	if size > t.Size() {
+		return nil, fmt.Errorf("size %d exceeds tree size %d", size, t.Size())
+	}
+
+	var peaks []Hash
+	var start uint64
+	for k := bits.Len64(size) - 1; k >= 0; k-- {
+		if size&(1<<k) == 0 {
+			continue
+		}
+		peak, err := t.node(k, start>>k)
+		if err != nil {
+			return nil, err
+		}
+		peaks = append(peaks, peak)
+		start += 1 << k
+	}
+	return peaks, nil
+}
+
+// InclusionProof returns a proof for the leaf at index in the tree of size leaves
+func (t *Tree) InclusionProof(index, size uint64) (*InclusionProof, error) {
+	if size > t.Size() {
+		return nil, fmt.Errorf("size %d exceeds tree size %d", size, t.Size())
+	}
+	if index >= size {
+		return nil, fmt.Errorf("index %d out of range for size %d", index, size)
+	}
+	hashes, err := t.path(index, 0, size)
+	if err != nil {
+		return nil, err
+	}
+	return &InclusionProof{Index: index, Size: size, Hashes: hashes}, nil
+}
+
+// ConsistencyProof returns a proof that the tree of oldSize leaves is a prefix
+// of the tree of newSize leaves
+func (t *Tree) ConsistencyProof(oldSize, newSize uint64) (*ConsistencyProof, error) {
+	if newSize > t.Size() {
+		return nil, fmt.Errorf("size %d exceeds tree size %d", newSize, t.Size())
+	}
+	if oldSize > newSize {
+		return nil, fmt.Errorf("old size %d exceeds new size %d", oldSize, newSize)
+	}
+	proof := &ConsistencyProof{OldSize: oldSize, NewSize: newSize}
+	if oldSize > 0 && oldSize < newSize {
+		hashes, err := t.subproof(oldSize, 0, newSize, true)
+		if err != nil {
+			return nil, err
+		}
+		proof.Hashes = hashes
+	}
+	return proof, nil
+}
+
+// subtree returns the hash of leaves [start, end). Subtrees are always aligned
+// the way RFC 6962 splits them, so perfect ones come from the level cache.
+func (t *Tree) subtree(start, end uint64) (Hash, error) {
+	n := end - start
+	if n&(n-1) == 0 {
+		k := bits.TrailingZeros64(n)
+		return t.node(k, start>>k)
+	}
+	split := start + largestPowerOfTwoBelow(n)
+	left, err := t.subtree(start, split)
+	if err != nil {
+		return Hash{}, err
+	}
+	right, err := t.subtree(split, end)
+	if err != nil {
+		return Hash{}, err
+	}
+	return NodeHash(left, right), nil
+}
+
+// path implements PATH(m, D[start:end]) from RFC 6962
+func (t *Tree) path(m, start, end uint64) ([]Hash, error) {
+	n := end - start
+	if n == 1 {
+		return nil, nil
+	}
+	k := largestPowerOfTwoBelow(n)
+	if m < k {
+		return t.extend(t.path(m, start, start+k))(t.subtree(start+k, end))
+	}
+	return t.extend(t.path(m-k, start+k, end))(t.subtree(start, start+k))
+}
+
+// subproof implements SUBPROOF(m, D[start:end], b) from RFC 6962
+func (t *Tree) subproof(m, start, end uint64, complete bool) ([]Hash, error) {
+	n := end - start
+	if m == n {
+		if complete {
+			return nil, nil
+		}
+		h, err := t.subtree(start, end)
+		return []Hash{h}, err
+	}
+	k := largestPowerOfTwoBelow(n)
+	if m <= k {
+		return t.extend(t.subproof(m, start, start+k, complete))(t.subtree(start+k, end))
+	}
+	return t.extend(t.subproof(m-k, start+k, end, false))(t.subtree(start, start+k))
+}
+
+// extend appends a hash to a partial proof, propagating the first error
+func (t *Tree) extend(proof []Hash, err error) func(Hash, error) ([]Hash, error) {
+	return func(h Hash, herr error) ([]Hash, error) {
+		if err != nil {
+			return nil, err
+		}
+		if herr != nil {
+			return nil, herr
+		}
+		return append(proof, h), nil
+	}
+}
+
+// largestPowerOfTwoBelow returns the largest power of two strictly less than n (n > 1)
+func largestPowerOfTwoBelow(n uint64) uint64 {
+	return 1 << (bits.Len64(n-1) - 1)
+}
+
+// VerifyInclusion checks that leaf is included in the tree with the given root,
+// following RFC 9162 section 2.1.3.2
+func VerifyInclusion(leaf Hash, proof *InclusionProof, root Hash) error {
+	if proof.Index >= proof.Size {
+		return fmt.Errorf("%w: index %d out of range for size %d", ErrInvalidProof, proof.Index, proof.Size)
+	}
+
+	fn, sn := proof.Index, proof.Size-1
+	r := leaf
+	for _, p := range proof.Hashes {
+		if sn == 0 {
+			return fmt.Errorf("%w: proof too long", ErrInvalidProof)
+		}
+		if fn&1 == 1 || fn == sn {
+			r = NodeHash(p, r)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			r = NodeHash(r, p)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+
+	if sn != 0 || r != root {
+		return ErrInvalidProof
+	}
+	return nil
+}
+
+// VerifyConsistency checks that oldRoot and newRoot are roots of trees where
+// the old one is a prefix of the new one, following RFC 9162 section 2.1.4.2
+func VerifyConsistency(proof *ConsistencyProof, oldRoot, newRoot Hash) error {
+	first, second := proof.OldSize, proof.NewSize
+	switch {
+	case first > second:
+		return fmt.Errorf("%w: old size %d exceeds new size %d", ErrInvalidProof, first, second)
+	case first == second:
+		if len(proof.Hashes) != 0 || oldRoot != newRoot {
+			return ErrInvalidProof
+		}
+		return nil
+	case first == 0:
+		if len(proof.Hashes) != 0 || oldRoot != EmptyRoot {
+			return ErrInvalidProof
+		}
+		return nil
+	case len(proof.Hashes) == 0:
+		return fmt.Errorf("%w: empty proof", ErrInvalidProof)
+	}
+
+	path := proof.Hashes
+	if first&(first-1) == 0 {
+		path = append([]Hash{oldRoot}, path...)
+	}
+
+	fn, sn := first-1, second-1
+	for fn&1 == 1 {
+		fn >>= 1
+		sn >>= 1
+	}
+
+	fr, sr := path[0], path[0]
+	for _, c := range path[1:] {
+		if sn == 0 {
+			return fmt.Errorf("%w: proof too long", ErrInvalidProof)
+		}
+		if fn&1 == 1 || fn == sn {
+			fr = NodeHash(c, fr)
+			sr = NodeHash(c, sr)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			sr = NodeHash(sr, c)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+
+	if sn != 0 || fr != oldRoot || sr != newRoot {
+		return ErrInvalidProof
+	}
+	return nil
+}
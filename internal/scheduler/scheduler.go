@@ -0,0 +1,302 @@
+package scheduler
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/yanchenko-igor/blockchain-universe/internal/config"
+	"github.com/yanchenko-igor/blockchain-universe/pkg/logger"
+	"github.com/yanchenko-igor/blockchain-universe/pkg/metrics"
+)
+
+// Config controls how tasks are scheduled
+type Config struct {
+	Workers int     // Runs in parallel; 0 for one per task
+	Jitter  float64 // Random change of every interval, as a fraction of it (0-1)
+	Overrun string  // config.OverrunSkip or config.OverrunCoalesce
+}
+
+// Scheduler runs tasks periodically on a bounded pool of workers. Tasks start
+// at a random offset within their interval, so tasks with equal intervals do
+// not run in lockstep, and a task never runs concurrently with itself.
+type Scheduler struct {
+	cfg     Config
+	tasks   []*Task
+	queue   chan *Task
+	metrics *schedulerMetrics
+	rng     *rand.Rand
+	rngMu   sync.Mutex // Guards rng
+	log     logger.Logger
+}
+
+// schedulerMetrics instruments the scheduler; nil fields ignore updates
+type schedulerMetrics struct {
+	runs     *metrics.Counter
+	missed   *metrics.Counter
+	wait     *metrics.Histogram
+	duration *metrics.Histogram
+	busy     *metrics.Gauge
+}
+
+// New creates a scheduler
+func New(cfg Config, log logger.Logger) *Scheduler {
+	if cfg.Overrun == "" {
+		cfg.Overrun = config.OverrunCoalesce
+	}
+	return &Scheduler{
+		cfg:     cfg,
+		metrics: &schedulerMetrics{},
+		rng:     rand.New(rand.NewSource(time.Now().UnixNano())),
+		log:     log,
+	}
+}
+
+// SetMetrics registers the scheduler metrics with reg
+func (s *Scheduler) SetMetrics(reg *metrics.Registry) {
+	s.metrics = &schedulerMetrics{
+		runs:     reg.NewCounter("bu_scheduler_runs_total", "Task runs, by task", "task"),
+		missed:   reg.NewCounter("bu_scheduler_missed_total", "Ticks that found the previous run still in flight, by task", "task"),
+		wait:     reg.NewHistogram("bu_scheduler_queue_wait_seconds", "Time runs waited for a free worker", metrics.DefaultBuckets),
+		duration: reg.NewHistogram("bu_scheduler_run_duration_seconds", "Duration of task runs, by task", metrics.DefaultBuckets, "task"),
+		busy:     reg.NewGauge("bu_scheduler_busy_workers", "Workers running a task"),
+	}
+}
+
+// Add schedules run every interval under name. Tasks must be added before
+// Run is called.
+func (s *Scheduler) Add(name string, interval time.Duration, run func(ctx context.Context)) *Task {
+	t := &Task{
+		name:     name,
+		run:      run,
+		s:        s,
+		interval: interval,
+		reset:    make(chan struct{}, 1),
+	}
+	s.tasks = append(s.tasks, t)
+	// A task is queued at most once, so the queue never blocks
+	s.queue = make(chan *Task, len(s.tasks))
+	return t
+}
+
+// Run runs the tasks until ctx is done. Runs in flight are cancelled through
+// ctx, and Run returns once they have ended.
+func (s *Scheduler) Run(ctx context.Context) {
+	workers := s.cfg.Workers
+	if workers <= 0 || workers > len(s.tasks) {
+		workers = len(s.tasks)
+	}
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.work(ctx)
+		}()
+	}
+	for _, t := range s.tasks {
+		wg.Add(1)
+		go func(t *Task) {
+			defer wg.Done()
+			t.loop(ctx)
+		}(t)
+	}
+	s.log.Info("Scheduler started", "tasks", len(s.tasks), "workers", workers, "jitter", s.cfg.Jitter, "overrun", s.cfg.Overrun)
+
+	wg.Wait()
+	s.log.Info("Scheduler stopped")
+}
+
+// work runs queued tasks until ctx is done
+func (s *Scheduler) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case t := <-s.queue:
+			t.execute(ctx)
+		}
+	}
+}
+
+// random returns a random number in [0, 1)
+func (s *Scheduler) random() float64 {
+	s.rngMu.Lock()
+	defer s.rngMu.Unlock()
+	return s.rng.Float64()
+}
+
+// offset returns a random delay before the first tick, within one interval
+func (s *Scheduler) offset(interval time.Duration) time.Duration {
+	return time.Duration(s.random() * float64(interval))
+}
+
+// next returns the delay until the next tick: interval changed by up to the
+// jitter fraction either way
+func (s *Scheduler) next(interval time.Duration) time.Duration {
+	if s.cfg.Jitter <= 0 {
+		return interval
+	}
+	d := time.Duration(float64(interval) * (1 + s.cfg.Jitter*(2*s.random()-1)))
+	if d < time.Millisecond {
+		d = time.Millisecond
+	}
+	return d
+}
+
+// Task is a periodic task of a scheduler
+type Task struct {
+	name string
+	run  func(ctx context.Context)
+	s    *Scheduler
+
+	mu       sync.Mutex // Guards the fields below
+	interval time.Duration
+	inFlight bool      // Queued or running
+	again    bool      // Coalesced ticks wait for the run in flight
+	overdue  int       // Ticks missed by the run in flight
+	queued   time.Time // When the run in flight was queued
+	stats    Stats
+
+	reset chan struct{} // Signals interval changes to the loop
+}
+
+// Stats counts the runs of a task
+type Stats struct {
+	Runs         int           // Completed runs
+	Missed       int           // Ticks that found a run still in flight
+	Triggered    int           // Runs requested by Trigger
+	LastDuration time.Duration // Of the last completed run
+}
+
+// Name returns the name of the task
+func (t *Task) Name() string {
+	return t.name
+}
+
+// Interval returns the interval between runs, without jitter
+func (t *Task) Interval() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.interval
+}
+
+// SetInterval changes the interval between runs, starting with the next tick
+func (t *Task) SetInterval(interval time.Duration) {
+	t.mu.Lock()
+	t.interval = interval
+	t.mu.Unlock()
+
+	select {
+	case t.reset <- struct{}{}:
+	default: // A change is already pending
+	}
+}
+
+// Trigger runs the task as soon as a worker is free instead of waiting for
+// the next tick, which then follows a full interval later. If a run is in
+// flight, the task runs once more after it.
+func (t *Task) Trigger() {
+	t.mu.Lock()
+	t.stats.Triggered++
+	if t.inFlight {
+		t.again = true
+		t.mu.Unlock()
+		return
+	}
+	t.inFlight = true
+	t.queued = time.Now()
+	t.mu.Unlock()
+
+	t.s.queue <- t
+	select {
+	case t.reset <- struct{}{}:
+	default:
+	}
+}
+
+// Stats returns the run statistics of the task
+func (t *Task) Stats() Stats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.stats
+}
+
+// loop queues the task on every tick until ctx is done
+func (t *Task) loop(ctx context.Context) {
+	timer := time.NewTimer(t.s.offset(t.Interval()))
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.reset:
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(t.s.next(t.Interval()))
+		case <-timer.C:
+			t.tick()
+			timer.Reset(t.s.next(t.Interval()))
+		}
+	}
+}
+
+// tick queues a run, or records a missed tick if a run is in flight
+func (t *Task) tick() {
+	t.mu.Lock()
+	if t.inFlight {
+		t.stats.Missed++
+		t.overdue++
+		t.again = t.s.cfg.Overrun == config.OverrunCoalesce
+		first := t.overdue == 1
+		t.mu.Unlock()
+
+		t.s.metrics.missed.Inc(t.name)
+		if first {
+			t.s.log.Warn("Task still in flight, missing ticks", "task", t.name, "overrun", t.s.cfg.Overrun)
+		}
+		return
+	}
+	t.inFlight = true
+	t.queued = time.Now()
+	t.mu.Unlock()
+
+	t.s.queue <- t
+}
+
+// execute runs the task on a worker and requeues it if ticks were coalesced
+func (t *Task) execute(ctx context.Context) {
+	t.mu.Lock()
+	queued := t.queued
+	t.mu.Unlock()
+
+	start := time.Now()
+	t.s.metrics.wait.Observe(start.Sub(queued).Seconds())
+	t.s.metrics.busy.Add(1)
+	t.run(ctx)
+	t.s.metrics.busy.Add(-1)
+	duration := time.Since(start)
+	t.s.metrics.runs.Inc(t.name)
+	t.s.metrics.duration.Observe(duration.Seconds(), t.name)
+
+	t.mu.Lock()
+	t.stats.Runs++
+	t.stats.LastDuration = duration
+	t.overdue = 0
+	if t.again && ctx.Err() == nil {
+		t.again = false
+		t.queued = time.Now()
+		t.mu.Unlock()
+		t.s.queue <- t
+		return
+	}
+	t.again = false
+	t.inFlight = false
+	t.mu.Unlock()
+}
@@ -0,0 +1,161 @@
+package scheduler
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/yanchenko-igor/blockchain-universe/internal/config"
+	"github.com/yanchenko-igor/blockchain-universe/pkg/logger"
+)
+
+// waitFor polls cond until it holds or a second has passed
+func waitFor(t *testing.T, cond func() bool) bool {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return true
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return cond()
+}
+
+func TestOverrun(t *testing.T) {
+	for overrun, runs := range map[string]int{config.OverrunCoalesce: 2, config.OverrunSkip: 1} {
+		t.Run(overrun, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			release := make(chan struct{})
+			var calls, running atomic.Int32
+			s := New(Config{Overrun: overrun}, logger.New("error"))
+			task := s.Add("slow", 2*time.Millisecond, func(ctx context.Context) {
+				if running.Add(1) > 1 {
+					t.Error("Runs of a task should not overlap")
+				}
+				if calls.Add(1) == 1 {
+					<-release
+				}
+				running.Add(-1)
+			})
+			go s.Run(ctx)
+
+			if !waitFor(t, func() bool { return task.Stats().Missed >= 3 }) {
+				t.Fatalf("Expected missed ticks while a run is in flight, got %+v", task.Stats())
+			}
+			task.SetInterval(time.Hour)
+			close(release)
+
+			waitFor(t, func() bool { return task.Stats().Runs >= runs })
+			time.Sleep(20 * time.Millisecond)
+			if got := task.Stats().Runs; got != runs {
+				t.Errorf("Expected %d runs, got %d", runs, got)
+			}
+		})
+	}
+}
+
+func TestWorkerPoolIsBounded(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var running, peak atomic.Int32
+	s := New(Config{Workers: 2}, logger.New("error"))
+	var tasks []*Task
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		tasks = append(tasks, s.Add(name, time.Millisecond, func(ctx context.Context) {
+			n := running.Add(1)
+			for {
+				p := peak.Load()
+				if n <= p || peak.CompareAndSwap(p, n) {
+					break
+				}
+			}
+			time.Sleep(2 * time.Millisecond)
+			running.Add(-1)
+		}))
+	}
+	go s.Run(ctx)
+
+	allRan := func() bool {
+		for _, task := range tasks {
+			if task.Stats().Runs == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	if !waitFor(t, allRan) {
+		t.Error("Every task should get a worker")
+	}
+	if p := peak.Load(); p > 2 {
+		t.Errorf("Expected at most 2 concurrent runs, got %d", p)
+	}
+}
+
+func TestShutdownCancelsRunsInFlight(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	started := make(chan struct{})
+	var once sync.Once
+	var cancelled atomic.Bool
+
+	s := New(Config{}, logger.New("error"))
+	s.Add("blocking", time.Millisecond, func(ctx context.Context) {
+		once.Do(func() { close(started) })
+		<-ctx.Done()
+		cancelled.Store(true)
+	})
+
+	stopped := make(chan struct{})
+	go func() {
+		s.Run(ctx)
+		close(stopped)
+	}()
+
+	<-started
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("Run should return once runs in flight are cancelled")
+	}
+	if !cancelled.Load() {
+		t.Error("The run in flight should see the cancellation")
+	}
+}
+
+func TestJitter(t *testing.T) {
+	s := New(Config{Jitter: 0.2}, logger.New("error"))
+	for range 1000 {
+		if d := s.next(time.Second); d < 800*time.Millisecond || d > 1200*time.Millisecond {
+			t.Fatalf("Interval %s out of jitter bounds", d)
+		}
+		if d := s.offset(time.Second); d < 0 || d >= time.Second {
+			t.Fatalf("First tick offset %s should be within one interval", d)
+		}
+	}
+}
+
+func TestTrigger(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	runs := make(chan struct{}, 10)
+	s := New(Config{}, logger.New("error"))
+	task := s.Add("idle", time.Hour, func(ctx context.Context) { runs <- struct{}{} })
+	go s.Run(ctx)
+
+	task.Trigger()
+	select {
+	case <-runs:
+	case <-time.After(time.Second):
+		t.Fatal("Trigger should run the task without waiting for a tick")
+	}
+	if stats := task.Stats(); stats.Triggered != 1 || stats.Missed != 0 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+}
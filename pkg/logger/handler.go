@@ -0,0 +1,82 @@
+package logger
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+)
+
+// levelHandler filters records by level and adds the fields attached to the
+// context
+type levelHandler struct {
+	level slog.Leveler
+	next  slog.Handler
+}
+
+func newLevelHandler(level slog.Leveler, next slog.Handler) *levelHandler {
+	return &levelHandler{level: level, next: next}
+}
+
+func (h *levelHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *levelHandler) Handle(ctx context.Context, r slog.Record) error {
+	if fields := contextFields(ctx); len(fields) > 0 {
+		r = r.Clone()
+		r.AddAttrs(fields...)
+	}
+	return h.next.Handle(ctx, r)
+}
+
+func (h *levelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &levelHandler{level: h.level, next: h.next.WithAttrs(attrs)}
+}
+
+func (h *levelHandler) WithGroup(name string) slog.Handler {
+	return &levelHandler{level: h.level, next: h.next.WithGroup(name)}
+}
+
+// fanoutHandler passes records to every sink. Sinks accept all levels; the
+// levelHandler in front of it filters.
+type fanoutHandler struct {
+	handlers []slog.Handler
+}
+
+func newFanoutHandler(sinks []sink) *fanoutHandler {
+	h := &fanoutHandler{}
+	for _, s := range sinks {
+		h.handlers = append(h.handlers, s.Handler())
+	}
+	return h
+}
+
+func (h *fanoutHandler) Enabled(context.Context, slog.Level) bool {
+	return true
+}
+
+func (h *fanoutHandler) Handle(ctx context.Context, r slog.Record) error {
+	var errs []error
+	for _, handler := range h.handlers {
+		if err := handler.Handle(ctx, r.Clone()); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (h *fanoutHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	next := &fanoutHandler{handlers: make([]slog.Handler, len(h.handlers))}
+	for i, handler := range h.handlers {
+		next.handlers[i] = handler.WithAttrs(attrs)
+	}
+	return next
+}
+
+func (h *fanoutHandler) WithGroup(name string) slog.Handler {
+	next := &fanoutHandler{handlers: make([]slog.Handler, len(h.handlers))}
+	for i, handler := range h.handlers {
+		next.handlers[i] = handler.WithGroup(name)
+	}
+	return next
+}
@@ -1,9 +1,12 @@
 package logger
 
 import (
+	"context"
+	"fmt"
 	"log/slog"
 	"os"
 	"strings"
+	"sync"
 )
 
 // Logger interface for structured logging
@@ -13,35 +16,163 @@ type Logger interface {
 	Warn(msg string, args ...interface{})
 	Error(msg string, args ...interface{})
 	Fatal(msg string, args ...interface{})
+
+	// Context variants add the fields attached to ctx with ContextWith
+	DebugContext(ctx context.Context, msg string, args ...interface{})
+	InfoContext(ctx context.Context, msg string, args ...interface{})
+	WarnContext(ctx context.Context, msg string, args ...interface{})
+	ErrorContext(ctx context.Context, msg string, args ...interface{})
+
+	// With returns a logger that adds the given key-value pairs to every message
+	With(args ...interface{}) Logger
+	// Named returns a logger for a package, filtered by the package's level
+	Named(name string) Logger
+}
+
+// Config selects log levels and sinks
+type Config struct {
+	Level  string            // Default level
+	Levels map[string]string // Levels by package name, see Logger.Named
+	Sinks  []SinkConfig      // Defaults to JSON on stdout
+}
+
+// exit terminates the process after a fatal message
+var exit = os.Exit
+
+// root is shared by all loggers derived from one New call
+type root struct {
+	mu      sync.RWMutex
+	level   slog.Level
+	levels  map[string]slog.Level
+	sinks   []sink
+	handler slog.Handler // Fan-out to all sinks
+}
+
+// packageLevel is the level of a named logger, read on every message so
+// levels can be changed at runtime
+type packageLevel struct {
+	root *root
+	name string
+}
+
+func (p packageLevel) Level() slog.Level {
+	p.root.mu.RLock()
+	defer p.root.mu.RUnlock()
+
+	if level, ok := p.root.levels[p.name]; ok {
+		return level
+	}
+	return p.root.level
 }
 
 type slogLogger struct {
 	logger *slog.Logger
+	root   *root
 }
 
-// New creates a new logger with the specified level
+// New creates a new logger with the specified level, writing JSON to stdout.
+// Unknown levels fall back to info.
 func New(level string) Logger {
-	var logLevel slog.Level
+	log, err := NewWithConfig(Config{Level: level})
+	if err != nil {
+		log, _ = NewWithConfig(Config{})
+	}
+	return log
+}
+
+// NewWithConfig creates a logger writing to the configured sinks
+func NewWithConfig(cfg Config) (Logger, error) {
+	r := &root{}
+	if err := r.setLevels(cfg.Level, cfg.Levels); err != nil {
+		return nil, err
+	}
+
+	sinkConfigs := cfg.Sinks
+	if len(sinkConfigs) == 0 {
+		sinkConfigs = []SinkConfig{{Type: SinkStdout, Format: FormatJSON}}
+	}
+	for _, sc := range sinkConfigs {
+		s, err := newSink(sc)
+		if err != nil {
+			r.close()
+			return nil, err
+		}
+		r.sinks = append(r.sinks, s)
+	}
+	r.handler = newFanoutHandler(r.sinks)
+
+	return &slogLogger{logger: slog.New(newLevelHandler(packageLevel{root: r}, r.handler)), root: r}, nil
+}
+
+// SetLevels changes the default and per-package levels of log and every
+// logger derived from it
+func SetLevels(log Logger, level string, levels map[string]string) error {
+	l, ok := log.(*slogLogger)
+	if !ok {
+		return fmt.Errorf("logger does not support changing levels")
+	}
+	return l.root.setLevels(level, levels)
+}
+
+// Sync flushes the sinks of log to durable storage
+func Sync(log Logger) error {
+	if l, ok := log.(*slogLogger); ok {
+		return l.root.sync()
+	}
+	return nil
+}
+
+// setLevels parses and applies levels
+func (r *root) setLevels(level string, levels map[string]string) error {
+	parsed, err := parseLevel(level)
+	if err != nil {
+		return err
+	}
+	byPackage := make(map[string]slog.Level, len(levels))
+	for name, value := range levels {
+		if byPackage[name], err = parseLevel(value); err != nil {
+			return fmt.Errorf("package %s: %w", name, err)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.level = parsed
+	r.levels = byPackage
+	return nil
+}
+
+// sync flushes all sinks
+func (r *root) sync() error {
+	var firstErr error
+	for _, s := range r.sinks {
+		if err := s.Sync(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// close closes all sinks
+func (r *root) close() {
+	for _, s := range r.sinks {
+		s.Close()
+	}
+}
+
+// parseLevel converts a level name; empty means info
+func parseLevel(level string) (slog.Level, error) {
 	switch strings.ToLower(level) {
 	case "debug":
-		logLevel = slog.LevelDebug
-	case "info":
-		logLevel = slog.LevelInfo
+		return slog.LevelDebug, nil
+	case "info", "":
+		return slog.LevelInfo, nil
 	case "warn":
-		logLevel = slog.LevelWarn
+		return slog.LevelWarn, nil
 	case "error":
-		logLevel = slog.LevelError
-	default:
-		logLevel = slog.LevelInfo
-	}
-
-	handler := slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
-		Level: logLevel,
-	})
-
-	return &slogLogger{
-		logger: slog.New(handler),
+		return slog.LevelError, nil
 	}
+	return slog.LevelInfo, fmt.Errorf("unknown log level %q", level)
 }
 
 func (l *slogLogger) Debug(msg string, args ...interface{}) {
@@ -60,7 +191,74 @@ func (l *slogLogger) Error(msg string, args ...interface{}) {
 	l.logger.Error(msg, args...)
 }
 
+// Fatal logs an error, flushes the sinks and exits
 func (l *slogLogger) Fatal(msg string, args ...interface{}) {
 	l.logger.Error(msg, args...)
-	os.Exit(1)
-}
\ No newline at end of file
+	l.root.sync()
+	l.root.close()
+	exit(1)
+}
+
+func (l *slogLogger) DebugContext(ctx context.Context, msg string, args ...interface{}) {
+	l.logger.DebugContext(ctx, msg, args...)
+}
+
+func (l *slogLogger) InfoContext(ctx context.Context, msg string, args ...interface{}) {
+	l.logger.InfoContext(ctx, msg, args...)
+}
+
+func (l *slogLogger) WarnContext(ctx context.Context, msg string, args ...interface{}) {
+	l.logger.WarnContext(ctx, msg, args...)
+}
+
+func (l *slogLogger) ErrorContext(ctx context.Context, msg string, args ...interface{}) {
+	l.logger.ErrorContext(ctx, msg, args...)
+}
+
+// With returns a logger that adds the given key-value pairs to every message
+func (l *slogLogger) With(args ...interface{}) Logger {
+	return &slogLogger{logger: l.logger.With(args...), root: l.root}
+}
+
+// Named returns a logger tagged with the package name and filtered by its level
+func (l *slogLogger) Named(name string) Logger {
+	h := l.logger.Handler().(*levelHandler)
+	next := h.next.WithAttrs([]slog.Attr{slog.String("package", name)})
+	return &slogLogger{logger: slog.New(newLevelHandler(packageLevel{root: l.root, name: name}, next)), root: l.root}
+}
+
+// fieldsKey is the context key of fields attached with ContextWith
+type fieldsKey struct{}
+
+// ContextWith returns a context carrying the given key-value pairs, which
+// the Context logging methods add to every message. Later values replace
+// earlier ones with the same key.
+func ContextWith(ctx context.Context, args ...interface{}) context.Context {
+	added := slog.Group("", args...).Value.Group()
+	existing := contextFields(ctx)
+
+	fields := make([]slog.Attr, 0, len(existing)+len(added))
+	for _, attr := range existing {
+		replaced := false
+		for _, a := range added {
+			if a.Key == attr.Key {
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			fields = append(fields, attr)
+		}
+	}
+	fields = append(fields, added...)
+	return context.WithValue(ctx, fieldsKey{}, fields)
+}
+
+// contextFields returns the fields attached to ctx
+func contextFields(ctx context.Context) []slog.Attr {
+	if ctx == nil {
+		return nil
+	}
+	fields, _ := ctx.Value(fieldsKey{}).([]slog.Attr)
+	return fields
+}
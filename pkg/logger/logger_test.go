@@ -0,0 +1,240 @@
+package logger
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readLines returns the JSON messages in a log file
+func readLines(t *testing.T, path string) []map[string]interface{} {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read log: %v", err)
+	}
+	var lines []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		if line == "" {
+			continue
+		}
+		var m map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &m); err != nil {
+			t.Fatalf("Invalid JSON line %q: %v", line, err)
+		}
+		lines = append(lines, m)
+	}
+	return lines
+}
+
+func TestPackageLevelsAndFields(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.log")
+	log, err := NewWithConfig(Config{
+		Level:  "warn",
+		Levels: map[string]string{"agent": "debug"},
+		Sinks:  []SinkConfig{{Type: SinkFile, Path: path}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+
+	agentLog := log.Named("agent").With("agent", "abc")
+	ctx := ContextWith(context.Background(), "trace_id", "t1", "event_hash", "h1")
+	ctx = ContextWith(ctx, "event_hash", "h2")
+
+	log.Info("Dropped by default level")
+	log.Named("llm").Info("Dropped by default level")
+	agentLog.DebugContext(ctx, "Kept by package level")
+
+	if err := SetLevels(log, "info", nil); err != nil {
+		t.Fatalf("Failed to set levels: %v", err)
+	}
+	agentLog.Debug("Dropped after level change")
+	log.Info("Kept after level change")
+
+	lines := readLines(t, path)
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 messages, got %d: %v", len(lines), lines)
+	}
+	first := lines[0]
+	if first["msg"] != "Kept by package level" || first["package"] != "agent" || first["agent"] != "abc" {
+		t.Errorf("Unexpected message: %v", first)
+	}
+	if first["trace_id"] != "t1" || first["event_hash"] != "h2" {
+		t.Errorf("Context fields missing or not replaced: %v", first)
+	}
+	if lines[1]["msg"] != "Kept after level change" {
+		t.Errorf("Unexpected message: %v", lines[1])
+	}
+
+	if err := SetLevels(log, "verbose", nil); err == nil {
+		t.Error("Unknown level should be rejected")
+	}
+}
+
+func TestFileRotation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.log")
+	os.WriteFile(path+".bak", []byte("unrelated"), 0644)
+	f, err := openRotatingFile(path, 100, 0, 2)
+	if err != nil {
+		t.Fatalf("Failed to open file: %v", err)
+	}
+	defer f.Close()
+
+	line := []byte(strings.Repeat("x", 59) + "\n")
+	for range 5 {
+		if _, err := f.Write(line); err != nil {
+			t.Fatalf("Failed to write: %v", err)
+		}
+		// Backup names have nanosecond resolution; keep them distinct
+		time.Sleep(time.Millisecond)
+	}
+
+	backups, _ := filepath.Glob(path + ".2*")
+	if len(backups) != 2 {
+		t.Errorf("Expected 2 backups, got %v", backups)
+	}
+	if _, err := os.Stat(path + ".bak"); err != nil {
+		t.Errorf("Pruning should only remove backups: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	if len(data) != len(line) {
+		t.Errorf("Expected one line in the current file, got %d bytes", len(data))
+	}
+
+	// Age-based rotation
+	aged, err := openRotatingFile(filepath.Join(dir, "aged.log"), 0, time.Millisecond, 0)
+	if err != nil {
+		t.Fatalf("Failed to open file: %v", err)
+	}
+	defer aged.Close()
+	aged.Write(line)
+	time.Sleep(5 * time.Millisecond)
+	aged.Write(line)
+	if backups, _ := filepath.Glob(filepath.Join(dir, "aged.log.*")); len(backups) != 1 {
+		t.Errorf("Expected 1 backup after max age, got %v", backups)
+	}
+}
+
+func TestFileRotationRecovers(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "logs")
+	os.Mkdir(dir, 0755)
+	path := filepath.Join(dir, "test.log")
+	f, err := openRotatingFile(path, 10, 0, 0)
+	if err != nil {
+		t.Fatalf("Failed to open file: %v", err)
+	}
+	defer f.Close()
+
+	line := []byte("0123456789\n")
+	f.Write(line)
+
+	// Renaming fails, the file is reopened and appended to
+	os.Remove(path)
+	if _, err := f.Write(line); err != nil {
+		t.Fatalf("Expected writes to continue after a failed rename: %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != string(line) {
+		t.Errorf("Expected the line in the reopened file, got %q", data)
+	}
+
+	// Rotation is not retried on every write
+	f.Write(line)
+	if data, _ := os.ReadFile(path); string(data) != strings.Repeat(string(line), 2) {
+		t.Errorf("Expected writes to append until the retry is due, got %q", data)
+	}
+	if backups, _ := filepath.Glob(path + ".*"); len(backups) != 0 {
+		t.Errorf("Expected no rotation before the retry is due, got %v", backups)
+	}
+	f.retryAt = time.Time{}
+
+	// Reopening fails until the directory is back
+	os.RemoveAll(dir)
+	if _, err := f.Write(line); err == nil {
+		t.Error("Expected the write to fail without a directory")
+	}
+	os.Mkdir(dir, 0755)
+	if _, err := f.Write(line); err != nil {
+		t.Errorf("Expected the next write to reopen the file: %v", err)
+	}
+
+	f.Close()
+	if _, err := f.Write(line); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("Expected writes after Close to fail, got %v", err)
+	}
+}
+
+func TestSyslogSink(t *testing.T) {
+	dir, err := os.MkdirTemp("", "syslog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	address := filepath.Join(dir, "log.sock") // Short path for the socket name limit
+
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: address, Net: "unixgram"})
+	if err != nil {
+		t.Skipf("Unix datagram sockets unavailable: %v", err)
+	}
+	defer conn.Close()
+
+	log, err := NewWithConfig(Config{Sinks: []SinkConfig{{Type: SinkSyslog, Address: address, Tag: "bu"}}})
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	log.Warn("Disk almost full", "free", 3)
+
+	buf := make([]byte, 1024)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("Failed to read datagram: %v", err)
+	}
+	msg := string(buf[:n])
+	if !strings.HasPrefix(msg, "<12>") {
+		t.Errorf("Expected user.warning priority, got %q", msg)
+	}
+	if !strings.Contains(msg, " bu[") || !strings.HasSuffix(msg, `level=WARN msg="Disk almost full" free=3`) {
+		t.Errorf("Unexpected message %q", msg)
+	}
+}
+
+func TestFatalFlushesSinks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.log")
+	log, err := NewWithConfig(Config{Sinks: []SinkConfig{{Type: SinkFile, Path: path, Format: FormatText}}})
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+
+	code := -1
+	exit = func(c int) { code = c }
+	defer func() { exit = os.Exit }()
+
+	log.Fatal("Unrecoverable", "error", "boom")
+	if code != 1 {
+		t.Errorf("Expected exit code 1, got %d", code)
+	}
+	data, _ := os.ReadFile(path)
+	if !strings.Contains(string(data), `level=ERROR msg=Unrecoverable error=boom`) {
+		t.Errorf("Fatal message not written: %q", data)
+	}
+}
+
+func TestInvalidConfig(t *testing.T) {
+	if _, err := NewWithConfig(Config{Sinks: []SinkConfig{{Type: "kafka"}}}); err == nil {
+		t.Error("Unknown sink type should be rejected")
+	}
+	if _, err := NewWithConfig(Config{Sinks: []SinkConfig{{Type: SinkFile}}}); err == nil {
+		t.Error("File sink without a path should be rejected")
+	}
+	if _, err := NewWithConfig(Config{Levels: map[string]string{"api": "loud"}}); err == nil {
+		t.Error("Unknown package level should be rejected")
+	}
+}
@@ -0,0 +1,393 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sink types
+const (
+	SinkStdout = "stdout"
+	SinkFile   = "file"
+	SinkSyslog = "syslog"
+)
+
+// Sink formats
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+// defaultSyslogAddress is the local syslog socket
+const defaultSyslogAddress = "/dev/log"
+
+// SinkConfig configures where log messages are written
+type SinkConfig struct {
+	Type   string `yaml:"type"`   // stdout, file or syslog
+	Format string `yaml:"format"` // json or text, for stdout and file sinks
+
+	// File sink
+	Path       string        `yaml:"path"`
+	MaxSizeMB  int           `yaml:"max_size_mb"` // Rotate when the file exceeds this size, 0 disables
+	MaxAge     time.Duration `yaml:"max_age"`     // Rotate when the file is older than this, 0 disables
+	MaxBackups int           `yaml:"max_backups"` // Rotated files to keep, 0 keeps all
+
+	// Syslog sink
+	Address string `yaml:"address"` // Unix datagram socket, defaults to /dev/log
+	Tag     string `yaml:"tag"`     // Defaults to the program name
+}
+
+// sink is a destination for log messages
+type sink interface {
+	Handler() slog.Handler
+	Sync() error
+	Close() error
+}
+
+// newSink creates the sink described by sc
+func newSink(sc SinkConfig) (sink, error) {
+	switch sc.Type {
+	case SinkStdout, "":
+		return newWriterSink(os.Stdout, sc.Format, nil)
+	case SinkFile:
+		if sc.Path == "" {
+			return nil, fmt.Errorf("file sink requires a path")
+		}
+		f, err := openRotatingFile(sc.Path, int64(sc.MaxSizeMB)<<20, sc.MaxAge, sc.MaxBackups)
+		if err != nil {
+			return nil, err
+		}
+		return newWriterSink(f, sc.Format, f)
+	case SinkSyslog:
+		return newSyslogSink(sc.Address, sc.Tag)
+	}
+	return nil, fmt.Errorf("unknown sink type %q", sc.Type)
+}
+
+// newHandler creates a slog handler in the given format accepting all levels
+func newHandler(w io.Writer, format string, replace func([]string, slog.Attr) slog.Attr) (slog.Handler, error) {
+	opts := &slog.HandlerOptions{Level: slog.LevelDebug, ReplaceAttr: replace}
+	switch format {
+	case FormatJSON, "":
+		return slog.NewJSONHandler(w, opts), nil
+	case FormatText:
+		return slog.NewTextHandler(w, opts), nil
+	}
+	return nil, fmt.Errorf("unknown log format %q", format)
+}
+
+// syncCloser is a writer that can be flushed and closed
+type syncCloser interface {
+	Sync() error
+	Close() error
+}
+
+// writerSink writes formatted messages to a stream or file
+type writerSink struct {
+	handler slog.Handler
+	file    syncCloser // nil for stdout, which is not closed
+}
+
+func newWriterSink(w io.Writer, format string, file syncCloser) (*writerSink, error) {
+	handler, err := newHandler(w, format, nil)
+	if err != nil {
+		if file != nil {
+			file.Close()
+		}
+		return nil, err
+	}
+	return &writerSink{handler: handler, file: file}, nil
+}
+
+func (s *writerSink) Handler() slog.Handler {
+	return s.handler
+}
+
+func (s *writerSink) Sync() error {
+	if s.file == nil {
+		// Syncing a terminal or pipe fails harmlessly
+		os.Stdout.Sync()
+		return nil
+	}
+	return s.file.Sync()
+}
+
+func (s *writerSink) Close() error {
+	if s.file == nil {
+		return nil
+	}
+	return s.file.Close()
+}
+
+// rotatingFile is a log file that is renamed to path.<timestamp> and
+// reopened when it grows too large or too old
+type rotatingFile struct {
+	path       string
+	maxSize    int64
+	maxAge     time.Duration
+	maxBackups int
+
+	mu      sync.Mutex
+	file    *os.File // nil after a failed reopen, retried on the next write
+	size    int64
+	opened  time.Time
+	retryAt time.Time // No rotation before then after a failed rename
+	closed  bool
+}
+
+// backupTimeFormat is the suffix of rotated files
+const backupTimeFormat = "20060102T150405.000000000"
+
+// rotateRetryInterval is how long a file that could not be renamed is
+// appended to before rotation is tried again
+const rotateRetryInterval = time.Minute
+
+func openRotatingFile(path string, maxSize int64, maxAge time.Duration, maxBackups int) (*rotatingFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create log directory: %w", err)
+	}
+	f := &rotatingFile{path: path, maxSize: maxSize, maxAge: maxAge, maxBackups: maxBackups}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// open opens the log file for appending; f.mu must be held
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat log file: %w", err)
+	}
+	f.file = file
+	f.size = info.Size()
+	f.opened = time.Now()
+	return nil
+}
+
+// Write appends p, rotating first if p would exceed the size limit or the
+// file is too old
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return 0, os.ErrClosed
+	}
+	if f.file == nil {
+		if err := f.open(); err != nil {
+			return 0, err
+		}
+	}
+	tooLarge := f.maxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.maxSize
+	tooOld := f.maxAge > 0 && time.Since(f.opened) >= f.maxAge
+	if (tooLarge || tooOld) && !time.Now().Before(f.retryAt) {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// rotate renames the current file and opens a new one; f.mu must be held.
+// If the file cannot be renamed, it is reopened and appended to, and rotation
+// is retried once rotateRetryInterval has passed. If no file could be opened,
+// the next write retries.
+func (f *rotatingFile) rotate() error {
+	err := f.file.Close()
+	f.file = nil
+	if err != nil {
+		return fmt.Errorf("failed to close log file: %w", err)
+	}
+	backup := f.path + "." + time.Now().UTC().Format(backupTimeFormat)
+	if err := os.Rename(f.path, backup); err != nil {
+		if err := f.open(); err != nil {
+			return err
+		}
+		f.retryAt = time.Now().Add(rotateRetryInterval)
+		// The log itself is the sink that failed
+		fmt.Fprintf(os.Stderr, "logger: failed to rotate log file: %v\n", err)
+		return nil
+	}
+	f.retryAt = time.Time{}
+	if err := f.open(); err != nil {
+		return err
+	}
+	f.prune()
+	return nil
+}
+
+// prune removes the oldest backups beyond the limit; f.mu must be held
+func (f *rotatingFile) prune() {
+	if f.maxBackups <= 0 {
+		return
+	}
+	matches, _ := filepath.Glob(f.path + ".*")
+	var backups []string
+	for _, match := range matches {
+		// Leave other files sharing the prefix, such as app.log.bak, alone
+		if _, err := time.Parse(backupTimeFormat, strings.TrimPrefix(match, f.path+".")); err == nil {
+			backups = append(backups, match)
+		}
+	}
+	if len(backups) <= f.maxBackups {
+		return
+	}
+	// Timestamps sort chronologically
+	sort.Strings(backups)
+	for _, backup := range backups[:len(backups)-f.maxBackups] {
+		os.Remove(backup)
+	}
+}
+
+// Sync flushes the file to disk
+func (f *rotatingFile) Sync() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return nil
+	}
+	return f.file.Sync()
+}
+
+// Close closes the file; later writes fail
+func (f *rotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.closed = true
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+// Syslog facility and severities, as defined by RFC 3164
+const (
+	syslogUser    = 1 << 3
+	syslogError   = 3
+	syslogWarning = 4
+	syslogInfo    = 6
+	syslogDebug   = 7
+)
+
+// syslogSink sends each message as one datagram in the BSD syslog format.
+// The message body is rendered by a text handler without the time, which
+// the syslog header carries.
+type syslogSink struct {
+	writer  *syslogWriter
+	handler slog.Handler
+}
+
+func newSyslogSink(address, tag string) (*syslogSink, error) {
+	if address == "" {
+		address = defaultSyslogAddress
+	}
+	if tag == "" {
+		tag = filepath.Base(os.Args[0])
+	}
+	conn, err := net.Dial("unixgram", address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to syslog: %w", err)
+	}
+
+	w := &syslogWriter{conn: conn, tag: tag, pid: os.Getpid()}
+	text, _ := newHandler(w, FormatText, func(groups []string, a slog.Attr) slog.Attr {
+		if len(groups) == 0 && a.Key == slog.TimeKey {
+			return slog.Attr{}
+		}
+		return a
+	})
+	return &syslogSink{writer: w, handler: &syslogHandler{writer: w, next: text}}, nil
+}
+
+func (s *syslogSink) Handler() slog.Handler {
+	return s.handler
+}
+
+// Sync is a no-op, datagrams are sent immediately
+func (s *syslogSink) Sync() error {
+	return nil
+}
+
+func (s *syslogSink) Close() error {
+	return s.writer.conn.Close()
+}
+
+// syslogWriter prefixes messages with the syslog header of the severity set
+// by the handler
+type syslogWriter struct {
+	conn     net.Conn
+	tag      string
+	pid      int
+	mu       sync.Mutex
+	severity int
+}
+
+func (w *syslogWriter) Write(p []byte) (int, error) {
+	header := fmt.Sprintf("<%d>%s %s[%d]: ", syslogUser|w.severity, time.Now().Format(time.Stamp), w.tag, w.pid)
+	if _, err := w.conn.Write([]byte(header + strings.TrimSuffix(string(p), "\n"))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// syslogHandler sets the severity of each record before the text handler
+// writes it
+type syslogHandler struct {
+	writer *syslogWriter
+	next   slog.Handler
+}
+
+func (h *syslogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *syslogHandler) Handle(ctx context.Context, r slog.Record) error {
+	h.writer.mu.Lock()
+	defer h.writer.mu.Unlock()
+
+	h.writer.severity = severity(r.Level)
+	return h.next.Handle(ctx, r)
+}
+
+func (h *syslogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &syslogHandler{writer: h.writer, next: h.next.WithAttrs(attrs)}
+}
+
+func (h *syslogHandler) WithGroup(name string) slog.Handler {
+	return &syslogHandler{writer: h.writer, next: h.next.WithGroup(name)}
+}
+
+// severity maps a slog level to a syslog severity
+func severity(level slog.Level) int {
+	switch {
+	case level >= slog.LevelError:
+		return syslogError
+	case level >= slog.LevelWarn:
+		return syslogWarning
+	case level >= slog.LevelInfo:
+		return syslogInfo
+	}
+	return syslogDebug
+}
@@ -0,0 +1,381 @@
+// Package metrics implements counters, gauges and histograms exposed in the
+// Prometheus text format, without external dependencies
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are histogram buckets for latencies in seconds
+var DefaultBuckets = []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// Registry holds metric families and writes them in the Prometheus text
+// exposition format
+type Registry struct {
+	mu       sync.Mutex
+	families map[string]family
+}
+
+// family is a named metric with its samples
+type family interface {
+	write(w *bufio.Writer)
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{families: make(map[string]family)}
+}
+
+// register adds a family, panicking on duplicate names as they are
+// programming errors
+func (r *Registry) register(name string, f family) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.families[name]; exists {
+		panic(fmt.Sprintf("metrics: %s registered twice", name))
+	}
+	r.families[name] = f
+}
+
+// WriteTo writes all metrics, sorted by name
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	names := make([]string, 0, len(r.families))
+	for name := range r.families {
+		names = append(names, name)
+	}
+	families := make([]family, 0, len(names))
+	sort.Strings(names)
+	for _, name := range names {
+		families = append(families, r.families[name])
+	}
+	r.mu.Unlock()
+
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	for _, f := range families {
+		f.write(bw)
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// ServeHTTP serves the metrics to a Prometheus scraper
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.WriteTo(w)
+}
+
+// countingWriter counts the bytes written for WriteTo
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// vec holds the series of a family by label values
+type vec[T any] struct {
+	name, help, kind string
+	labels           []string
+	newSeries        func() *T
+	mu               sync.Mutex
+	series           map[string]*T
+	values           map[string][]string
+}
+
+func newVec[T any](name, help, kind string, labels []string, newSeries func() *T) *vec[T] {
+	return &vec[T]{
+		name:      name,
+		help:      help,
+		kind:      kind,
+		labels:    labels,
+		newSeries: newSeries,
+		series:    make(map[string]*T),
+		values:    make(map[string][]string),
+	}
+}
+
+// with returns the series for the label values, creating it
+func (v *vec[T]) with(labelValues []string) *T {
+	if len(labelValues) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", v.name, len(v.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	s, exists := v.series[key]
+	if !exists {
+		s = v.newSeries()
+		v.series[key] = s
+		v.values[key] = append([]string(nil), labelValues...)
+	}
+	return s
+}
+
+// each calls fn for every series, sorted by label values
+func (v *vec[T]) each(fn func(labels string, s *T)) {
+	v.mu.Lock()
+	keys := make([]string, 0, len(v.series))
+	for key := range v.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	series := make([]*T, len(keys))
+	labels := make([]string, len(keys))
+	for i, key := range keys {
+		series[i] = v.series[key]
+		labels[i] = formatLabels(v.labels, v.values[key])
+	}
+	v.mu.Unlock()
+
+	for i := range series {
+		fn(labels[i], series[i])
+	}
+}
+
+// header writes the HELP and TYPE lines
+func (v *vec[T]) header(w *bufio.Writer) {
+	writeHeader(w, v.name, v.help, v.kind)
+}
+
+// value is a float64 safe for concurrent use
+type value struct {
+	mu sync.Mutex
+	v  float64
+}
+
+func (v *value) add(delta float64) {
+	v.mu.Lock()
+	v.v += delta
+	v.mu.Unlock()
+}
+
+func (v *value) set(x float64) {
+	v.mu.Lock()
+	v.v = x
+	v.mu.Unlock()
+}
+
+func (v *value) get() float64 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.v
+}
+
+// Counter is a monotonically increasing value, optionally partitioned by
+// labels. A nil Counter ignores updates, so instrumentation can be optional.
+type Counter struct {
+	vec *vec[value]
+}
+
+// NewCounter registers a counter with the given label names
+func (r *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{vec: newVec(name, help, "counter", labels, func() *value { return &value{} })}
+	r.register(name, c)
+	return c
+}
+
+// Inc adds one to the series with the given label values
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds a non-negative delta to the series with the given label values
+func (c *Counter) Add(delta float64, labelValues ...string) {
+	if c == nil || delta < 0 {
+		return
+	}
+	c.vec.with(labelValues).add(delta)
+}
+
+func (c *Counter) write(w *bufio.Writer) {
+	c.vec.header(w)
+	c.vec.each(func(labels string, s *value) {
+		writeSample(w, c.vec.name, labels, s.get())
+	})
+}
+
+// Gauge is a value that can go up and down, optionally partitioned by
+// labels. A nil Gauge ignores updates.
+type Gauge struct {
+	vec *vec[value]
+}
+
+// NewGauge registers a gauge with the given label names
+func (r *Registry) NewGauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{vec: newVec(name, help, "gauge", labels, func() *value { return &value{} })}
+	r.register(name, g)
+	return g
+}
+
+// Set sets the series with the given label values
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	if g == nil {
+		return
+	}
+	g.vec.with(labelValues).set(v)
+}
+
+// Add adds delta to the series with the given label values
+func (g *Gauge) Add(delta float64, labelValues ...string) {
+	if g == nil {
+		return
+	}
+	g.vec.with(labelValues).add(delta)
+}
+
+func (g *Gauge) write(w *bufio.Writer) {
+	g.vec.header(w)
+	g.vec.each(func(labels string, s *value) {
+		writeSample(w, g.vec.name, labels, s.get())
+	})
+}
+
+// gaugeFunc is a gauge whose value is read when metrics are written
+type gaugeFunc struct {
+	name, help string
+	fn         func() float64
+}
+
+// NewGaugeFunc registers a gauge that calls fn on every scrape, for values
+// such as collection sizes that are cheaper to read than to track
+func (r *Registry) NewGaugeFunc(name, help string, fn func() float64) {
+	r.register(name, &gaugeFunc{name: name, help: help, fn: fn})
+}
+
+func (g *gaugeFunc) write(w *bufio.Writer) {
+	writeHeader(w, g.name, g.help, "gauge")
+	writeSample(w, g.name, "", g.fn())
+}
+
+// histogramSeries holds the bucket counts of one label combination
+type histogramSeries struct {
+	mu     sync.Mutex
+	counts []uint64 // Per bucket, not cumulative
+	sum    float64
+	count  uint64
+}
+
+// Histogram counts observations in buckets, optionally partitioned by
+// labels. A nil Histogram ignores observations.
+type Histogram struct {
+	vec     *vec[histogramSeries]
+	buckets []float64
+}
+
+// NewHistogram registers a histogram with the given upper bucket bounds,
+// which must be sorted, and label names
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	buckets = append([]float64(nil), buckets...)
+	h := &Histogram{
+		buckets: buckets,
+		vec: newVec(name, help, "histogram", labels, func() *histogramSeries {
+			return &histogramSeries{counts: make([]uint64, len(buckets))}
+		}),
+	}
+	r.register(name, h)
+	return h
+}
+
+// Observe records a value in the series with the given label values
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	if h == nil {
+		return
+	}
+	s := h.vec.with(labelValues)
+	i := sort.SearchFloat64s(h.buckets, v)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if i < len(s.counts) {
+		s.counts[i]++
+	}
+	s.sum += v
+	s.count++
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.vec.header(w)
+	h.vec.each(func(labels string, s *histogramSeries) {
+		s.mu.Lock()
+		counts := append([]uint64(nil), s.counts...)
+		sum, count := s.sum, s.count
+		s.mu.Unlock()
+
+		cumulative := uint64(0)
+		for i, bound := range h.buckets {
+			cumulative += counts[i]
+			writeSample(w, h.vec.name+"_bucket", withLabel(labels, "le", formatValue(bound)), float64(cumulative))
+		}
+		writeSample(w, h.vec.name+"_bucket", withLabel(labels, "le", "+Inf"), float64(count))
+		writeSample(w, h.vec.name+"_sum", labels, sum)
+		writeSample(w, h.vec.name+"_count", labels, float64(count))
+	})
+}
+
+// writeHeader writes the HELP and TYPE lines of a family
+func writeHeader(w *bufio.Writer, name, help, kind string) {
+	help = strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// writeSample writes one sample line
+func writeSample(w *bufio.Writer, name, labels string, v float64) {
+	w.WriteString(name)
+	if labels != "" {
+		w.WriteString("{" + labels + "}")
+	}
+	w.WriteString(" " + formatValue(v) + "\n")
+}
+
+// formatLabels renders label pairs without braces
+func formatLabels(names, values []string) string {
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + `="` + escapeLabel(values[i]) + `"`
+	}
+	return strings.Join(pairs, ",")
+}
+
+// withLabel appends a label pair to rendered labels
+func withLabel(labels, name, value string) string {
+	pair := name + `="` + escapeLabel(value) + `"`
+	if labels == "" {
+		return pair
+	}
+	return labels + "," + pair
+}
+
+// escapeLabel escapes a label value
+func escapeLabel(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+// formatValue renders a sample value
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,85 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTextFormat(t *testing.T) {
+	reg := NewRegistry()
+	requests := reg.NewCounter("test_requests_total", "Requests by code", "code")
+	size := reg.NewGauge("test_size", "Current size")
+	latency := reg.NewHistogram("test_latency_seconds", "Latency", []float64{0.1, 1})
+	reg.NewGaugeFunc("test_items", "Items", func() float64 { return 7 })
+
+	requests.Inc("200")
+	requests.Inc("200")
+	requests.Add(3, `5"x`)
+	size.Set(42)
+	size.Add(-2)
+	latency.Observe(0.05)
+	latency.Observe(0.5)
+	latency.Observe(5)
+
+	var out strings.Builder
+	if _, err := reg.WriteTo(&out); err != nil {
+		t.Fatalf("Failed to write metrics: %v", err)
+	}
+
+	expected := `# HELP test_items Items
+# TYPE test_items gauge
+test_items 7
+# HELP test_latency_seconds Latency
+# TYPE test_latency_seconds histogram
+test_latency_seconds_bucket{le="0.1"} 1
+test_latency_seconds_bucket{le="1"} 2
+test_latency_seconds_bucket{le="+Inf"} 3
+test_latency_seconds_sum 5.55
+test_latency_seconds_count 3
+# HELP test_requests_total Requests by code
+# TYPE test_requests_total counter
+test_requests_total{code="200"} 2
+test_requests_total{code="5\"x"} 3
+# HELP test_size Current size
+# TYPE test_size gauge
+test_size 40
+`
+	if out.String() != expected {
+		t.Errorf("Unexpected output:\n%s", out.String())
+	}
+}
+
+func TestNilMetricsIgnoreUpdates(t *testing.T) {
+	var c *Counter
+	var g *Gauge
+	var h *Histogram
+	c.Inc()
+	g.Set(1)
+	h.Observe(1)
+}
+
+func TestDuplicateRegistrationPanics(t *testing.T) {
+	reg := NewRegistry()
+	reg.NewCounter("test_total", "Test")
+	defer func() {
+		if recover() == nil {
+			t.Error("Registering a name twice should panic")
+		}
+	}()
+	reg.NewGauge("test_total", "Test")
+}
+
+func TestHandler(t *testing.T) {
+	reg := NewRegistry()
+	reg.NewCounter("test_total", "Test").Inc()
+
+	rec := httptest.NewRecorder()
+	reg.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Errorf("Unexpected content type %q", rec.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(rec.Body.String(), "test_total 1\n") {
+		t.Errorf("Unexpected body:\n%s", rec.Body.String())
+	}
+}
@@ -0,0 +1,147 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// ExportRequest is an OTLP/JSON ExportTraceServiceRequest
+type ExportRequest struct {
+	ResourceSpans []ResourceSpans `json:"resourceSpans"`
+}
+
+// ResourceSpans groups the spans of one service
+type ResourceSpans struct {
+	Resource   Resource     `json:"resource"`
+	ScopeSpans []ScopeSpans `json:"scopeSpans"`
+}
+
+// Resource describes the service emitting spans
+type Resource struct {
+	Attributes []KeyValue `json:"attributes"`
+}
+
+// ScopeSpans groups the spans of one instrumentation scope
+type ScopeSpans struct {
+	Scope Scope      `json:"scope"`
+	Spans []SpanData `json:"spans"`
+}
+
+// Scope names the instrumentation that created spans
+type Scope struct {
+	Name string `json:"name"`
+}
+
+// SpanData is a finished span. IDs are hex-encoded and timestamps are
+// strings, as OTLP/JSON requires for 64-bit integers.
+type SpanData struct {
+	TraceID           string     `json:"traceId"`
+	SpanID            string     `json:"spanId"`
+	ParentSpanID      string     `json:"parentSpanId,omitempty"`
+	Name              string     `json:"name"`
+	Kind              int        `json:"kind"`
+	StartTimeUnixNano uint64     `json:"startTimeUnixNano,string"`
+	EndTimeUnixNano   uint64     `json:"endTimeUnixNano,string"`
+	Attributes        []KeyValue `json:"attributes,omitempty"`
+	Status            Status     `json:"status"`
+}
+
+// Status is the outcome of a span
+type Status struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// KeyValue is a span or resource attribute
+type KeyValue struct {
+	Key   string   `json:"key"`
+	Value AnyValue `json:"value"`
+}
+
+// AnyValue holds exactly one attribute value
+type AnyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    string   `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+// FileExporter appends export requests to a file, one JSON object per
+// line, in the format of the OpenTelemetry collector's file exporter
+type FileExporter struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFileExporter opens path for appending
+func NewFileExporter(path string) (*FileExporter, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open trace file: %w", err)
+	}
+	return &FileExporter{file: f}, nil
+}
+
+// Export writes req as a single line
+func (e *FileExporter) Export(_ context.Context, req *ExportRequest) error {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to encode spans: %w", err)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, err := e.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write spans: %w", err)
+	}
+	return nil
+}
+
+// Close closes the file
+func (e *FileExporter) Close() error {
+	return e.file.Close()
+}
+
+// HTTPExporter posts export requests to an OTLP/HTTP collector
+type HTTPExporter struct {
+	endpoint string
+	client   *http.Client
+}
+
+// NewHTTPExporter creates an exporter for a collector's traces endpoint,
+// such as http://localhost:4318/v1/traces
+func NewHTTPExporter(endpoint string) *HTTPExporter {
+	return &HTTPExporter{endpoint: endpoint, client: &http.Client{}}
+}
+
+// Export posts req as JSON
+func (e *HTTPExporter) Export(ctx context.Context, req *ExportRequest) error {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to encode spans: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", e.endpoint, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := e.client.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("failed to send spans: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("collector error (status %d): %s", resp.StatusCode, body)
+	}
+	return nil
+}
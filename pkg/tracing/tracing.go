@@ -0,0 +1,311 @@
+// Package tracing records spans across a unit of work, such as an agent's
+// decision cycle, and exports them in the OTLP/JSON format without external
+// dependencies
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/yanchenko-igor/blockchain-universe/pkg/logger"
+)
+
+// Span kinds, as defined by OTLP
+const (
+	KindInternal = 1
+	KindClient   = 3
+)
+
+// Span status codes, as defined by OTLP
+const (
+	StatusUnset = 0
+	StatusOK    = 1
+	StatusError = 2
+)
+
+// queueSize bounds the finished spans waiting for export
+const queueSize = 1024
+
+// batchSize is the number of spans that triggers an export even before the
+// root span of a trace ends
+const batchSize = 256
+
+// dropWarningInterval limits how often dropped spans are logged
+const dropWarningInterval = time.Minute
+
+// Exporter sends spans to a backend
+type Exporter interface {
+	Export(ctx context.Context, req *ExportRequest) error
+}
+
+// Tracer creates spans and exports them in the background. A nil Tracer
+// creates no-op spans, so tracing can be optional.
+type Tracer struct {
+	service   string
+	exporters []Exporter
+	queue     chan SpanData
+	done      chan struct{}
+	mu        sync.RWMutex // Guards closing the queue
+	closed    bool
+	dropped   atomic.Uint64
+	lastDrop  atomic.Int64 // Unix nanoseconds of the last dropped span warning
+	log       logger.Logger
+}
+
+// New creates a tracer exporting spans to the given exporters
+func New(service string, log logger.Logger, exporters ...Exporter) *Tracer {
+	t := &Tracer{
+		service:   service,
+		exporters: exporters,
+		queue:     make(chan SpanData, queueSize),
+		done:      make(chan struct{}),
+		log:       log,
+	}
+	go t.run()
+	return t
+}
+
+// Start begins a span, as a child of the span in ctx if there is one
+func (t *Tracer) Start(ctx context.Context, name string) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+	span := &Span{
+		tracer: t,
+		data: SpanData{
+			SpanID:            newID(8),
+			Name:              name,
+			Kind:              KindInternal,
+			StartTimeUnixNano: uint64(time.Now().UnixNano()),
+		},
+	}
+	if parent := SpanFromContext(ctx); parent != nil {
+		span.data.TraceID = parent.data.TraceID
+		span.data.ParentSpanID = parent.data.SpanID
+	} else {
+		span.data.TraceID = newID(16)
+	}
+	// Messages logged with ctx carry the trace and span IDs
+	ctx = logger.ContextWith(ctx, "trace_id", span.data.TraceID, "span_id", span.data.SpanID)
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// Start begins a child of the span in ctx. Without a span in ctx it returns
+// a no-op span, so libraries can trace without holding a tracer.
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+	parent := SpanFromContext(ctx)
+	if parent == nil {
+		return ctx, nil
+	}
+	return parent.tracer.Start(ctx, name)
+}
+
+// Shutdown exports the remaining spans, stops the tracer and closes the
+// exporters that hold resources, such as a FileExporter's file
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	if !t.closed {
+		t.closed = true
+		close(t.queue)
+	}
+	t.mu.Unlock()
+
+	select {
+	case <-t.done:
+	case <-ctx.Done():
+		return fmt.Errorf("failed to export remaining spans: %w", ctx.Err())
+	}
+
+	if dropped := t.dropped.Load(); dropped > 0 {
+		t.log.Warn("Spans were dropped, export queue was full", "dropped", dropped)
+	}
+	var closeErr error
+	for _, exporter := range t.exporters {
+		if closer, ok := exporter.(io.Closer); ok {
+			if err := closer.Close(); err != nil && closeErr == nil {
+				closeErr = fmt.Errorf("failed to close exporter: %w", err)
+			}
+		}
+	}
+	return closeErr
+}
+
+// Dropped returns how many spans were dropped because the export queue was full
+func (t *Tracer) Dropped() uint64 {
+	if t == nil {
+		return 0
+	}
+	return t.dropped.Load()
+}
+
+// run exports finished spans in batches, one per trace unless traces are
+// very large
+func (t *Tracer) run() {
+	defer close(t.done)
+
+	var batch []SpanData
+	for span := range t.queue {
+		batch = append(batch, span)
+		if span.ParentSpanID == "" || len(batch) >= batchSize {
+			t.export(batch)
+			batch = nil
+		}
+	}
+	if len(batch) > 0 {
+		t.export(batch)
+	}
+}
+
+// export sends a batch to every exporter
+func (t *Tracer) export(spans []SpanData) {
+	req := &ExportRequest{ResourceSpans: []ResourceSpans{{
+		Resource: Resource{Attributes: []KeyValue{Attribute("service.name", t.service)}},
+		ScopeSpans: []ScopeSpans{{
+			Scope: Scope{Name: t.service},
+			Spans: spans,
+		}},
+	}}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for _, exporter := range t.exporters {
+		if err := exporter.Export(ctx, req); err != nil {
+			t.log.Warn("Failed to export spans", "spans", len(spans), "error", err)
+		}
+	}
+}
+
+// spanKey is the context key of the current span
+type spanKey struct{}
+
+// SpanFromContext returns the current span, or nil
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// Span is a timed operation within a trace. A nil Span ignores all calls.
+type Span struct {
+	tracer *Tracer
+	mu     sync.Mutex
+	data   SpanData
+	ended  bool
+}
+
+// TraceID returns the hex-encoded ID of the span's trace
+func (s *Span) TraceID() string {
+	if s == nil {
+		return ""
+	}
+	return s.data.TraceID
+}
+
+// SetKind sets the span kind, e.g. KindClient for outgoing requests
+func (s *Span) SetKind(kind int) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Kind = kind
+}
+
+// SetAttribute records a string, integer, float or boolean attribute
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.ended {
+		s.data.Attributes = append(s.data.Attributes, Attribute(key, value))
+	}
+}
+
+// RecordError marks the span as failed
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Status = Status{Code: StatusError, Message: err.Error()}
+}
+
+// End finishes the span and queues it for export. Spans are dropped if the
+// exporters cannot keep up.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.EndTimeUnixNano = uint64(time.Now().UnixNano())
+	data := s.data
+	s.mu.Unlock()
+
+	s.tracer.enqueue(data)
+}
+
+// enqueue queues a finished span unless the tracer was shut down
+func (t *Tracer) enqueue(span SpanData) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if t.closed {
+		return
+	}
+	select {
+	case t.queue <- span:
+	default:
+		dropped := t.dropped.Add(1)
+		// Exporters fall behind for a while, so warn once per interval
+		now := time.Now().UnixNano()
+		last := t.lastDrop.Load()
+		if now-last >= int64(dropWarningInterval) && t.lastDrop.CompareAndSwap(last, now) {
+			t.log.Warn("Spans dropped, export queue is full", "name", span.Name, "dropped", dropped)
+		}
+	}
+}
+
+// newID returns a random hex-encoded ID of n bytes
+func newID(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Attribute converts a key-value pair to its OTLP representation
+func Attribute(key string, value interface{}) KeyValue {
+	kv := KeyValue{Key: key}
+	switch v := value.(type) {
+	case string:
+		kv.Value.StringValue = &v
+	case bool:
+		kv.Value.BoolValue = &v
+	case int:
+		kv.Value.IntValue = strconv.Itoa(v)
+	case int64:
+		kv.Value.IntValue = strconv.FormatInt(v, 10)
+	case float64:
+		kv.Value.DoubleValue = &v
+	default:
+		s := fmt.Sprint(v)
+		kv.Value.StringValue = &s
+	}
+	return kv
+}
@@ -0,0 +1,155 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yanchenko-igor/blockchain-universe/pkg/logger"
+)
+
+func TestSpansExportedToCollector(t *testing.T) {
+	requests := make(chan ExportRequest, 4)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ExportRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("Invalid OTLP/JSON: %v", err)
+		}
+		requests <- req
+	}))
+	defer collector.Close()
+
+	tracer := New("test-service", logger.New("error"), NewHTTPExporter(collector.URL))
+
+	ctx, root := tracer.Start(context.Background(), "root")
+	root.SetAttribute("agent", "abc")
+	_, child := Start(ctx, "child")
+	child.SetKind(KindClient)
+	child.RecordError(errors.New("failed"))
+	child.End()
+	root.End()
+
+	var req ExportRequest
+	select {
+	case req = <-requests:
+	case <-time.After(5 * time.Second):
+		t.Fatal("No spans exported")
+	}
+
+	resource := req.ResourceSpans[0]
+	if attr := resource.Resource.Attributes[0]; attr.Key != "service.name" || *attr.Value.StringValue != "test-service" {
+		t.Errorf("Unexpected resource: %+v", resource.Resource)
+	}
+	spans := resource.ScopeSpans[0].Spans
+	if len(spans) != 2 || spans[0].Name != "child" || spans[1].Name != "root" {
+		t.Fatalf("Expected child and root spans, got %+v", spans)
+	}
+	if spans[0].TraceID != spans[1].TraceID || spans[0].ParentSpanID != spans[1].SpanID || len(spans[0].TraceID) != 32 {
+		t.Error("Child should belong to the root's trace")
+	}
+	if spans[0].Kind != KindClient || spans[0].Status.Code != StatusError {
+		t.Errorf("Unexpected child span: %+v", spans[0])
+	}
+	if spans[1].EndTimeUnixNano < spans[1].StartTimeUnixNano {
+		t.Error("Span should end after it starts")
+	}
+
+	if err := tracer.Shutdown(context.Background()); err != nil {
+		t.Errorf("Shutdown failed: %v", err)
+	}
+	// Spans ended after shutdown are dropped
+	_, late := tracer.Start(context.Background(), "late")
+	late.End()
+}
+
+func TestFileExporter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traces.jsonl")
+	exporter, err := NewFileExporter(path)
+	if err != nil {
+		t.Fatalf("Failed to create exporter: %v", err)
+	}
+	tracer := New("test-service", logger.New("error"), exporter)
+	for range 2 {
+		_, span := tracer.Start(context.Background(), "cycle")
+		span.End()
+	}
+	if err := tracer.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+	if err := exporter.Export(context.Background(), &ExportRequest{}); err == nil {
+		t.Error("Shutdown should close the trace file")
+	}
+
+	data, _ := os.ReadFile(path)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected one line per trace, got %d", len(lines))
+	}
+	if !strings.Contains(lines[0], `"startTimeUnixNano":"`) {
+		t.Errorf("Timestamps should be encoded as strings: %s", lines[0])
+	}
+}
+
+// blockingExporter holds every export until it is released
+type blockingExporter struct {
+	release chan struct{}
+}
+
+func (e *blockingExporter) Export(ctx context.Context, _ *ExportRequest) error {
+	<-e.release
+	return nil
+}
+
+func TestSpansAreDroppedWhenExportFallsBehind(t *testing.T) {
+	exporter := &blockingExporter{release: make(chan struct{})}
+	tracer := New("test-service", logger.New("error"), exporter)
+	for range queueSize + 10 {
+		_, span := tracer.Start(context.Background(), "cycle")
+		span.End()
+	}
+	if dropped := tracer.Dropped(); dropped < 9 {
+		t.Errorf("Expected the spans beyond the queue to be dropped, got %d", dropped)
+	}
+	close(exporter.release)
+	tracer.Shutdown(context.Background())
+}
+
+func TestWithoutTracer(t *testing.T) {
+	var tracer *Tracer
+	ctx, span := tracer.Start(context.Background(), "root")
+	span.SetAttribute("key", "value")
+	span.End()
+	if _, child := Start(ctx, "child"); child != nil {
+		t.Error("Spans without a tracer should be no-ops")
+	}
+}
+
+func TestLogsCarryTraceIDs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.log")
+	log, err := logger.NewWithConfig(logger.Config{Sinks: []logger.SinkConfig{{Type: logger.SinkFile, Path: path}}})
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	tracer := New("test-service", log)
+	defer tracer.Shutdown(context.Background())
+
+	ctx, span := tracer.Start(context.Background(), "root")
+	log.InfoContext(ctx, "Inside span")
+	span.End()
+
+	var msg map[string]string
+	data, _ := os.ReadFile(path)
+	if err := json.Unmarshal(data, &msg); err != nil {
+		t.Fatalf("Invalid log line %q: %v", data, err)
+	}
+	if msg["trace_id"] != span.TraceID() || msg["span_id"] == "" {
+		t.Errorf("Log message lacks trace IDs: %v", msg)
+	}
+}